@@ -1,63 +1,454 @@
 package main
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	// Time zones for ?tz= of GET /api/contacts/upcoming and of reminders, images may have none.
+	_ "time/tzdata"
 
+	"github.com/BramAristyo/rest-api-contact-person/internal/cache"
 	"github.com/BramAristyo/rest-api-contact-person/internal/config"
 	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
 	"github.com/BramAristyo/rest-api-contact-person/internal/handler"
+	"github.com/BramAristyo/rest-api-contact-person/internal/interactions"
+	"github.com/BramAristyo/rest-api-contact-person/internal/jobs"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
 	"github.com/BramAristyo/rest-api-contact-person/internal/middleware"
+	"github.com/BramAristyo/rest-api-contact-person/internal/ratelimit"
+	"github.com/BramAristyo/rest-api-contact-person/internal/reminders"
 	"github.com/BramAristyo/rest-api-contact-person/internal/repository"
+	"github.com/BramAristyo/rest-api-contact-person/internal/server"
 	"github.com/BramAristyo/rest-api-contact-person/internal/services"
-	"github.com/go-playground/validator/v10"
+	"github.com/BramAristyo/rest-api-contact-person/internal/tasks"
+	"github.com/BramAristyo/rest-api-contact-person/migrations"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/metrics"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/tracing"
 )
 
 func main() {
-	cfg := config.Load()
-	db := database.Connect(cfg.DatabaseUrl)
-	defer db.Close()
+	config.RegisterFlags(flag.CommandLine)
+	flag.Usage = usage
+	flag.Parse()
 
-	mux := http.NewServeMux()
-	apiMux := http.NewServeMux()
+	switch flag.Arg(0) {
+	case "", "serve":
+		// Exit only after run has returned, so its deferred cleanup like db.Close() still happens.
+		if err := run(); err != nil {
+			slog.Error("server stopped with error", "error", err)
+			os.Exit(1)
+		}
+
+		slog.Info("server stopped")
+	case "migrate":
+		if err := runMigrate(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "config":
+		if err := runConfig(flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `usage: api [flags] [command]
+
+commands:
+  serve          run the API server (default)
+  migrate        apply or roll back database migrations, see api migrate help
+  config print   show the effective configuration with secrets redacted
 
-	apiMux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
+Every setting can come from a flag, an env var, the config file or its
+default, in that order of precedence.
+
+flags:
+`)
+	flag.PrintDefaults()
+}
 
-		err := json.NewEncoder(w).Encode(map[string]string{
-			"status":  "ok",
-			"message": "API is healthy",
-		})
+// runConfig prints the effective configuration, followed by any problems with it.
+func runConfig(args []string) error {
+	if len(args) != 1 || args[0] != "print" {
+		return fmt.Errorf("usage: api [flags] config print")
+	}
 
+	cfg, err := config.Load(flag.CommandLine)
+	if cfg != nil {
+		cfg.Print(os.Stdout)
+	}
+
+	return err
+}
+
+func run() error {
+	cfg, err := config.Load(flag.CommandLine)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger.New(os.Stdout, cfg.LogLevel, cfg.LogFormat))
+
+	tracer, err := newTracer(cfg)
+	if err != nil {
+		return err
+	}
+	if tracer != nil {
+		tracing.SetTracer(tracer)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+			tracing.SetTracer(nil)
+			tracer.Shutdown(ctx)
+		}()
+	}
+
+	// Cancelled on SIGINT/SIGTERM, which starts the graceful shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// db and migrator stay nil with the sqlite and memory drivers, the features
+	// that need Postgres are turned off then.
+	var db *database.DB
+	var migrator *database.Migrator
+	var contactRepository domain.ContactRepository
+	var groupRepository domain.GroupRepository
+
+	switch cfg.DBDriver {
+	case "", "postgres":
+		db, err = database.Connect(ctx, cfg.DatabaseUrl, cfg.PoolConfig())
 		if err != nil {
-			return
+			return err
+		}
+		defer db.Close()
+
+		if err := db.AddReplicas(ctx, cfg.DBReplicaUrls, cfg.PoolConfig(), cfg.DBReplicaMaxLag); err != nil {
+			return err
 		}
+		go db.MonitorReplicas(ctx, cfg.DBReplicaCheckPeriod)
+
+		migrator, err = database.NewMigrator(db.Pool, migrations.FS)
+		if err != nil {
+			return err
+		}
+		if cfg.MigrateOnStart {
+			if err := migrator.Up(ctx); err != nil {
+				return err
+			}
+		}
+		if err := migrator.Check(ctx); err != nil {
+			return err
+		}
+
+		contactRepository = repository.NewContactRepository(db)
+		groupRepository = repository.NewGroupRepository(db)
+	case "sqlite":
+		sqliteDB, err := database.ConnectSQLite(cfg.SQLitePath)
+		if err != nil {
+			return err
+		}
+		defer sqliteDB.Close()
+
+		contactRepository = repository.NewSQLiteContactRepository(sqliteDB)
+		groupRepository = repository.NewSQLiteGroupRepository(sqliteDB)
+	case "memory":
+		store := repository.NewMemoryStore()
+		contactRepository = repository.NewMemoryContactRepository(store)
+		groupRepository = repository.NewMemoryGroupRepository(store)
+	default:
+		return fmt.Errorf("unknown DB_DRIVER %q", cfg.DBDriver)
+	}
+
+	mux := http.NewServeMux()
+	registry := metrics.NewRegistry()
+
+	healthHandler := handler.NewHealthHandler(db, migrator)
+	mux.HandleFunc("GET /livez", healthHandler.Livez)
+	mux.HandleFunc("GET /readyz", healthHandler.Readyz)
+	mux.Handle("GET /metrics", registry.Handler())
+
+	validate := handler.NewValidator()
+
+	contactRepository, err = newCachedContactRepository(ctx, cfg, contactRepository, db, registry)
+	if err != nil {
+		return err
+	}
+	contactService := services.NewContactService(contactRepository, groupRepository)
+	groupService := services.NewGroupService(groupRepository, contactRepository)
+	contactHandler := handler.NewContactHandler(db, validate, contactService, cfg.ContactsAllLimit, cfg.StrictJSON)
+	groupHandler := handler.NewGroupHandler(groupService, validate, cfg.StrictJSON)
+	calendarHandler := handler.NewCalendarHandler(contactService, groupService, cfg.CalendarRefreshInterval)
+
+	// Routes are registered with the full /api path on one mux, so the metrics
+	// middleware can resolve the matched pattern for its route label.
+	mux.HandleFunc("GET /api/contacts", contactHandler.Paginate)
+	mux.HandleFunc("GET /api/contacts/all", contactHandler.GetAll)
+	mux.HandleFunc("GET /api/contacts/upcoming", calendarHandler.Upcoming)
+	mux.HandleFunc("GET /api/contacts/{id}", contactHandler.GetById)
+	mux.HandleFunc("POST /api/contacts", contactHandler.Store)
+	mux.HandleFunc("PUT /api/contacts/{id}", contactHandler.Update)
+	mux.HandleFunc("DELETE /api/contacts/{id}", contactHandler.Delete)
+
+	mux.HandleFunc("GET /api/groups", groupHandler.Paginate)
+	mux.HandleFunc("GET /api/groups/{id}", groupHandler.GetById)
+	mux.HandleFunc("GET /api/groups/{id}/contacts", groupHandler.Contacts)
+	mux.HandleFunc("POST /api/groups", groupHandler.Store)
+	mux.HandleFunc("POST /api/groups/preview", groupHandler.Preview)
+	mux.HandleFunc("PUT /api/groups/{id}", groupHandler.Update)
+	mux.HandleFunc("DELETE /api/groups/{id}", groupHandler.Delete)
+
+	mux.HandleFunc("GET /api/calendar.ics", calendarHandler.Feed)
+
+	tagHandler := handler.NewTagHandler(contactService, validate, cfg.StrictJSON)
+	mux.HandleFunc("GET /api/tags", tagHandler.Autocomplete)
+	mux.HandleFunc("PUT /api/tags/{name}", tagHandler.Rename)
+	mux.HandleFunc("POST /api/tags/merge", tagHandler.Merge)
 
+	if db != nil {
+		var invalidate func(ctx context.Context)
+		var invalidateContact func(ctx context.Context, id int)
+		if cached, ok := contactRepository.(*repository.CachedContactRepository); ok {
+			invalidate = cached.InvalidateAll
+			invalidateContact = cached.Invalidate
+		}
+		backupHandler := handler.NewBackupHandler(db, migrator, cfg.BackupTimeout, invalidate)
+		admin := middleware.Admin(cfg.AdminToken)
+		mux.Handle("GET /api/backup", admin(http.HandlerFunc(backupHandler.Backup)))
+		mux.Handle("POST /api/restore", admin(http.HandlerFunc(backupHandler.Restore)))
+
+		queue := jobs.NewQueue(db, cfg.JobMaxAttempts)
+		jobHandler := handler.NewJobHandler(queue, validate, cfg.StrictJSON)
+		mux.HandleFunc("POST /api/exports", jobHandler.Export)
+		mux.HandleFunc("POST /api/imports", jobHandler.Import)
+		mux.HandleFunc("POST /api/contacts/merge", jobHandler.MergeContacts)
+		mux.HandleFunc("POST /api/contacts/purge", jobHandler.PurgeContacts)
+		mux.HandleFunc("GET /api/jobs/{id}", jobHandler.GetById)
+		mux.HandleFunc("POST /api/jobs/{id}/cancel", jobHandler.Cancel)
+		mux.HandleFunc("GET /api/jobs/{id}/files/{name}", jobHandler.File)
+
+		// With JOB_WORKERS=0 jobs wait for cmd/worker.
+		if cfg.JobWorkers > 0 {
+			worker := jobs.NewWorker(queue, cfg.JobOptions())
+			tasks.Register(worker, db, migrator, invalidate)
+
+			workerCtx, stopWorker := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				worker.Run(workerCtx)
+			}()
+			// Runs before db.Close, running jobs are handed back first.
+			defer func() {
+				stopWorker()
+				<-done
+			}()
+		}
+
+		reminderStore := reminders.NewStore(db)
+		reminderHandler := handler.NewReminderHandler(reminderStore, validate, cfg.StrictJSON)
+		mux.HandleFunc("POST /api/contacts/{id}/reminders", reminderHandler.Store)
+		mux.HandleFunc("GET /api/contacts/{id}/reminders", reminderHandler.ByContact)
+		mux.HandleFunc("GET /api/reminders", reminderHandler.Paginate)
+		mux.HandleFunc("GET /api/reminders/{id}", reminderHandler.GetById)
+		mux.HandleFunc("POST /api/reminders/{id}/snooze", reminderHandler.Snooze)
+		mux.HandleFunc("POST /api/reminders/{id}/complete", reminderHandler.Complete)
+		mux.HandleFunc("DELETE /api/reminders/{id}", reminderHandler.Delete)
+
+		interactionHandler := handler.NewInteractionHandler(interactions.NewStore(db), validate, cfg.StrictJSON, invalidateContact)
+		mux.HandleFunc("POST /api/contacts/{id}/interactions", interactionHandler.Store)
+		mux.HandleFunc("GET /api/contacts/{id}/interactions", interactionHandler.ByContact)
+		mux.HandleFunc("GET /api/contacts/{id}/interactions/{interactionId}", interactionHandler.GetById)
+		mux.HandleFunc("PUT /api/contacts/{id}/interactions/{interactionId}", interactionHandler.Update)
+		mux.HandleFunc("DELETE /api/contacts/{id}/interactions/{interactionId}", interactionHandler.Delete)
+		mux.HandleFunc("GET /api/contacts/{id}/timeline", interactionHandler.Timeline)
+
+		if cfg.ReminderScheduler {
+			scheduler := reminders.NewScheduler(db, reminderStore, newReminderNotifiers(cfg), cfg.ReminderOptions())
+
+			schedulerCtx, stopScheduler := context.WithCancel(ctx)
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				scheduler.Run(schedulerCtx)
+			}()
+			// Runs before db.Close, the leader lock is given up first.
+			defer func() {
+				stopScheduler()
+				<-done
+			}()
+		}
+	}
+
+	if db != nil {
+		database.RegisterPoolMetrics(registry, db)
+	}
+	registerCountMetric(registry, "contacts", contactRepository.Count)
+	registerCountMetric(registry, "groups", groupRepository.Count)
+
+	rateLimitMiddleware, err := newRateLimitMiddleware(cfg, db, mux)
+	if err != nil {
+		return err
+	}
+
+	requestIDMiddleware := middleware.RequestID(mux)
+	metricsMiddleware := middleware.Metrics(registry, mux)
+	tracingMiddleware := middleware.Tracing(mux)
+
+	corsMiddleware := middleware.CORS(middleware.CORSOptions{
+		AllowedOrigins: cfg.CORSAllowedOrigins,
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Accept", "If-None-Match", "Authorization", middleware.APIKeyHeader, middleware.RequestIDHeader, middleware.PrimaryUntilHeader, tracing.TraceparentHeader},
+		ExposedHeaders: []string{middleware.RequestIDHeader, middleware.PrimaryUntilHeader, tracing.TraceparentHeader, "X-Total-Count", "X-Total-Pages", "ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+		MaxAge:         cfg.CORSMaxAge,
 	})
 
-	validate := validator.New()
+	compressMiddleware := func(next http.Handler) http.Handler { return next }
+	if cfg.CompressionEnabled {
+		compressMiddleware = middleware.Compress(cfg.CompressionMinBytes)
+	}
+
+	srv := server.New(cfg, middleware.Chain(mux,
+		requestIDMiddleware,
+		middleware.Logger,
+		middleware.SecurityHeaders(cfg.HSTS),
+		corsMiddleware,
+		compressMiddleware,
+		tracingMiddleware,
+		metricsMiddleware,
+		middleware.Recovery,
+		middleware.BodyLimit(cfg.MaxBodyBytes, mux, map[string]int64{"POST /api/restore": cfg.RestoreMaxBytes, "POST /api/imports": cfg.RestoreMaxBytes}),
+		rateLimitMiddleware,
+		middleware.ReadYourWrites(stickyWindow(cfg)),
+	))
+	srv.OnShutdown(healthHandler.Drain)
+
+	return srv.Run(ctx)
+}
+
+// newReminderNotifiers builds the notifiers named by REMINDER_NOTIFIERS.
+func newReminderNotifiers(cfg *config.Config) []reminders.Notifier {
+	var notifiers []reminders.Notifier
+	for _, name := range cfg.ReminderNotifiers {
+		switch name {
+		case "log":
+			notifiers = append(notifiers, reminders.LogNotifier{})
+		case "webhook":
+			notifiers = append(notifiers, reminders.NewWebhookNotifier(cfg.ReminderWebhookURL, cfg.ReminderWebhookSecret, cfg.ReminderNotifyTimeout))
+		case "smtp":
+			notifiers = append(notifiers, &reminders.SMTPNotifier{
+				Addr:     cfg.SMTPAddr,
+				Username: cfg.SMTPUsername,
+				Password: cfg.SMTPPassword,
+				From:     cfg.SMTPFrom,
+				To:       cfg.SMTPTo,
+				Timeout:  cfg.ReminderNotifyTimeout,
+			})
+		}
+	}
+	return notifiers
+}
+
+// newTracer builds the tracer for the configured exporter, nil means tracing is off.
+func newTracer(cfg *config.Config) (*tracing.Tracer, error) {
+	switch cfg.TracingExporter {
+	case "", "none":
+		return nil, nil
+	case "stdout":
+		return tracing.NewTracer(tracing.NewWriterExporter(os.Stdout)), nil
+	case "file":
+		exporter, err := tracing.NewFileExporter(cfg.TracingFile)
+		if err != nil {
+			return nil, err
+		}
+		return tracing.NewTracer(exporter), nil
+	case "otlp":
+		return tracing.NewTracer(tracing.NewOTLPExporter(cfg.OTLPEndpoint, cfg.ServiceName)), nil
+	default:
+		return nil, fmt.Errorf("unknown TRACING_EXPORTER %q", cfg.TracingExporter)
+	}
+}
+
+// newCachedContactRepository puts the read-through cache in front of
+// contactRepository, CACHE_BACKEND=none turns it off.
+func newCachedContactRepository(ctx context.Context, cfg *config.Config, contactRepository domain.ContactRepository, db *database.DB, registry *metrics.Registry) (domain.ContactRepository, error) {
+	var backend cache.Backend
+	switch cfg.CacheBackend {
+	case "none":
+		return contactRepository, nil
+	case "", "memory":
+		backend = cache.NewMemoryBackend(cfg.CacheSize)
+	default:
+		return nil, fmt.Errorf("unknown CACHE_BACKEND %q", cfg.CacheBackend)
+	}
+
+	var notifier *cache.Notifier
+	// Instances can only share a database, and so need invalidating, with Postgres.
+	if cfg.CacheNotify && db != nil {
+		notifier = cache.NewNotifier(db.Pool, repository.ContactsCacheChannel)
+	}
+
+	cached := repository.NewCachedContactRepository(contactRepository, backend, cfg.CacheTTL, stickyWindow(cfg), notifier, cache.NewMetrics(registry))
+	go cached.Listen(ctx)
 
-	contactRepository := repository.NewContactRepository(db)
-	contactService := services.NewContactService(contactRepository)
-	contactHandler := handler.NewContactHandler(db, validate, contactService)
+	return cached, nil
+}
 
-	apiMux.HandleFunc("GET /contacts", contactHandler.Paginate)
-	apiMux.HandleFunc("GET /contacts/all", contactHandler.GetAll)
-	apiMux.HandleFunc("GET /contacts/{id}", contactHandler.GetById)
-	apiMux.HandleFunc("POST /contacts", contactHandler.Store)
-	apiMux.HandleFunc("PUT /contacts/{id}", contactHandler.Update)
-	apiMux.HandleFunc("DELETE /contacts/{id}", contactHandler.Delete)
+// stickyWindow is how long reads go to the primary after a write, 0 without
+// replicas since every read goes to the primary anyway.
+func stickyWindow(cfg *config.Config) time.Duration {
+	if len(cfg.DBReplicaUrls) == 0 {
+		return 0
+	}
+	return cfg.DBStickyWindow
+}
 
-	mux.Handle("/api/", http.StripPrefix("/api", apiMux))
+// newRateLimitMiddleware limits every /api/ route, RATE_LIMIT_STORE=none turns it off.
+func newRateLimitMiddleware(cfg *config.Config, db *database.DB, routes *http.ServeMux) (func(http.Handler) http.Handler, error) {
+	var store ratelimit.Store
+	switch cfg.RateLimitStore {
+	case "none":
+		return func(next http.Handler) http.Handler { return next }, nil
+	case "", "memory":
+		store = ratelimit.NewMemoryStore()
+	case "postgres":
+		if db == nil {
+			return nil, fmt.Errorf("RATE_LIMIT_STORE=postgres needs DB_DRIVER=postgres")
+		}
+		store = ratelimit.NewPostgresStore(db.Pool)
+	default:
+		return nil, fmt.Errorf("unknown RATE_LIMIT_STORE %q", cfg.RateLimitStore)
+	}
 
-	// TODO (next steps):
-	// 1. Complete Create, Update, and Delete features for contacts. Done
-	// 2. Refactor: Separate logic into service and repository layers.
-	// 3. Implement Logging middleware (step 1). Done
-	// 4. Implement Recovery middleware (step 2). Done
-	// 5. Implement Unit tests for handlers, services, and repositories. and Integration tests for API endpoints.
+	policy, err := ratelimit.NewPolicy(cfg.RateLimitRead, cfg.RateLimitWrite, cfg.RateLimitRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	return middleware.RateLimit(store, policy, routes, "/api/", cfg.RateLimitAPIKeys), nil
+}
 
-	log.Printf("server running on http://localhost:%v", cfg.AppPort)
-	log.Fatal(http.ListenAndServe(":"+cfg.AppPort, middleware.Logger(middleware.Recovery(mux))))
+// registerCountMetric exposes a row count as a gauge, counted on every scrape.
+func registerCountMetric(registry *metrics.Registry, name string, count func(ctx context.Context) (int64, error)) {
+	registry.NewGaugeFunc(name+"_count", "Number of "+name+" stored.", func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+
+		total, err := count(ctx)
+		if err != nil {
+			return math.NaN()
+		}
+		return float64(total)
+	})
 }
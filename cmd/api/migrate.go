@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/config"
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/migrations"
+)
+
+const migrateUsage = `usage: api migrate <command>
+
+commands:
+  up              apply every pending migration
+  down N          roll back the last N migrations
+  to VERSION      apply or roll back until VERSION is the latest applied
+  status          list the migrations and whether they are applied
+  force VERSION   record VERSION as the latest applied without running any SQL`
+
+// runMigrate runs the migrate subcommand against the Postgres database of the config.
+func runMigrate(args []string) error {
+	if len(args) == 0 || args[0] == "help" {
+		fmt.Println(migrateUsage)
+		return nil
+	}
+
+	cfg, err := config.Load(flag.CommandLine)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger.New(os.Stderr, cfg.LogLevel, "text"))
+
+	if cfg.DBDriver != "" && cfg.DBDriver != "postgres" {
+		return fmt.Errorf("migrations only run against Postgres, DB_DRIVER is %s", cfg.DBDriver)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := database.Connect(ctx, cfg.DatabaseUrl, cfg.PoolConfig())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db.Pool, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrator.Up(ctx)
+	case "down":
+		n, err := intArg(args, "N")
+		if err != nil {
+			return err
+		}
+		return migrator.Down(ctx, int(n))
+	case "to":
+		version, err := intArg(args, "VERSION")
+		if err != nil {
+			return err
+		}
+		return migrator.To(ctx, version)
+	case "force":
+		version, err := intArg(args, "VERSION")
+		if err != nil {
+			return err
+		}
+		return migrator.Force(ctx, version)
+	case "status":
+		return printMigrationStatus(ctx, migrator)
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+// intArg reads the one non negative number a migrate command takes.
+func intArg(args []string, name string) (int64, error) {
+	if len(args) != 2 {
+		return 0, fmt.Errorf("usage: api migrate %s %s", args[0], name)
+	}
+
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non negative number, got %q", name, args[1])
+	}
+
+	return n, nil
+}
+
+func printMigrationStatus(ctx context.Context, migrator *database.Migrator) error {
+	states, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range states {
+		status, appliedAt := "pending", ""
+		if s.Applied {
+			status = "applied"
+			if !s.AppliedAt.IsZero() {
+				appliedAt = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+		}
+		if s.Modified {
+			status = "modified"
+		}
+		if s.Missing {
+			status = "unknown to this binary"
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// distribution draws how many groups a contact is in, written "kind:params":
+//
+//	fixed:3       every contact is in 3 groups
+//	uniform:0-5   between 0 and 5 groups, equally likely
+//	poisson:2     2 groups on average, a few contacts in many more
+//	zipf:1.5      most contacts in no or one group, a long tail in many
+//
+// Draws are capped at the number of groups.
+type distribution struct {
+	kind string
+	a, b float64
+}
+
+func parseDistribution(spec string) (distribution, error) {
+	kind, params, _ := strings.Cut(spec, ":")
+	invalid := fmt.Errorf("invalid distribution %q, expected fixed:N, uniform:MIN-MAX, poisson:MEAN or zipf:S", spec)
+
+	switch kind {
+	case "fixed":
+		n, err := strconv.Atoi(params)
+		if err != nil || n < 0 {
+			return distribution{}, invalid
+		}
+		return distribution{kind: kind, a: float64(n)}, nil
+	case "uniform":
+		lo, hi, found := strings.Cut(params, "-")
+		low, errLow := strconv.Atoi(lo)
+		high, errHigh := strconv.Atoi(hi)
+		if !found || errLow != nil || errHigh != nil || low < 0 || high < low {
+			return distribution{}, invalid
+		}
+		return distribution{kind: kind, a: float64(low), b: float64(high)}, nil
+	case "poisson":
+		mean, err := strconv.ParseFloat(params, 64)
+		if err != nil || mean <= 0 {
+			return distribution{}, invalid
+		}
+		return distribution{kind: kind, a: mean}, nil
+	case "zipf":
+		s, err := strconv.ParseFloat(params, 64)
+		// rand.NewZipf needs s > 1.
+		if err != nil || s <= 1 {
+			return distribution{}, invalid
+		}
+		return distribution{kind: kind, a: s}, nil
+	default:
+		return distribution{}, invalid
+	}
+}
+
+func (d distribution) sample(rng *rand.Rand, groups int) int {
+	var n int
+	switch d.kind {
+	case "fixed":
+		n = int(d.a)
+	case "uniform":
+		n = int(d.a) + rng.IntN(int(d.b-d.a)+1)
+	case "poisson":
+		// Knuth, fine for the small means a contact's group count has.
+		limit, p := math.Exp(-d.a), 1.0
+		for {
+			p *= rng.Float64()
+			if p <= limit {
+				break
+			}
+			n++
+		}
+	case "zipf":
+		if groups == 0 {
+			return 0
+		}
+		n = int(rand.NewZipf(rng, d.a, 1, uint64(groups)).Uint64())
+	}
+
+	return min(n, groups)
+}
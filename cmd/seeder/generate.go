@@ -0,0 +1,248 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// maxColumnLength is the VARCHAR(100) of contacts.name, contacts.email and groups.name.
+	maxColumnLength = 100
+	// maxLocalPart is the longest local part of an email address RFC 5321 allows.
+	maxLocalPart = 64
+	// recentContacts is how far back a near duplicate may look for its original.
+	recentContacts = 100
+)
+
+type contactRow struct {
+	name  string
+	email string
+	phone string
+	// groups are indexes into the seeded groups.
+	groups []int
+}
+
+// generator makes contacts from one random stream, so a seed always gives the
+// same contacts in the same order. Group memberships come from a second
+// stream, changing the distribution does not change the contacts.
+type generator struct {
+	rng         *rand.Rand
+	groupRng    *rand.Rand
+	perContact  distribution
+	groupCount  int
+	groupOrder  []int
+	emails      map[string]bool
+	recent      []contactRow
+	recentIndex int
+}
+
+func newGenerator(seed uint64, perContact distribution, groupCount int) *generator {
+	groupOrder := make([]int, groupCount)
+	for i := range groupOrder {
+		groupOrder[i] = i
+	}
+
+	return &generator{
+		rng:        rand.New(rand.NewPCG(seed, 0)),
+		groupRng:   rand.New(rand.NewPCG(seed, 1)),
+		perContact: perContact,
+		groupCount: groupCount,
+		groupOrder: groupOrder,
+		emails:     make(map[string]bool),
+	}
+}
+
+func (g *generator) contact(l locale, e edgeCases) contactRow {
+	var c contactRow
+
+	roll := g.rng.Float64()
+	switch {
+	case roll < e.UnicodeNames:
+		c = g.person(l)
+		c.name = pick(g.rng, unicodeNames)
+	case roll < e.UnicodeNames+e.LongNames:
+		c = g.person(l)
+		c.name = g.longName(c.name)
+	case roll < e.UnicodeNames+e.LongNames+e.LongEmails:
+		c = g.person(l)
+		c.email = g.longEmail(c.email)
+	case roll < e.UnicodeNames+e.LongNames+e.LongEmails+e.NearDuplicates && len(g.recent) > 0:
+		c = g.nearDuplicate(pick(g.rng, g.recent))
+		// A variant of an already long contact may not fit the columns.
+		if utf8.RuneCountInString(c.name) > maxColumnLength || len(c.email) > maxColumnLength-4 {
+			c = g.person(l)
+		}
+	default:
+		c = g.person(l)
+	}
+
+	c.email = g.unique(c.email)
+	c.groups = g.groups()
+	g.remember(c)
+
+	return c
+}
+
+func (g *generator) person(l locale) contactRow {
+	first, firstAscii := splitName(pick(g.rng, l.firstNames))
+	last, lastAscii := splitName(pick(g.rng, l.lastNames))
+
+	name := first + " " + last
+	if l.familyFirst {
+		name = last + " " + first
+	}
+
+	local := strings.ToLower(firstAscii) + pick(g.rng, []string{".", "_", ""}) + strings.ToLower(lastAscii)
+	if g.rng.IntN(3) == 0 {
+		local += fmt.Sprint(g.rng.IntN(100))
+	}
+
+	return contactRow{
+		name:  name,
+		email: local + "@" + pick(g.rng, emailDomains),
+		phone: g.phone(l),
+	}
+}
+
+// phone is E.164, what the API accepts.
+func (g *generator) phone(l locale) string {
+	var b strings.Builder
+	b.WriteString("+" + l.countryCode + pick(g.rng, l.phonePrefixes))
+	for range l.phoneDigits {
+		b.WriteByte(byte('0' + g.rng.IntN(10)))
+	}
+	return b.String()
+}
+
+// longName repeats middle names until the name column is full.
+func (g *generator) longName(name string) string {
+	first, last, _ := strings.Cut(name, " ")
+	parts := []string{first}
+	length := utf8.RuneCountInString(first) + 1 + utf8.RuneCountInString(last)
+	for {
+		middle, _ := splitName(pick(g.rng, locales["en"].firstNames))
+		if length+1+len(middle) > maxColumnLength {
+			break
+		}
+		parts = append(parts, middle)
+		length += 1 + len(middle)
+	}
+
+	return strings.Join(append(parts, last), " ")
+}
+
+// longEmail pads the local part to 64 characters and the domain with
+// subdomains until the email column is full.
+func (g *generator) longEmail(email string) string {
+	local, domain, _ := strings.Cut(email, "@")
+	for len(local) < maxLocalPart {
+		local += "." + strings.Repeat(string(rune('a'+g.rng.IntN(26))), 1+g.rng.IntN(8))
+	}
+	local = strings.TrimRight(local[:maxLocalPart], ".")
+
+	for len(local)+1+len(domain) < maxColumnLength-4 {
+		domain = string(rune('a'+g.rng.IntN(26))) + "." + domain
+	}
+
+	return local + "@" + domain
+}
+
+// nearDuplicate looks like the original to a human but not to a unique index.
+func (g *generator) nearDuplicate(original contactRow) contactRow {
+	c := original
+	local, domain, _ := strings.Cut(original.email, "@")
+
+	switch g.rng.IntN(4) {
+	case 0:
+		c.name = strings.ToUpper(original.name)
+		c.email = strings.ToUpper(local[:1]) + local[1:] + "@" + domain
+	case 1:
+		c.name = "  " + strings.Join(strings.Fields(original.name), "   ") + " "
+		c.email = local + "+" + fmt.Sprint(g.rng.IntN(1000)) + "@" + domain
+	case 2:
+		if first, last, found := strings.Cut(original.name, " "); found {
+			c.name = last + ", " + first
+		}
+		c.email = strings.ReplaceAll(local, ".", "") + "@" + pick(g.rng, emailDomains)
+	default:
+		c.name = titleCase(strings.ToLower(original.name))
+		c.email = local + "@" + strings.ToUpper(domain)
+		c.phone = formatPhone(original.phone)
+	}
+
+	return c
+}
+
+// unique numbers an email already handed out, the column has a unique index.
+func (g *generator) unique(email string) string {
+	candidate := email
+	for n := 2; g.emails[candidate]; n++ {
+		local, domain, _ := strings.Cut(email, "@")
+		suffix := fmt.Sprint(n)
+		candidate = local[:min(len(local), maxLocalPart-len(suffix))] + suffix + "@" + domain
+	}
+
+	g.emails[candidate] = true
+	return candidate
+}
+
+// groups draws the contact's memberships, a partial shuffle picks them without repeats.
+func (g *generator) groups() []int {
+	n := g.perContact.sample(g.groupRng, g.groupCount)
+	groups := make([]int, n)
+	for i := range n {
+		j := i + g.groupRng.IntN(g.groupCount-i)
+		g.groupOrder[i], g.groupOrder[j] = g.groupOrder[j], g.groupOrder[i]
+		groups[i] = g.groupOrder[i]
+	}
+
+	return groups
+}
+
+func (g *generator) remember(c contactRow) {
+	if len(g.recent) < recentContacts {
+		g.recent = append(g.recent, c)
+		return
+	}
+
+	g.recent[g.recentIndex] = c
+	g.recentIndex = (g.recentIndex + 1) % recentContacts
+}
+
+func pick[T any](rng *rand.Rand, values []T) T {
+	return values[rng.IntN(len(values))]
+}
+
+// splitName splits "display|ascii", the ascii form defaults to the display one.
+func splitName(value string) (string, string) {
+	display, ascii, found := strings.Cut(value, "|")
+	if !found {
+		return display, display
+	}
+	return display, ascii
+}
+
+func titleCase(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		if i == 0 || runes[i-1] == ' ' {
+			runes[i] = unicode.ToUpper(r)
+		}
+	}
+	return string(runes)
+}
+
+// formatPhone writes an E.164 number the way people type it, e.g. +1 (212) 555-0100.
+func formatPhone(phone string) string {
+	digits := strings.TrimPrefix(phone, "+")
+	n := len(digits)
+	// A near duplicate of a near duplicate is formatted already.
+	if n < 11 || strings.Trim(digits, "0123456789") != "" {
+		return phone
+	}
+
+	return fmt.Sprintf("+%s (%s) %s-%s", digits[:n-10], digits[n-10:n-7], digits[n-7:n-4], digits[n-4:])
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"log/slog"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// seedContactsTable stages a chunk, so ON CONFLICT can skip emails that are
+// already in contacts, which COPY straight into contacts cannot.
+const seedContactsTable = `CREATE TEMPORARY TABLE IF NOT EXISTS seed_contacts (
+	ord   INT NOT NULL,
+	name  TEXT NOT NULL,
+	email TEXT,
+	phone TEXT
+) ON COMMIT DELETE ROWS`
+
+type loader struct {
+	pool      *pgxpool.Pool
+	chunkSize int
+	total     int
+
+	done        int
+	skipped     int
+	memberships int
+	started     time.Time
+	reported    time.Time
+}
+
+func truncate(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, `TRUNCATE contacts, groups, contact_groups RESTART IDENTITY CASCADE`)
+	return err
+}
+
+// seedGroups returns the ids of the named groups in order. Static groups that
+// already exist by name are reused, the others are created.
+func seedGroups(ctx context.Context, pool *pgxpool.Pool, names []string) ([]int64, error) {
+	ids := make(map[string]int64, len(names))
+
+	rows, err := pool.Query(ctx, `SELECT id, name FROM groups WHERE name = ANY($1) AND filter IS NULL ORDER BY id`, names)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if _, ok := ids[name]; !ok {
+			ids[name] = id
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for _, name := range names {
+		if _, ok := ids[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		rows, err := pool.Query(ctx, `INSERT INTO groups (name) SELECT unnest($1::text[]) RETURNING id, name`, missing)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var name string
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			ids[name] = id
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Info("groups seeded", "created", len(missing), "reused", len(names)-len(missing))
+
+	groupIds := make([]int64, len(names))
+	for i, name := range names {
+		groupIds[i] = ids[name]
+	}
+	return groupIds, nil
+}
+
+// seedContacts copies the contacts chunk by chunk, one transaction each, so
+// an interrupted run keeps the chunks that were committed.
+func (l *loader) seedContacts(ctx context.Context, contacts iter.Seq[contactRow], groupIds []int64) error {
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, seedContactsTable); err != nil {
+		return err
+	}
+
+	l.started, l.reported = time.Now(), time.Now()
+
+	chunk := make([]contactRow, 0, l.chunkSize)
+	for c := range contacts {
+		chunk = append(chunk, c)
+		if len(chunk) < l.chunkSize {
+			continue
+		}
+		if err := l.copyChunk(ctx, conn.Conn(), chunk, groupIds); err != nil {
+			return err
+		}
+		chunk = chunk[:0]
+	}
+	if len(chunk) > 0 {
+		if err := l.copyChunk(ctx, conn.Conn(), chunk, groupIds); err != nil {
+			return err
+		}
+	}
+
+	elapsed := time.Since(l.started)
+	slog.Info("contacts seeded",
+		"inserted", l.done-l.skipped,
+		"skipped", l.skipped,
+		"memberships", l.memberships,
+		"duration", elapsed.Round(time.Millisecond).String(),
+		"rows_per_second", int(float64(l.done)/max(elapsed.Seconds(), 0.001)),
+	)
+	return nil
+}
+
+func (l *loader) copyChunk(ctx context.Context, conn *pgx.Conn, chunk []contactRow, groupIds []int64) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Seeded memberships are no group changes worth a timeline entry.
+	if err := database.SkipChangeTracking(ctx, tx); err != nil {
+		return err
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"seed_contacts"}, []string{"ord", "name", "email", "phone"},
+		pgx.CopyFromSlice(len(chunk), func(i int) ([]interface{}, error) {
+			return []interface{}{i, chunk[i].name, chunk[i].email, chunk[i].phone}, nil
+		}))
+	if err != nil {
+		return fmt.Errorf("copy contacts: %w", err)
+	}
+
+	// Emails already in contacts are skipped, like the old batch inserts did.
+	rows, err := tx.Query(ctx, `INSERT INTO contacts (name, email, phone)
+		SELECT name, email, phone FROM seed_contacts ORDER BY ord
+		ON CONFLICT (email) DO NOTHING
+		RETURNING id, email`)
+	if err != nil {
+		return fmt.Errorf("insert contacts: %w", err)
+	}
+
+	inserted := make(map[string]int64, len(chunk))
+	for rows.Next() {
+		var id int64
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return err
+		}
+		inserted[email] = id
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("insert contacts: %w", err)
+	}
+
+	var memberships [][]interface{}
+	for _, c := range chunk {
+		id, ok := inserted[c.email]
+		if !ok {
+			continue
+		}
+		for _, group := range c.groups {
+			memberships = append(memberships, []interface{}{id, groupIds[group]})
+		}
+	}
+
+	if len(memberships) > 0 {
+		if _, err := tx.CopyFrom(ctx, pgx.Identifier{"contact_groups"}, []string{"contact_id", "group_id"}, pgx.CopyFromRows(memberships)); err != nil {
+			return fmt.Errorf("copy contact groups: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	l.done += len(chunk)
+	l.skipped += len(chunk) - len(inserted)
+	l.memberships += len(memberships)
+	l.progress()
+	return nil
+}
+
+// progress logs at most once a second, chunks can be much faster than that.
+func (l *loader) progress() {
+	if time.Since(l.reported) < time.Second && l.done < l.total {
+		return
+	}
+	l.reported = time.Now()
+
+	slog.Info("seeding contacts",
+		"done", l.done,
+		"total", l.total,
+		"percent", fmt.Sprintf("%.1f", 100*float64(l.done)/float64(max(l.total, 1))),
+		"rows_per_second", int(float64(l.done)/max(time.Since(l.started).Seconds(), 0.001)),
+		"skipped", l.skipped,
+	)
+}
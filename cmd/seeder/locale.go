@@ -0,0 +1,102 @@
+package main
+
+// locale is what the fake contacts of a country are made of. Names are
+// "display|ascii", the ascii form builds the email and is left out when both
+// are the same.
+type locale struct {
+	firstNames []string
+	lastNames  []string
+	// familyFirst writes the last name first, as in Japanese.
+	familyFirst bool
+
+	countryCode string
+	// phonePrefixes start the national number, phoneDigits random digits follow.
+	phonePrefixes []string
+	phoneDigits   int
+}
+
+// emailDomains are reserved for examples, seeded emails never reach anyone.
+var emailDomains = []string{"example.com", "example.org", "example.net"}
+
+var locales = map[string]locale{
+	"en": {
+		firstNames: []string{
+			"James", "Mary", "John", "Patricia", "Robert", "Jennifer", "Michael", "Linda", "William", "Elizabeth",
+			"David", "Barbara", "Richard", "Susan", "Joseph", "Jessica", "Thomas", "Sarah", "Charles", "Karen",
+			"Daniel", "Emily", "Matthew", "Olivia", "Anthony", "Sophia", "Mark", "Grace", "Steven", "Chloe",
+		},
+		lastNames: []string{
+			"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+			"Wilson", "Anderson", "Taylor", "Thomas", "Moore", "Jackson", "Martin", "Lee", "Thompson", "White",
+			"Harris", "Clark", "Lewis", "Walker", "Hall", "Young", "King", "Wright", "Scott", "Green",
+		},
+		countryCode:   "1",
+		phonePrefixes: []string{"201", "212", "305", "415", "512", "617", "702", "808"},
+		phoneDigits:   7,
+	},
+	"id": {
+		firstNames: []string{
+			"Budi", "Siti", "Agus", "Dewi", "Andi", "Rina", "Dedi", "Sri", "Eko", "Putri",
+			"Hendra", "Wulan", "Rizky", "Ayu", "Fajar", "Indah", "Bayu", "Lestari", "Yusuf", "Nur",
+			"Bram", "Intan", "Dimas", "Ratna", "Arif", "Maya", "Teguh", "Fitri", "Joko", "Kartika",
+		},
+		lastNames: []string{
+			"Santoso", "Wijaya", "Saputra", "Hidayat", "Setiawan", "Nugroho", "Pratama", "Kurniawan", "Wibowo", "Gunawan",
+			"Susanto", "Lestari", "Hartono", "Halim", "Siregar", "Nasution", "Simanjuntak", "Sihombing", "Purnomo", "Aristyo",
+			"Firmansyah", "Ramadhan", "Permana", "Utomo", "Sutanto", "Kusuma", "Rahayu", "Wahyudi", "Syahputra", "Harahap",
+		},
+		countryCode:   "62",
+		phonePrefixes: []string{"811", "812", "813", "821", "822", "852", "856", "857", "878", "895"},
+		phoneDigits:   8,
+	},
+	"de": {
+		firstNames: []string{
+			"Lukas", "Anna", "Jonas", "Lena", "Leon", "Marie", "Finn", "Sophie", "Paul", "Emma",
+			"Jürgen|Juergen", "Jörg|Joerg", "Günter|Guenter", "Käthe|Kaethe", "Björn|Bjoern", "Hannah", "Felix", "Mia", "Maximilian", "Lea",
+		},
+		lastNames: []string{
+			"Müller|Mueller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz", "Hoffmann",
+			"Schäfer|Schaefer", "Koch", "Bauer", "Richter", "Klein", "Wolf", "Schröder|Schroeder", "Neumann", "Schwarz", "Weiß|Weiss",
+		},
+		countryCode:   "49",
+		phonePrefixes: []string{"151", "152", "157", "160", "170", "171", "175", "176"},
+		phoneDigits:   8,
+	},
+	"ja": {
+		firstNames: []string{
+			"陽翔|haruto", "蓮|ren", "湊|minato", "蒼|aoi", "樹|itsuki", "大翔|hiroto", "悠真|yuma", "朝陽|asahi",
+			"陽葵|himari", "凛|rin", "結菜|yuina", "葵|aoi", "紬|tsumugi", "芽依|mei", "さくら|sakura", "美咲|misaki",
+		},
+		lastNames: []string{
+			"佐藤|sato", "鈴木|suzuki", "高橋|takahashi", "田中|tanaka", "伊藤|ito", "渡辺|watanabe", "山本|yamamoto", "中村|nakamura",
+			"小林|kobayashi", "加藤|kato", "吉田|yoshida", "山田|yamada", "佐々木|sasaki", "山口|yamaguchi", "松本|matsumoto", "井上|inoue",
+		},
+		familyFirst:   true,
+		countryCode:   "81",
+		phonePrefixes: []string{"70", "80", "90"},
+		phoneDigits:   8,
+	},
+}
+
+// unicodeNames exercise encodings, collation and rendering: combining marks,
+// right-to-left scripts, CJK, emoji and punctuation inside names.
+var unicodeNames = []string{
+	"Zoë Saldaña",
+	"Zoé Beyoncé",
+	"Ægir Þórsson",
+	"Łukasz Żółć",
+	"Ольга Смирнова",
+	"Σωκράτης Παπαδόπουλος",
+	"محمد الأمين",
+	"דוד כהן",
+	"李小龙",
+	"김민준",
+	"Nguyễn Thị Minh Khai",
+	"José María Núñez",
+	"Siobhán O'Connor-Smith",
+	"Renée 🎉 Dupont",
+	"François d’Alembert",
+	"Ṁïẍëḋ Ŝċṙïṗṫ",
+	"अर्जुन शर्मा",
+	"Şükrü Öztürk",
+}
@@ -2,172 +2,193 @@ package main
 
 import (
 	"context"
-	"log"
-	"math/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"iter"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/BramAristyo/rest-api-contact-person/internal/config"
 	"github.com/BramAristyo/rest-api-contact-person/internal/database"
-	"github.com/go-faker/faker/v4"
-	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
 )
 
 func main() {
-	cfg := config.Load()
-	db := database.Connect(cfg.DatabaseUrl)
-	defer db.Close()
+	slog.SetDefault(logger.New(os.Stderr, "info", "text"))
 
-	ctx := context.Background()
-	SeedContacts(ctx, db, 5000)
-	SeedGroups(ctx, db)
-	SeedContactGroups(ctx, db)
-}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-func SeedContacts(ctx context.Context, db *pgxpool.Pool, total int) {
-	// Using Batch for bulk insert is more efficient than inserting one by one,
-	batch := &pgx.Batch{}
+	args := os.Args[1:]
+	command := ""
+	if len(args) > 0 {
+		command = args[0]
+	}
 
-	for i := 0; i < total; i++ {
-		name := faker.Name()
-		email := faker.Email()
-		phone := faker.Phonenumber()
+	var err error
+	switch command {
+	case "fixtures":
+		err = runFixtures(ctx, args[1:])
+	case "snapshot":
+		err = runSnapshot(ctx, args[1:])
+	case "restore":
+		err = runRestore(ctx, args[1:])
+	default:
+		err = run(ctx, args)
+	}
 
-		// insert into batch
-		batch.Queue(
-			`INSERT INTO contacts (name, email, phone) 
-             VALUES ($1, $2, $3) 
-             ON CONFLICT (email) DO NOTHING`,
-			name, email, phone,
-		)
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		slog.Error("seeder failed", "command", command, "error", err)
+		stop()
+		os.Exit(1)
 	}
+}
 
-	// Send the batch to the database, it returns a BatchResults which we can iterate over to get results of each query.
-	br := db.SendBatch(ctx, batch)
-	defer func(br pgx.BatchResults) {
-		err := br.Close()
-		if err != nil {
-			log.Fatal("Batch Closed error")
-		}
-	}(br)
+func run(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("seeder", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `usage: seeder [flags]
+       seeder fixtures FILE...
+       seeder snapshot FILE
+       seeder restore FILE
+
+Seeds the Postgres database of the API config with fake contacts and groups.
+The same seed and flags, or the same scenario, always produce the same data.
+
+commands:
+  fixtures   replace contacts, groups and memberships with YAML or JSON fixtures
+  snapshot   write contacts, groups, memberships and reminders to a zip archive, - is stdout
+  restore    replace contacts, groups, memberships and reminders with a snapshot archive
+
+flags:
+`)
+		fs.PrintDefaults()
+	}
 
-	// We should check the result of each query in the batch, since some might fail due to unique constraint on email, we can log and skip those without failing the whole batch.
-	for i := 0; i < total; i++ {
-		_, err := br.Exec()
-		if err != nil {
-			log.Printf("skip row %d: %v\n", i+1, err)
-		}
+	contacts := fs.Int("contacts", 5000, "number of contacts")
+	groups := fs.Int("groups", len(defaultGroups), "number of groups")
+	seed := fs.Uint64("seed", 0, "random seed, 0 picks one and prints it")
+	localeName := fs.String("locale", "en", "locale of names and phone numbers: "+strings.Join(localeNames(), ", "))
+	groupsPerContact := fs.String("groups-per-contact", "fixed:3", "groups per contact: fixed:N, uniform:MIN-MAX, poisson:MEAN or zipf:S")
+	edgeCaseFlag := fs.String("edge-cases", "", "fractions of edge cases, e.g. unicode_names=0.05,long_emails=0.01,near_duplicates=0.02")
+	truncateFlag := fs.Bool("truncate", false, "empty contacts, groups and memberships first and restart their ids")
+	chunkSize := fs.Int("chunk-size", 1000, "contacts copied per transaction")
+	scenarioPath := fs.String("scenario", "", "YAML scenario file, replaces the dataset flags")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
 	}
 
-	log.Printf("%d contacts seeded\n", total)
-}
-func SeedGroups(ctx context.Context, db *pgxpool.Pool) {
-	groups := []string{
-		"Family",
-		"Friends",
-		"Work",
-		"Colleagues",
-		"School",
-		"University",
-		"Clients",
-		"Business",
-		"Emergency",
-		"Neighbors",
-		"Gym",
-		"Sports",
-		"Hobbies",
-		"Travel",
-		"Medical",
-		"Services",
-		"Favorites",
-		"Blocked",
-	}
-
-	batch := &pgx.Batch{}
-	for _, g := range groups {
-		batch.Queue(
-			`INSERT INTO groups (name) VALUES ($1) ON CONFLICT DO NOTHING`, g,
-		)
-	}
-
-	br := db.SendBatch(ctx, batch)
-	defer func(br pgx.BatchResults) {
-		err := br.Close()
-		if err != nil {
-			log.Fatal("Batch Closed error:", err)
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	var s scenario
+	if *scenarioPath != "" {
+		for _, name := range []string{"contacts", "groups", "locale", "groups-per-contact", "edge-cases"} {
+			if set[name] {
+				return fmt.Errorf("--%s cannot be combined with --scenario, set it in the scenario file", name)
+			}
 		}
-	}(br)
 
-	for range groups {
-		if _, err := br.Exec(); err != nil {
-			log.Printf("skip group: %v \n", err)
+		var err error
+		if s, err = loadScenario(*scenarioPath); err != nil {
+			return err
+		}
+	} else {
+		edge, err := parseEdgeCases(*edgeCaseFlag)
+		if err != nil {
+			return err
+		}
+		s = scenario{
+			Name:             "flags",
+			Groups:           groupSpec{Count: *groups},
+			GroupsPerContact: *groupsPerContact,
+			Contacts:         []contactSpec{{Count: *contacts, Locale: *localeName, EdgeCases: edge}},
 		}
 	}
 
-	log.Printf("%d groups seeded\n", len(groups))
-}
-func SeedContactGroups(ctx context.Context, db *pgxpool.Pool) {
-	// Streaming approach to avoid loading all contact and group ids into memory at once
-	contactRows, err := db.Query(ctx, `SELECT id FROM contacts`)
-	if err != nil {
-		log.Fatal("Error while fetching contacts.")
+	// Flags override the scenario, so a scenario can be replayed with another seed.
+	if set["seed"] || *scenarioPath == "" {
+		s.Seed = *seed
+	}
+	if set["truncate"] || *scenarioPath == "" {
+		s.Truncate = *truncateFlag
+	}
+	if set["chunk-size"] || *scenarioPath == "" {
+		s.ChunkSize = *chunkSize
+	}
+	if s.Seed == 0 {
+		s.Seed = rand.Uint64()
 	}
-	defer contactRows.Close()
 
-	var contactIds []int64
-	for contactRows.Next() {
-		var id int64
-		if err := contactRows.Scan(&id); err != nil {
-			log.Fatal("Error scanning contact id:", err)
-		}
-		contactIds = append(contactIds, id)
+	if err := s.validate(); err != nil {
+		return err
 	}
 
-	groupRows, err := db.Query(ctx, `SELECT id FROM groups`)
+	db, err := connect(ctx)
 	if err != nil {
-		log.Fatal("Error while fetching groups")
+		return err
 	}
-	defer groupRows.Close()
+	defer db.Close()
 
-	var groupIds []int64
-	for groupRows.Next() {
-		var id int64
-		if err := groupRows.Scan(&id); err != nil {
-			log.Fatal("Error scanning group id:", err)
+	slog.Info("seeding", "scenario", s.Name, "seed", s.Seed, "contacts", s.totalContacts(), "groups_per_contact", s.GroupsPerContact)
+
+	if s.Truncate {
+		if err := truncate(ctx, db.Pool); err != nil {
+			return fmt.Errorf("truncate: %w", err)
 		}
-		groupIds = append(groupIds, id)
+		slog.Info("tables truncated")
 	}
 
-	batch := &pgx.Batch{}
-	total := 0
+	names := s.groupNames()
+	groupIds, err := seedGroups(ctx, db.Pool, names)
+	if err != nil {
+		return fmt.Errorf("seed groups: %w", err)
+	}
 
-	for _, contactId := range contactIds {
-		rand.Shuffle(len(groupIds), func(i, j int) {
-			groupIds[i], groupIds[j] = groupIds[j], groupIds[i]
-		})
+	perContact, _ := parseDistribution(s.GroupsPerContact)
+	g := newGenerator(s.Seed, perContact, len(names))
 
-		for _, groupId := range groupIds[:3] {
-			batch.Queue(
-				`INSERT INTO contact_groups (contact_id, group_id) VALUES ($1,$2) ON CONFLICT DO NOTHING`,
-				contactId, groupId,
-			)
-			total++
-		}
+	l := &loader{pool: db.Pool, chunkSize: s.ChunkSize, total: s.totalContacts()}
+	if err := l.seedContacts(ctx, generate(g, s.Contacts), groupIds); err != nil {
+		return fmt.Errorf("seed contacts: %w", err)
 	}
 
-	br := db.SendBatch(ctx, batch)
-	defer func(br pgx.BatchResults) {
-		err := br.Close()
-		if err != nil {
+	slog.Info("done, repeat this run with the same seed", "seed", s.Seed)
+	return nil
+}
 
-		}
-	}(br)
+// connect opens the Postgres database of the API config.
+func connect(ctx context.Context) (*database.DB, error) {
+	cfg, err := config.Load(nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.DBDriver != "" && cfg.DBDriver != "postgres" {
+		return nil, fmt.Errorf("the seeder only works with Postgres, DB_DRIVER is %s", cfg.DBDriver)
+	}
 
-	for i := 0; i < total; i++ {
-		if _, err := br.Exec(); err != nil {
-			log.Printf("skip row %d: %v", i+1, err)
-		}
+	return database.Connect(ctx, cfg.DatabaseUrl, cfg.PoolConfig())
+}
 
+// generate yields the contacts of every segment in order.
+func generate(g *generator, segments []contactSpec) iter.Seq[contactRow] {
+	return func(yield func(contactRow) bool) {
+		for _, segment := range segments {
+			l := locales[segment.Locale]
+			for range segment.Count {
+				if !yield(g.contact(l, segment.EdgeCases)) {
+					return
+				}
+			}
+		}
 	}
-
-	log.Printf("%d contact_groups seeded\n\n", total)
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// scenario describes a dataset. Contacts are made of segments, each with its
+// own count, locale and share of edge cases. The same scenario and seed always
+// produce the same rows.
+type scenario struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Seed 0 picks a random one, it is printed so the run can be repeated.
+	Seed      uint64 `yaml:"seed"`
+	Truncate  bool   `yaml:"truncate"`
+	ChunkSize int    `yaml:"chunk_size"`
+
+	Groups groupSpec `yaml:"groups"`
+	// GroupsPerContact is a distribution, see parseDistribution.
+	GroupsPerContact string        `yaml:"groups_per_contact"`
+	Contacts         []contactSpec `yaml:"contacts"`
+}
+
+// groupSpec takes the given names, or defaultGroups, first and then cuts them
+// or makes up more until there are Count.
+type groupSpec struct {
+	Count int      `yaml:"count"`
+	Names []string `yaml:"names"`
+}
+
+type contactSpec struct {
+	Count     int       `yaml:"count"`
+	Locale    string    `yaml:"locale"`
+	EdgeCases edgeCases `yaml:"edge_cases"`
+}
+
+// edgeCases are the fractions of a segment's contacts that are unusual on purpose.
+type edgeCases struct {
+	// UnicodeNames come from unicodeNames: combining marks, RTL, CJK and emoji.
+	UnicodeNames float64 `yaml:"unicode_names"`
+	// LongNames fill the 100 characters of the name column.
+	LongNames float64 `yaml:"long_names"`
+	// LongEmails have a 64 character local part and fill the email column.
+	LongEmails float64 `yaml:"long_emails"`
+	// NearDuplicates repeat an earlier contact with a different case,
+	// whitespace, plus address or phone format.
+	NearDuplicates float64 `yaml:"near_duplicates"`
+}
+
+var defaultGroups = []string{
+	"Family", "Friends", "Work", "Colleagues", "School", "University", "Clients", "Business", "Emergency",
+	"Neighbors", "Gym", "Sports", "Hobbies", "Travel", "Medical", "Services", "Favorites", "Blocked",
+}
+
+func loadScenario(path string) (scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return scenario{}, err
+	}
+
+	var s scenario
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	// A misspelled key would otherwise silently seed the defaults.
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&s); err != nil {
+		return scenario{}, fmt.Errorf("scenario %s: %w", path, err)
+	}
+	if s.Name == "" {
+		s.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	return s, nil
+}
+
+// validate fills in defaults and checks the scenario before anything is written.
+func (s *scenario) validate() error {
+	if s.ChunkSize == 0 {
+		s.ChunkSize = 1000
+	}
+	if s.ChunkSize < 0 {
+		return fmt.Errorf("chunk size must be positive, got %d", s.ChunkSize)
+	}
+	if s.Groups.Count < 0 {
+		return fmt.Errorf("group count must not be negative, got %d", s.Groups.Count)
+	}
+	for _, name := range s.Groups.Names {
+		if name == "" || utf8.RuneCountInString(name) > maxColumnLength {
+			return fmt.Errorf("group name %q must be between 1 and %d characters", name, maxColumnLength)
+		}
+	}
+	if s.GroupsPerContact == "" {
+		s.GroupsPerContact = "fixed:3"
+	}
+	if _, err := parseDistribution(s.GroupsPerContact); err != nil {
+		return err
+	}
+	if len(s.Contacts) == 0 {
+		return fmt.Errorf("scenario %s has no contacts", s.Name)
+	}
+
+	for i := range s.Contacts {
+		segment := &s.Contacts[i]
+		if segment.Locale == "" {
+			segment.Locale = "en"
+		}
+		if _, ok := locales[segment.Locale]; !ok {
+			return fmt.Errorf("contacts[%d]: unknown locale %q, available: %s", i, segment.Locale, strings.Join(localeNames(), ", "))
+		}
+		if segment.Count < 0 {
+			return fmt.Errorf("contacts[%d]: count must not be negative, got %d", i, segment.Count)
+		}
+
+		e := segment.EdgeCases
+		for _, fraction := range []float64{e.UnicodeNames, e.LongNames, e.LongEmails, e.NearDuplicates} {
+			if fraction < 0 || fraction > 1 {
+				return fmt.Errorf("contacts[%d]: edge case fractions must be between 0 and 1", i)
+			}
+		}
+		if e.UnicodeNames+e.LongNames+e.LongEmails+e.NearDuplicates > 1 {
+			return fmt.Errorf("contacts[%d]: edge case fractions add up to more than 1", i)
+		}
+	}
+
+	return nil
+}
+
+func (s *scenario) groupNames() []string {
+	names := s.Groups.Names
+	if len(names) == 0 {
+		names = defaultGroups
+	}
+	names = append([]string(nil), names...)
+
+	if s.Groups.Count > 0 && s.Groups.Count < len(names) {
+		return names[:s.Groups.Count]
+	}
+	for i := len(names); i < s.Groups.Count; i++ {
+		names = append(names, "Group "+strconv.Itoa(i+1))
+	}
+	return names
+}
+
+func (s *scenario) totalContacts() int {
+	total := 0
+	for _, segment := range s.Contacts {
+		total += segment.Count
+	}
+	return total
+}
+
+// parseEdgeCases reads the --edge-cases flag, e.g. "unicode_names=0.05,long_emails=0.01".
+func parseEdgeCases(value string) (edgeCases, error) {
+	var e edgeCases
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		key, raw, found := strings.Cut(pair, "=")
+		fraction, err := strconv.ParseFloat(raw, 64)
+		if !found || err != nil {
+			return e, fmt.Errorf("invalid edge case %q, expected name=fraction", pair)
+		}
+
+		switch strings.TrimSpace(key) {
+		case "unicode_names":
+			e.UnicodeNames = fraction
+		case "long_names":
+			e.LongNames = fraction
+		case "long_emails":
+			e.LongEmails = fraction
+		case "near_duplicates":
+			e.NearDuplicates = fraction
+		default:
+			return e, fmt.Errorf("unknown edge case %q, expected unicode_names, long_names, long_emails or near_duplicates", key)
+		}
+	}
+
+	return e, nil
+}
+
+func localeNames() []string {
+	names := make([]string, 0, len(locales))
+	for name := range locales {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
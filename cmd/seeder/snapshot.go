@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/snapshot"
+	"github.com/BramAristyo/rest-api-contact-person/migrations"
+)
+
+// runFixtures replaces the contacts, groups and memberships with fixture files.
+func runFixtures(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: seeder fixtures FILE...")
+	}
+
+	fixtures, err := snapshot.ReadFixtures(args...)
+	if err != nil {
+		return err
+	}
+
+	db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if _, err := schemaVersion(ctx, db); err != nil {
+		return err
+	}
+
+	counts, err := snapshot.LoadFixtures(ctx, db.Pool, fixtures)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("fixtures loaded", "groups", counts["groups"], "contacts", counts["contacts"], "memberships", counts["contact_groups"])
+	return nil
+}
+
+// runSnapshot writes the contacts, groups and memberships to an archive, - is stdout.
+func runSnapshot(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: seeder snapshot FILE")
+	}
+	path := args[0]
+
+	db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db.Pool, migrations.FS)
+	if err != nil {
+		return err
+	}
+	status, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	write := func(w io.Writer) (*snapshot.Manifest, error) {
+		return snapshot.Write(ctx, db.Pool, status.Version, w)
+	}
+
+	var manifest *snapshot.Manifest
+	if path == "-" {
+		manifest, err = write(os.Stdout)
+	} else {
+		manifest, err = writeFile(path, write)
+	}
+	if err != nil {
+		return err
+	}
+
+	slog.Info("snapshot written", "file", path, "schema_version", manifest.SchemaVersion,
+		"groups", manifest.Rows["groups"], "contacts", manifest.Rows["contacts"], "memberships", manifest.Rows["contact_groups"])
+	return nil
+}
+
+// writeFile writes next to path and renames, an interrupted snapshot never
+// replaces a good one.
+func writeFile(path string, write func(w io.Writer) (*snapshot.Manifest, error)) (*snapshot.Manifest, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	manifest, err := write(tmp)
+	if err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// runRestore replaces the contacts, groups and memberships with an archive.
+func runRestore(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: seeder restore FILE")
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	archive, err := snapshot.Open(file, info.Size())
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	db, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	version, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	counts, err := snapshot.Restore(ctx, db.Pool, archive, version)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("snapshot restored", "file", args[0], "taken_at", archive.Manifest.CreatedAt,
+		"groups", counts["groups"], "contacts", counts["contacts"], "memberships", counts["contact_groups"])
+	return nil
+}
+
+// schemaVersion fails unless the database has every migration of this binary,
+// data is only loaded into the schema it was written for.
+func schemaVersion(ctx context.Context, db *database.DB) (int64, error) {
+	migrator, err := database.NewMigrator(db.Pool, migrations.FS)
+	if err != nil {
+		return 0, err
+	}
+	if err := migrator.Check(ctx); err != nil {
+		return 0, err
+	}
+
+	status, err := migrator.Version(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return status.Version, nil
+}
@@ -0,0 +1,86 @@
+// Command worker runs background jobs apart from the API, e.g. with the API
+// started with JOB_WORKERS=0. It reads the same settings as the API.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/cache"
+	"github.com/BramAristyo/rest-api-contact-person/internal/config"
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/jobs"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/internal/repository"
+	"github.com/BramAristyo/rest-api-contact-person/internal/tasks"
+	"github.com/BramAristyo/rest-api-contact-person/migrations"
+)
+
+func main() {
+	config.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: worker [flags]\n\nruns background jobs until SIGINT or SIGTERM, JOB_WORKERS of them at a time\n\nflags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(); err != nil {
+		slog.Error("worker stopped with error", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	cfg, err := config.Load(flag.CommandLine)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger.New(os.Stdout, cfg.LogLevel, cfg.LogFormat))
+
+	if cfg.DBDriver != "" && cfg.DBDriver != "postgres" {
+		return fmt.Errorf("jobs are stored in Postgres, DB_DRIVER is %s", cfg.DBDriver)
+	}
+	if cfg.JobWorkers == 0 {
+		return fmt.Errorf("JOB_WORKERS is 0, the worker would run no jobs")
+	}
+
+	// Cancelled on SIGINT/SIGTERM, running jobs are handed back to the queue.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	db, err := database.Connect(ctx, cfg.DatabaseUrl, cfg.PoolConfig())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db.Pool, migrations.FS)
+	if err != nil {
+		return err
+	}
+	if err := migrator.Check(ctx); err != nil {
+		return err
+	}
+
+	// The worker has no cache of its own, it only tells the API instances.
+	var invalidate func(ctx context.Context)
+	if cfg.CacheNotify && cfg.CacheBackend != "none" {
+		notifier := cache.NewNotifier(db.Pool, repository.ContactsCacheChannel)
+		invalidate = func(ctx context.Context) {
+			if err := notifier.Publish(ctx, cache.InvalidateAll); err != nil {
+				slog.Warn("publish contacts cache invalidation", "error", err)
+			}
+		}
+	}
+
+	worker := jobs.NewWorker(jobs.NewQueue(db, cfg.JobMaxAttempts), cfg.JobOptions())
+	tasks.Register(worker, db, migrator, invalidate)
+	worker.Run(ctx)
+
+	return nil
+}
@@ -0,0 +1,19 @@
+// Package cache holds the pieces of the read-through cache: a Backend to keep
+// entries in, request coalescing for misses and invalidation across instances
+// through Postgres LISTEN/NOTIFY.
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Backend stores encoded entries. MemoryBackend is the default, a shared store
+// like Redis can be plugged in by implementing this interface.
+type Backend interface {
+	// Get returns false when the key is missing or expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// DeletePrefix removes every key starting with prefix, "" clears everything.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
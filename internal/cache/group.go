@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"errors"
+	"sync"
+)
+
+type call struct {
+	done  chan struct{}
+	value []byte
+	err   error
+}
+
+// Group coalesces concurrent loads of the same key, only the first caller runs
+// fn and the others wait for its result. A thundering herd on a hot key costs
+// one query instead of one per request.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Do runs fn once per key at a time. shared reports whether the result came
+// from another caller's load.
+func (g *Group) Do(key string, fn func() ([]byte, error)) (value []byte, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.value, c.err, true
+	}
+
+	c := &call{done: make(chan struct{}), err: errors.New("cache: load panicked")}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	// Deferred so waiters are released with an error even when fn panics.
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.value, c.err = fn()
+	return c.value, c.err, false
+}
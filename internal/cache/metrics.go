@@ -0,0 +1,28 @@
+package cache
+
+import "github.com/BramAristyo/rest-api-contact-person/pkg/metrics"
+
+// Metrics counts lookups per cache and operation, safe to use when nil.
+type Metrics struct {
+	hits   *metrics.CounterVec
+	misses *metrics.CounterVec
+}
+
+func NewMetrics(registry *metrics.Registry) *Metrics {
+	return &Metrics{
+		hits:   registry.NewCounterVec("cache_hits_total", "Cache lookups answered from the cache.", "cache", "operation"),
+		misses: registry.NewCounterVec("cache_misses_total", "Cache lookups that went to the database.", "cache", "operation"),
+	}
+}
+
+func (m *Metrics) Hit(cache string, operation string) {
+	if m != nil {
+		m.hits.Inc(cache, operation)
+	}
+}
+
+func (m *Metrics) Miss(cache string, operation string) {
+	if m != nil {
+		m.misses.Inc(cache, operation)
+	}
+}
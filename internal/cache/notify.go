@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// InvalidateAll is passed to the Listen handler after every (re)connect,
+// notifications sent while disconnected are lost so everything may be stale.
+const InvalidateAll = "*"
+
+const maxListenBackoff = 30 * time.Second
+
+// Notifier broadcasts invalidations to every instance through Postgres
+// NOTIFY on channel. Payloads are prefixed with the sending instance's id so
+// an instance skips its own messages, it already invalidated locally.
+type Notifier struct {
+	db      *pgxpool.Pool
+	channel string
+	origin  string
+}
+
+func NewNotifier(db *pgxpool.Pool, channel string) *Notifier {
+	var id [8]byte
+	rand.Read(id[:])
+
+	return &Notifier{db: db, channel: channel, origin: hex.EncodeToString(id[:])}
+}
+
+func (n *Notifier) Publish(ctx context.Context, payload string) error {
+	_, err := n.db.Exec(ctx, `SELECT pg_notify($1, $2)`, n.channel, n.origin+":"+payload)
+	return err
+}
+
+// Listen calls handle for every payload published by other instances until ctx
+// is done. It holds its own connection outside the pool and reconnects with
+// backoff when it drops.
+func (n *Notifier) Listen(ctx context.Context, handle func(payload string)) {
+	backoff := time.Second
+	for {
+		err := n.listen(ctx, handle, func() { backoff = time.Second })
+		if ctx.Err() != nil {
+			return
+		}
+
+		slog.Warn("cache: listen for invalidations", "channel", n.channel, "error", err, "retry_in", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, maxListenBackoff)
+	}
+}
+
+func (n *Notifier) listen(ctx context.Context, handle func(payload string), connected func()) error {
+	conn, err := pgx.ConnectConfig(ctx, n.db.Config().ConnConfig)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, `LISTEN `+pgx.Identifier{n.channel}.Sanitize()); err != nil {
+		return err
+	}
+	connected()
+	handle(InvalidateAll)
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		origin, payload, _ := strings.Cut(notification.Payload, ":")
+		if origin != n.origin {
+			handle(payload)
+		}
+	}
+}
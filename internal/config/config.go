@@ -1,34 +1,337 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net"
+	"net/url"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/jobs"
+	"github.com/BramAristyo/rest-api-contact-person/internal/reminders"
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DatabaseUrl string
-	AppPort     string
+	// DBDriver is one of postgres, sqlite or memory.
+	DBDriver string
+	// DatabaseUrl is DATABASE_URL, or built from the DB_* settings when that is unset.
+	DatabaseUrl   string
+	DBHost        string
+	DBPort        string
+	DBUser        string
+	DBPassword    string
+	DBName        string
+	DBSSLMode     string
+	DBSSLRootCert string
+	DBMaxConns    int
+	DBMinConns    int
+	// Connections are replaced after DBMaxConnLifetime and closed after being
+	// idle for DBMaxConnIdleTime, idle ones are checked every DBHealthCheckPeriod.
+	DBMaxConnLifetime   time.Duration
+	DBMaxConnIdleTime   time.Duration
+	DBHealthCheckPeriod time.Duration
+	DBConnectTimeout    time.Duration
+	// DBStartupTimeout is how long to keep retrying until Postgres is up on start.
+	DBStartupTimeout time.Duration
+	// DBQueryTimeout bounds every query, 0 disables it.
+	DBQueryTimeout time.Duration
+	DBReadRetries  int
+	// DBBreakerThreshold consecutive connection failures or statement timeouts
+	// make queries fail fast for DBBreakerCooldown, 0 disables the breaker.
+	DBBreakerThreshold int
+	DBBreakerCooldown  time.Duration
+	// DBReplicaUrls are read replicas, replicas lagging more than
+	// DBReplicaMaxLag behind are skipped. Clients read from the primary for
+	// DBStickyWindow after they wrote.
+	DBReplicaUrls        []string
+	DBReplicaMaxLag      time.Duration
+	DBReplicaCheckPeriod time.Duration
+	DBStickyWindow       time.Duration
+	SQLitePath           string
+	// MigrateOnStart applies pending migrations before the API starts serving.
+	MigrateOnStart bool
+
+	AppPort string
+	// TLSCertFile and TLSKeyFile make the API serve HTTPS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// ContactsAllLimit is the hard cap of rows streamed by GET /api/contacts/all.
+	ContactsAllLimit int
+	// CalendarRefreshInterval is how often subscribers should fetch the calendar feed.
+	CalendarRefreshInterval time.Duration
+	// RestoreMaxBytes replaces MaxBodyBytes for POST /api/restore and POST /api/imports.
+	RestoreMaxBytes int64
+	// BackupTimeout replaces the server read and write timeouts for backups and restores.
+	BackupTimeout time.Duration
+	// AdminToken is the bearer token of the backup and restore routes, they
+	// are disabled while it is empty.
+	AdminToken string
+
+	// JobWorkers is the number of jobs the API runs at the same time, 0 leaves
+	// them to cmd/worker. A job not heard of for JobVisibilityTimeout is taken
+	// over by another worker.
+	JobWorkers           int
+	JobPollInterval      time.Duration
+	JobVisibilityTimeout time.Duration
+	JobTimeout           time.Duration
+	JobMaxAttempts       int
+	JobRetention         time.Duration
+
+	// ReminderScheduler runs the reminder scheduler, only the instance holding
+	// its leader lock sends. ReminderNotifiers are some of log, webhook and smtp.
+	ReminderScheduler     bool
+	ReminderInterval      time.Duration
+	ReminderMaxAttempts   int
+	ReminderNotifiers     []string
+	ReminderNotifyTimeout time.Duration
+	ReminderWebhookURL    string
+	ReminderWebhookSecret string
+	// SMTP* are the mail server of the smtp notifier, without SMTPUsername
+	// it does not authenticate.
+	SMTPAddr     string
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+	SMTPTo       []string
+
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// ShutdownTimeout is how long in-flight requests get to finish after SIGINT/SIGTERM.
+	ShutdownTimeout time.Duration
+
+	// TracingExporter is one of none, stdout, file or otlp.
+	TracingExporter string
+	TracingFile     string
+	OTLPEndpoint    string
+	ServiceName     string
+
+	// RateLimitStore is one of none, memory or postgres. Limits are "rate:burst"
+	// and RateLimitRoutes a ";" separated list of "pattern=rate:burst".
+	RateLimitStore  string
+	RateLimitRead   string
+	RateLimitWrite  string
+	RateLimitRoutes string
+	// RateLimitAPIKeys are the X-API-Key values that get a budget of their
+	// own, other clients are limited by ip.
+	RateLimitAPIKeys []string
+
+	// CORSAllowedOrigins is a comma separated list of origins, "*" allows any.
+	CORSAllowedOrigins []string
+	CORSMaxAge         time.Duration
+	HSTS               bool
+	MaxBodyBytes       int64
+	// StrictJSON rejects unknown fields in request bodies.
+	StrictJSON bool
+
+	// Responses smaller than CompressionMinBytes are not worth compressing.
+	CompressionEnabled  bool
+	CompressionMinBytes int
+
+	// CacheBackend is one of none or memory. CacheNotify sends invalidations to
+	// the other instances through Postgres NOTIFY.
+	CacheBackend string
+	CacheSize    int
+	CacheTTL     time.Duration
+	CacheNotify  bool
+
+	// LogLevel is one of debug, info, warn or error and LogFormat json or text.
+	LogLevel  string
+	LogFormat string
+
+	// ConfigFile is the YAML or TOML file that was read, if any.
+	ConfigFile string
+
+	// values and sources record each setting as given and where it came from, for Print.
+	values  map[string]string
+	sources map[string]Source
+}
+
+// Source is where a setting's value came from. Later sources take precedence:
+// flags over env vars, env vars over the config file, the file over defaults.
+type Source string
+
+const (
+	SourceDefault Source = "default"
+	SourceFile    Source = "file"
+	SourceEnv     Source = "env"
+	SourceFlag    Source = "flag"
+	// SourceDerived marks DATABASE_URL built from the DB_* settings.
+	SourceDerived Source = "derived"
+)
+
+// ConfigFileEnv names the config file when the --config flag is not given.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// ValidationError lists every problem found, so they can be fixed in one go.
+type ValidationError struct {
+	Problems []string
 }
 
-func Load() *Config {
-	err := godotenv.Load(".env")
-	if err != nil {
-		fmt.Println("Error loading .env file, using environment variables: ", err)
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// RegisterFlags adds --config and one flag per setting to fs, e.g. --app-port
+// for APP_PORT. Pass the same fs to Load after parsing it.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.String("config", "", "YAML or TOML config file (env "+ConfigFileEnv+")")
+
+	for _, s := range settings {
+		fs.Var(&settingFlag{isBool: s.isBool}, s.flagName(), fmt.Sprintf("%s (env %s, default %q)", s.usage, s.key, s.def))
+	}
+}
+
+// Load reads the settings from defaults, the config file, the environment
+// (.env included) and flags, in increasing precedence, and validates them.
+// flags may be nil. On a *ValidationError the config is returned as well, so
+// it can still be printed.
+func Load(flags *flag.FlagSet) (*Config, error) {
+	// .env only fills variables the environment does not set already.
+	if err := godotenv.Load(".env"); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		slog.Warn("Error loading .env file, using environment variables", "error", err)
+	}
+
+	values := make(map[string]string, len(settings))
+	sources := make(map[string]Source, len(settings))
+	for _, s := range settings {
+		values[s.key], sources[s.key] = s.def, SourceDefault
+	}
+
+	var problems []string
+
+	path := os.Getenv(ConfigFileEnv)
+	if flags != nil {
+		if f := flags.Lookup("config"); f != nil && f.Value.String() != "" {
+			path = f.Value.String()
+		}
 	}
 
-	dbUrl := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=disable",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-	)
+	if path != "" {
+		fileValues, err := readFile(path)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
 
-	return &Config{
-		DatabaseUrl: dbUrl,
-		AppPort:     os.Getenv("APP_PORT"),
+		for _, key := range slices.Sorted(maps.Keys(fileValues)) {
+			if _, ok := lookupSetting(key); !ok {
+				problems = append(problems, fmt.Sprintf("%s: unknown setting %s", path, strings.ToLower(key)))
+				continue
+			}
+			values[key], sources[key] = fileValues[key], SourceFile
+		}
 	}
+
+	for _, s := range settings {
+		if value, ok := os.LookupEnv(s.key); ok && value != "" {
+			values[s.key], sources[s.key] = value, SourceEnv
+		}
+	}
+
+	if flags != nil {
+		flags.Visit(func(f *flag.Flag) {
+			for _, s := range settings {
+				if s.flagName() == f.Name {
+					values[s.key], sources[s.key] = f.Value.String(), SourceFlag
+				}
+			}
+		})
+	}
+
+	cfg := &Config{ConfigFile: path, values: values, sources: sources}
+	invalid := make(map[string]bool)
+	for _, s := range settings {
+		if err := s.apply(cfg, values[s.key]); err != nil {
+			invalid[s.key] = true
+			shown := values[s.key]
+			if s.secret {
+				shown = redacted
+			}
+			problems = append(problems, fmt.Sprintf("%s: %v, got %q from %s", s.key, err, shown, sources[s.key]))
+		}
+	}
+
+	if cfg.DatabaseUrl == "" {
+		cfg.DatabaseUrl = cfg.buildDatabaseUrl()
+		cfg.sources["DATABASE_URL"] = SourceDerived
+	}
+
+	problems = append(problems, cfg.validate(invalid)...)
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Problems: problems}
+	}
+
+	return cfg, nil
+}
+
+// buildDatabaseUrl escapes every part, so passwords with special characters work.
+func (c *Config) buildDatabaseUrl() string {
+	u := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(c.DBUser, c.DBPassword),
+		Host:   net.JoinHostPort(c.DBHost, c.DBPort),
+		Path:   "/" + c.DBName,
+	}
+	if c.DBPassword == "" {
+		u.User = url.User(c.DBUser)
+	}
+
+	query := url.Values{}
+	query.Set("sslmode", c.DBSSLMode)
+	if c.DBSSLRootCert != "" {
+		query.Set("sslrootcert", c.DBSSLRootCert)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// PoolConfig is the Postgres pool part of the config.
+func (c *Config) PoolConfig() database.PoolConfig {
+	return database.PoolConfig{
+		MaxConns:          int32(c.DBMaxConns),
+		MinConns:          int32(c.DBMinConns),
+		MaxConnLifetime:   c.DBMaxConnLifetime,
+		MaxConnIdleTime:   c.DBMaxConnIdleTime,
+		HealthCheckPeriod: c.DBHealthCheckPeriod,
+		ConnectTimeout:    c.DBConnectTimeout,
+		StartupTimeout:    c.DBStartupTimeout,
+		QueryTimeout:      c.DBQueryTimeout,
+		ReadRetries:       c.DBReadRetries,
+		BreakerThreshold:  c.DBBreakerThreshold,
+		BreakerCooldown:   c.DBBreakerCooldown,
+	}
+}
+
+func (c *Config) ReminderOptions() reminders.Options {
+	return reminders.Options{
+		Interval:    c.ReminderInterval,
+		Batch:       100,
+		MaxAttempts: c.ReminderMaxAttempts,
+	}
+}
+
+func (c *Config) JobOptions() jobs.Options {
+	return jobs.Options{
+		Concurrency:  c.JobWorkers,
+		PollInterval: c.JobPollInterval,
+		Lease:        c.JobVisibilityTimeout,
+		Timeout:      c.JobTimeout,
+		Retention:    c.JobRetention,
+	}
+}
+
+// Source tells where the setting named by its env var came from.
+func (c *Config) Source(key string) Source {
+	return c.sources[key]
 }
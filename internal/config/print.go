@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+)
+
+// Print writes the effective value and source of every setting, secrets are redacted.
+func (c *Config) Print(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SETTING\tVALUE\tSOURCE")
+	if c.ConfigFile != "" {
+		fmt.Fprintf(tw, "CONFIG_FILE\t%s\t\n", c.ConfigFile)
+	}
+
+	for _, s := range settings {
+		value := c.values[s.key]
+		switch {
+		case s.key == "DATABASE_URL":
+			// Shown even when derived, with the password hidden.
+			value = redacted
+			if u, err := url.Parse(c.DatabaseUrl); err == nil {
+				value = u.Redacted()
+			}
+		case s.key == "DB_REPLICA_URLS":
+			replicas := make([]string, len(c.DBReplicaUrls))
+			for i, replica := range c.DBReplicaUrls {
+				replicas[i] = redacted
+				if u, err := url.Parse(replica); err == nil {
+					replicas[i] = u.Redacted()
+				}
+			}
+			value = strings.Join(replicas, ",")
+		case s.secret && value != "":
+			value = redacted
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.key, value, c.sources[s.key])
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,213 @@
+package config
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const redacted = "****"
+
+// setting is one configuration value. key is the env var, the flag is the
+// same in kebab case (--app-port) and the file key in snake case, either flat
+// (app_port) or nested (app: {port: ...}).
+type setting struct {
+	key    string
+	def    string
+	usage  string
+	secret bool
+	isBool bool
+	apply  func(c *Config, value string) error
+}
+
+func (s setting) flagName() string {
+	return strings.ToLower(strings.ReplaceAll(s.key, "_", "-"))
+}
+
+func lookupSetting(key string) (setting, bool) {
+	for _, s := range settings {
+		if s.key == key {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+var settings = []setting{
+	{key: "DB_DRIVER", def: "postgres", usage: "storage for contacts and groups: postgres, sqlite or memory", apply: stringValue(func(c *Config) *string { return &c.DBDriver })},
+	{key: "DATABASE_URL", usage: "Postgres connection URL, overrides the DB_* settings", secret: true, apply: stringValue(func(c *Config) *string { return &c.DatabaseUrl })},
+	{key: "DB_HOST", def: "localhost", usage: "Postgres host", apply: stringValue(func(c *Config) *string { return &c.DBHost })},
+	{key: "DB_PORT", def: "5432", usage: "Postgres port", apply: stringValue(func(c *Config) *string { return &c.DBPort })},
+	{key: "DB_USER", usage: "Postgres user", apply: stringValue(func(c *Config) *string { return &c.DBUser })},
+	{key: "DB_PASSWORD", usage: "Postgres password", secret: true, apply: stringValue(func(c *Config) *string { return &c.DBPassword })},
+	{key: "DB_NAME", usage: "Postgres database", apply: stringValue(func(c *Config) *string { return &c.DBName })},
+	{key: "DB_SSLMODE", def: "prefer", usage: "Postgres sslmode: disable, allow, prefer, require, verify-ca or verify-full", apply: stringValue(func(c *Config) *string { return &c.DBSSLMode })},
+	{key: "DB_SSLROOTCERT", usage: "CA certificate file to verify the Postgres server with", apply: stringValue(func(c *Config) *string { return &c.DBSSLRootCert })},
+	{key: "DB_MAX_CONNS", def: "10", usage: "maximum connections in the Postgres pool", apply: intValue(func(c *Config) *int { return &c.DBMaxConns })},
+	{key: "DB_MIN_CONNS", def: "0", usage: "connections the Postgres pool keeps open when idle", apply: intValue(func(c *Config) *int { return &c.DBMinConns })},
+	{key: "DB_MAX_CONN_LIFETIME", def: "1h", usage: "age after which a Postgres connection is closed and replaced", apply: durationValue(func(c *Config) *time.Duration { return &c.DBMaxConnLifetime })},
+	{key: "DB_MAX_CONN_IDLE_TIME", def: "30m", usage: "idle time after which a Postgres connection is closed", apply: durationValue(func(c *Config) *time.Duration { return &c.DBMaxConnIdleTime })},
+	{key: "DB_HEALTH_CHECK_PERIOD", def: "1m", usage: "how often idle Postgres connections are checked", apply: durationValue(func(c *Config) *time.Duration { return &c.DBHealthCheckPeriod })},
+	{key: "DB_CONNECT_TIMEOUT", def: "5s", usage: "time a single Postgres connection attempt may take", apply: durationValue(func(c *Config) *time.Duration { return &c.DBConnectTimeout })},
+	{key: "DB_STARTUP_TIMEOUT", def: "30s", usage: "how long to keep retrying until Postgres is up on start", apply: durationValue(func(c *Config) *time.Duration { return &c.DBStartupTimeout })},
+	{key: "DB_QUERY_TIMEOUT", def: "5s", usage: "statement timeout of every query, 0 disables it", apply: durationValue(func(c *Config) *time.Duration { return &c.DBQueryTimeout })},
+	{key: "DB_READ_RETRIES", def: "3", usage: "retries of reads that failed with a serialization failure or a broken connection", apply: intValue(func(c *Config) *int { return &c.DBReadRetries })},
+	{key: "DB_BREAKER_THRESHOLD", def: "5", usage: "consecutive connection failures or statement timeouts that open the circuit breaker, 0 disables it", apply: intValue(func(c *Config) *int { return &c.DBBreakerThreshold })},
+	{key: "DB_BREAKER_COOLDOWN", def: "10s", usage: "how long the open circuit breaker fails queries fast", apply: durationValue(func(c *Config) *time.Duration { return &c.DBBreakerCooldown })},
+	{key: "DB_REPLICA_URLS", usage: "comma separated Postgres read replica URLs", secret: true, apply: listValue(func(c *Config) *[]string { return &c.DBReplicaUrls })},
+	{key: "DB_REPLICA_MAX_LAG", def: "5s", usage: "replication lag past which a replica gets no reads", apply: durationValue(func(c *Config) *time.Duration { return &c.DBReplicaMaxLag })},
+	{key: "DB_REPLICA_CHECK_PERIOD", def: "2s", usage: "how often the lag of every replica is checked", apply: durationValue(func(c *Config) *time.Duration { return &c.DBReplicaCheckPeriod })},
+	{key: "DB_STICKY_WINDOW", def: "10s", usage: "how long a client reads from the primary after it wrote", apply: durationValue(func(c *Config) *time.Duration { return &c.DBStickyWindow })},
+	{key: "SQLITE_PATH", def: "contacts.db", usage: "SQLite database file for DB_DRIVER=sqlite", apply: stringValue(func(c *Config) *string { return &c.SQLitePath })},
+	{key: "MIGRATE_ON_START", def: "false", usage: "apply pending migrations before serving", isBool: true, apply: boolValue(func(c *Config) *bool { return &c.MigrateOnStart })},
+
+	{key: "APP_PORT", def: "5000", usage: "port the API listens on", apply: stringValue(func(c *Config) *string { return &c.AppPort })},
+	{key: "TLS_CERT_FILE", usage: "certificate file, serves HTTPS together with TLS_KEY_FILE", apply: stringValue(func(c *Config) *string { return &c.TLSCertFile })},
+	{key: "TLS_KEY_FILE", usage: "private key file of TLS_CERT_FILE", apply: stringValue(func(c *Config) *string { return &c.TLSKeyFile })},
+	{key: "CONTACTS_ALL_LIMIT", def: "50000", usage: "maximum rows streamed by GET /api/contacts/all", apply: intValue(func(c *Config) *int { return &c.ContactsAllLimit })},
+	{key: "CALENDAR_REFRESH_INTERVAL", def: "12h", usage: "how often calendar apps are asked to fetch GET /api/calendar.ics again", apply: durationValue(func(c *Config) *time.Duration { return &c.CalendarRefreshInterval })},
+	{key: "RESTORE_MAX_BYTES", def: "104857600", usage: "largest archive accepted by POST /api/restore and POST /api/imports", apply: int64Value(func(c *Config) *int64 { return &c.RestoreMaxBytes })},
+	{key: "BACKUP_TIMEOUT", def: "10m", usage: "time a backup or restore may take, instead of the server timeouts", apply: durationValue(func(c *Config) *time.Duration { return &c.BackupTimeout })},
+	{key: "ADMIN_TOKEN", usage: "bearer token of GET /api/backup and POST /api/restore, both are disabled when empty", secret: true, apply: stringValue(func(c *Config) *string { return &c.AdminToken })},
+	{key: "JOB_WORKERS", def: "2", usage: "background jobs the API runs at the same time, 0 leaves them to cmd/worker", apply: intValue(func(c *Config) *int { return &c.JobWorkers })},
+	{key: "JOB_POLL_INTERVAL", def: "1s", usage: "how often an idle worker looks for jobs", apply: durationValue(func(c *Config) *time.Duration { return &c.JobPollInterval })},
+	{key: "JOB_VISIBILITY_TIMEOUT", def: "1m", usage: "time after which a job not heard of is taken over by another worker", apply: durationValue(func(c *Config) *time.Duration { return &c.JobVisibilityTimeout })},
+	{key: "JOB_TIMEOUT", def: "30m", usage: "time a single attempt of a job may take", apply: durationValue(func(c *Config) *time.Duration { return &c.JobTimeout })},
+	{key: "JOB_MAX_ATTEMPTS", def: "3", usage: "times a failing job is tried", apply: intValue(func(c *Config) *int { return &c.JobMaxAttempts })},
+	{key: "JOB_RETENTION", def: "168h", usage: "how long finished jobs and their files are kept", apply: durationValue(func(c *Config) *time.Duration { return &c.JobRetention })},
+	{key: "REMINDER_SCHEDULER", def: "true", usage: "send due reminders from this instance when it holds the leader lock", isBool: true, apply: boolValue(func(c *Config) *bool { return &c.ReminderScheduler })},
+	{key: "REMINDER_INTERVAL", def: "30s", usage: "how often the scheduler looks for due reminders", apply: durationValue(func(c *Config) *time.Duration { return &c.ReminderInterval })},
+	{key: "REMINDER_MAX_ATTEMPTS", def: "5", usage: "times sending a due reminder is tried", apply: intValue(func(c *Config) *int { return &c.ReminderMaxAttempts })},
+	{key: "REMINDER_NOTIFIERS", def: "log", usage: "comma separated notifiers due reminders are sent to: log, webhook, smtp", apply: listValue(func(c *Config) *[]string { return &c.ReminderNotifiers })},
+	{key: "REMINDER_NOTIFY_TIMEOUT", def: "10s", usage: "time a webhook or mail of a reminder may take", apply: durationValue(func(c *Config) *time.Duration { return &c.ReminderNotifyTimeout })},
+	{key: "REMINDER_WEBHOOK_URL", usage: "URL the webhook notifier POSTs due reminders to", apply: stringValue(func(c *Config) *string { return &c.ReminderWebhookURL })},
+	{key: "REMINDER_WEBHOOK_SECRET", usage: "key of the X-Signature HMAC of webhook bodies, unsigned when empty", secret: true, apply: stringValue(func(c *Config) *string { return &c.ReminderWebhookSecret })},
+	{key: "SMTP_ADDR", def: "localhost:1025", usage: "host:port of the mail server of the smtp notifier", apply: stringValue(func(c *Config) *string { return &c.SMTPAddr })},
+	{key: "SMTP_USERNAME", usage: "mail server user, no authentication when empty", apply: stringValue(func(c *Config) *string { return &c.SMTPUsername })},
+	{key: "SMTP_PASSWORD", usage: "mail server password", secret: true, apply: stringValue(func(c *Config) *string { return &c.SMTPPassword })},
+	{key: "SMTP_FROM", def: "reminders@localhost", usage: "sender of reminder mails", apply: stringValue(func(c *Config) *string { return &c.SMTPFrom })},
+	{key: "SMTP_TO", usage: "comma separated recipients of reminder mails", apply: listValue(func(c *Config) *[]string { return &c.SMTPTo })},
+	{key: "SERVER_READ_TIMEOUT", def: "10s", usage: "time to read a request", apply: durationValue(func(c *Config) *time.Duration { return &c.ReadTimeout })},
+	{key: "SERVER_WRITE_TIMEOUT", def: "30s", usage: "time to write a response", apply: durationValue(func(c *Config) *time.Duration { return &c.WriteTimeout })},
+	{key: "SERVER_IDLE_TIMEOUT", def: "120s", usage: "time a keep-alive connection may stay idle", apply: durationValue(func(c *Config) *time.Duration { return &c.IdleTimeout })},
+	{key: "SERVER_SHUTDOWN_TIMEOUT", def: "15s", usage: "time in-flight requests get to finish on shutdown", apply: durationValue(func(c *Config) *time.Duration { return &c.ShutdownTimeout })},
+
+	{key: "TRACING_EXPORTER", def: "none", usage: "where spans go: none, stdout, file or otlp", apply: stringValue(func(c *Config) *string { return &c.TracingExporter })},
+	{key: "TRACING_FILE", def: "traces.jsonl", usage: "file for TRACING_EXPORTER=file", apply: stringValue(func(c *Config) *string { return &c.TracingFile })},
+	{key: "OTLP_ENDPOINT", def: "http://localhost:4318/v1/traces", usage: "OTLP/HTTP endpoint for TRACING_EXPORTER=otlp", apply: stringValue(func(c *Config) *string { return &c.OTLPEndpoint })},
+	{key: "SERVICE_NAME", def: "rest-api-contact-person", usage: "service name reported with traces", apply: stringValue(func(c *Config) *string { return &c.ServiceName })},
+
+	{key: "RATE_LIMIT_STORE", def: "memory", usage: "token buckets store: none, memory or postgres", apply: stringValue(func(c *Config) *string { return &c.RateLimitStore })},
+	{key: "RATE_LIMIT_READ", def: "20:40", usage: "rate:burst for GET requests", apply: stringValue(func(c *Config) *string { return &c.RateLimitRead })},
+	{key: "RATE_LIMIT_WRITE", def: "5:10", usage: "rate:burst for other requests", apply: stringValue(func(c *Config) *string { return &c.RateLimitWrite })},
+	{key: "RATE_LIMIT_ROUTES", def: "GET /api/contacts/all=0.2:2;GET /api/backup=0.05:2;POST /api/restore=0.05:2;POST /api/exports=0.05:2;POST /api/imports=0.05:2", usage: `";" separated "pattern=rate:burst" overrides`, apply: stringValue(func(c *Config) *string { return &c.RateLimitRoutes })},
+	{key: "RATE_LIMIT_API_KEYS", usage: "comma separated X-API-Key values limited per key instead of per ip", secret: true, apply: listValue(func(c *Config) *[]string { return &c.RateLimitAPIKeys })},
+
+	{key: "CORS_ALLOWED_ORIGINS", usage: `comma separated origins, "*" allows any`, apply: listValue(func(c *Config) *[]string { return &c.CORSAllowedOrigins })},
+	{key: "CORS_MAX_AGE", def: "10m", usage: "how long browsers cache a preflight response", apply: durationValue(func(c *Config) *time.Duration { return &c.CORSMaxAge })},
+	{key: "HSTS", def: "true", usage: "send Strict-Transport-Security", isBool: true, apply: boolValue(func(c *Config) *bool { return &c.HSTS })},
+	{key: "MAX_BODY_BYTES", def: "1048576", usage: "largest accepted request body", apply: int64Value(func(c *Config) *int64 { return &c.MaxBodyBytes })},
+	{key: "STRICT_JSON", def: "false", usage: "reject unknown fields in request bodies", isBool: true, apply: boolValue(func(c *Config) *bool { return &c.StrictJSON })},
+
+	{key: "COMPRESSION_ENABLED", def: "true", usage: "compress responses", isBool: true, apply: boolValue(func(c *Config) *bool { return &c.CompressionEnabled })},
+	{key: "COMPRESSION_MIN_BYTES", def: "1024", usage: "smallest response body that gets compressed", apply: intValue(func(c *Config) *int { return &c.CompressionMinBytes })},
+
+	{key: "CACHE_BACKEND", def: "memory", usage: "contact read cache: none or memory", apply: stringValue(func(c *Config) *string { return &c.CacheBackend })},
+	{key: "CACHE_SIZE", def: "10000", usage: "maximum cached entries", apply: intValue(func(c *Config) *int { return &c.CacheSize })},
+	{key: "CACHE_TTL", def: "1m", usage: "how long a cached entry is served", apply: durationValue(func(c *Config) *time.Duration { return &c.CacheTTL })},
+	{key: "CACHE_NOTIFY", def: "true", usage: "invalidate other instances through Postgres NOTIFY", isBool: true, apply: boolValue(func(c *Config) *bool { return &c.CacheNotify })},
+
+	{key: "LOG_LEVEL", def: "info", usage: "debug, info, warn or error", apply: stringValue(func(c *Config) *string { return &c.LogLevel })},
+	{key: "LOG_FORMAT", def: "json", usage: "json or text", apply: stringValue(func(c *Config) *string { return &c.LogFormat })},
+}
+
+func stringValue(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = strings.TrimSpace(value)
+		return nil
+	}
+}
+
+func intValue(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func int64Value(field func(c *Config) *int64) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// boolValue accepts the values of strconv.ParseBool.
+func boolValue(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+// durationValue parses values like "10s" or "1m".
+func durationValue(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return errors.New(`must be a duration like "10s" or "1m"`)
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+// listValue splits a comma separated value, empty entries are dropped.
+func listValue(field func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		var values []string
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*field(c) = values
+		return nil
+	}
+}
+
+// settingFlag only records the raw value, Load parses it like the other sources.
+type settingFlag struct {
+	value  string
+	isBool bool
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *settingFlag) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be passed as --hsts instead of --hsts=true.
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.isBool
+}
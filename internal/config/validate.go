@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validate checks values that parsed but make no sense, and combinations of
+// settings. Keys in invalid already have a problem reported and are skipped.
+func (c *Config) validate(invalid map[string]bool) []string {
+	var problems []string
+	add := func(key string, format string, args ...interface{}) {
+		if !invalid[key] {
+			problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	oneOf := func(key string, value string, allowed ...string) {
+		if !slices.Contains(allowed, value) {
+			add(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+		}
+	}
+	positive := func(key string, value int64) {
+		if value <= 0 {
+			add(key, "must be greater than 0, got %d", value)
+		}
+	}
+
+	oneOf("DB_DRIVER", c.DBDriver, "postgres", "sqlite", "memory")
+	if c.DBDriver == "postgres" {
+		if c.sources["DATABASE_URL"] == SourceDerived {
+			for _, required := range []struct{ key, value string }{{"DB_HOST", c.DBHost}, {"DB_USER", c.DBUser}, {"DB_NAME", c.DBName}} {
+				if required.value == "" {
+					add(required.key, "is required with DB_DRIVER=postgres unless DATABASE_URL is set")
+				}
+			}
+			if !validPort(c.DBPort) {
+				add("DB_PORT", "must be a port number between 1 and 65535, got %q", c.DBPort)
+			}
+		} else if u, err := url.Parse(c.DatabaseUrl); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+			add("DATABASE_URL", "must be a postgres:// URL")
+		}
+
+		oneOf("DB_SSLMODE", c.DBSSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full")
+		positive("DB_MAX_CONNS", int64(c.DBMaxConns))
+		if c.DBMinConns < 0 || c.DBMinConns > c.DBMaxConns {
+			add("DB_MIN_CONNS", "must be between 0 and DB_MAX_CONNS (%d), got %d", c.DBMaxConns, c.DBMinConns)
+		}
+		fileExists(&problems, "DB_SSLROOTCERT", c.DBSSLRootCert)
+
+		positive("DB_MAX_CONN_LIFETIME", int64(c.DBMaxConnLifetime))
+		positive("DB_MAX_CONN_IDLE_TIME", int64(c.DBMaxConnIdleTime))
+		positive("DB_HEALTH_CHECK_PERIOD", int64(c.DBHealthCheckPeriod))
+		positive("DB_CONNECT_TIMEOUT", int64(c.DBConnectTimeout))
+		if c.DBStartupTimeout < 0 {
+			add("DB_STARTUP_TIMEOUT", "must not be negative, got %s", c.DBStartupTimeout)
+		}
+		if c.DBQueryTimeout < 0 {
+			add("DB_QUERY_TIMEOUT", "must not be negative, 0 disables it, got %s", c.DBQueryTimeout)
+		}
+		if c.DBReadRetries < 0 {
+			add("DB_READ_RETRIES", "must not be negative, got %d", c.DBReadRetries)
+		}
+		if c.DBBreakerThreshold < 0 {
+			add("DB_BREAKER_THRESHOLD", "must not be negative, 0 disables the breaker, got %d", c.DBBreakerThreshold)
+		}
+		if c.DBBreakerThreshold > 0 {
+			positive("DB_BREAKER_COOLDOWN", int64(c.DBBreakerCooldown))
+		}
+
+		for _, replica := range c.DBReplicaUrls {
+			if u, err := url.Parse(replica); err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+				add("DB_REPLICA_URLS", "must be postgres:// URLs")
+				break
+			}
+		}
+		if len(c.DBReplicaUrls) > 0 {
+			positive("DB_REPLICA_MAX_LAG", int64(c.DBReplicaMaxLag))
+			positive("DB_REPLICA_CHECK_PERIOD", int64(c.DBReplicaCheckPeriod))
+			// Within the window a replica may still miss the client's write.
+			if c.DBStickyWindow < c.DBReplicaMaxLag+c.DBReplicaCheckPeriod {
+				add("DB_STICKY_WINDOW", "must be at least DB_REPLICA_MAX_LAG + DB_REPLICA_CHECK_PERIOD (%s), got %s", c.DBReplicaMaxLag+c.DBReplicaCheckPeriod, c.DBStickyWindow)
+			}
+		}
+	} else if len(c.DBReplicaUrls) > 0 {
+		add("DB_REPLICA_URLS", "needs DB_DRIVER=postgres")
+	}
+	if c.DBDriver == "sqlite" && c.SQLitePath == "" {
+		add("SQLITE_PATH", "is required with DB_DRIVER=sqlite")
+	}
+
+	if !validPort(c.AppPort) {
+		add("APP_PORT", "must be a port number between 1 and 65535, got %q", c.AppPort)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		add("TLS_CERT_FILE", "and TLS_KEY_FILE must be set together")
+	}
+	fileExists(&problems, "TLS_CERT_FILE", c.TLSCertFile)
+	fileExists(&problems, "TLS_KEY_FILE", c.TLSKeyFile)
+
+	positive("CONTACTS_ALL_LIMIT", int64(c.ContactsAllLimit))
+	positive("CALENDAR_REFRESH_INTERVAL", int64(c.CalendarRefreshInterval))
+	positive("RESTORE_MAX_BYTES", c.RestoreMaxBytes)
+	positive("BACKUP_TIMEOUT", int64(c.BackupTimeout))
+	if c.JobWorkers < 0 {
+		add("JOB_WORKERS", "must not be negative, 0 leaves jobs to cmd/worker, got %d", c.JobWorkers)
+	}
+	positive("JOB_POLL_INTERVAL", int64(c.JobPollInterval))
+	// The lease is renewed every third of it.
+	if c.JobVisibilityTimeout < 3*time.Second {
+		add("JOB_VISIBILITY_TIMEOUT", "must be at least 3s, got %s", c.JobVisibilityTimeout)
+	}
+	positive("JOB_TIMEOUT", int64(c.JobTimeout))
+	positive("JOB_MAX_ATTEMPTS", int64(c.JobMaxAttempts))
+	positive("JOB_RETENTION", int64(c.JobRetention))
+	positive("REMINDER_INTERVAL", int64(c.ReminderInterval))
+	positive("REMINDER_MAX_ATTEMPTS", int64(c.ReminderMaxAttempts))
+	positive("REMINDER_NOTIFY_TIMEOUT", int64(c.ReminderNotifyTimeout))
+	if len(c.ReminderNotifiers) == 0 {
+		add("REMINDER_NOTIFIERS", "must name at least one of log, webhook, smtp")
+	}
+	for _, notifier := range c.ReminderNotifiers {
+		oneOf("REMINDER_NOTIFIERS", notifier, "log", "webhook", "smtp")
+	}
+	if slices.Contains(c.ReminderNotifiers, "webhook") {
+		if u, err := url.Parse(c.ReminderWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("REMINDER_WEBHOOK_URL", "must be an http(s) URL with REMINDER_NOTIFIERS=webhook, got %q", c.ReminderWebhookURL)
+		}
+	}
+	if slices.Contains(c.ReminderNotifiers, "smtp") {
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			add("SMTP_ADDR", "must be host:port, got %q", c.SMTPAddr)
+		}
+		if c.SMTPFrom == "" {
+			add("SMTP_FROM", "is required with REMINDER_NOTIFIERS=smtp")
+		}
+		if len(c.SMTPTo) == 0 {
+			add("SMTP_TO", "is required with REMINDER_NOTIFIERS=smtp")
+		}
+	}
+	positive("SERVER_READ_TIMEOUT", int64(c.ReadTimeout))
+	positive("SERVER_WRITE_TIMEOUT", int64(c.WriteTimeout))
+	positive("SERVER_IDLE_TIMEOUT", int64(c.IdleTimeout))
+	positive("SERVER_SHUTDOWN_TIMEOUT", int64(c.ShutdownTimeout))
+
+	oneOf("TRACING_EXPORTER", c.TracingExporter, "none", "stdout", "file", "otlp")
+	if c.TracingExporter == "file" && c.TracingFile == "" {
+		add("TRACING_FILE", "is required with TRACING_EXPORTER=file")
+	}
+	if c.TracingExporter == "otlp" {
+		if u, err := url.Parse(c.OTLPEndpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			add("OTLP_ENDPOINT", "must be an http(s) URL, got %q", c.OTLPEndpoint)
+		}
+	}
+
+	oneOf("RATE_LIMIT_STORE", c.RateLimitStore, "none", "memory", "postgres")
+	if c.RateLimitStore == "postgres" && c.DBDriver != "postgres" {
+		add("RATE_LIMIT_STORE", "postgres needs DB_DRIVER=postgres")
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "") {
+			add("CORS_ALLOWED_ORIGINS", "%q is not an origin like https://example.com", origin)
+		}
+	}
+	if c.CORSMaxAge < 0 {
+		add("CORS_MAX_AGE", "must not be negative")
+	}
+	positive("MAX_BODY_BYTES", c.MaxBodyBytes)
+	if c.CompressionMinBytes < 0 {
+		add("COMPRESSION_MIN_BYTES", "must not be negative")
+	}
+
+	oneOf("CACHE_BACKEND", c.CacheBackend, "none", "memory")
+	if c.CacheBackend != "none" {
+		positive("CACHE_SIZE", int64(c.CacheSize))
+		positive("CACHE_TTL", int64(c.CacheTTL))
+	}
+
+	oneOf("LOG_LEVEL", strings.ToLower(c.LogLevel), "debug", "info", "warn", "error")
+	oneOf("LOG_FORMAT", c.LogFormat, "json", "text")
+
+	return problems
+}
+
+func validPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 1 && n <= 65535
+}
+
+func fileExists(problems *[]string, key string, path string) {
+	if path == "" {
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		*problems = append(*problems, fmt.Sprintf("%s: %v", key, err))
+	}
+}
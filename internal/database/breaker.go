@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// breaker opens after threshold consecutive connection failures or statement
+// timeouts and then rejects every query until cooldown has passed. After that
+// a single query is let through as a probe, its outcome closes or reopens the
+// breaker. A probe that does not report back within cooldown, e.g. a QueryRow
+// that is never scanned, is given up on and the next query probes instead.
+// Errors that come from a reachable database, e.g. a unique violation, count
+// as successes. A threshold of 0 disables the breaker.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+	probedAt time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing && time.Since(b.probedAt) < b.cooldown || time.Since(b.openedAt) < b.cooldown {
+		return false
+	}
+
+	b.probing = true
+	b.probedAt = time.Now()
+	return true
+}
+
+func (b *breaker) record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	switch {
+	case connectionError(err) || errors.Is(err, errStatementTimeout):
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openedAt = time.Now()
+		}
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// The caller gave up, that says nothing about the database.
+	default:
+		b.failures = 0
+	}
+}
+
+func (b *breaker) state() string {
+	if b.threshold <= 0 {
+		return breakerClosed
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.failures < b.threshold:
+		return breakerClosed
+	case time.Since(b.openedAt) < b.cooldown:
+		return breakerOpen
+	default:
+		return breakerHalfOpen
+	}
+}
+
+// retryable tells whether running an idempotent read again may succeed.
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	// 40001 serialization_failure, 40P01 deadlock_detected.
+	if errors.As(err, &pgErr) && (pgErr.Code == "40001" || pgErr.Code == "40P01") {
+		return true
+	}
+	return connectionError(err)
+}
+
+// connectionError tells whether err means the database could not be reached
+// or the connection broke, as opposed to the database rejecting the query.
+func connectionError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// Class 08 connection_exception, 57P01-57P03 the server is shutting
+		// down or not accepting connections yet.
+		return strings.HasPrefix(pgErr.Code, "08") || pgErr.Code == "57P01" || pgErr.Code == "57P02" || pgErr.Code == "57P03"
+	}
+
+	var connectErr *pgconn.ConnectError
+	var netErr net.Error
+	return errors.As(err, &connectErr) ||
+		errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		pgconn.SafeToRetry(err)
+}
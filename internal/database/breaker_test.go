@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+const testCooldown = 20 * time.Millisecond
+
+// openBreaker returns a breaker with a threshold of 2 that has just opened.
+func openBreaker(t *testing.T) *breaker {
+	t.Helper()
+
+	b := newBreaker(2, testCooldown)
+	for range 2 {
+		if !b.allow() {
+			t.Fatal("closed breaker rejected a query")
+		}
+		b.record(io.EOF)
+	}
+	if b.allow() || b.state() != breakerOpen {
+		t.Fatalf("breaker is %s after 2 connection failures, want open", b.state())
+	}
+	return b
+}
+
+func TestBreaker(t *testing.T) {
+	t.Run("failures that are not about the connection do not open it", func(t *testing.T) {
+		b := newBreaker(2, testCooldown)
+		for _, err := range []error{io.EOF, errors.New("unique violation"), io.EOF, context.Canceled, context.DeadlineExceeded} {
+			b.allow()
+			b.record(err)
+		}
+		if b.state() != breakerClosed {
+			t.Fatalf("breaker is %s, want closed", b.state())
+		}
+	})
+
+	t.Run("statement timeouts open it", func(t *testing.T) {
+		b := newBreaker(2, testCooldown)
+		for range 2 {
+			b.allow()
+			b.record(errStatementTimeout)
+		}
+		if b.state() != breakerOpen {
+			t.Fatalf("breaker is %s, want open", b.state())
+		}
+	})
+
+	t.Run("a successful probe closes it", func(t *testing.T) {
+		b := openBreaker(t)
+		time.Sleep(testCooldown)
+
+		if b.state() != breakerHalfOpen || !b.allow() {
+			t.Fatalf("breaker is %s after the cooldown, want a half-open probe", b.state())
+		}
+		if b.allow() {
+			t.Fatal("a second query was let through while probing")
+		}
+		b.record(nil)
+		if b.state() != breakerClosed || !b.allow() {
+			t.Fatalf("breaker is %s after a good probe, want closed", b.state())
+		}
+	})
+
+	t.Run("a failed probe reopens it", func(t *testing.T) {
+		b := openBreaker(t)
+		time.Sleep(testCooldown)
+
+		b.allow()
+		b.record(io.EOF)
+		if b.state() != breakerOpen || b.allow() {
+			t.Fatalf("breaker is %s after a failed probe, want open", b.state())
+		}
+	})
+
+	t.Run("a probe that never reports back is given up on", func(t *testing.T) {
+		b := openBreaker(t)
+		time.Sleep(testCooldown)
+
+		if !b.allow() {
+			t.Fatal("no probe after the cooldown")
+		}
+		// E.g. a QueryRow that is never scanned.
+		if b.allow() {
+			t.Fatal("a second query was let through while probing")
+		}
+		time.Sleep(testCooldown)
+		if !b.allow() {
+			t.Fatal("a lost probe blocks the breaker")
+		}
+	})
+
+	t.Run("threshold 0 disables it", func(t *testing.T) {
+		b := newBreaker(0, testCooldown)
+		for range 5 {
+			b.record(io.EOF)
+		}
+		if !b.allow() || b.state() != breakerClosed {
+			t.Fatalf("disabled breaker is %s", b.state())
+		}
+	})
+}
+
+func TestOutcome(t *testing.T) {
+	d := &DB{queryTimeout: time.Millisecond}
+
+	ctx, cancel := d.withTimeout(context.Background())
+	defer cancel()
+	<-ctx.Done()
+	if err := outcome(ctx, ctx.Err()); err != errStatementTimeout {
+		t.Fatalf("statement timeout is %v, want errStatementTimeout", err)
+	}
+
+	// The caller's own deadline passes first, that is not the database's fault.
+	parent, cancelParent := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancelParent()
+	<-parent.Done()
+	ctx, cancel = d.withTimeout(parent)
+	defer cancel()
+	if err := outcome(ctx, ctx.Err()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("caller deadline is %v, want context.DeadlineExceeded", err)
+	}
+
+	if err := outcome(context.Background(), nil); err != nil {
+		t.Fatalf("success is %v", err)
+	}
+}
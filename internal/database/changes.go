@@ -0,0 +1,15 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SkipChangeTracking turns off the triggers recording contact history and
+// keeping last_contacted_at for the rest of tx. Restores and the seeder write
+// rows that carry both already, or that have no history worth keeping.
+func SkipChangeTracking(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `SET LOCAL contacts.track_changes = 'off'`)
+	return err
+}
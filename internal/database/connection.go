@@ -2,20 +2,112 @@ package database
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func Connect(dbUrl string) *pgxpool.Pool {
-	pool, err := pgxpool.New(context.Background(), dbUrl)
+// maxConnectDelay caps the backoff between connection attempts on startup.
+const maxConnectDelay = 5 * time.Second
+
+// PoolConfig sizes and tunes the connection pool. Zero durations keep the
+// pgxpool defaults, except QueryTimeout where 0 means no statement timeout.
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	MaxConnIdleTime   time.Duration
+	HealthCheckPeriod time.Duration
+	// ConnectTimeout bounds a single connection attempt.
+	ConnectTimeout time.Duration
+	// StartupTimeout is how long Connect keeps retrying until the database is up.
+	StartupTimeout time.Duration
+
+	QueryTimeout time.Duration
+	// ReadRetries is how often DB.Read runs a read again after a transient error.
+	ReadRetries int
+	// The breaker opens after BreakerThreshold consecutive connection failures
+	// or statement timeouts and fails fast for BreakerCooldown, 0 disables it.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Connect opens the pool and waits for the database to answer a ping, retrying
+// with backoff for up to StartupTimeout, e.g. while Postgres is still starting
+// next to the API.
+func Connect(ctx context.Context, dbUrl string, poolConfig PoolConfig) (*DB, error) {
+	pool, err := newPool(ctx, dbUrl, poolConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(poolConfig.StartupTimeout)
+	delay := 250 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := pool.Ping(ctx)
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil || time.Now().Add(delay).After(deadline) {
+			pool.Close()
+			return nil, fmt.Errorf("database unreachable after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("Database not ready, retrying", "attempt", attempt, "retry_in", delay.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxConnectDelay)
+	}
+
+	return newDB(pool, poolConfig), nil
+}
+
+// newPool configures the pool, connections are only opened once it is used.
+func newPool(ctx context.Context, dbUrl string, poolConfig PoolConfig) (*pgxpool.Pool, error) {
+	config, err := pgxpool.ParseConfig(dbUrl)
 	if err != nil {
-		log.Fatal("Database connected unsuccessfully:", err)
+		return nil, fmt.Errorf("invalid database url: %w", err)
+	}
+
+	config.MaxConns = poolConfig.MaxConns
+	config.MinConns = poolConfig.MinConns
+	if poolConfig.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = poolConfig.MaxConnLifetime
+		// Connections opened together should not all be recycled together.
+		config.MaxConnLifetimeJitter = poolConfig.MaxConnLifetime / 10
+	}
+	if poolConfig.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = poolConfig.MaxConnIdleTime
+	}
+	if poolConfig.HealthCheckPeriod > 0 {
+		config.HealthCheckPeriod = poolConfig.HealthCheckPeriod
 	}
+	if poolConfig.ConnectTimeout > 0 {
+		config.ConnConfig.ConnectTimeout = poolConfig.ConnectTimeout
+	}
+
+	// Every query gets a span, it is a no-op while no tracer is installed.
+	config.ConnConfig.Tracer = queryTracer{}
 
-	if err := pool.Ping(context.Background()); err != nil {
-		log.Fatal("Unable to Ping Database!")
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("create database pool: %w", err)
 	}
 
-	return pool
+	return pool, nil
+}
+
+func newDB(pool *pgxpool.Pool, poolConfig PoolConfig) *DB {
+	return &DB{
+		Pool:         pool,
+		queryTimeout: poolConfig.QueryTimeout,
+		readRetries:  poolConfig.ReadRetries,
+		breaker:      newBreaker(poolConfig.BreakerThreshold, poolConfig.BreakerCooldown),
+	}
 }
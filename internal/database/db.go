@@ -0,0 +1,214 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrCircuitOpen is returned without touching the database while the circuit
+// breaker is open.
+var ErrCircuitOpen = fmt.Errorf("database circuit breaker is open: %w", domain.ErrUnavailable)
+
+// errStatementTimeout is the cause of a query cut off by the statement timeout.
+var errStatementTimeout = errors.New("statement timeout")
+
+// retryBaseDelay is the wait before the first retry of a read, doubled for every next one.
+const retryBaseDelay = 50 * time.Millisecond
+
+// DB is the pool with a statement timeout on every query and a circuit
+// breaker in front of it. Query, QueryRow, Exec and Begin go through both,
+// everything else, e.g. Ping or CopyFrom, goes straight to the embedded pool.
+// Those always run on the primary, only Read sends queries to replicas.
+type DB struct {
+	*pgxpool.Pool
+
+	queryTimeout time.Duration
+	readRetries  int
+	breaker      *breaker
+	retries      atomic.Int64
+
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+}
+
+type noTimeoutKey struct{}
+
+// WithoutQueryTimeout lifts the statement timeout for the queries run with
+// ctx, for streams that are bounded by the request instead.
+func WithoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTimeoutKey{}, true)
+}
+
+func (d *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if d.queryTimeout <= 0 || ctx.Value(noTimeoutKey{}) != nil {
+		return ctx, func() {}
+	}
+	return context.WithTimeoutCause(ctx, d.queryTimeout, errStatementTimeout)
+}
+
+// outcome is err as the breaker sees it, ctx is the one of withTimeout. A
+// query cut off by the statement timeout is a failure of the database, unlike
+// one whose caller gave up.
+func outcome(ctx context.Context, err error) error {
+	if err != nil && errors.Is(context.Cause(ctx), errStatementTimeout) {
+		return errStatementTimeout
+	}
+	return err
+}
+
+func (d *DB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if !d.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	ctx, cancel := d.withTimeout(ctx)
+	rows, err := d.Pool.Query(ctx, sql, args...)
+	if err != nil {
+		d.breaker.record(outcome(ctx, err))
+		cancel()
+		return nil, err
+	}
+
+	return &trackedRows{Rows: rows, db: d, ctx: ctx, cancel: cancel}, nil
+}
+
+func (d *DB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if !d.breaker.allow() {
+		return errRow{err: ErrCircuitOpen}
+	}
+
+	ctx, cancel := d.withTimeout(ctx)
+	return &trackedRow{row: d.Pool.QueryRow(ctx, sql, args...), db: d, ctx: ctx, cancel: cancel}
+}
+
+func (d *DB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if !d.breaker.allow() {
+		return pgconn.CommandTag{}, ErrCircuitOpen
+	}
+
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	tag, err := d.Pool.Exec(ctx, sql, args...)
+	d.breaker.record(outcome(ctx, err))
+	return tag, err
+}
+
+// Begin only bounds starting the transaction, the statements in it run with
+// the context they are given.
+func (d *DB) Begin(ctx context.Context) (pgx.Tx, error) {
+	if !d.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	beginCtx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := d.Pool.Begin(beginCtx)
+	d.breaker.record(outcome(beginCtx, err))
+	return tx, err
+}
+
+// Read runs fn with a healthy replica, or the primary when there is none or
+// ctx is marked WithPrimary. A replica that cannot be reached is skipped until
+// its next lag check and fn runs again right away elsewhere. fn also runs again
+// with backoff when it fails with a serialization failure or a broken
+// connection, so it must only read.
+func (d *DB) Read(ctx context.Context, fn func(ctx context.Context, db *DB) error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; {
+		db := d
+		r := d.replica(ctx)
+		if r != nil {
+			db = r.db
+		}
+
+		err := fn(ctx, db)
+		if r != nil && (connectionError(err) || errors.Is(err, ErrCircuitOpen)) {
+			r.healthy.Store(false)
+			logger.FromContext(ctx).Warn("replica unreachable, skipping it until the next lag check", "replica", r.addr, "error", err)
+			continue
+		}
+		if err == nil || attempt > d.readRetries || !retryable(err) {
+			return err
+		}
+
+		d.retries.Add(1)
+		logger.FromContext(ctx).Warn("retrying database read", "attempt", attempt, "error", err)
+
+		// Full jitter, so readers that failed together do not retry together.
+		timer := time.NewTimer(rand.N(delay) + time.Millisecond)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		delay *= 2
+		attempt++
+	}
+}
+
+// Retries is the number of reads that were retried.
+func (d *DB) Retries() int64 {
+	return d.retries.Load()
+}
+
+// BreakerState is closed, open or half-open.
+func (d *DB) BreakerState() string {
+	return d.breaker.state()
+}
+
+// trackedRows reports the outcome to the breaker and releases the timeout once closed.
+type trackedRows struct {
+	pgx.Rows
+	db     *DB
+	ctx    context.Context
+	cancel context.CancelFunc
+	closed bool
+}
+
+func (r *trackedRows) Close() {
+	r.Rows.Close()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.db.breaker.record(outcome(r.ctx, r.Rows.Err()))
+	r.cancel()
+}
+
+// trackedRow reports the outcome to the breaker on Scan, errors of QueryRow only show there.
+type trackedRow struct {
+	row    pgx.Row
+	db     *DB
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func (r *trackedRow) Scan(dest ...interface{}) error {
+	defer r.cancel()
+
+	err := r.row.Scan(dest...)
+	r.db.breaker.record(outcome(r.ctx, err))
+	return err
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(dest ...interface{}) error {
+	return r.err
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Leader elects one instance among all sharing the database through a
+// session advisory lock. The lock is held on a connection of its own, it is
+// gone when that connection is, e.g. when the instance dies.
+type Leader struct {
+	pool *pgxpool.Pool
+	key  int64
+	conn *pgxpool.Conn
+}
+
+// NewLeader returns an election for key, any constant works as long as
+// nothing else in the database uses it.
+func NewLeader(pool *pgxpool.Pool, key int64) *Leader {
+	return &Leader{pool: pool, key: key}
+}
+
+// Check tries to become the leader, or makes sure this instance still is.
+// False means another instance leads. Not safe for concurrent use.
+func (l *Leader) Check(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		if err := l.conn.Ping(ctx); err == nil {
+			return true, nil
+		}
+		// The lock went with the connection, another instance may hold it now.
+		l.drop()
+	}
+
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&locked); err != nil {
+		conn.Release()
+		return false, err
+	}
+	if !locked {
+		conn.Release()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+// Release gives up the leadership, another instance can take it on its next Check.
+func (l *Leader) Release(ctx context.Context) {
+	if l.conn == nil {
+		return
+	}
+	if _, err := l.conn.Exec(ctx, `SELECT pg_advisory_unlock($1)`, l.key); err != nil {
+		l.drop()
+		return
+	}
+	l.conn.Release()
+	l.conn = nil
+}
+
+// drop closes the connection instead of returning it to the pool, so the
+// lock cannot stay behind on a pooled connection.
+func (l *Leader) drop() {
+	l.conn.Conn().Close(context.Background())
+	l.conn.Release()
+	l.conn = nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"github.com/BramAristyo/rest-api-contact-person/pkg/metrics"
+)
+
+// RegisterPoolMetrics exposes the pgxpool statistics and the state of the
+// retries and the circuit breaker, read on every scrape.
+func RegisterPoolMetrics(registry *metrics.Registry, db *DB) {
+	registry.NewGaugeFunc("pgxpool_acquired_conns", "Number of connections currently checked out of the pool.", func() float64 {
+		return float64(db.Stat().AcquiredConns())
+	})
+	registry.NewGaugeFunc("pgxpool_idle_conns", "Number of idle connections in the pool.", func() float64 {
+		return float64(db.Stat().IdleConns())
+	})
+	registry.NewGaugeFunc("pgxpool_total_conns", "Total number of connections in the pool.", func() float64 {
+		return float64(db.Stat().TotalConns())
+	})
+	registry.NewGaugeFunc("pgxpool_max_conns", "Maximum size of the pool.", func() float64 {
+		return float64(db.Stat().MaxConns())
+	})
+	registry.NewCounterFunc("pgxpool_acquire_count_total", "Number of successful connection acquires.", func() float64 {
+		return float64(db.Stat().AcquireCount())
+	})
+	registry.NewCounterFunc("pgxpool_wait_count_total", "Number of acquires that had to wait for a connection.", func() float64 {
+		return float64(db.Stat().EmptyAcquireCount())
+	})
+	registry.NewCounterFunc("pgxpool_wait_duration_seconds_total", "Total time spent waiting for a connection.", func() float64 {
+		return db.Stat().EmptyAcquireWaitTime().Seconds()
+	})
+	registry.NewCounterFunc("db_read_retries_total", "Number of reads run again after a transient error.", func() float64 {
+		return float64(db.Retries())
+	})
+	registry.NewGaugeFunc("db_replicas_healthy", "Number of read replicas that currently get reads.", func() float64 {
+		healthy := 0
+		for _, r := range db.replicas {
+			if r.healthy.Load() {
+				healthy++
+			}
+		}
+		return float64(healthy)
+	})
+	registry.NewGaugeFunc("db_circuit_open", "1 while the circuit breaker fails queries fast, 0 otherwise.", func() float64 {
+		if db.BreakerState() == breakerClosed {
+			return 0
+		}
+		return 1
+	})
+}
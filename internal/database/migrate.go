@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// migrationLockKey is the pg_advisory_lock key held while migrating, any
+// constant works as long as nothing else in the database uses it.
+const migrationLockKey int64 = 0x636f6e7461637473
+
+const createHistoryTable = `
+CREATE TABLE IF NOT EXISTS schema_history (
+    version    BIGINT PRIMARY KEY,
+    name       TEXT NOT NULL,
+    checksum   TEXT NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+)`
+
+// Migrator applies and rolls back migrations. Each migration runs in its own
+// transaction together with its schema_history row, so a failed migration
+// leaves nothing behind.
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+}
+
+func NewMigrator(db *pgxpool.Pool, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Latest is the highest version this binary has, 0 without migrations.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration in version order.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down rolls back the last n applied migrations.
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	return m.locked(ctx, func(conn *pgx.Conn, applied map[int64]appliedMigration) error {
+		versions := slices.Sorted(maps.Keys(applied))
+		slices.Reverse(versions)
+
+		for _, version := range versions[:min(n, len(versions))] {
+			if err := m.rollback(ctx, conn, version); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// To applies or rolls back migrations until version is the latest applied
+// one, version 0 rolls back everything.
+func (m *Migrator) To(ctx context.Context, version int64) error {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(mig Migration) bool { return mig.Version == version }) {
+		return fmt.Errorf("no migration with version %d", version)
+	}
+
+	return m.locked(ctx, func(conn *pgx.Conn, applied map[int64]appliedMigration) error {
+		for _, mig := range m.migrations {
+			if a, ok := applied[mig.Version]; ok && a.Checksum != mig.Checksum {
+				return fmt.Errorf("migration %d_%s was changed after it was applied, restore the file or run migrate force", mig.Version, mig.Name)
+			}
+		}
+
+		versions := slices.Sorted(maps.Keys(applied))
+		slices.Reverse(versions)
+		for _, v := range versions {
+			if v > version {
+				if err := m.rollback(ctx, conn, v); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok || mig.Version > version {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Force records version as the latest applied migration without running any
+// SQL, to recover after fixing a failed or edited migration by hand.
+func (m *Migrator) Force(ctx context.Context, version int64) error {
+	// The history is not read, it may be the dirty state being recovered from.
+	return m.withLock(ctx, func(conn *pgx.Conn) error {
+		if _, err := conn.Exec(ctx, createHistoryTable); err != nil {
+			return err
+		}
+
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, `DELETE FROM schema_history WHERE version > $1`, version); err != nil {
+				return err
+			}
+
+			for _, mig := range m.migrations {
+				if mig.Version > version {
+					break
+				}
+
+				_, err := tx.Exec(ctx, `
+					INSERT INTO schema_history (version, name, checksum) VALUES ($1, $2, $3)
+					ON CONFLICT (version) DO UPDATE SET name = EXCLUDED.name, checksum = EXCLUDED.checksum`,
+					mig.Version, mig.Name, mig.Checksum)
+				if err != nil {
+					return err
+				}
+			}
+
+			slog.Info("migration version forced", "version", version)
+			return nil
+		})
+	})
+}
+
+// Status lists every migration known to the binary or the database.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationState, error) {
+	applied, err := readHistory(ctx, m.db, m.migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, mig := range m.migrations {
+		a, ok := applied[mig.Version]
+		states = append(states, MigrationState{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			Applied:   ok,
+			AppliedAt: a.AppliedAt,
+			Modified:  ok && a.Checksum != mig.Checksum,
+		})
+		delete(applied, mig.Version)
+	}
+
+	for _, a := range applied {
+		states = append(states, MigrationState{Version: a.Version, Name: a.Name, Applied: true, AppliedAt: a.AppliedAt, Missing: true})
+	}
+	slices.SortFunc(states, func(a, b MigrationState) int { return int(a.Version - b.Version) })
+
+	return states, nil
+}
+
+// Version compares the database with the migrations of this binary.
+func (m *Migrator) Version(ctx context.Context) (MigrationStatus, error) {
+	states, err := m.Status(ctx)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+
+	status := MigrationStatus{Expected: m.Latest()}
+	for _, s := range states {
+		if s.Applied {
+			status.Version = max(status.Version, s.Version)
+		} else {
+			status.Pending++
+		}
+	}
+
+	return status, nil
+}
+
+// Check fails when migrations of this binary are not applied yet, the API
+// would run against a schema it does not know.
+func (m *Migrator) Check(ctx context.Context) error {
+	status, err := m.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	if status.Pending > 0 {
+		return fmt.Errorf("database schema is at version %d with %d pending migrations, this binary expects version %d: run `api migrate up` or start with --migrate-on-start",
+			status.Version, status.Pending, status.Expected)
+	}
+
+	if status.Version > status.Expected {
+		slog.Warn("database schema is newer than this binary", "version", status.Version, "expected", status.Expected)
+	}
+
+	return nil
+}
+
+// withLock runs fn on one connection holding the migration advisory lock, so
+// instances starting at the same time migrate one after the other.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return err
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	return fn(conn.Conn())
+}
+
+// locked is withLock plus the applied migrations, a golang-migrate state is
+// copied into schema_history on the first run.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgx.Conn, applied map[int64]appliedMigration) error) error {
+	return m.withLock(ctx, func(conn *pgx.Conn) error {
+		// Read before the table is created, otherwise the legacy state is not looked at.
+		applied, err := readHistory(ctx, conn, m.migrations)
+		if err != nil {
+			return err
+		}
+
+		if _, err := conn.Exec(ctx, createHistoryTable); err != nil {
+			return err
+		}
+
+		for _, a := range applied {
+			_, err := conn.Exec(ctx, `INSERT INTO schema_history (version, name, checksum) VALUES ($1, $2, $3) ON CONFLICT (version) DO NOTHING`, a.Version, a.Name, a.Checksum)
+			if err != nil {
+				return err
+			}
+		}
+
+		return fn(conn, applied)
+	})
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *pgx.Conn, mig Migration) error {
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		// The simple protocol runs files with several statements, which a
+		// prepared statement cannot.
+		if _, err := tx.Conn().PgConn().Exec(ctx, mig.Up).ReadAll(); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `INSERT INTO schema_history (version, name, checksum) VALUES ($1, $2, $3)`, mig.Version, mig.Name, mig.Checksum)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("apply migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	slog.Info("migration applied", "version", mig.Version, "name", mig.Name)
+	return nil
+}
+
+func (m *Migrator) rollback(ctx context.Context, conn *pgx.Conn, version int64) error {
+	i := slices.IndexFunc(m.migrations, func(mig Migration) bool { return mig.Version == version })
+	if i < 0 || m.migrations[i].Down == "" {
+		return fmt.Errorf("roll back migration %d: this binary has no down file for it", version)
+	}
+	mig := m.migrations[i]
+
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Conn().PgConn().Exec(ctx, mig.Down).ReadAll(); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `DELETE FROM schema_history WHERE version = $1`, mig.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("roll back migration %d_%s: %w", mig.Version, mig.Name, err)
+	}
+
+	slog.Info("migration rolled back", "version", mig.Version, "name", mig.Name)
+	return nil
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Migration is one numbered pair of files, e.g.
+// 000001_create_contacts_table.up.sql and 000001_create_contacts_table.down.sql.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+	// Checksum is the sha256 of the up file, it tells when an applied
+	// migration was edited afterwards.
+	Checksum string
+}
+
+// LoadMigrations reads the migration files at the root of fsys, ordered by version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(file, "."+direction+".sql"), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if !ok || err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: file name must be <version>_<name>.up.sql or .down.sql", file)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			sum := sha256.Sum256(data)
+			m.Up, m.Checksum = string(data), hex.EncodeToString(sum[:])
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return int(a.Version - b.Version) })
+
+	return migrations, nil
+}
+
+// appliedMigration is a row of schema_history.
+type appliedMigration struct {
+	Version   int64
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// readHistory returns the applied migrations by version. Before the first run
+// of the migrator, a database migrated by golang-migrate reports the versions
+// up to the one in its schema_migrations table, which the migrator adopts.
+func readHistory(ctx context.Context, db querier, migrations []Migration) (map[int64]appliedMigration, error) {
+	applied := make(map[int64]appliedMigration)
+
+	rows, err := db.Query(ctx, `SELECT version, name, checksum, applied_at FROM schema_history`)
+	if err != nil {
+		if !isUndefinedTable(err) {
+			return nil, err
+		}
+		return legacyHistory(ctx, db, migrations)
+	}
+
+	for rows.Next() {
+		var a appliedMigration
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		applied[a.Version] = a
+	}
+
+	return applied, rows.Err()
+}
+
+// legacyHistory reads the state golang-migrate left in schema_migrations.
+func legacyHistory(ctx context.Context, db querier, migrations []Migration) (map[int64]appliedMigration, error) {
+	applied := make(map[int64]appliedMigration)
+
+	var version int64
+	var dirty bool
+	err := db.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) || isUndefinedTable(err) {
+			return applied, nil
+		}
+		return nil, err
+	}
+
+	if dirty {
+		return nil, fmt.Errorf("golang-migrate left version %d dirty, fix the schema by hand and run migrate force %d", version, version)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			applied[m.Version] = appliedMigration{Version: m.Version, Name: m.Name, Checksum: m.Checksum}
+		}
+	}
+
+	return applied, nil
+}
+
+// isUndefinedTable reports a 42P01 undefined_table error, the migrations have
+// never run against this database.
+func isUndefinedTable(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "42P01"
+}
+
+// MigrationStatus is reported by the readiness probe.
+type MigrationStatus struct {
+	// Version is the highest applied migration, 0 when none is.
+	Version int64 `json:"version"`
+	// Expected is the highest migration embedded in this binary.
+	Expected int64 `json:"expected"`
+	// Pending counts the migrations of this binary that are not applied.
+	Pending int `json:"pending"`
+}
+
+// MigrationState is one line of migrate status.
+type MigrationState struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Modified is set when the up file changed after it was applied.
+	Modified bool
+	// Missing is set for applied migrations this binary has no files for,
+	// usually a database migrated by a newer binary.
+	Missing bool
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// replicaLagQuery is 0 on a replica that replayed everything it received, an
+// idle primary would otherwise make its replicas look further and further behind.
+const replicaLagQuery = `
+	SELECT CASE
+		WHEN NOT pg_is_in_recovery() THEN 0
+		WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+		ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END::float8`
+
+type replica struct {
+	db   *DB
+	addr string
+	// healthy is set by the lag check, and cleared as soon as a read fails to reach the replica.
+	healthy atomic.Bool
+	lag     atomic.Int64
+}
+
+// ReplicaStatus is the last known state of a read replica.
+type ReplicaStatus struct {
+	Addr    string `json:"addr"`
+	Healthy bool   `json:"healthy"`
+	Lag     string `json:"lag"`
+}
+
+type primaryKey struct{}
+
+// WithPrimary makes the reads run with ctx go to the primary, e.g. right after
+// the caller wrote and a replica may not have the write yet.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// AddReplicas opens a pool per replica url, configured like the primary.
+// Replicas are not waited for, they only get reads once MonitorReplicas found
+// them within maxLag.
+func (d *DB) AddReplicas(ctx context.Context, urls []string, poolConfig PoolConfig, maxLag time.Duration) error {
+	for _, url := range urls {
+		pool, err := newPool(ctx, url, poolConfig)
+		if err != nil {
+			return err
+		}
+
+		config := pool.Config().ConnConfig
+		d.replicas = append(d.replicas, &replica{
+			db:   newDB(pool, poolConfig),
+			addr: net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))),
+		})
+	}
+	d.maxLag = maxLag
+
+	return nil
+}
+
+// MonitorReplicas checks the lag of every replica every period until ctx is done.
+func (d *DB) MonitorReplicas(ctx context.Context, period time.Duration) {
+	if len(d.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		for _, r := range d.replicas {
+			d.checkReplica(ctx, r, period)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *DB) checkReplica(ctx context.Context, r *replica, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var seconds float64
+	err := r.db.QueryRow(ctx, replicaLagQuery).Scan(&seconds)
+	lag := time.Duration(seconds * float64(time.Second))
+	r.lag.Store(int64(lag))
+
+	healthy := err == nil && lag <= d.maxLag
+	if healthy == r.healthy.Swap(healthy) {
+		return
+	}
+
+	switch {
+	case healthy:
+		slog.Info("Replica available for reads", "replica", r.addr, "lag", lag.String())
+	case err != nil:
+		slog.Warn("Replica unreachable, reading from the primary", "replica", r.addr, "error", err)
+	default:
+		slog.Warn("Replica lags behind, reading from the primary", "replica", r.addr, "lag", lag.String(), "max_lag", d.maxLag.String())
+	}
+}
+
+// replica picks a healthy replica round robin, nil means the read goes to the primary.
+func (d *DB) replica(ctx context.Context) *replica {
+	if len(d.replicas) == 0 || ctx.Value(primaryKey{}) != nil {
+		return nil
+	}
+
+	start := d.next.Add(1)
+	for i := range d.replicas {
+		r := d.replicas[(start+uint64(i))%uint64(len(d.replicas))]
+		if r.healthy.Load() {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// Replicas reports every replica, for readiness.
+func (d *DB) Replicas() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, len(d.replicas))
+	for i, r := range d.replicas {
+		statuses[i] = ReplicaStatus{
+			Addr:    r.addr,
+			Healthy: r.healthy.Load(),
+			Lag:     time.Duration(r.lag.Load()).String(),
+		}
+	}
+
+	return statuses
+}
+
+// Close closes the primary and every replica pool.
+func (d *DB) Close() {
+	for _, r := range d.replicas {
+		r.db.Close()
+	}
+	d.Pool.Close()
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	_ "modernc.org/sqlite"
+)
+
+// sqliteSchema mirrors the Postgres migrations for the tables the SQLite
+// repositories use.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS contacts (
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    name              TEXT NOT NULL,
+    email             TEXT UNIQUE,
+    phone             TEXT,
+    birthday          TEXT,
+    anniversary       TEXT,
+    dates             TEXT NOT NULL DEFAULT '[]',
+    tags              TEXT NOT NULL DEFAULT '[]',
+    -- Always NULL, interactions are only kept in Postgres.
+    last_contacted_at TIMESTAMP,
+    created_at        TIMESTAMP NOT NULL,
+    updated_at        TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS groups (
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    name       TEXT NOT NULL,
+    -- The filter expression of a smart group, NULL for a static one.
+    filter     TEXT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS contact_groups (
+    contact_id INTEGER NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    group_id   INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    PRIMARY KEY (contact_id, group_id)
+);`
+
+// sqliteAddedColumns are the columns added to a table after it was created,
+// a database file from before gets them with ALTER TABLE.
+var sqliteAddedColumns = []struct {
+	table, column, definition string
+}{
+	{"contacts", "birthday", "TEXT"},
+	{"contacts", "anniversary", "TEXT"},
+	{"contacts", "dates", "TEXT NOT NULL DEFAULT '[]'"},
+	{"contacts", "last_contacted_at", "TIMESTAMP"},
+	{"contacts", "tags", "TEXT NOT NULL DEFAULT '[]'"},
+	{"groups", "filter", "TEXT"},
+}
+
+// ConnectSQLite opens the SQLite database at path, ":memory:" for a throwaway
+// one, and creates the schema when it is missing.
+func ConnectSQLite(path string) (*sql.DB, error) {
+	// Times are stored as "2006-01-02 15:04:05.999999999-07:00" text, which
+	// sorts chronologically for MAX(updated_at) as long as everything is UTC.
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_time_format", "sqlite")
+
+	db, err := sql.Open("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer, and every connection to ":memory:" would
+	// be a database of its own.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.ExecContext(context.Background(), sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addSQLiteColumns(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func addSQLiteColumns(ctx context.Context, db *sql.DB) error {
+	for _, c := range sqliteAddedColumns {
+		var exists bool
+		err := db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM pragma_table_info(?) WHERE name = ?)`, c.table, c.column).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, `ALTER TABLE `+c.table+` ADD COLUMN `+c.column+` `+c.definition); err != nil {
+			return fmt.Errorf("add %s.%s: %w", c.table, c.column, err)
+		}
+	}
+	return nil
+}
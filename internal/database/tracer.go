@@ -0,0 +1,27 @@
+package database
+
+import (
+	"context"
+
+	"github.com/BramAristyo/rest-api-contact-person/pkg/tracing"
+	"github.com/jackc/pgx/v5"
+)
+
+// queryTracer starts a client span around every query run through the pool,
+// as a child of whatever span is in the query context.
+type queryTracer struct{}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = tracing.StartWithKind(ctx, tracing.KindClient, "pgx.query",
+		tracing.String("db.system", "postgresql"),
+		tracing.String("db.statement", data.SQL),
+	)
+	return ctx
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := tracing.SpanFromContext(ctx)
+	span.SetAttributes(tracing.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	span.RecordError(data.Err)
+	span.End()
+}
@@ -1,45 +1,222 @@
 package domain
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"iter"
 	"time"
 )
 
 type Contact struct {
-	Id        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Phone     string    `json:"phone"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Id          int           `json:"id"`
+	Name        string        `json:"name"`
+	Email       string        `json:"email"`
+	Phone       string        `json:"phone"`
+	Birthday    PartialDate   `json:"birthday"`
+	Anniversary PartialDate   `json:"anniversary"`
+	Dates       []ContactDate `json:"dates"`
+	// Tags are normalized, sorted and unique.
+	Tags []string `json:"tags"`
+	// LastContactedAt is the latest call, meeting or email logged, nil when
+	// there is none. The database keeps it up to date.
+	LastContactedAt *time.Time `json:"last_contacted_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	Groups          []Group    `json:"groups,omitzero"`
+
+	// fields is the ?fields= projection set by Project, nil renders every
+	// field.
+	fields []string
+}
+
+// Project returns c rendering only id and fields, plus groups when they are
+// embedded. An empty fields keeps the full contact.
+func (c Contact) Project(fields []string) Contact {
+	c.fields = fields
+	return c
+}
+
+// ProjectContacts applies Project to every contact.
+func ProjectContacts(contacts []Contact, fields []string) {
+	for i := range contacts {
+		contacts[i] = contacts[i].Project(fields)
+	}
+}
+
+func (c Contact) MarshalJSON() ([]byte, error) {
+	// contact has the fields of Contact without this method.
+	type contact Contact
+	full, err := json.Marshal(contact(c))
+	if err != nil || len(c.fields) == 0 {
+		return full, err
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(full, &values); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	columns := QueryOptions{Fields: c.fields, Include: ContactIncludes}.Columns(ContactFields)
+	for _, key := range columns {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(`"` + key + `":`)
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
 }
 
+// ContactFields are the columns that can be selected with ?fields=.
+var ContactFields = []string{"id", "name", "email", "phone", "birthday", "anniversary", "dates", "tags", "last_contacted_at", "created_at", "updated_at"}
+
+// ContactSorts are the columns contacts can be sorted by with ?sort=.
+var ContactSorts = []string{"id", "name", "created_at", "updated_at", "last_contacted_at"}
+
+// ContactIncludes are the relations that can be embedded with ?include=.
+var ContactIncludes = []string{"groups"}
+
 type CreateContactRequest struct {
-	Name  string `json:"name" validate:"required,min=3"`
-	Email string `json:"email" validate:"required,email"`
-	Phone string `json:"phone" validate:"required,e164"`
+	Name  string   `json:"name" validate:"required,min=3"`
+	Email string   `json:"email" validate:"required,email"`
+	Phone string   `json:"phone" validate:"required,e164"`
+	Tags  []string `json:"tags" validate:"max=50,dive,tag"`
+	ContactDatesRequest
 }
 
 type UpdateContactRequest struct {
 	Name  string `json:"name" validate:"required,min=3"`
 	Email string `json:"email" validate:"required,email"`
 	Phone string `json:"phone" validate:"required,e164"`
+	// Tags replace the contact's tags, nil when left out of the request keeps
+	// the current ones and an empty list removes them.
+	Tags *[]string `json:"tags" validate:"omitempty,max=50,dive,tag"`
+	ContactDatesRequest
+}
+
+// ContactDatesRequest are the dates of a contact in create and update
+// requests, written like PartialDate. A date left out of the request is nil
+// and keeps its current value, an empty one removes it.
+type ContactDatesRequest struct {
+	Birthday    *string               `json:"birthday" validate:"omitempty,partial_date"`
+	Anniversary *string               `json:"anniversary" validate:"omitempty,partial_date"`
+	Dates       *[]ContactDateRequest `json:"dates" validate:"omitempty,max=20,dive"`
+}
+
+type ContactDateRequest struct {
+	Label string `json:"label" validate:"required,max=50"`
+	Date  string `json:"date" validate:"required,partial_date"`
+}
+
+// ApplyTo parses the dates in the request into u, those left out stay nil.
+// The request is expected to be validated.
+func (r ContactDatesRequest) ApplyTo(u *ContactUpdate) error {
+	if r.Birthday != nil {
+		birthday, err := parseOptionalDate(*r.Birthday)
+		if err != nil {
+			return err
+		}
+		u.Birthday = &birthday
+	}
+	if r.Anniversary != nil {
+		anniversary, err := parseOptionalDate(*r.Anniversary)
+		if err != nil {
+			return err
+		}
+		u.Anniversary = &anniversary
+	}
+	if r.Dates != nil {
+		dates := []ContactDate{}
+		for _, d := range *r.Dates {
+			date, err := ParsePartialDate(d.Date)
+			if err != nil {
+				return err
+			}
+			dates = append(dates, ContactDate{Label: d.Label, Date: date})
+		}
+		u.Dates = &dates
+	}
+
+	return nil
+}
+
+// ContactUpdate is what an update writes to a contact. Nil dates and tags
+// keep their current value, the repositories leave those columns alone
+// rather than writing back a value read earlier.
+type ContactUpdate struct {
+	Name  string
+	Email string
+	Phone string
+	// Birthday and Anniversary are removed when zero.
+	Birthday    *PartialDate
+	Anniversary *PartialDate
+	Dates       *[]ContactDate
+	Tags        *[]string
+}
+
+// ApplyTo writes u into c, the fields u keeps are left as they are.
+func (u ContactUpdate) ApplyTo(c *Contact) {
+	c.Name, c.Email, c.Phone = u.Name, u.Email, u.Phone
+	if u.Birthday != nil {
+		c.Birthday = *u.Birthday
+	}
+	if u.Anniversary != nil {
+		c.Anniversary = *u.Anniversary
+	}
+	if u.Dates != nil {
+		c.Dates = append([]ContactDate{}, *u.Dates...)
+	}
+	if u.Tags != nil {
+		c.Tags = append([]string{}, *u.Tags...)
+	}
 }
 
 type ContactRepository interface {
-	GetAll(ctx context.Context) ([]Contact, error)
-	Paginate(ctx context.Context, page int, limit int) ([]Contact, int64, error)
-	GetById(ctx context.Context, id int) (*Contact, error)
+	GetAll(ctx context.Context, limit int, fields []string) iter.Seq2[Contact, error]
+	// Paginate returns a page of the contacts matching filter and how many match.
+	Paginate(ctx context.Context, page int, limit int, fields []string, sort Sort, filter ContactFilter) ([]Contact, int64, error)
+	GetById(ctx context.Context, id int, fields []string) (*Contact, error)
+	GetByGroupIds(ctx context.Context, groupIds []int) (map[int][]Contact, error)
+	// GetDated streams the contacts with a birthday, anniversary or labelled
+	// date, only the members of groupId unless it is 0 and only those with a
+	// date on one of monthDays, written "MM-DD", unless it is nil.
+	GetDated(ctx context.Context, groupId int, monthDays []string) iter.Seq2[Contact, error]
+	Count(ctx context.Context) (int64, error)
+	Fingerprint(ctx context.Context) (Fingerprint, error)
 	Store(ctx context.Context, contact *Contact) (*Contact, error)
-	Update(ctx context.Context, id int, contact *Contact) (*Contact, error)
+	Update(ctx context.Context, id int, update *ContactUpdate) (*Contact, error)
 	Delete(ctx context.Context, id int) error
+	// Tags lists the tags starting with prefix, the most used first.
+	Tags(ctx context.Context, prefix string, limit int) ([]Tag, error)
+	// ReplaceTags replaces the tags from with to on every contact carrying
+	// any of them and returns how many contacts changed.
+	ReplaceTags(ctx context.Context, from []string, to string) (int64, error)
 }
 
 type ContactService interface {
-	GetAll(ctx context.Context) ([]Contact, error)
-	Paginate(ctx context.Context, page int, limit int) ([]Contact, int64, error)
-	GetById(ctx context.Context, id int) (*Contact, error)
+	GetAll(ctx context.Context, limit int, opts QueryOptions) iter.Seq2[Contact, error]
+	Paginate(ctx context.Context, page int, limit int, opts QueryOptions) ([]Contact, int64, error)
+	GetById(ctx context.Context, id int, opts QueryOptions) (*Contact, error)
+	Fingerprint(ctx context.Context) (Fingerprint, error)
+	// Upcoming lists the occasions in the days days from today on, soonest first.
+	Upcoming(ctx context.Context, today time.Time, days int, groupId int) ([]Occasion, error)
+	GetDated(ctx context.Context, groupId int) iter.Seq2[Contact, error]
 	Store(ctx context.Context, req *CreateContactRequest) (*Contact, error)
 	Update(ctx context.Context, id int, req *UpdateContactRequest) (*Contact, error)
 	Delete(ctx context.Context, id int) error
+	Tags(ctx context.Context, prefix string, limit int) ([]Tag, error)
+	// RenameTag renames a tag on every contact, merging it into to where a
+	// contact has both. A tag no contact has is ErrNotFound.
+	RenameTag(ctx context.Context, from, to string) (int64, error)
+	// MergeTags replaces every tag of sources with target on every contact.
+	MergeTags(ctx context.Context, req *MergeTagsRequest) (int64, error)
 }
@@ -0,0 +1,522 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxContactQueryLength is the longest filter expression, in bytes.
+	MaxContactQueryLength = 1000
+	// maxContactQueryDepth bounds the nesting of parentheses and NOTs.
+	maxContactQueryDepth = 20
+)
+
+// ContactQueryFields are the text columns a filter expression can compare.
+var ContactQueryFields = []string{"name", "email", "phone"}
+
+// contactQueryKeys are the key:value conditions of a filter expression.
+var contactQueryKeys = map[string]QueryCondition{
+	"tag":              {Field: "tags", Operator: QueryHas},
+	"created_after":    {Field: "created_at", Operator: QueryAfter},
+	"created_before":   {Field: "created_at", Operator: QueryBefore},
+	"updated_after":    {Field: "updated_at", Operator: QueryAfter},
+	"updated_before":   {Field: "updated_at", Operator: QueryBefore},
+	"contacted_after":  {Field: "last_contacted_at", Operator: QueryAfter},
+	"contacted_before": {Field: "last_contacted_at", Operator: QueryBefore},
+}
+
+// ContactQuery is a parsed filter expression, like
+// email ends with @acme.com AND tag:vip AND created_after:2026-01-01.
+// The repositories compile it to SQL, Matches evaluates it in memory.
+type ContactQuery interface {
+	Matches(c Contact) bool
+	// String is the canonical form of the expression, equal queries have
+	// equal strings.
+	String() string
+}
+
+type QueryOperator string
+
+const (
+	QueryIs         QueryOperator = "is"
+	QueryIsNot      QueryOperator = "is not"
+	QueryContains   QueryOperator = "contains"
+	QueryStartsWith QueryOperator = "starts with"
+	QueryEndsWith   QueryOperator = "ends with"
+	// QueryHas matches the contacts carrying the tag Value.
+	QueryHas QueryOperator = "has"
+	// QueryAfter matches on or after the day Value, QueryBefore strictly
+	// before it, both in UTC. A contact never talked to matches neither.
+	QueryAfter  QueryOperator = "after"
+	QueryBefore QueryOperator = "before"
+)
+
+// QueryCondition compares one column. Field is one of ContactQueryFields for
+// the text operators, tags for QueryHas and created_at, updated_at or
+// last_contacted_at for QueryAfter and QueryBefore, whose Value is a
+// YYYY-MM-DD date. Text comparisons ignore case.
+type QueryCondition struct {
+	Field    string
+	Operator QueryOperator
+	Value    string
+}
+
+// QueryAnd matches the contacts every query matches.
+type QueryAnd []ContactQuery
+
+// QueryOr matches the contacts any query matches.
+type QueryOr []ContactQuery
+
+// QueryNot matches the contacts Query does not.
+type QueryNot struct {
+	Query ContactQuery
+}
+
+func (c QueryCondition) Matches(contact Contact) bool {
+	switch c.Operator {
+	case QueryHas:
+		return slices.Contains(contact.Tags, c.Value)
+	case QueryAfter, QueryBefore:
+		var at *time.Time
+		switch c.Field {
+		case "created_at":
+			at = &contact.CreatedAt
+		case "updated_at":
+			at = &contact.UpdatedAt
+		case "last_contacted_at":
+			at = contact.LastContactedAt
+		}
+		day, err := time.Parse(time.DateOnly, c.Value)
+		if at == nil || err != nil {
+			return false
+		}
+		if c.Operator == QueryAfter {
+			return !at.Before(day)
+		}
+		return at.Before(day)
+	}
+
+	var value string
+	switch c.Field {
+	case "name":
+		value = contact.Name
+	case "email":
+		value = contact.Email
+	case "phone":
+		value = contact.Phone
+	default:
+		return false
+	}
+	value, want := strings.ToLower(value), strings.ToLower(c.Value)
+
+	switch c.Operator {
+	case QueryIs:
+		return value == want
+	case QueryIsNot:
+		return value != want
+	case QueryContains:
+		return strings.Contains(value, want)
+	case QueryStartsWith:
+		return strings.HasPrefix(value, want)
+	case QueryEndsWith:
+		return strings.HasSuffix(value, want)
+	}
+	return false
+}
+
+func (c QueryCondition) String() string {
+	for key, condition := range contactQueryKeys {
+		if condition.Field == c.Field && condition.Operator == c.Operator {
+			return key + ":" + c.Value
+		}
+	}
+	return c.Field + " " + string(c.Operator) + " " + quoteQueryValue(c.Value)
+}
+
+// quoteQueryValue writes value as a double-quoted string ParseContactQuery
+// reads back.
+func quoteQueryValue(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
+
+func (q QueryAnd) Matches(contact Contact) bool {
+	for _, query := range q {
+		if !query.Matches(contact) {
+			return false
+		}
+	}
+	return true
+}
+
+func (q QueryAnd) String() string {
+	parts := make([]string, len(q))
+	for i, query := range q {
+		parts[i] = query.String()
+		if _, ok := query.(QueryOr); ok {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " AND ")
+}
+
+func (q QueryOr) Matches(contact Contact) bool {
+	return slices.ContainsFunc(q, func(query ContactQuery) bool { return query.Matches(contact) })
+}
+
+func (q QueryOr) String() string {
+	parts := make([]string, len(q))
+	for i, query := range q {
+		parts[i] = query.String()
+	}
+	return strings.Join(parts, " OR ")
+}
+
+func (q QueryNot) Matches(contact Contact) bool {
+	return !q.Query.Matches(contact)
+}
+
+func (q QueryNot) String() string {
+	if _, ok := q.Query.(QueryCondition); ok {
+		return "NOT " + q.Query.String()
+	}
+	if _, ok := q.Query.(QueryNot); ok {
+		return "NOT " + q.Query.String()
+	}
+	return "NOT (" + q.Query.String() + ")"
+}
+
+// QueryError is a syntax error in a filter expression at byte Offset.
+type QueryError struct {
+	Offset  int
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Offset+1)
+}
+
+// ParseContactQuery reads a filter expression. Conditions are joined with
+// AND and OR, AND binding tighter, negated with NOT and grouped with
+// parentheses, keywords in any case. A condition is either
+//
+//	<field> <operator> <value>
+//
+// with a field of ContactQueryFields and an operator of is or =, is not or
+// !=, contains, starts with or ends with, or a key:value pair of tag:<tag>,
+// created_after, created_before, updated_after, updated_before,
+// contacted_after or contacted_before with a YYYY-MM-DD date. Values with
+// spaces, parentheses, quotes, = or ! are written in double quotes, with \"
+// for a quote and \\ for a backslash.
+func ParseContactQuery(s string) (ContactQuery, error) {
+	if len(s) > MaxContactQueryLength {
+		return nil, &QueryError{Offset: MaxContactQueryLength, Message: fmt.Sprintf("filter is longer than %d characters", MaxContactQueryLength)}
+	}
+
+	tokens, err := lexContactQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens, end: len(s)}
+	query, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.peek(); ok {
+		return nil, p.errorAt(t, "unexpected "+t.describe())
+	}
+	return query, nil
+}
+
+type queryTokenKind int
+
+const (
+	queryWord queryTokenKind = iota
+	queryString
+	queryOpen
+	queryClose
+	queryEqual
+	queryNotEqual
+)
+
+type queryToken struct {
+	kind   queryTokenKind
+	text   string
+	offset int
+}
+
+func (t queryToken) describe() string {
+	if t.kind == queryString {
+		return quoteQueryValue(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// isKeyword reports whether t is the bare word keyword, in any case.
+func (t queryToken) isKeyword(keyword string) bool {
+	return t.kind == queryWord && strings.EqualFold(t.text, keyword)
+}
+
+func lexContactQuery(s string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: queryOpen, text: "(", offset: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: queryClose, text: ")", offset: i})
+			i++
+		case c == '=':
+			tokens = append(tokens, queryToken{kind: queryEqual, text: "=", offset: i})
+			i++
+		case c == '!':
+			if !strings.HasPrefix(s[i:], "!=") {
+				return nil, &QueryError{Offset: i, Message: "expected '!='"}
+			}
+			tokens = append(tokens, queryToken{kind: queryNotEqual, text: "!=", offset: i})
+			i += 2
+		case c == '"':
+			var value strings.Builder
+			start := i
+			for i++; ; i++ {
+				if i >= len(s) {
+					return nil, &QueryError{Offset: start, Message: "unterminated string"}
+				}
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				} else if s[i] == '"' {
+					break
+				}
+				value.WriteByte(s[i])
+			}
+			tokens = append(tokens, queryToken{kind: queryString, text: value.String(), offset: start})
+			i++
+		default:
+			start := i
+			for i < len(s) && !strings.ContainsRune(" \t\n\r()=!\"", rune(s[i])) {
+				i++
+			}
+			tokens = append(tokens, queryToken{kind: queryWord, text: s[start:i], offset: start})
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	// end is the length of the input, where errors about a missing token
+	// point.
+	end int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) next() (queryToken, bool) {
+	t, ok := p.peek()
+	if ok {
+		p.pos++
+	}
+	return t, ok
+}
+
+func (p *queryParser) errorAt(t queryToken, message string) error {
+	return &QueryError{Offset: t.offset, Message: message}
+}
+
+func (p *queryParser) errorAtEnd(message string) error {
+	return &QueryError{Offset: p.end, Message: message}
+}
+
+// acceptKeyword consumes the next token if it is keyword.
+func (p *queryParser) acceptKeyword(keyword string) bool {
+	if t, ok := p.peek(); ok && t.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) or(depth int) (ContactQuery, error) {
+	first, err := p.and(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := QueryOr{first}
+	for p.acceptKeyword("or") {
+		query, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	if len(queries) == 1 {
+		return first, nil
+	}
+	return queries, nil
+}
+
+func (p *queryParser) and(depth int) (ContactQuery, error) {
+	first, err := p.unary(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := QueryAnd{first}
+	for p.acceptKeyword("and") {
+		query, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	if len(queries) == 1 {
+		return first, nil
+	}
+	return queries, nil
+}
+
+func (p *queryParser) unary(depth int) (ContactQuery, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.errorAtEnd("expected a condition")
+	}
+	if depth >= maxContactQueryDepth {
+		return nil, p.errorAt(t, fmt.Sprintf("filter is nested deeper than %d levels", maxContactQueryDepth))
+	}
+
+	if t.isKeyword("not") {
+		p.pos++
+		query, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return QueryNot{Query: query}, nil
+	}
+
+	if t.kind == queryOpen {
+		p.pos++
+		query, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.next(); !ok {
+			return nil, p.errorAtEnd("expected ')'")
+		} else if closing.kind != queryClose {
+			return nil, p.errorAt(closing, "expected ')', got "+closing.describe())
+		}
+		return query, nil
+	}
+
+	return p.condition()
+}
+
+func (p *queryParser) condition() (ContactQuery, error) {
+	t, _ := p.next()
+	if t.kind != queryWord {
+		return nil, p.errorAt(t, "expected a condition, got "+t.describe())
+	}
+
+	if key, value, found := strings.Cut(t.text, ":"); found {
+		return p.keyValue(t, strings.ToLower(key), value)
+	}
+
+	field := strings.ToLower(t.text)
+	if !slices.Contains(ContactQueryFields, field) {
+		return nil, p.errorAt(t, fmt.Sprintf("unknown field '%s', expected one of %s or a key:value condition", t.text, strings.Join(ContactQueryFields, ", ")))
+	}
+
+	operator, err := p.operator()
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := p.next()
+	if !ok {
+		return nil, p.errorAtEnd("expected a value")
+	}
+	if value.kind != queryWord && value.kind != queryString {
+		return nil, p.errorAt(value, "expected a value, got "+value.describe())
+	}
+	return QueryCondition{Field: field, Operator: operator, Value: value.text}, nil
+}
+
+func (p *queryParser) operator() (QueryOperator, error) {
+	t, ok := p.next()
+	if !ok {
+		return "", p.errorAtEnd("expected an operator")
+	}
+
+	switch {
+	case t.kind == queryEqual:
+		return QueryIs, nil
+	case t.kind == queryNotEqual:
+		return QueryIsNot, nil
+	case t.isKeyword("is"):
+		if p.acceptKeyword("not") {
+			return QueryIsNot, nil
+		}
+		return QueryIs, nil
+	case t.isKeyword("contains"):
+		return QueryContains, nil
+	case t.isKeyword("starts"):
+		if !p.acceptKeyword("with") {
+			return "", p.errorAt(t, "expected 'starts with'")
+		}
+		return QueryStartsWith, nil
+	case t.isKeyword("ends"):
+		if !p.acceptKeyword("with") {
+			return "", p.errorAt(t, "expected 'ends with'")
+		}
+		return QueryEndsWith, nil
+	}
+	return "", p.errorAt(t, "expected an operator, one of is, is not, =, !=, contains, starts with or ends with, got "+t.describe())
+}
+
+// keyValue reads key:value, the value may also be the quoted string after
+// key:.
+func (p *queryParser) keyValue(t queryToken, key, value string) (ContactQuery, error) {
+	condition, ok := contactQueryKeys[key]
+	if !ok {
+		keys := make([]string, 0, len(contactQueryKeys))
+		for key := range contactQueryKeys {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		return nil, p.errorAt(t, fmt.Sprintf("unknown condition '%s:', expected one of %s", key, strings.Join(keys, ", ")))
+	}
+
+	if value == "" {
+		if next, ok := p.peek(); ok && next.kind == queryString {
+			p.pos++
+			value = next.text
+		}
+	}
+
+	switch condition.Operator {
+	case QueryHas:
+		value = NormalizeTag(value)
+		if !ValidTag(value) {
+			return nil, p.errorAt(t, "invalid tag '"+value+"'")
+		}
+	default:
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			return nil, p.errorAt(t, "invalid date '"+value+"', expected YYYY-MM-DD")
+		}
+	}
+
+	condition.Value = value
+	return condition, nil
+}
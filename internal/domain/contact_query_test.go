@@ -0,0 +1,138 @@
+package domain
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseContactQuery(t *testing.T) {
+	is := func(field, value string) QueryCondition {
+		return QueryCondition{Field: field, Operator: QueryIs, Value: value}
+	}
+	tag := func(value string) QueryCondition {
+		return QueryCondition{Field: "tags", Operator: QueryHas, Value: value}
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want ContactQuery
+	}{
+		{"condition", "name = ada", is("name", "ada")},
+		{"keywords in any case", "NAME Is Not ada", QueryCondition{Field: "name", Operator: QueryIsNot, Value: "ada"}},
+		{"not equal", "email != ada@example.com", QueryCondition{Field: "email", Operator: QueryIsNot, Value: "ada@example.com"}},
+		{"two word operator", "email ends with @acme.com", QueryCondition{Field: "email", Operator: QueryEndsWith, Value: "@acme.com"}},
+		{"key value", "created_after:2026-01-01", QueryCondition{Field: "created_at", Operator: QueryAfter, Value: "2026-01-01"}},
+		{"tag is normalized", `tag:"VIP"`, tag("vip")},
+
+		{"and binds tighter than or", "name = a OR name = b AND tag:vip",
+			QueryOr{is("name", "a"), QueryAnd{is("name", "b"), tag("vip")}}},
+		{"and before or", "name = a AND name = b OR tag:vip",
+			QueryOr{QueryAnd{is("name", "a"), is("name", "b")}, tag("vip")}},
+		{"parentheses group", "(name = a OR name = b) AND tag:vip",
+			QueryAnd{QueryOr{is("name", "a"), is("name", "b")}, tag("vip")}},
+		{"not binds tighter than and", "NOT tag:vip AND name = a",
+			QueryAnd{QueryNot{Query: tag("vip")}, is("name", "a")}},
+		{"not of a group", "not (tag:a or tag:b)",
+			QueryNot{Query: QueryOr{tag("a"), tag("b")}}},
+		{"double not", "NOT NOT tag:vip", QueryNot{Query: QueryNot{Query: tag("vip")}}},
+		{"redundant parentheses", "((tag:vip))", tag("vip")},
+
+		{"quoted value with spaces", `name = "Ada Lovelace"`, is("name", "Ada Lovelace")},
+		{"escaped quote", `name = "Ada \"The\" Lovelace"`, is("name", `Ada "The" Lovelace`)},
+		{"escaped backslash", `name contains "a\\b"`, QueryCondition{Field: "name", Operator: QueryContains, Value: `a\b`}},
+		{"special characters in quotes", `name = "(a) = !b OR c"`, is("name", "(a) = !b OR c")},
+		{"empty quoted value", `name = ""`, is("name", "")},
+		{"keyword as a quoted value", `name = "and"`, is("name", "and")},
+		{"no spaces around =", "name=ada", is("name", "ada")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseContactQuery(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %#v, want %#v", got, tt.want)
+			}
+
+			// The canonical form reads back to the same query.
+			again, err := ParseContactQuery(got.String())
+			if err != nil || !reflect.DeepEqual(again, got) {
+				t.Fatalf("%q reads back as %#v, %v", got.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseContactQueryErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		offset  int
+		message string
+	}{
+		{"empty", "", 0, "expected a condition"},
+		{"missing value", "name =", 6, "expected a value"},
+		{"missing operator", "name", 4, "expected an operator"},
+		{"dangling and", "name = ada AND", 14, "expected a condition"},
+		{"dangling not", "tag:vip AND NOT", 15, "expected a condition"},
+		{"value is a parenthesis", "name = (", 7, "expected a value, got '('"},
+		{"unclosed parenthesis", "(name = a", 9, "expected ')'"},
+		{"unopened parenthesis", "name = a)", 8, "unexpected ')'"},
+		{"condition is a parenthesis", ")", 0, "expected a condition, got ')'"},
+		{"missing and", "name = a name = b", 9, "unexpected 'name'"},
+		{"unterminated string", `name = "ada`, 7, "unterminated string"},
+		{"escape at the end", `name = "ada\`, 7, "unterminated string"},
+		{"lone bang", "name ! a", 5, "expected '!='"},
+
+		{"unknown field", "age = 3", 0, "unknown field 'age'"},
+		{"unknown field later on", "tag:vip OR age = 3", 11, "unknown field 'age'"},
+		{"unknown operator", "name like a", 5, "expected an operator"},
+		{"operator is a value", `name "ada"`, 5, `expected an operator, one of is, is not, =, !=, contains, starts with or ends with, got "ada"`},
+		{"half an operator", "name starts a", 5, "expected 'starts with'"},
+		{"unknown key", "foo:bar", 0, "unknown condition 'foo:'"},
+		{"invalid date", "created_after:2026-13-01", 0, "invalid date '2026-13-01'"},
+		{"missing date", "created_after:", 0, "invalid date ''"},
+		{"invalid tag", `tag:"bad tag"`, 0, "invalid tag 'bad tag'"},
+
+		{"nested parentheses", strings.Repeat("(", 20) + "tag:a" + strings.Repeat(")", 20), 20, "nested deeper than 20 levels"},
+		{"nested nots", strings.Repeat("NOT ", 20) + "tag:a", 80, "nested deeper than 20 levels"},
+		{"too long", "name = " + strings.Repeat("a", MaxContactQueryLength-6), MaxContactQueryLength, "longer than 1000 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseContactQuery(tt.in)
+			queryErr, ok := err.(*QueryError)
+			if !ok {
+				t.Fatalf("error %v, want a *QueryError", err)
+			}
+			if queryErr.Offset != tt.offset || !strings.Contains(queryErr.Message, tt.message) {
+				t.Fatalf("error %q at %d, want %q at %d", queryErr.Message, queryErr.Offset, tt.message, tt.offset)
+			}
+		})
+	}
+}
+
+func TestParseContactQueryLimits(t *testing.T) {
+	limits := map[string]string{
+		"parentheses": strings.Repeat("(", 19) + "tag:a" + strings.Repeat(")", 19),
+		"nots":        strings.Repeat("NOT ", 19) + "tag:a",
+		"length":      "name = " + strings.Repeat("a", MaxContactQueryLength-7),
+	}
+	for name, in := range limits {
+		if _, err := ParseContactQuery(in); err != nil {
+			t.Fatalf("%s at the limit: %v", name, err)
+		}
+	}
+}
+
+func TestQueryErrorPosition(t *testing.T) {
+	_, err := ParseContactQuery("name = ada AND")
+	if err == nil || err.Error() != "expected a condition at position 15" {
+		t.Fatalf("error %v, want the 1-based position", err)
+	}
+}
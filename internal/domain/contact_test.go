@@ -0,0 +1,91 @@
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestContactProject(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	contact := Contact{
+		Id:        1,
+		Name:      "Ada",
+		Email:     "ada@example.com",
+		Phone:     "+6281234567890",
+		Birthday:  PartialDate{Month: time.December, Day: 10},
+		Tags:      []string{"family"},
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+
+	tests := []struct {
+		name    string
+		contact Contact
+		want    string
+	}{
+		{
+			name:    "full",
+			contact: contact,
+			want: `{"id":1,"name":"Ada","email":"ada@example.com","phone":"+6281234567890",` +
+				`"birthday":"--12-10","anniversary":null,"dates":null,"tags":["family"],"last_contacted_at":null,` +
+				`"created_at":"2024-01-02T03:04:05Z","updated_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "empty projection",
+			contact: contact.Project(nil),
+			want: `{"id":1,"name":"Ada","email":"ada@example.com","phone":"+6281234567890",` +
+				`"birthday":"--12-10","anniversary":null,"dates":null,"tags":["family"],"last_contacted_at":null,` +
+				`"created_at":"2024-01-02T03:04:05Z","updated_at":"2024-01-02T03:04:05Z"}`,
+		},
+		{
+			name:    "projection keeps id and field order",
+			contact: contact.Project([]string{"tags", "name"}),
+			want:    `{"id":1,"name":"Ada","tags":["family"]}`,
+		},
+		{
+			name:    "projected zero values are rendered",
+			contact: contact.Project([]string{"anniversary", "last_contacted_at"}),
+			want:    `{"id":1,"anniversary":null,"last_contacted_at":null}`,
+		},
+		{
+			name: "embedded groups survive the projection",
+			contact: func() Contact {
+				c := contact
+				c.Groups = []Group{{Id: 2, Name: "Family", CreatedAt: created, UpdatedAt: created}}
+				return c.Project([]string{"name"})
+			}(),
+			want: `{"id":1,"name":"Ada","groups":[{"id":2,"name":"Family","filter":"",` +
+				`"created_at":"2024-01-02T03:04:05Z","updated_at":"2024-01-02T03:04:05Z"}]}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.contact)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// The cache stores contacts as JSON, the full rendering has to read back.
+func TestContactJSONRoundTrip(t *testing.T) {
+	contact := Contact{Id: 1, Name: "Ada", Birthday: PartialDate{Year: 1990, Month: time.February, Day: 28}}
+
+	raw, err := json.Marshal(contact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Contact
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != contact.Id || got.Name != contact.Name || got.Birthday != contact.Birthday || !got.Anniversary.IsZero() {
+		t.Fatalf("read back %+v, want %+v", got, contact)
+	}
+}
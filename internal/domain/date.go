@@ -0,0 +1,201 @@
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// PartialDate is a calendar day whose year may be unknown. It is written as
+// 2006-01-02, or as --01-02 without the year like vCard does.
+type PartialDate struct {
+	// Year is 0 when unknown.
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// ContactDate is a labelled date of a contact, e.g. "Name day".
+type ContactDate struct {
+	Label string      `json:"label"`
+	Date  PartialDate `json:"date"`
+}
+
+const (
+	OccasionBirthday    = "birthday"
+	OccasionAnniversary = "anniversary"
+	OccasionDate        = "date"
+)
+
+// Occasion is a yearly recurring date of a contact, On is set when it is
+// listed as upcoming.
+type Occasion struct {
+	ContactId int         `json:"contact_id"`
+	Name      string      `json:"name"`
+	Kind      string      `json:"kind"`
+	Label     string      `json:"label,omitzero"`
+	Date      PartialDate `json:"date"`
+	On        PartialDate `json:"on,omitzero"`
+	DaysUntil int         `json:"days_until"`
+	// Years is the age turned or years since the anniversary, 0 when the year is unknown.
+	Years int `json:"years,omitzero"`
+}
+
+// Occasions lists the birthday, anniversary and labelled dates of c.
+func (c Contact) Occasions() []Occasion {
+	var occasions []Occasion
+	add := func(kind, label string, date PartialDate) {
+		if !date.IsZero() {
+			occasions = append(occasions, Occasion{ContactId: c.Id, Name: c.Name, Kind: kind, Label: label, Date: date})
+		}
+	}
+
+	add(OccasionBirthday, "", c.Birthday)
+	add(OccasionAnniversary, "", c.Anniversary)
+	for _, d := range c.Dates {
+		add(OccasionDate, d.Label, d.Date)
+	}
+	return occasions
+}
+
+func ParsePartialDate(s string) (PartialDate, error) {
+	invalid := fmt.Errorf("invalid date %q, want YYYY-MM-DD or --MM-DD", s)
+	if len(s) != 7 && len(s) != 10 {
+		return PartialDate{}, invalid
+	}
+
+	// Both forms end in -MM-DD, led by the year or by a dash.
+	var d PartialDate
+	if len(s) == 10 {
+		year, ok := digits(s[:4])
+		if !ok || year < 1 {
+			return PartialDate{}, invalid
+		}
+		d.Year = year
+		s = s[4:]
+	} else if s[0] == '-' {
+		s = s[1:]
+	}
+
+	month, okMonth := digits(s[1:3])
+	day, okDay := digits(s[4:6])
+	if s[0] != '-' || s[3] != '-' || !okMonth || !okDay || month < 1 || month > 12 || day < 1 {
+		return PartialDate{}, invalid
+	}
+	d.Month, d.Day = time.Month(month), day
+
+	// Without a year Feb 29 is fine, with one it has to be a leap year.
+	year := d.Year
+	if year == 0 {
+		year = 2000
+	}
+	if day > daysIn(year, d.Month) {
+		return PartialDate{}, invalid
+	}
+
+	return d, nil
+}
+
+// MonthDay is the day of the year d falls on, written "MM-DD".
+func (d PartialDate) MonthDay() string {
+	return fmt.Sprintf("%02d-%02d", int(d.Month), d.Day)
+}
+
+// MonthDays lists the "MM-DD" days of the days days from from on, the days a
+// yearly date has to fall on to come up in that window. "02-29" is listed with
+// Feb 28 of a common year, where it falls. It is nil when the window covers
+// the whole year.
+func MonthDays(from time.Time, days int) []string {
+	if days >= 366 {
+		return nil
+	}
+
+	monthDays := make([]string, 0, days+1)
+	for i := range days {
+		day := from.AddDate(0, 0, i)
+		d := PartialDate{Month: day.Month(), Day: day.Day()}
+		monthDays = append(monthDays, d.MonthDay())
+		if d.Month == time.February && d.Day == 28 && daysIn(day.Year(), time.February) == 28 {
+			monthDays = append(monthDays, "02-29")
+		}
+	}
+	return monthDays
+}
+
+// parseOptionalDate is ParsePartialDate where "" is the zero date.
+func parseOptionalDate(s string) (PartialDate, error) {
+	if s == "" {
+		return PartialDate{}, nil
+	}
+	return ParsePartialDate(s)
+}
+
+func (d PartialDate) IsZero() bool {
+	return d.Month == 0
+}
+
+func (d PartialDate) HasYear() bool {
+	return d.Year != 0
+}
+
+func (d PartialDate) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	if !d.HasYear() {
+		return fmt.Sprintf("--%02d-%02d", int(d.Month), d.Day)
+	}
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, int(d.Month), d.Day)
+}
+
+func (d PartialDate) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// MarshalJSON renders an unknown date as null.
+func (d PartialDate) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+func (d *PartialDate) UnmarshalText(text []byte) error {
+	parsed, err := ParsePartialDate(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// In returns the day d falls on in year, as midnight UTC. Feb 29 falls on
+// Feb 28 in common years.
+func (d PartialDate) In(year int) time.Time {
+	return time.Date(year, d.Month, min(d.Day, daysIn(year, d.Month)), 0, 0, 0, 0, time.UTC)
+}
+
+// Next returns the first day d falls on from the day of from on.
+func (d PartialDate) Next(from time.Time) time.Time {
+	today := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	if next := d.In(today.Year()); !next.Before(today) {
+		return next
+	}
+	return d.In(today.Year() + 1)
+}
+
+// digits parses s when it only has digits, strconv.Atoi also takes signs.
+func digits(s string) (int, bool) {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
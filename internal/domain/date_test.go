@@ -0,0 +1,170 @@
+package domain
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestParsePartialDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want PartialDate
+		ok   bool
+	}{
+		{"1992-02-29", PartialDate{Year: 1992, Month: time.February, Day: 29}, true},
+		{"2000-02-29", PartialDate{Year: 2000, Month: time.February, Day: 29}, true},
+		{"2023-12-31", PartialDate{Year: 2023, Month: time.December, Day: 31}, true},
+		{"0001-01-01", PartialDate{Year: 1, Month: time.January, Day: 1}, true},
+		{"--02-29", PartialDate{Month: time.February, Day: 29}, true},
+		{"--06-14", PartialDate{Month: time.June, Day: 14}, true},
+
+		{"1993-02-29", PartialDate{}, false},
+		{"1900-02-29", PartialDate{}, false},
+		{"--02-30", PartialDate{}, false},
+		{"--04-31", PartialDate{}, false},
+		{"2023-13-01", PartialDate{}, false},
+		{"2023-00-10", PartialDate{}, false},
+		{"2023-01-00", PartialDate{}, false},
+		{"0000-01-01", PartialDate{}, false},
+		{"-02-28", PartialDate{}, false},
+		{"---02-28", PartialDate{}, false},
+		{"+992-02-28", PartialDate{}, false},
+		{"1992/02/28", PartialDate{}, false},
+		{"--0228", PartialDate{}, false},
+		{"", PartialDate{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePartialDate(tt.in)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error %v, want ok %v", err, tt.ok)
+			}
+			if got != tt.want {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			if tt.ok && got.String() != tt.in {
+				t.Fatalf("String() = %q, want %q", got.String(), tt.in)
+			}
+		})
+	}
+}
+
+func TestPartialDateIn(t *testing.T) {
+	leapDay := PartialDate{Month: time.February, Day: 29}
+
+	tests := []struct {
+		name string
+		date PartialDate
+		year int
+		want time.Time
+	}{
+		{"leap day in a leap year", leapDay, 2024, day(2024, time.February, 29)},
+		{"leap day in a common year", leapDay, 2023, day(2023, time.February, 28)},
+		{"leap day in a century", leapDay, 1900, day(1900, time.February, 28)},
+		{"leap day in a 400th year", leapDay, 2000, day(2000, time.February, 29)},
+		{"year of the date is ignored", PartialDate{Year: 1990, Month: time.June, Day: 14}, 2025, day(2025, time.June, 14)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.date.In(tt.year); !got.Equal(tt.want) {
+				t.Fatalf("In(%d) = %s, want %s", tt.year, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartialDateNext(t *testing.T) {
+	leapDay := PartialDate{Month: time.February, Day: 29}
+	newYearsEve := PartialDate{Month: time.December, Day: 31}
+	newYear := PartialDate{Year: 1990, Month: time.January, Day: 1}
+
+	tests := []struct {
+		name string
+		date PartialDate
+		from time.Time
+		want time.Time
+	}{
+		{"today", newYearsEve, day(2024, time.December, 31), day(2024, time.December, 31)},
+		{"later this year", newYearsEve, day(2024, time.June, 1), day(2024, time.December, 31)},
+		{"wraps into next year", newYear, day(2024, time.December, 31), day(2025, time.January, 1)},
+		{"new year on new year", newYear, day(2025, time.January, 1), day(2025, time.January, 1)},
+		{"leap day ahead in a leap year", leapDay, day(2024, time.February, 1), day(2024, time.February, 29)},
+		{"leap day ahead in a common year", leapDay, day(2023, time.February, 1), day(2023, time.February, 28)},
+		{"leap day on Feb 28 of a common year", leapDay, day(2023, time.February, 28), day(2023, time.February, 28)},
+		{"leap day passed wraps to a leap year", leapDay, day(2023, time.March, 1), day(2024, time.February, 29)},
+		{"leap day passed wraps to a common year", leapDay, day(2024, time.March, 1), day(2025, time.February, 28)},
+		{"time of day and zone are dropped", newYearsEve, time.Date(2024, time.December, 31, 23, 59, 0, 0, time.FixedZone("UTC+7", 7*3600)), day(2024, time.December, 31)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.date.Next(tt.from); !got.Equal(tt.want) {
+				t.Fatalf("Next(%s) = %s, want %s", tt.from.Format(time.DateOnly), got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+			}
+		})
+	}
+}
+
+func TestMonthDays(t *testing.T) {
+	tests := []struct {
+		name string
+		from time.Time
+		days int
+		want []string
+	}{
+		{"wraps the year", day(2024, time.December, 30), 4, []string{"12-30", "12-31", "01-01", "01-02"}},
+		{"leap year has its own Feb 29", day(2024, time.February, 27), 4, []string{"02-27", "02-28", "02-29", "03-01"}},
+		{"common year lists Feb 29 with Feb 28", day(2023, time.February, 27), 3, []string{"02-27", "02-28", "02-29", "03-01"}},
+		{"no days", day(2024, time.June, 1), 0, []string{}},
+		{"whole year", day(2024, time.June, 1), 366, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := MonthDays(tt.from, tt.days)
+			if !slices.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContactDatesRequestApplyTo(t *testing.T) {
+	birthday := PartialDate{Year: 1992, Month: time.February, Day: 29}
+	anniversary := PartialDate{Month: time.June, Day: 14}
+	current := Contact{Birthday: birthday, Anniversary: anniversary, Dates: []ContactDate{{Label: "Name day", Date: anniversary}}}
+
+	empty, newBirthday := "", "--03-01"
+	tests := []struct {
+		name string
+		req  ContactDatesRequest
+		want Contact
+	}{
+		{"absent dates are kept", ContactDatesRequest{}, current},
+		{"only the birthday changes", ContactDatesRequest{Birthday: &newBirthday},
+			Contact{Birthday: PartialDate{Month: time.March, Day: 1}, Anniversary: anniversary, Dates: current.Dates}},
+		{"empty values remove them", ContactDatesRequest{Birthday: &empty, Anniversary: &empty, Dates: &[]ContactDateRequest{}},
+			Contact{Dates: []ContactDate{}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update ContactUpdate
+			if err := tt.req.ApplyTo(&update); err != nil {
+				t.Fatal(err)
+			}
+			got := current
+			update.ApplyTo(&got)
+			if got.Birthday != tt.want.Birthday || got.Anniversary != tt.want.Anniversary || !slices.Equal(got.Dates, tt.want.Dates) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
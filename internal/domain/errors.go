@@ -0,0 +1,12 @@
+package domain
+
+import "errors"
+
+// Every repository implementation returns these, so handlers can map them to
+// status codes without knowing the storage behind.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrEmailTaken = errors.New("email already exists")
+	// ErrUnavailable means the storage is down, the request may succeed later.
+	ErrUnavailable = errors.New("storage unavailable")
+)
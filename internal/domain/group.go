@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+type Group struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// Filter is the ParseContactQuery expression of a smart group, whose
+	// members are the contacts it matches right now. It is empty for a
+	// static group, whose members are kept in contact_groups.
+	Filter    string    `json:"filter"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Contacts  []Contact `json:"contacts,omitzero"`
+}
+
+// GroupIncludes are the relations that can be embedded with ?include=.
+// Embedded contacts are the static members, smart groups have none.
+var GroupIncludes = []string{"contacts"}
+
+// ErrStaticGroup is a write to a static group, only smart groups can be
+// changed through the API.
+var ErrStaticGroup = errors.New("group is not a smart group")
+
+func (g Group) Smart() bool {
+	return g.Filter != ""
+}
+
+// SmartGroupRequest is the body of POST /api/groups and PUT /api/groups/{id}.
+type SmartGroupRequest struct {
+	Name   string `json:"name" validate:"required,max=100"`
+	Filter string `json:"filter" validate:"required,max=1000"`
+}
+
+// PreviewGroupRequest is the body of POST /api/groups/preview.
+type PreviewGroupRequest struct {
+	Filter string `json:"filter" validate:"required,max=1000"`
+}
+
+type GroupRepository interface {
+	Paginate(ctx context.Context, page int, limit int) ([]Group, int64, error)
+	GetById(ctx context.Context, id int) (*Group, error)
+	GetByContactIds(ctx context.Context, contactIds []int) (map[int][]Group, error)
+	Count(ctx context.Context) (int64, error)
+	Store(ctx context.Context, group *Group) (*Group, error)
+	Update(ctx context.Context, id int, group *Group) (*Group, error)
+	Delete(ctx context.Context, id int) error
+}
+
+type GroupService interface {
+	Paginate(ctx context.Context, page int, limit int, opts QueryOptions) ([]Group, int64, error)
+	GetById(ctx context.Context, id int, opts QueryOptions) (*Group, error)
+	// Contacts lists the members of a group, a smart group's filter is
+	// evaluated on every call.
+	Contacts(ctx context.Context, id int, page int, limit int, opts QueryOptions) ([]Contact, int64, error)
+	// Preview lists the contacts a filter matches, to try it before saving.
+	// An invalid filter is a *QueryError.
+	Preview(ctx context.Context, filter string, page int, limit int, opts QueryOptions) ([]Contact, int64, error)
+	// Store creates a smart group, an invalid filter is a *QueryError.
+	Store(ctx context.Context, req *SmartGroupRequest) (*Group, error)
+	// Update and Delete only change smart groups, a static group is
+	// ErrStaticGroup.
+	Update(ctx context.Context, id int, req *SmartGroupRequest) (*Group, error)
+	Delete(ctx context.Context, id int) error
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// QueryOptions carries the ?fields= projection, ?include= relations,
+// ?sort= order and filters of a read request. An empty Fields selects every
+// column.
+type QueryOptions struct {
+	Fields  []string
+	Include []string
+	Sort    Sort
+	Filter  ContactFilter
+}
+
+// ContactFilter narrows a list of contacts, the zero filter matches all.
+type ContactFilter struct {
+	Tags TagFilter
+	// GroupId keeps the members of a group, unless it is 0.
+	GroupId int
+	// Query keeps the contacts a smart group's filter matches, unless it is
+	// nil.
+	Query ContactQuery
+}
+
+func (f ContactFilter) IsZero() bool {
+	return len(f.Tags) == 0 && f.GroupId == 0 && f.Query == nil
+}
+
+func (f ContactFilter) String() string {
+	query := ""
+	if f.Query != nil {
+		query = f.Query.String()
+	}
+	return fmt.Sprintf("tags=%s group_id=%d query=%q", f.Tags, f.GroupId, query)
+}
+
+// Sort orders a list by one column, the zero Sort is by id. A missing value
+// sorts before every other, so ascending by last_contacted_at starts with the
+// contacts never talked to.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+func (o QueryOptions) Includes(relation string) bool {
+	return slices.Contains(o.Include, relation)
+}
+
+// Columns are the keys of a record rendered with these options: id and the
+// selected fields in the order of all, or all of them without ?fields=,
+// followed by the includes.
+func (o QueryOptions) Columns(all []string) []string {
+	columns := all
+	if len(o.Fields) > 0 {
+		columns = nil
+		for _, field := range all {
+			if field == "id" || slices.Contains(o.Fields, field) {
+				columns = append(columns, field)
+			}
+		}
+	}
+	return append(slices.Clone(columns), o.Include...)
+}
+
+// Fingerprint summarizes a table, it changes whenever a row is added, updated
+// or deleted, so it can back an ETag without reading the rows.
+type Fingerprint struct {
+	LastUpdated time.Time
+	Count       int64
+}
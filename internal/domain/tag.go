@@ -0,0 +1,98 @@
+package domain
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MaxTagLength is the longest tag, in bytes.
+const MaxTagLength = 50
+
+// tagPattern is a normalized tag: lowercase letters, digits, - and _.
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Tag is a label in use and how many contacts carry it.
+type Tag struct {
+	Name     string `json:"name"`
+	Contacts int64  `json:"contacts"`
+}
+
+// NormalizeTag trims and lowercases a tag, tags compare in that form.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// ValidTag reports whether tag is a normalized tag, like vip or q3-lead.
+func ValidTag(tag string) bool {
+	return len(tag) <= MaxTagLength && tagPattern.MatchString(tag)
+}
+
+// NormalizeTags normalizes every tag, sorted and without duplicates.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		normalized = append(normalized, NormalizeTag(tag))
+	}
+	slices.Sort(normalized)
+	return slices.Compact(normalized)
+}
+
+// TagFilter matches contacts by tags. Every clause must match, a clause
+// matches the contacts with any of its tags.
+type TagFilter [][]string
+
+var errInvalidTagFilter = errors.New("tags must be tags joined by , for AND and | for OR, like vip,q3-lead|needs-followup")
+
+// ParseTagFilter reads a filter like vip,q3-lead|needs-followup, vip and
+// either q3-lead or needs-followup. AND binds looser than OR.
+func ParseTagFilter(s string) (TagFilter, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var filter TagFilter
+	for clause := range strings.SplitSeq(s, ",") {
+		var tags []string
+		for tag := range strings.SplitSeq(clause, "|") {
+			tag = NormalizeTag(tag)
+			if !ValidTag(tag) {
+				return nil, errInvalidTagFilter
+			}
+			tags = append(tags, tag)
+		}
+		slices.Sort(tags)
+		filter = append(filter, slices.Compact(tags))
+	}
+	return filter, nil
+}
+
+// Matches reports whether a contact with tags passes the filter.
+func (f TagFilter) Matches(tags []string) bool {
+	for _, clause := range f {
+		if !slices.ContainsFunc(clause, func(tag string) bool { return slices.Contains(tags, tag) }) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f TagFilter) String() string {
+	clauses := make([]string, len(f))
+	for i, clause := range f {
+		clauses[i] = strings.Join(clause, "|")
+	}
+	return strings.Join(clauses, ",")
+}
+
+// RenameTagRequest is the body of PUT /api/tags/{name}.
+type RenameTagRequest struct {
+	Name string `json:"name" validate:"required,tag"`
+}
+
+// MergeTagsRequest is the body of POST /api/tags/merge.
+type MergeTagsRequest struct {
+	Sources []string `json:"sources" validate:"required,min=1,max=50,dive,tag"`
+	Target  string   `json:"target" validate:"required,tag"`
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/internal/snapshot"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+)
+
+// archiveField is the multipart form field a restore reads the archive from.
+const archiveField = "archive"
+
+type BackupHandler struct {
+	db       *database.DB
+	migrator *database.Migrator
+	// timeout bounds a whole backup or restore, well past the server's
+	// read and write timeouts.
+	timeout time.Duration
+	// invalidate drops cached contacts after a restore changed them.
+	invalidate func(ctx context.Context)
+}
+
+// NewBackupHandler needs Postgres, invalidate may be nil without a cache.
+func NewBackupHandler(db *database.DB, migrator *database.Migrator, timeout time.Duration, invalidate func(ctx context.Context)) *BackupHandler {
+	if invalidate == nil {
+		invalidate = func(ctx context.Context) {}
+	}
+	return &BackupHandler{
+		db:         db,
+		migrator:   migrator,
+		timeout:    timeout,
+		invalidate: invalidate,
+	}
+}
+
+// Backup streams a snapshot archive of the contacts, groups and memberships,
+// see the snapshot package for its layout.
+func (h *BackupHandler) Backup(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+	// Not every ResponseWriter supports deadlines, the server's then apply.
+	http.NewResponseController(w).SetWriteDeadline(time.Now().Add(h.timeout))
+
+	status, err := h.migrator.Version(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("backup schema version", "error", err)
+		writeServerError(w, r, err, "Error creating backup")
+		return
+	}
+
+	name := "contacts-" + time.Now().UTC().Format("20060102T150405Z") + ".zip"
+	out := &trackedWriter{w: w}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("Cache-Control", "no-store")
+
+	manifest, err := snapshot.Write(ctx, h.db.Pool, status.Version, out)
+	if err != nil {
+		logger.FromContext(ctx).Error("backup", "error", err)
+		if !out.written {
+			w.Header().Del("Content-Disposition")
+			writeServerError(w, r, err, "Error creating backup")
+			return
+		}
+		// The status is sent already. The archive's central directory is
+		// written last, a cut short archive does not open.
+		return
+	}
+
+	logger.FromContext(ctx).Info("backup written", "schema_version", manifest.SchemaVersion,
+		"groups", manifest.Rows["groups"], "contacts", manifest.Rows["contacts"], "memberships", manifest.Rows["contact_groups"])
+}
+
+// trackedWriter tells whether anything reached the client yet.
+type trackedWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (t *trackedWriter) Write(p []byte) (int, error) {
+	t.written = true
+	return t.w.Write(p)
+}
+
+// Restore applies a snapshot archive, sent as the raw body or as the archive
+// field of a multipart form. ?mode=merge, the default, inserts and updates
+// rows, ?mode=replace also deletes the rows missing from the archive. With
+// ?dry_run=true nothing changes, the report tells what would.
+func (h *BackupHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	mode, dryRun, errs := parseRestoreOptions(r)
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.timeout)
+	defer cancel()
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Now().Add(h.timeout))
+	controller.SetWriteDeadline(time.Now().Add(h.timeout))
+
+	// A zip is read from its end, the upload is spooled to disk first.
+	file, err := os.CreateTemp("", "restore-*.zip")
+	if err != nil {
+		logger.FromContext(ctx).Error("restore temp file", "error", err)
+		response.WriteError(w, r, "Error restoring backup", http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	size, err := receiveArchive(r, file)
+	if err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+
+	archive, err := snapshot.Open(file, size)
+	if err != nil {
+		h.writeRestoreError(w, r, err)
+		return
+	}
+
+	status, err := h.migrator.Version(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Error("restore schema version", "error", err)
+		writeServerError(w, r, err, "Error restoring backup")
+		return
+	}
+
+	report, err := snapshot.Apply(ctx, h.db.Pool, archive, status.Version, mode, dryRun)
+	if err != nil {
+		h.writeRestoreError(w, r, err)
+		return
+	}
+
+	if dryRun {
+		response.WriteSuccess(w, r, report, "Restore preview, nothing was changed", http.StatusOK)
+		return
+	}
+
+	h.invalidate(ctx)
+	logger.FromContext(ctx).Info("backup restored", "mode", mode, "taken_at", archive.Manifest.CreatedAt)
+	response.WriteSuccess(w, r, report, "Backup restored successfully", http.StatusOK)
+}
+
+// parseRestoreOptions reads ?mode=, merge by default, and ?dry_run=.
+func parseRestoreOptions(r *http.Request) (snapshot.Mode, bool, map[string]string) {
+	query := r.URL.Query()
+	errs := map[string]string{}
+
+	mode := snapshot.ModeMerge
+	if value := query.Get("mode"); value != "" {
+		mode = snapshot.Mode(value)
+		if mode != snapshot.ModeMerge && mode != snapshot.ModeReplace {
+			errs["mode"] = "must be merge or replace"
+		}
+	}
+
+	dryRun := false
+	if value := query.Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			errs["dry_run"] = "must be true or false"
+		}
+	}
+
+	return mode, dryRun, errs
+}
+
+// receiveArchive copies the archive of the request, the raw body or the
+// archive field of a multipart form, into dst and returns its size.
+func receiveArchive(r *http.Request, dst io.Writer) (int64, error) {
+	body := io.Reader(r.Body)
+
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		reader, err := r.MultipartReader()
+		if err != nil {
+			return 0, err
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return 0, http.ErrMissingFile
+			}
+			if err != nil {
+				return 0, err
+			}
+			if part.FormName() == archiveField {
+				body = part
+				break
+			}
+		}
+	}
+
+	return io.Copy(dst, body)
+}
+
+// writeUploadError answers a failed receiveArchive.
+func writeUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		response.WriteError(w, r, "Request body too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, http.ErrMissingFile):
+		response.WriteValidationErrors(w, r, map[string]string{archiveField: "is required"}, http.StatusBadRequest)
+	default:
+		logger.FromContext(r.Context()).Warn("archive upload", "error", err)
+		response.WriteError(w, r, "Invalid request payload", http.StatusBadRequest)
+	}
+}
+
+func (h *BackupHandler) writeRestoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, snapshot.ErrInvalidArchive):
+		response.WriteValidationErrors(w, r, map[string]string{archiveField: err.Error()}, http.StatusBadRequest)
+	case errors.Is(err, snapshot.ErrSchemaMismatch), errors.Is(err, snapshot.ErrConflict):
+		response.WriteError(w, r, err.Error(), http.StatusConflict)
+	default:
+		logger.FromContext(r.Context()).Error("restore", "error", err)
+		writeServerError(w, r, err, "Error restoring backup")
+	}
+}
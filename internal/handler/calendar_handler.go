@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/ical"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+)
+
+const (
+	defaultUpcomingDays = 30
+	maxUpcomingDays     = 366
+)
+
+// calendarYear starts the events of dates without a year, a leap year so Feb 29 exists.
+const calendarYear = 2000
+
+type CalendarHandler struct {
+	contacts domain.ContactService
+	groups   domain.GroupService
+	// refresh is how often subscribed calendar apps are asked to fetch the feed.
+	refresh time.Duration
+}
+
+func NewCalendarHandler(contacts domain.ContactService, groups domain.GroupService, refresh time.Duration) *CalendarHandler {
+	return &CalendarHandler{
+		contacts: contacts,
+		groups:   groups,
+		refresh:  refresh,
+	}
+}
+
+// Upcoming lists the birthdays, anniversaries and labelled dates of the next
+// ?days= days, today included, with today taken in the ?tz= time zone.
+func (h *CalendarHandler) Upcoming(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	errs := make(map[string]string)
+
+	days := defaultUpcomingDays
+	if value := query.Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxUpcomingDays {
+			errs["days"] = fmt.Sprintf("days must be a number from 1 to %d", maxUpcomingDays)
+		}
+		days = n
+	}
+
+	location := time.UTC
+	if value := query.Get("tz"); value != "" {
+		var err error
+		if location, err = time.LoadLocation(value); err != nil {
+			errs["tz"] = "tz must be a time zone like Asia/Jakarta"
+		}
+	}
+
+	group, ok := h.parseGroup(w, r, errs)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	occasions, err := h.contacts.Upcoming(ctx, time.Now().In(location), days, group.Id)
+	if err != nil {
+		logger.FromContext(ctx).Error("upcoming dates", "error", err)
+		writeServerError(w, r, err, "Error get upcoming dates")
+		return
+	}
+
+	response.WriteSuccess(w, r, occasions, "Upcoming dates retrieved successfully", http.StatusOK)
+}
+
+// Feed is an iCalendar feed of every date as a yearly all-day event, only of
+// the members of ?group_id= when given.
+func (h *CalendarHandler) Feed(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.parseGroup(w, r, make(map[string]string))
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	name := "Contacts"
+	if group.Id > 0 {
+		name += ": " + group.Name
+	} else if h.notModified(w, r) {
+		// Memberships do not show in the fingerprint, a group's feed is always sent.
+		return
+	}
+
+	contacts, stop, err := peekError(h.contacts.GetDated(ctx, group.Id))
+	defer stop()
+	if err != nil {
+		logger.FromContext(ctx).Error("calendar contacts", "error", err)
+		writeServerError(w, r, err, "Error get calendar")
+		return
+	}
+
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": "contacts.ics"}))
+	w.WriteHeader(http.StatusOK)
+
+	cal := ical.NewWriter(w, ical.Calendar{
+		ProdId:          "-//rest-api-contact-person//Contacts//EN",
+		Name:            name,
+		RefreshInterval: h.refresh,
+	})
+	for contact, err := range contacts {
+		if err != nil {
+			// The status is sent, the client gets a calendar without its end.
+			logger.FromContext(ctx).Error("stream calendar", "error", err)
+			return
+		}
+
+		for _, o := range contact.Occasions() {
+			if err := cal.Event(occasionEvent(contact, o)); err != nil {
+				return
+			}
+		}
+	}
+	if err := cal.Close(); err != nil {
+		logger.FromContext(ctx).Warn("write calendar", "error", err)
+	}
+}
+
+// parseGroup reads ?group_id= into errs and answers 400 with every error in
+// errs, 404 for a group that does not exist. Without ?group_id= the group has
+// id 0.
+func (h *CalendarHandler) parseGroup(w http.ResponseWriter, r *http.Request, errs map[string]string) (*domain.Group, bool) {
+	groupId := 0
+	if value := r.URL.Query().Get("group_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 1 {
+			errs["group_id"] = "group_id must be a positive number"
+		}
+		groupId = id
+	}
+
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return nil, false
+	}
+	if groupId == 0 {
+		return &domain.Group{}, true
+	}
+
+	ctx := r.Context()
+	group, err := h.groups.GetById(ctx, groupId, domain.QueryOptions{})
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "Group not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("get group", "group_id", groupId, "error", err)
+		writeServerError(w, r, err, "Error get group")
+		return nil, false
+	}
+
+	return group, true
+}
+
+// notModified answers 304 while the contacts did not change since the
+// subscriber's last fetch.
+func (h *CalendarHandler) notModified(w http.ResponseWriter, r *http.Request) bool {
+	ctx := r.Context()
+
+	fingerprint, err := h.contacts.Fingerprint(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("contacts fingerprint", "error", err)
+		return false
+	}
+
+	return response.NotModified(w, r, response.WeakETag("calendar", fingerprint.LastUpdated.UnixNano(), fingerprint.Count))
+}
+
+// occasionEvent turns o into a yearly event. Feb 29 falls on the last day of
+// February, Feb 28 in common years, like Upcoming counts it.
+func occasionEvent(contact domain.Contact, o domain.Occasion) ical.Event {
+	year := calendarYear
+	if o.Date.HasYear() {
+		year = o.Date.Year
+	}
+
+	rule := "FREQ=YEARLY"
+	if o.Date.Month == time.February && o.Date.Day == 29 {
+		rule = "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=-1"
+	}
+
+	event := ical.Event{
+		Stamp:      contact.UpdatedAt,
+		Start:      o.Date.In(year),
+		RRule:      rule,
+		Categories: []string{o.Kind},
+	}
+
+	switch o.Kind {
+	case domain.OccasionBirthday:
+		event.UID = fmt.Sprintf("contact-%d-birthday", contact.Id)
+		event.Summary = contact.Name + "'s birthday"
+		if o.Date.HasYear() {
+			event.Description = fmt.Sprintf("Born in %d", o.Date.Year)
+		}
+	case domain.OccasionAnniversary:
+		event.UID = fmt.Sprintf("contact-%d-anniversary", contact.Id)
+		event.Summary = contact.Name + "'s anniversary"
+	default:
+		// Labelled dates have no id, the UID stays the same while label and date do.
+		hash := fnv.New64a()
+		hash.Write([]byte(o.Label + "\x00" + o.Date.String()))
+		event.UID = fmt.Sprintf("contact-%d-date-%x", contact.Id, hash.Sum64())
+		event.Summary = contact.Name + ": " + o.Label
+	}
+	if o.Kind != domain.OccasionBirthday && o.Date.HasYear() {
+		event.Description = fmt.Sprintf("Since %d", o.Date.Year)
+	}
+	event.UID += "@rest-api-contact-person"
+
+	return event
+}
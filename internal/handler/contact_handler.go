@@ -1,84 +1,163 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"iter"
+	"maps"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
 	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
 	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
 	"github.com/go-playground/validator/v10"
-	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type ContactHandler struct {
-	db       *pgxpool.Pool
+	db       *database.DB
 	validate *validator.Validate
 	service  domain.ContactService
+	allLimit int
+	// strictJSON rejects unknown fields in request bodies.
+	strictJSON bool
 }
 
-func NewContactHandler(db *pgxpool.Pool, validate *validator.Validate, service domain.ContactService) *ContactHandler {
+func NewContactHandler(db *database.DB, validate *validator.Validate, service domain.ContactService, allLimit int, strictJSON bool) *ContactHandler {
 	return &ContactHandler{
-		db:       db,
-		validate: validate,
-		service:  service,
+		db:         db,
+		validate:   validate,
+		service:    service,
+		allLimit:   allLimit,
+		strictJSON: strictJSON,
 	}
 }
 
+// GetAll streams every contact up to the configured hard cap.
+// Send Accept: application/x-ndjson to get one contact per line.
 func (h *ContactHandler) GetAll(w http.ResponseWriter, r *http.Request) {
+	opts, errs := parseQueryOptions(r, domain.ContactFields, domain.ContactIncludes)
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
 	ctx := r.Context()
-	contacts, err := h.service.GetAll(ctx)
+	// The rows are read straight from the database, so the table fingerprint
+	// backs the ETag. The headers go out with the first row, the row count
+	// also tells up front whether the cap cuts the list.
+	if fingerprint, err := h.service.Fingerprint(ctx); err != nil {
+		// Serve the full response, caching is only an optimization.
+		logger.FromContext(ctx).Warn("contacts fingerprint", "error", err)
+	} else {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(fingerprint.Count, 10))
+		if fingerprint.Count > int64(h.allLimit) {
+			w.Header().Set("X-Truncated", "true")
+		}
+		if h.notModified(w, r, fingerprint, opts) {
+			return
+		}
+	}
 
+	contacts, stop, err := peekError(h.service.GetAll(ctx, h.allLimit, opts))
+	defer stop()
 	if err != nil {
-		response.WriteError(w, "Error iterating contacts", http.StatusInternalServerError)
+		logger.FromContext(ctx).Error("stream contacts", "error", err)
+		writeServerError(w, r, err, "Error iterating items")
 		return
 	}
 
-	response.WriteSuccess(w, contacts, "Contacts retrieved successfully", http.StatusOK)
+	columns := opts.Columns(domain.ContactFields)
+	response.WriteStream(w, r, logStreamError(ctx, "stream contacts", contacts), columns, "Contacts retrieved successfully")
 }
 
 func (h *ContactHandler) Paginate(w http.ResponseWriter, r *http.Request) {
-	// Get params and make it int, if error or less than 1, set default value.
-	page, err := strconv.Atoi(r.URL.Query().Get("page"))
-	if err != nil || page < 1 {
-		page = 1
-	}
+	page, limit := parsePagination(r)
 
-	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
-	if err != nil || limit < 1 {
-		limit = 10
+	opts, errs := parseQueryOptions(r, domain.ContactFields, domain.ContactIncludes)
+	sort, sortErrs := parseSort(r, domain.ContactSorts)
+	maps.Copy(errs, sortErrs)
+	tags, err := domain.ParseTagFilter(r.URL.Query().Get("tags"))
+	if err != nil {
+		errs["tags"] = err.Error()
+	}
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
 	}
+	opts.Sort = sort
+	opts.Filter.Tags = tags
 
 	ctx := r.Context()
-
-	contacts, total, err := h.service.Paginate(ctx, page, limit)
+	contacts, total, err := h.service.Paginate(ctx, page, limit, opts)
+	if err != nil {
+		logger.FromContext(ctx).Error("paginate contacts", "error", err)
+		writeServerError(w, r, err, "Error paginate contacts")
+		return
+	}
 
 	totalPages := (total + int64(limit) - 1) / int64(limit)
 
-	response.WritePaginated(w, contacts, response.PaginationMeta{
+	// Pages may come from the read cache, the ETag is taken from the body so
+	// it never vouches for data the client was not sent.
+	response.WritePaginatedCached(w, r, contacts, response.PaginationMeta{
 		Page:       page,
 		Limit:      limit,
 		Total:      total,
 		TotalPages: totalPages,
-	}, http.StatusOK)
+	})
+}
+
+// notModified answers 304 when the client's ETag for GET /api/contacts/all
+// still matches the contacts table. The ETag covers the latest updated_at and the row count plus
+// everything in the request that shapes the body. Responses with includes are
+// not cached, changes to groups do not show in the contacts fingerprint.
+func (h *ContactHandler) notModified(w http.ResponseWriter, r *http.Request, fingerprint domain.Fingerprint, opts domain.QueryOptions) bool {
+	if len(opts.Include) > 0 {
+		return false
+	}
+
+	parts := []interface{}{
+		fingerprint.LastUpdated.UnixNano(),
+		fingerprint.Count,
+		strings.Join(opts.Fields, ","),
+		r.Header.Get("Accept"),
+		r.URL.Query().Get("format"),
+		h.allLimit,
+	}
+
+	return response.NotModified(w, r, response.WeakETag(parts...))
 }
 
 func (h *ContactHandler) GetById(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		response.WriteError(w, "Invalid contact ID", http.StatusBadRequest)
+		response.WriteError(w, r, "Invalid contact ID", http.StatusBadRequest)
+		return
+	}
+
+	opts, errs := parseQueryOptions(r, domain.ContactFields, domain.ContactIncludes)
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
 		return
 	}
 
 	ctx := r.Context()
 
-	contact, err := h.service.GetById(ctx, id)
+	contact, err := h.service.GetById(ctx, id, opts)
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "Contact not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		response.WriteError(w, "Error get contact", http.StatusInternalServerError)
+		logger.FromContext(ctx).Error("get contact", "contact_id", id, "error", err)
+		writeServerError(w, r, err, "Error get contact")
 		return
 	}
 
-	response.WriteSuccess(w, contact, "Contact retrieved successfully", http.StatusOK)
+	response.WriteSuccess(w, r, contact, "Contact retrieved successfully", http.StatusOK)
 }
 
 func (h *ContactHandler) Store(w http.ResponseWriter, r *http.Request) {
@@ -86,47 +165,64 @@ func (h *ContactHandler) Store(w http.ResponseWriter, r *http.Request) {
 
 	// Stream request body and decode into struct, more efficient than read.All and then unmarshal.
 	// data, _ := io.ReadAll(r.Body) is not recommended for large payloads as it loads everything into memory at once, while Decoder can handle it in chunks.
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &req, h.strictJSON) {
 		return
 	}
 
 	if err := h.validate.Struct(req); err != nil {
-		response.WriteValidationErrors(w, response.FormatValidationError(err), http.StatusBadRequest)
+		response.WriteValidationErrors(w, r, response.FormatValidationError(err), http.StatusBadRequest)
 		return
 	}
 
 	contact, err := h.service.Store(r.Context(), &req)
+	if errors.Is(err, domain.ErrEmailTaken) {
+		response.WriteError(w, r, "Email already exists", http.StatusConflict)
+		return
+	}
 	if err != nil {
-		response.WriteError(w, "Error while create contact", http.StatusInternalServerError)
+		logger.FromContext(r.Context()).Error("create contact", "error", err)
+		writeServerError(w, r, err, "Error while create contact")
+		return
 	}
 
-	response.WriteSuccess(w, map[string]int{"id": contact.Id}, "Contact created successfully", http.StatusCreated)
+	response.WriteSuccess(w, r, map[string]int{"id": contact.Id}, "Contact created successfully", http.StatusCreated)
 }
 
 func (h *ContactHandler) Update(w http.ResponseWriter, r *http.Request) {
 	id := r.PathValue("id")
 
 	var req domain.UpdateContactRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		response.WriteError(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &req, h.strictJSON) {
 		return
 	}
 
 	if err := h.validate.Struct(req); err != nil {
-		response.WriteValidationErrors(w, response.FormatValidationError(err), http.StatusBadRequest)
+		response.WriteValidationErrors(w, r, response.FormatValidationError(err), http.StatusBadRequest)
 		return
 	}
 
 	idInt, err := strconv.Atoi(id)
 	if err != nil {
-		response.WriteError(w, "Invalid contact ID", http.StatusBadRequest)
+		response.WriteError(w, r, "Invalid contact ID", http.StatusBadRequest)
 		return
 	}
 
 	contact, err := h.service.Update(r.Context(), idInt, &req)
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "Contact not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, domain.ErrEmailTaken) {
+		response.WriteError(w, r, "Email already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("update contact", "contact_id", idInt, "error", err)
+		writeServerError(w, r, err, "Error while update contact")
+		return
+	}
 
-	response.WriteSuccess(w, contact, "Contact updated successfully", http.StatusOK)
+	response.WriteSuccess(w, r, contact, "Contact updated successfully", http.StatusOK)
 }
 
 func (h *ContactHandler) Delete(w http.ResponseWriter, r *http.Request) {
@@ -134,16 +230,35 @@ func (h *ContactHandler) Delete(w http.ResponseWriter, r *http.Request) {
 
 	idInt, err := strconv.Atoi(id)
 	if err != nil {
-		response.WriteError(w, "Error while parse string to Int", http.StatusBadRequest)
+		response.WriteError(w, r, "Error while parse string to Int", http.StatusBadRequest)
 		return
 	}
 
 	err = h.service.Delete(r.Context(), idInt)
-
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "Contact not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		response.WriteError(w, "Error while delete contact", http.StatusInternalServerError)
+		logger.FromContext(r.Context()).Error("delete contact", "contact_id", idInt, "error", err)
+		writeServerError(w, r, err, "Error while delete contact")
 		return
 	}
 
-	response.WriteSuccess(w, nil, "Contact deleted successfully", http.StatusOK)
+	response.WriteSuccess(w, r, nil, "Contact deleted successfully", http.StatusOK)
+}
+
+// logStreamError logs the error that ends a streamed response, WriteStream only
+// tells the client about it.
+func logStreamError[T any](ctx context.Context, msg string, items iter.Seq2[T, error]) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for item, err := range items {
+			if err != nil {
+				logger.FromContext(ctx).Error(msg, "error", err)
+			}
+			if !yield(item, err) {
+				return
+			}
+		}
+	}
 }
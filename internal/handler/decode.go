@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/BramAristyo/rest-api-contact-person/pkg/request"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+)
+
+// decodeBody decodes the JSON body into dst and writes the error response
+// itself when that fails, the caller only has to return on false.
+func decodeBody(w http.ResponseWriter, r *http.Request, dst interface{}, strict bool) bool {
+	err := request.DecodeJSON(r, dst, strict)
+	if err == nil {
+		return true
+	}
+
+	var fieldErr *request.FieldError
+	switch {
+	case errors.Is(err, request.ErrBodyTooLarge):
+		response.WriteError(w, r, "Request body too large", http.StatusRequestEntityTooLarge)
+	case errors.As(err, &fieldErr):
+		response.WriteValidationErrors(w, r, map[string]string{fieldErr.Field: fieldErr.Message}, http.StatusBadRequest)
+	case errors.Is(err, request.ErrTrailingData):
+		response.WriteValidationErrors(w, r, map[string]string{"body": err.Error()}, http.StatusBadRequest)
+	default:
+		response.WriteError(w, r, "Invalid request payload", http.StatusBadRequest)
+	}
+
+	return false
+}
@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"errors"
+	"iter"
+	"net/http"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+)
+
+// unavailableRetryAfter is the Retry-After of 503 responses, in seconds.
+const unavailableRetryAfter = "5"
+
+// writeServerError answers 503 while the storage is down, so clients and load
+// balancers know to come back, and 500 with message for anything else.
+func writeServerError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	if errors.Is(err, domain.ErrUnavailable) {
+		w.Header().Set("Retry-After", unavailableRetryAfter)
+		response.WriteError(w, r, "Service temporarily unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	response.WriteError(w, r, message, http.StatusInternalServerError)
+}
+
+// peekError pulls the first item of items, so an error before anything was
+// produced can get a proper status. The returned iterator still yields every
+// item, the first one included. stop must be called once done with it.
+func peekError[T any](items iter.Seq2[T, error]) (rest iter.Seq2[T, error], stop func(), err error) {
+	next, stop := iter.Pull2(items)
+
+	first, err, ok := next()
+	if err != nil {
+		stop()
+		return nil, stop, err
+	}
+
+	return func(yield func(T, error) bool) {
+		if !ok || !yield(first, nil) {
+			return
+		}
+		for {
+			item, err, ok := next()
+			if !ok || !yield(item, err) {
+				return
+			}
+		}
+	}, stop, nil
+}
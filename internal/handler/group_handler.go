@@ -0,0 +1,267 @@
+package handler
+
+import (
+	"errors"
+	"maps"
+	"net/http"
+	"strconv"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+	"github.com/go-playground/validator/v10"
+)
+
+type GroupHandler struct {
+	service  domain.GroupService
+	validate *validator.Validate
+	// strictJSON rejects unknown fields in request bodies.
+	strictJSON bool
+}
+
+func NewGroupHandler(service domain.GroupService, validate *validator.Validate, strictJSON bool) *GroupHandler {
+	return &GroupHandler{
+		service:    service,
+		validate:   validate,
+		strictJSON: strictJSON,
+	}
+}
+
+func (h *GroupHandler) Paginate(w http.ResponseWriter, r *http.Request) {
+	page, limit := parsePagination(r)
+
+	opts, errs := parseQueryOptions(r, nil, domain.GroupIncludes)
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
+	groups, total, err := h.service.Paginate(r.Context(), page, limit, opts)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("paginate groups", "error", err)
+		writeServerError(w, r, err, "Error paginate groups")
+		return
+	}
+
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
+	response.WritePaginated(w, r, groups, response.PaginationMeta{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: totalPages,
+	}, http.StatusOK)
+}
+
+func (h *GroupHandler) GetById(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		response.WriteError(w, r, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	opts, errs := parseQueryOptions(r, nil, domain.GroupIncludes)
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
+	group, err := h.service.GetById(r.Context(), id, opts)
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "Group not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("get group", "group_id", id, "error", err)
+		writeServerError(w, r, err, "Error get group")
+		return
+	}
+
+	response.WriteSuccess(w, r, group, "Group retrieved successfully", http.StatusOK)
+}
+
+// Contacts lists the members of a group, for a smart group the contacts its
+// filter matches now. ?fields= and ?sort= work like on GET /api/contacts.
+func (h *GroupHandler) Contacts(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		response.WriteError(w, r, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	page, limit := parsePagination(r)
+	opts, errs := parseContactListOptions(r)
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	contacts, total, err := h.service.Contacts(ctx, id, page, limit, opts)
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "Group not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("list group contacts", "group_id", id, "error", err)
+		writeServerError(w, r, err, "Error list group contacts")
+		return
+	}
+
+	writeContactPage(w, r, contacts, total, page, limit)
+}
+
+// Preview lists the contacts a filter matches, before it is saved as a smart
+// group. It is paginated like Contacts.
+func (h *GroupHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	var req domain.PreviewGroupRequest
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		response.WriteValidationErrors(w, r, response.FormatValidationError(err), http.StatusBadRequest)
+		return
+	}
+
+	page, limit := parsePagination(r)
+	opts, errs := parseContactListOptions(r)
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	contacts, total, err := h.service.Preview(ctx, req.Filter, page, limit, opts)
+	if writeQueryError(w, r, err) {
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("preview group", "error", err)
+		writeServerError(w, r, err, "Error preview group")
+		return
+	}
+
+	writeContactPage(w, r, contacts, total, page, limit)
+}
+
+// Store creates a smart group. Static groups are only created by the seeder
+// and fixtures.
+func (h *GroupHandler) Store(w http.ResponseWriter, r *http.Request) {
+	var req domain.SmartGroupRequest
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		response.WriteValidationErrors(w, r, response.FormatValidationError(err), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	group, err := h.service.Store(ctx, &req)
+	if writeQueryError(w, r, err) {
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("create group", "error", err)
+		writeServerError(w, r, err, "Error create group")
+		return
+	}
+
+	response.WriteSuccess(w, r, group, "Group created successfully", http.StatusCreated)
+}
+
+func (h *GroupHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		response.WriteError(w, r, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var req domain.SmartGroupRequest
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		response.WriteValidationErrors(w, r, response.FormatValidationError(err), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	group, err := h.service.Update(ctx, id, &req)
+	if writeQueryError(w, r, err) || writeGroupWriteError(w, r, err) {
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("update group", "group_id", id, "error", err)
+		writeServerError(w, r, err, "Error update group")
+		return
+	}
+
+	response.WriteSuccess(w, r, group, "Group updated successfully", http.StatusOK)
+}
+
+func (h *GroupHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		response.WriteError(w, r, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	err = h.service.Delete(ctx, id)
+	if writeGroupWriteError(w, r, err) {
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("delete group", "group_id", id, "error", err)
+		writeServerError(w, r, err, "Error delete group")
+		return
+	}
+
+	response.WriteSuccess(w, r, nil, "Group deleted successfully", http.StatusOK)
+}
+
+// parseContactListOptions reads the ?fields= and ?sort= of a list of contacts.
+func parseContactListOptions(r *http.Request) (domain.QueryOptions, map[string]string) {
+	opts, errs := parseQueryOptions(r, domain.ContactFields, nil)
+	sort, sortErrs := parseSort(r, domain.ContactSorts)
+	maps.Copy(errs, sortErrs)
+	opts.Sort = sort
+	return opts, errs
+}
+
+func writeContactPage(w http.ResponseWriter, r *http.Request, contacts []domain.Contact, total int64, page, limit int) {
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
+	response.WritePaginated(w, r, contacts, response.PaginationMeta{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: totalPages,
+	}, http.StatusOK)
+}
+
+// writeQueryError answers 400 with the position of a syntax error in a
+// filter and reports whether err was one.
+func writeQueryError(w http.ResponseWriter, r *http.Request, err error) bool {
+	var queryErr *domain.QueryError
+	if !errors.As(err, &queryErr) {
+		return false
+	}
+	response.WriteValidationErrors(w, r, map[string]string{"filter": queryErr.Error()}, http.StatusBadRequest)
+	return true
+}
+
+// writeGroupWriteError answers a missing group with 404 and a static one with
+// 409 and reports whether err was either.
+func writeGroupWriteError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		response.WriteError(w, r, "Group not found", http.StatusNotFound)
+	case errors.Is(err, domain.ErrStaticGroup):
+		response.WriteError(w, r, "Only smart groups can be changed", http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+)
+
+// readyTimeout bounds the database checks of a readiness probe.
+const readyTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	db       *database.DB
+	migrator *database.Migrator
+	draining atomic.Bool
+}
+
+type poolStats struct {
+	TotalConns           int32  `json:"total_conns"`
+	AcquiredConns        int32  `json:"acquired_conns"`
+	IdleConns            int32  `json:"idle_conns"`
+	MaxConns             int32  `json:"max_conns"`
+	AcquireCount         int64  `json:"acquire_count"`
+	EmptyAcquireCount    int64  `json:"empty_acquire_count"`
+	CanceledAcquireCount int64  `json:"canceled_acquire_count"`
+	AcquireDuration      string `json:"acquire_duration"`
+}
+
+type readiness struct {
+	Status string `json:"status"`
+	// Breaker is the state of the database circuit breaker: closed, open or half-open.
+	Breaker   string                    `json:"breaker,omitempty"`
+	Pool      *poolStats                `json:"pool,omitempty"`
+	Migration *database.MigrationStatus `json:"migration,omitempty"`
+	// Replicas only inform, reads fall back to the primary without them.
+	Replicas []database.ReplicaStatus `json:"replicas,omitempty"`
+}
+
+// NewHealthHandler takes a nil db when contacts are not stored in Postgres,
+// readiness then only reflects draining.
+func NewHealthHandler(db *database.DB, migrator *database.Migrator) *HealthHandler {
+	return &HealthHandler{
+		db:       db,
+		migrator: migrator,
+	}
+}
+
+// Drain makes readiness fail from now on, called when the server starts shutting down.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Livez only tells the process is up and serving, it never touches the database
+// so a database outage does not get the container restarted.
+func (h *HealthHandler) Livez(w http.ResponseWriter, r *http.Request) {
+	response.WriteSuccess(w, r, map[string]string{"status": "ok"}, "API is alive", http.StatusOK)
+}
+
+// Readyz tells whether this instance should receive traffic.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		response.WriteError(w, r, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if h.db == nil {
+		response.WriteSuccess(w, r, readiness{Status: "ok"}, "API is ready", http.StatusOK)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	if err := h.db.Ping(ctx); err != nil {
+		logger.FromContext(ctx).Warn("readiness ping failed", "error", err)
+		response.WriteError(w, r, "Database is unreachable", http.StatusServiceUnavailable)
+		return
+	}
+
+	migration, err := h.migrator.Version(ctx)
+	if err != nil {
+		logger.FromContext(ctx).Warn("readiness migration check failed", "error", err)
+		response.WriteError(w, r, "Error reading migration version", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Another instance may have rolled the schema back after this one started.
+	if migration.Pending > 0 {
+		response.WriteError(w, r, "Database migrations are pending", http.StatusServiceUnavailable)
+		return
+	}
+
+	stat := h.db.Stat()
+	response.WriteSuccess(w, r, readiness{
+		Status:  "ok",
+		Breaker: h.db.BreakerState(),
+		Pool: &poolStats{
+			TotalConns:           stat.TotalConns(),
+			AcquiredConns:        stat.AcquiredConns(),
+			IdleConns:            stat.IdleConns(),
+			MaxConns:             stat.MaxConns(),
+			AcquireCount:         stat.AcquireCount(),
+			EmptyAcquireCount:    stat.EmptyAcquireCount(),
+			CanceledAcquireCount: stat.CanceledAcquireCount(),
+			AcquireDuration:      stat.AcquireDuration().String(),
+		},
+		Migration: &migration,
+		Replicas:  h.db.Replicas(),
+	}, "API is ready", http.StatusOK)
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/interactions"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+	"github.com/go-playground/validator/v10"
+)
+
+// maxInteractionSkew is how far in the future occurred_at may be, for clocks
+// running a little ahead.
+const maxInteractionSkew = 5 * time.Minute
+
+type InteractionHandler struct {
+	store    *interactions.Store
+	validate *validator.Validate
+	// strictJSON rejects unknown fields in request bodies.
+	strictJSON bool
+	// invalidate drops a cached contact after its last_contacted_at may have moved.
+	invalidate func(ctx context.Context, contactId int)
+}
+
+// NewInteractionHandler needs Postgres, invalidate may be nil without a cache.
+func NewInteractionHandler(store *interactions.Store, validate *validator.Validate, strictJSON bool, invalidate func(ctx context.Context, contactId int)) *InteractionHandler {
+	if invalidate == nil {
+		invalidate = func(ctx context.Context, contactId int) {}
+	}
+	return &InteractionHandler{
+		store:      store,
+		validate:   validate,
+		strictJSON: strictJSON,
+		invalidate: invalidate,
+	}
+}
+
+// Store logs an interaction with the contact, at occurred_at or now.
+func (h *InteractionHandler) Store(w http.ResponseWriter, r *http.Request) {
+	contactId, ok := interactionContactId(w, r)
+	if !ok {
+		return
+	}
+
+	interaction, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+	interaction.ContactId = contactId
+	if interaction.OccurredAt.IsZero() {
+		interaction.OccurredAt = time.Now()
+	}
+
+	ctx := r.Context()
+	created, err := h.store.Create(ctx, interaction)
+	if !h.handleError(w, r, err, "Contact not found", contactId, "create") {
+		return
+	}
+	h.invalidate(ctx, contactId)
+
+	w.Header().Set("Location", "/api/contacts/"+strconv.Itoa(contactId)+"/interactions/"+strconv.FormatInt(created.Id, 10))
+	response.WriteSuccess(w, r, created, "Interaction created successfully", http.StatusCreated)
+}
+
+// ByContact lists the interactions of a contact, latest first, only those of
+// ?type= when given.
+func (h *InteractionHandler) ByContact(w http.ResponseWriter, r *http.Request) {
+	contactId, ok := interactionContactId(w, r)
+	if !ok {
+		return
+	}
+
+	typ := interactions.Type(r.URL.Query().Get("type"))
+	if typ != "" && !slices.Contains(interactions.Types, typ) {
+		response.WriteValidationErrors(w, r, map[string]string{"type": "type must be call, meeting, email or note"}, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	page, limit := parsePagination(r)
+	list, total, err := h.store.List(ctx, contactId, typ, page, limit)
+	if !h.handleError(w, r, err, "Contact not found", contactId, "list") {
+		return
+	}
+
+	writeInteractionPage(w, r, list, page, limit, total)
+}
+
+// Timeline lists everything that happened to a contact, latest first: its
+// interactions, changes, groups joined and left, and its creation.
+func (h *InteractionHandler) Timeline(w http.ResponseWriter, r *http.Request) {
+	contactId, ok := interactionContactId(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	page, limit := parsePagination(r)
+	entries, total, err := h.store.Timeline(ctx, contactId, page, limit)
+	if !h.handleError(w, r, err, "Contact not found", contactId, "timeline") {
+		return
+	}
+
+	writeInteractionPage(w, r, entries, page, limit, total)
+}
+
+func (h *InteractionHandler) GetById(w http.ResponseWriter, r *http.Request) {
+	contactId, id, ok := interactionIds(w, r)
+	if !ok {
+		return
+	}
+
+	interaction, err := h.store.Get(r.Context(), contactId, id)
+	if !h.handleError(w, r, err, "Interaction not found", contactId, "get") {
+		return
+	}
+
+	response.WriteSuccess(w, r, interaction, "Interaction retrieved successfully", http.StatusOK)
+}
+
+// Update replaces an interaction, it keeps its occurred_at when none is given.
+func (h *InteractionHandler) Update(w http.ResponseWriter, r *http.Request) {
+	contactId, id, ok := interactionIds(w, r)
+	if !ok {
+		return
+	}
+
+	interaction, ok := h.decode(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	updated, err := h.store.Update(ctx, contactId, id, interaction)
+	if !h.handleError(w, r, err, "Interaction not found", contactId, "update") {
+		return
+	}
+	h.invalidate(ctx, contactId)
+
+	response.WriteSuccess(w, r, updated, "Interaction updated successfully", http.StatusOK)
+}
+
+func (h *InteractionHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	contactId, id, ok := interactionIds(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	err := h.store.Delete(ctx, contactId, id)
+	if !h.handleError(w, r, err, "Interaction not found", contactId, "delete") {
+		return
+	}
+	h.invalidate(ctx, contactId)
+
+	response.WriteSuccess(w, r, nil, "Interaction deleted successfully", http.StatusOK)
+}
+
+// decode reads and validates the body of a create or update, false means it
+// answered already. OccurredAt is zero when the body has none.
+func (h *InteractionHandler) decode(w http.ResponseWriter, r *http.Request) (*interactions.Interaction, bool) {
+	var req interactions.Request
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return nil, false
+	}
+
+	errs := make(map[string]string)
+	if err := h.validate.Struct(req); err != nil {
+		errs = response.FormatValidationError(err)
+	}
+	if !slices.Contains(interactions.Types, req.Type) {
+		errs["type"] = "type must be call, meeting, email or note"
+	}
+	interaction := &interactions.Interaction{Type: req.Type, Summary: req.Summary, Body: req.Body}
+	if req.OccurredAt != nil {
+		if req.OccurredAt.After(time.Now().Add(maxInteractionSkew)) {
+			errs["occurred_at"] = "occurred_at must not be in the future"
+		}
+		interaction.OccurredAt = *req.OccurredAt
+	}
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return nil, false
+	}
+
+	return interaction, true
+}
+
+func writeInteractionPage[T any](w http.ResponseWriter, r *http.Request, list []T, page, limit int, total int64) {
+	response.WritePaginated(w, r, list, response.PaginationMeta{
+		Page:       page,
+		Limit:      limit,
+		Total:      total,
+		TotalPages: (total + int64(limit) - 1) / int64(limit),
+	}, http.StatusOK)
+}
+
+func interactionContactId(w http.ResponseWriter, r *http.Request) (int, bool) {
+	contactId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		response.WriteError(w, r, "Invalid contact ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return contactId, true
+}
+
+func interactionIds(w http.ResponseWriter, r *http.Request) (int, int64, bool) {
+	contactId, ok := interactionContactId(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(r.PathValue("interactionId"), 10, 64)
+	if err != nil {
+		response.WriteError(w, r, "Invalid interaction ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return contactId, id, true
+}
+
+// handleError answers for a failed store call, false means it did. notFound
+// is the message when the contact or interaction is missing.
+func (h *InteractionHandler) handleError(w http.ResponseWriter, r *http.Request, err error, notFound string, contactId int, action string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, domain.ErrNotFound):
+		response.WriteError(w, r, notFound, http.StatusNotFound)
+	default:
+		logger.FromContext(r.Context()).Error(action+" interactions", "contact_id", contactId, "error", err)
+		writeServerError(w, r, err, "Error "+action+" interactions")
+	}
+	return false
+}
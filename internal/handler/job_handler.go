@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/jobs"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/internal/snapshot"
+	"github.com/BramAristyo/rest-api-contact-person/internal/tasks"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+	"github.com/go-playground/validator/v10"
+)
+
+type JobHandler struct {
+	queue    *jobs.Queue
+	validate *validator.Validate
+	// strictJSON rejects unknown fields in request bodies.
+	strictJSON bool
+}
+
+// jobView is a job with the links to follow it.
+type jobView struct {
+	*jobs.Job
+	Links map[string]string `json:"links"`
+}
+
+func NewJobHandler(queue *jobs.Queue, validate *validator.Validate, strictJSON bool) *JobHandler {
+	return &JobHandler{
+		queue:      queue,
+		validate:   validate,
+		strictJSON: strictJSON,
+	}
+}
+
+func newJobView(job *jobs.Job) jobView {
+	self := "/api/jobs/" + strconv.FormatInt(job.Id, 10)
+	links := map[string]string{"self": self}
+	if !job.Finished() {
+		links["cancel"] = self + "/cancel"
+	}
+	for _, name := range job.Files {
+		links[name] = self + "/files/" + name
+	}
+	return jobView{Job: job, Links: links}
+}
+
+// Export queues a job writing a snapshot archive, downloaded from the job's
+// archive link once it succeeded.
+func (h *JobHandler) Export(w http.ResponseWriter, r *http.Request) {
+	h.enqueue(w, r, tasks.KindExport, struct{}{}, nil)
+}
+
+// Import queues a job applying a snapshot archive, with the options and the
+// upload of POST /api/restore.
+func (h *JobHandler) Import(w http.ResponseWriter, r *http.Request) {
+	mode, dryRun, errs := parseRestoreOptions(r)
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
+	var archive bytes.Buffer
+	if _, err := receiveArchive(r, &archive); err != nil {
+		writeUploadError(w, r, err)
+		return
+	}
+	// Only the manifest is checked here, the rest when the job runs.
+	if _, err := snapshot.Open(bytes.NewReader(archive.Bytes()), int64(archive.Len())); err != nil {
+		response.WriteValidationErrors(w, r, map[string]string{archiveField: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	h.enqueue(w, r, tasks.KindImport, tasks.ImportPayload{Mode: mode, DryRun: dryRun}, &jobs.File{
+		Filename:    "import.zip",
+		ContentType: "application/zip",
+		Data:        archive.Bytes(),
+	})
+}
+
+// MergeContacts queues a job folding the source contacts into the target.
+func (h *JobHandler) MergeContacts(w http.ResponseWriter, r *http.Request) {
+	var req tasks.MergeContactsPayload
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.WriteValidationErrors(w, r, response.FormatValidationError(err), http.StatusBadRequest)
+		return
+	}
+	if slices.Contains(req.SourceIds, req.TargetId) {
+		response.WriteValidationErrors(w, r, map[string]string{"source_ids": "must not contain target_id"}, http.StatusBadRequest)
+		return
+	}
+
+	h.enqueue(w, r, tasks.KindMergeContacts, req, nil)
+}
+
+// PurgeContacts queues a job deleting the contacts matching every filter given.
+func (h *JobHandler) PurgeContacts(w http.ResponseWriter, r *http.Request) {
+	var req tasks.PurgeContactsPayload
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		response.WriteValidationErrors(w, r, response.FormatValidationError(err), http.StatusBadRequest)
+		return
+	}
+	if req.Empty() {
+		response.WriteValidationErrors(w, r, map[string]string{"body": "set at least one of ids, group_id or updated_before"}, http.StatusBadRequest)
+		return
+	}
+
+	h.enqueue(w, r, tasks.KindPurgeContacts, req, nil)
+}
+
+// enqueue answers 202 with the queued job and its Location.
+func (h *JobHandler) enqueue(w http.ResponseWriter, r *http.Request, kind string, payload interface{}, input *jobs.File) {
+	job, err := h.queue.Enqueue(r.Context(), kind, payload, input)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("enqueue job", "kind", kind, "error", err)
+		writeServerError(w, r, err, "Error while queue job")
+		return
+	}
+
+	view := newJobView(job)
+	w.Header().Set("Location", view.Links["self"])
+	response.WriteSuccess(w, r, view, "Job queued", http.StatusAccepted)
+}
+
+func (h *JobHandler) GetById(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		response.WriteError(w, r, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.queue.Get(r.Context(), id)
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("get job", "job_id", id, "error", err)
+		writeServerError(w, r, err, "Error get job")
+		return
+	}
+
+	response.WriteSuccess(w, r, newJobView(job), "Job retrieved successfully", http.StatusOK)
+}
+
+// Cancel cancels a queued job, a running one is asked to stop and answered
+// with 202 until its worker did.
+func (h *JobHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		response.WriteError(w, r, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.queue.Cancel(r.Context(), id)
+	switch {
+	case errors.Is(err, domain.ErrNotFound):
+		response.WriteError(w, r, "Job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, jobs.ErrFinished):
+		response.WriteError(w, r, "Job already finished", http.StatusConflict)
+		return
+	case err != nil:
+		logger.FromContext(r.Context()).Error("cancel job", "job_id", id, "error", err)
+		writeServerError(w, r, err, "Error cancel job")
+		return
+	}
+
+	if job.Status == jobs.StatusCancelled {
+		response.WriteSuccess(w, r, newJobView(job), "Job cancelled", http.StatusOK)
+		return
+	}
+	response.WriteSuccess(w, r, newJobView(job), "Job cancellation requested", http.StatusAccepted)
+}
+
+// File downloads a file a job produced.
+func (h *JobHandler) File(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		response.WriteError(w, r, "Invalid job ID", http.StatusBadRequest)
+		return
+	}
+
+	// The upload a job was queued with is not handed out again.
+	name := r.PathValue("name")
+	if name == jobs.InputFile {
+		response.WriteError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	file, err := h.queue.File(r.Context(), id, name)
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.FromContext(r.Context()).Error("get job file", "job_id", id, "name", name, "error", err)
+		writeServerError(w, r, err, "Error get job file")
+		return
+	}
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file.Filename}))
+	w.Header().Set("Content-Length", strconv.Itoa(len(file.Data)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(file.Data)
+}
@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+)
+
+// parsePagination gets page and limit params and make it int, if error or less than 1, set default value.
+func parsePagination(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit < 1 {
+		limit = 10
+	}
+
+	return page, limit
+}
+
+// parseQueryOptions reads the comma separated ?fields= and ?include= params.
+// Values outside the allowed lists are returned as validation errors keyed by param name.
+func parseQueryOptions(r *http.Request, allowedFields []string, allowedIncludes []string) (domain.QueryOptions, map[string]string) {
+	errs := make(map[string]string)
+
+	fields := splitParam(r.URL.Query().Get("fields"))
+	for _, f := range fields {
+		if len(allowedFields) == 0 {
+			errs["fields"] = "fields is not supported"
+			break
+		}
+		if !slices.Contains(allowedFields, f) {
+			errs["fields"] = "fields must be any of " + strings.Join(allowedFields, ", ")
+			break
+		}
+	}
+
+	include := splitParam(r.URL.Query().Get("include"))
+	for _, i := range include {
+		if !slices.Contains(allowedIncludes, i) {
+			errs["include"] = "include must be any of " + strings.Join(allowedIncludes, ", ")
+			break
+		}
+	}
+
+	return domain.QueryOptions{Fields: fields, Include: include}, errs
+}
+
+// parseSort reads ?sort=, a column of allowed, descending with a leading "-".
+// The error is keyed by param name.
+func parseSort(r *http.Request, allowed []string) (domain.Sort, map[string]string) {
+	value := strings.TrimSpace(r.URL.Query().Get("sort"))
+	if value == "" {
+		return domain.Sort{}, nil
+	}
+
+	field, desc := strings.CutPrefix(value, "-")
+	if !slices.Contains(allowed, field) {
+		return domain.Sort{}, map[string]string{"sort": "sort must be one of " + strings.Join(allowed, ", ") + ", with a leading - for descending"}
+	}
+	return domain.Sort{Field: field, Desc: desc}, nil
+}
+
+func splitParam(value string) []string {
+	var parts []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
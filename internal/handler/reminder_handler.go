@@ -0,0 +1,287 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/internal/reminders"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	defaultReminderDays = 7
+	maxReminderDays     = 366
+)
+
+type ReminderHandler struct {
+	store    *reminders.Store
+	validate *validator.Validate
+	// strictJSON rejects unknown fields in request bodies.
+	strictJSON bool
+}
+
+func NewReminderHandler(store *reminders.Store, validate *validator.Validate, strictJSON bool) *ReminderHandler {
+	return &ReminderHandler{
+		store:      store,
+		validate:   validate,
+		strictJSON: strictJSON,
+	}
+}
+
+// Store adds a reminder to the contact, recurring when it has a recurrence.
+func (h *ReminderHandler) Store(w http.ResponseWriter, r *http.Request) {
+	contactId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		response.WriteError(w, r, "Invalid contact ID", http.StatusBadRequest)
+		return
+	}
+
+	var req reminders.CreateRequest
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return
+	}
+
+	errs := make(map[string]string)
+	if err := h.validate.Struct(req); err != nil {
+		errs = response.FormatValidationError(err)
+	}
+	if req.DueAt.IsZero() {
+		errs["due_at"] = "due_at is required"
+	}
+	rule, err := reminders.ParseRule(req.Recurrence)
+	if err != nil {
+		errs["recurrence"] = err.Error()
+	}
+	timeZone := req.TimeZone
+	if timeZone == "" {
+		timeZone = "UTC"
+	} else if _, err := time.LoadLocation(timeZone); err != nil || timeZone == "Local" {
+		errs["time_zone"] = "time_zone must be a time zone like Asia/Jakarta"
+	}
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	reminder, err := h.store.Create(ctx, &reminders.Reminder{
+		ContactId:  contactId,
+		Note:       req.Note,
+		DueAt:      req.DueAt,
+		Recurrence: rule.String(),
+		TimeZone:   timeZone,
+	})
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "Contact not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("create reminder", "contact_id", contactId, "error", err)
+		writeServerError(w, r, err, "Error while create reminder")
+		return
+	}
+
+	w.Header().Set("Location", "/api/reminders/"+strconv.FormatInt(reminder.Id, 10))
+	response.WriteSuccess(w, r, reminder, "Reminder created successfully", http.StatusCreated)
+}
+
+// ByContact lists the reminders of a contact, only those with ?status= when given.
+func (h *ReminderHandler) ByContact(w http.ResponseWriter, r *http.Request) {
+	contactId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		response.WriteError(w, r, "Invalid contact ID", http.StatusBadRequest)
+		return
+	}
+
+	filter, errs := parseReminderFilter(r)
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+	filter.ContactId = contactId
+
+	h.list(w, r, filter)
+}
+
+// Paginate lists the reminders of every contact. ?due=overdue are the pending
+// ones whose time passed, ?due=upcoming the pending ones of the next ?days=
+// days.
+func (h *ReminderHandler) Paginate(w http.ResponseWriter, r *http.Request) {
+	filter, errs := parseReminderFilter(r)
+
+	query := r.URL.Query()
+	switch due := reminders.Due(query.Get("due")); due {
+	case "", reminders.DueOverdue, reminders.DueUpcoming:
+		filter.Due = due
+	default:
+		errs["due"] = "due must be overdue or upcoming"
+	}
+
+	days := defaultReminderDays
+	if value := query.Get("days"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxReminderDays {
+			errs["days"] = fmt.Sprintf("days must be a number from 1 to %d", maxReminderDays)
+		}
+		days = n
+	}
+	filter.Within = time.Duration(days) * 24 * time.Hour
+
+	if len(errs) > 0 {
+		response.WriteValidationErrors(w, r, errs, http.StatusBadRequest)
+		return
+	}
+
+	h.list(w, r, filter)
+}
+
+// parseReminderFilter reads the pagination and ?status=.
+func parseReminderFilter(r *http.Request) (reminders.Filter, map[string]string) {
+	errs := make(map[string]string)
+	page, limit := parsePagination(r)
+	filter := reminders.Filter{Page: page, Limit: limit}
+
+	switch status := reminders.Status(r.URL.Query().Get("status")); status {
+	case "", reminders.StatusPending, reminders.StatusCompleted:
+		filter.Status = status
+	default:
+		errs["status"] = "status must be pending or completed"
+	}
+
+	return filter, errs
+}
+
+func (h *ReminderHandler) list(w http.ResponseWriter, r *http.Request, filter reminders.Filter) {
+	ctx := r.Context()
+	list, total, err := h.store.List(ctx, filter)
+	if err != nil {
+		logger.FromContext(ctx).Error("list reminders", "error", err)
+		writeServerError(w, r, err, "Error list reminders")
+		return
+	}
+
+	response.WritePaginated(w, r, list, response.PaginationMeta{
+		Page:       filter.Page,
+		Limit:      filter.Limit,
+		Total:      total,
+		TotalPages: (total + int64(filter.Limit) - 1) / int64(filter.Limit),
+	}, http.StatusOK)
+}
+
+func (h *ReminderHandler) GetById(w http.ResponseWriter, r *http.Request) {
+	id, ok := reminderId(w, r)
+	if !ok {
+		return
+	}
+
+	reminder, err := h.store.Get(r.Context(), id)
+	if !h.handleError(w, r, err, id, "get") {
+		return
+	}
+
+	response.WriteSuccess(w, r, reminder, "Reminder retrieved successfully", http.StatusOK)
+}
+
+// Snooze moves a pending reminder to until, or for from now, it is sent
+// again then.
+func (h *ReminderHandler) Snooze(w http.ResponseWriter, r *http.Request) {
+	id, ok := reminderId(w, r)
+	if !ok {
+		return
+	}
+
+	var req reminders.SnoozeRequest
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return
+	}
+
+	now := time.Now()
+	until := req.Until
+	switch {
+	case until.IsZero() == (req.For == ""):
+		response.WriteValidationErrors(w, r, map[string]string{"body": "set either until or for"}, http.StatusBadRequest)
+		return
+	case req.For != "":
+		d, err := time.ParseDuration(req.For)
+		if err != nil || d <= 0 {
+			response.WriteValidationErrors(w, r, map[string]string{"for": "for must be a positive duration like 30m or 2h"}, http.StatusBadRequest)
+			return
+		}
+		until = now.Add(d)
+	case !until.After(now):
+		response.WriteValidationErrors(w, r, map[string]string{"until": "until must be in the future"}, http.StatusBadRequest)
+		return
+	}
+
+	reminder, err := h.store.Snooze(r.Context(), id, until)
+	if !h.handleError(w, r, err, id, "snooze") {
+		return
+	}
+
+	response.WriteSuccess(w, r, reminder, "Reminder snoozed", http.StatusOK)
+}
+
+// Complete completes a reminder. A recurring one is moved to its next
+// occurrence instead, until its recurrence ended.
+func (h *ReminderHandler) Complete(w http.ResponseWriter, r *http.Request) {
+	id, ok := reminderId(w, r)
+	if !ok {
+		return
+	}
+
+	reminder, err := h.store.Complete(r.Context(), id, time.Now())
+	if !h.handleError(w, r, err, id, "complete") {
+		return
+	}
+
+	if reminder.Status == reminders.StatusCompleted {
+		response.WriteSuccess(w, r, reminder, "Reminder completed", http.StatusOK)
+		return
+	}
+	response.WriteSuccess(w, r, reminder, "Reminder moved to its next occurrence", http.StatusOK)
+}
+
+func (h *ReminderHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := reminderId(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.store.Delete(r.Context(), id)
+	if !h.handleError(w, r, err, id, "delete") {
+		return
+	}
+
+	response.WriteSuccess(w, r, nil, "Reminder deleted successfully", http.StatusOK)
+}
+
+func reminderId(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		response.WriteError(w, r, "Invalid reminder ID", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+// handleError answers for a failed store call, false means it did.
+func (h *ReminderHandler) handleError(w http.ResponseWriter, r *http.Request, err error, id int64, action string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, domain.ErrNotFound):
+		response.WriteError(w, r, "Reminder not found", http.StatusNotFound)
+	case errors.Is(err, reminders.ErrCompleted):
+		response.WriteError(w, r, "Reminder already completed", http.StatusConflict)
+	default:
+		logger.FromContext(r.Context()).Error(action+" reminder", "reminder_id", id, "error", err)
+		writeServerError(w, r, err, "Error "+action+" reminder")
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	defaultTagLimit = 10
+	maxTagLimit     = 100
+)
+
+type TagHandler struct {
+	service  domain.ContactService
+	validate *validator.Validate
+	// strictJSON rejects unknown fields in request bodies.
+	strictJSON bool
+}
+
+func NewTagHandler(service domain.ContactService, validate *validator.Validate, strictJSON bool) *TagHandler {
+	return &TagHandler{
+		service:    service,
+		validate:   validate,
+		strictJSON: strictJSON,
+	}
+}
+
+// Autocomplete lists the tags starting with ?prefix=, the most used first,
+// with how many contacts carry each.
+func (h *TagHandler) Autocomplete(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultTagLimit
+	if value := query.Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxTagLimit {
+			response.WriteValidationErrors(w, r, map[string]string{"limit": "limit must be a number from 1 to " + strconv.Itoa(maxTagLimit)}, http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	ctx := r.Context()
+	tags, err := h.service.Tags(ctx, domain.NormalizeTag(query.Get("prefix")), limit)
+	if err != nil {
+		logger.FromContext(ctx).Error("list tags", "error", err)
+		writeServerError(w, r, err, "Error list tags")
+		return
+	}
+
+	response.WriteSuccess(w, r, tags, "Tags retrieved successfully", http.StatusOK)
+}
+
+// Rename renames a tag on every contact, contacts that already have the new
+// name keep it once.
+func (h *TagHandler) Rename(w http.ResponseWriter, r *http.Request) {
+	from := domain.NormalizeTag(r.PathValue("name"))
+	if !domain.ValidTag(from) {
+		response.WriteError(w, r, "Invalid tag", http.StatusBadRequest)
+		return
+	}
+
+	var req domain.RenameTagRequest
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		response.WriteValidationErrors(w, r, response.FormatValidationError(err), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	changed, err := h.service.RenameTag(ctx, from, req.Name)
+	if errors.Is(err, domain.ErrNotFound) {
+		response.WriteError(w, r, "Tag not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.FromContext(ctx).Error("rename tag", "tag", from, "error", err)
+		writeServerError(w, r, err, "Error rename tag")
+		return
+	}
+
+	response.WriteSuccess(w, r, map[string]int64{"contacts": changed}, "Tag renamed successfully", http.StatusOK)
+}
+
+// Merge replaces every source tag with the target on every contact.
+func (h *TagHandler) Merge(w http.ResponseWriter, r *http.Request) {
+	var req domain.MergeTagsRequest
+	if !decodeBody(w, r, &req, h.strictJSON) {
+		return
+	}
+	if err := h.validate.Struct(req); err != nil {
+		response.WriteValidationErrors(w, r, response.FormatValidationError(err), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	changed, err := h.service.MergeTags(ctx, &req)
+	if err != nil {
+		logger.FromContext(ctx).Error("merge tags", "target", req.Target, "error", err)
+		writeServerError(w, r, err, "Error merge tags")
+		return
+	}
+
+	response.WriteSuccess(w, r, map[string]int64{"contacts": changed}, "Tags merged successfully", http.StatusOK)
+}
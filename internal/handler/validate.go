@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/go-playground/validator/v10"
+)
+
+// NewValidator returns a validator knowing the tags of the request types
+// besides the built in ones: partial_date for domain.PartialDate strings, empty
+// for none, and tag for tags, in any case.
+func NewValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterValidation("partial_date", func(fl validator.FieldLevel) bool {
+		// A date left out is a nil pointer, "" removes it.
+		if fl.Field().String() == "" {
+			return true
+		}
+		_, err := domain.ParsePartialDate(fl.Field().String())
+		return err == nil
+	})
+	validate.RegisterValidation("tag", func(fl validator.FieldLevel) bool {
+		return domain.ValidTag(domain.NormalizeTag(fl.Field().String()))
+	})
+	return validate
+}
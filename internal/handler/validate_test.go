@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+)
+
+func TestValidateContactDates(t *testing.T) {
+	validate := NewValidator()
+	empty, bad, date := "", "1993-02-29", "--12-10"
+
+	tests := []struct {
+		name string
+		req  domain.ContactDatesRequest
+		ok   bool
+	}{
+		{"left out", domain.ContactDatesRequest{}, true},
+		{"empty removes it", domain.ContactDatesRequest{Birthday: &empty, Anniversary: &empty, Dates: &[]domain.ContactDateRequest{}}, true},
+		{"date", domain.ContactDatesRequest{Birthday: &date}, true},
+		{"invalid date", domain.ContactDatesRequest{Anniversary: &bad}, false},
+		{"labelled date needs a date", domain.ContactDatesRequest{Dates: &[]domain.ContactDateRequest{{Label: "Name day"}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validate.Struct(tt.req); (err == nil) != tt.ok {
+				t.Fatalf("error %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
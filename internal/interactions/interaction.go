@@ -0,0 +1,69 @@
+// Package interactions are the calls, meetings, emails and notes logged
+// against a contact, and the contact's timeline merging them with the
+// history the database records for it.
+package interactions
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Type string
+
+const (
+	TypeCall    Type = "call"
+	TypeMeeting Type = "meeting"
+	TypeEmail   Type = "email"
+	// TypeNote is no contact, it leaves last_contacted_at alone.
+	TypeNote Type = "note"
+)
+
+var Types = []Type{TypeCall, TypeMeeting, TypeEmail, TypeNote}
+
+type Interaction struct {
+	Id         int64     `json:"id"`
+	ContactId  int       `json:"contact_id"`
+	Type       Type      `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Summary    string    `json:"summary"`
+	Body       string    `json:"body,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Request is the body of POST and PUT /api/contacts/{id}/interactions.
+type Request struct {
+	Type Type `json:"type"`
+	// OccurredAt is now when creating and unchanged when updating if not set.
+	OccurredAt *time.Time `json:"occurred_at"`
+	Summary    string     `json:"summary" validate:"required,max=200"`
+	Body       string     `json:"body" validate:"max=10000"`
+}
+
+// EntryKind is what a timeline entry is about.
+type EntryKind string
+
+const (
+	KindInteraction    EntryKind = "interaction"
+	KindContactCreated EntryKind = "contact_created"
+	KindContactUpdated EntryKind = "contact_updated"
+	KindGroupJoined    EntryKind = "group_joined"
+	KindGroupLeft      EntryKind = "group_left"
+)
+
+// Entry is a line of a contact's timeline, only the field of its kind is set.
+type Entry struct {
+	Kind EntryKind `json:"kind"`
+	At   time.Time `json:"at"`
+	// Interaction is set for KindInteraction.
+	Interaction *Interaction `json:"interaction,omitempty"`
+	// Changes maps each changed field to {"from", "to"}, for KindContactUpdated.
+	Changes json.RawMessage `json:"changes,omitempty"`
+	// Group is set for KindGroupJoined and KindGroupLeft, by the name it had then.
+	Group *EntryGroup `json:"group,omitempty"`
+}
+
+type EntryGroup struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
@@ -0,0 +1,214 @@
+package interactions
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const interactionColumns = `id, contact_id, type, occurred_at, summary, body, created_at, updated_at`
+
+// timelineQuery merges the interactions and the recorded history of the
+// contact $1, its creation included. Columns that do not apply are NULL.
+const timelineQuery = `WITH timeline AS (
+	SELECT 'interaction' AS kind, occurred_at AS at, id, type, summary, body, created_at, updated_at,
+		NULL::jsonb AS changes, NULL::bigint AS group_id, NULL::varchar AS group_name
+	FROM interactions WHERE contact_id = $1
+	UNION ALL
+	SELECT kind, occurred_at, id, NULL, NULL, NULL, NULL, NULL, changes, group_id, group_name
+	FROM contact_events WHERE contact_id = $1
+	UNION ALL
+	-- created_at has no time zone, it is UTC like everywhere else it is read.
+	SELECT 'contact_created', created_at AT TIME ZONE 'UTC', id, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL
+	FROM contacts WHERE id = $1 AND created_at IS NOT NULL
+)`
+
+// Store keeps interactions in Postgres. Every read goes to the primary, the
+// timeline of a contact is usually read right after logging to it.
+type Store struct {
+	db *database.DB
+}
+
+func NewStore(db *database.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create logs an interaction from the ContactId, Type, OccurredAt, Summary and
+// Body of i. A missing contact is domain.ErrNotFound.
+func (s *Store) Create(ctx context.Context, i *Interaction) (*Interaction, error) {
+	created, err := scanInteraction(s.db.QueryRow(ctx, `INSERT INTO interactions (contact_id, type, occurred_at, summary, body)
+		VALUES ($1, $2, $3, $4, $5) RETURNING `+interactionColumns,
+		i.ContactId, string(i.Type), i.OccurredAt, i.Summary, i.Body))
+	var pgErr *pgconn.PgError
+	// 23503 foreign_key_violation, the contact does not exist.
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return nil, domain.ErrNotFound
+	}
+	return created, err
+}
+
+func (s *Store) Get(ctx context.Context, contactId int, id int64) (*Interaction, error) {
+	i, err := scanInteraction(s.db.QueryRow(ctx, `SELECT `+interactionColumns+` FROM interactions WHERE id = $1 AND contact_id = $2`, id, contactId))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return i, err
+}
+
+// List returns a page of the contact's interactions, latest first, only those
+// of typ unless it is empty, and how many there are in total. A missing
+// contact is domain.ErrNotFound.
+func (s *Store) List(ctx context.Context, contactId int, typ Type, page, limit int) ([]Interaction, int64, error) {
+	if err := s.contactExists(ctx, contactId); err != nil {
+		return nil, 0, err
+	}
+
+	where := ` FROM interactions WHERE contact_id = $1 AND ($2 = '' OR type = $2)`
+
+	var total int64
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*)`+where, contactId, string(typ)).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(ctx, `SELECT `+interactionColumns+where+
+		` ORDER BY occurred_at DESC, id DESC LIMIT `+strconv.Itoa(limit)+` OFFSET `+strconv.Itoa((page-1)*limit), contactId, string(typ))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	interactions := []Interaction{}
+	for rows.Next() {
+		i, err := scanInteraction(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		interactions = append(interactions, *i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return interactions, total, nil
+}
+
+// Update replaces the Type, Summary and Body of the interaction id of the
+// contact, and OccurredAt when it is not zero.
+func (s *Store) Update(ctx context.Context, contactId int, id int64, i *Interaction) (*Interaction, error) {
+	var occurredAt *time.Time
+	if !i.OccurredAt.IsZero() {
+		occurredAt = &i.OccurredAt
+	}
+
+	updated, err := scanInteraction(s.db.QueryRow(ctx, `UPDATE interactions SET
+			type = $3,
+			occurred_at = COALESCE($4, occurred_at),
+			summary = $5,
+			body = $6,
+			updated_at = NOW()
+		WHERE id = $1 AND contact_id = $2
+		RETURNING `+interactionColumns,
+		id, contactId, string(i.Type), occurredAt, i.Summary, i.Body))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return updated, err
+}
+
+func (s *Store) Delete(ctx context.Context, contactId int, id int64) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM interactions WHERE id = $1 AND contact_id = $2`, id, contactId)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// Timeline returns a page of everything that happened to the contact, latest
+// first: interactions, changes to the contact, groups joined and left, and
+// its creation. A missing contact is domain.ErrNotFound.
+func (s *Store) Timeline(ctx context.Context, contactId int, page, limit int) ([]Entry, int64, error) {
+	if err := s.contactExists(ctx, contactId); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := s.db.QueryRow(ctx, timelineQuery+` SELECT COUNT(*) FROM timeline`, contactId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	// Entries at the same time keep a stable order across pages.
+	rows, err := s.db.Query(ctx, timelineQuery+` SELECT kind, at, id, type, summary, body, created_at, updated_at, changes, group_id, group_name
+		FROM timeline ORDER BY at DESC, kind, id DESC LIMIT `+strconv.Itoa(limit)+` OFFSET `+strconv.Itoa((page-1)*limit), contactId)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		var e Entry
+		var id int64
+		var typ, summary, body, groupName *string
+		var createdAt, updatedAt *time.Time
+		var groupId *int
+		if err := rows.Scan(&e.Kind, &e.At, &id, &typ, &summary, &body, &createdAt, &updatedAt, &e.Changes, &groupId, &groupName); err != nil {
+			return nil, 0, err
+		}
+
+		switch e.Kind {
+		case KindInteraction:
+			e.Interaction = &Interaction{
+				Id:         id,
+				ContactId:  contactId,
+				Type:       Type(*typ),
+				OccurredAt: e.At,
+				Summary:    *summary,
+				Body:       *body,
+				CreatedAt:  *createdAt,
+				UpdatedAt:  *updatedAt,
+			}
+		case KindGroupJoined, KindGroupLeft:
+			e.Group = &EntryGroup{}
+			if groupId != nil {
+				e.Group.Id = *groupId
+			}
+			if groupName != nil {
+				e.Group.Name = *groupName
+			}
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return entries, total, nil
+}
+
+func (s *Store) contactExists(ctx context.Context, contactId int) error {
+	var exists bool
+	if err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM contacts WHERE id = $1)`, contactId).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+func scanInteraction(row pgx.Row) (*Interaction, error) {
+	var i Interaction
+	if err := row.Scan(&i.Id, &i.ContactId, &i.Type, &i.OccurredAt, &i.Summary, &i.Body, &i.CreatedAt, &i.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
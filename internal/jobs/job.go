@@ -0,0 +1,91 @@
+// Package jobs runs long operations outside of the HTTP request that started
+// them. Jobs are rows of the jobs table, workers in any number of processes
+// claim them with FOR UPDATE SKIP LOCKED and hold a lease on them while they
+// run. A job whose worker died is claimed again once its lease expired.
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// InputFile is the name of the file a job is enqueued with, e.g. an
+// uploaded archive. Every other file is a result of the job.
+const InputFile = "input"
+
+var (
+	// ErrFinished means the job already succeeded, failed or was cancelled.
+	ErrFinished = errors.New("job already finished")
+	// ErrCancelled is the cause of a running job's context once the job was
+	// cancelled.
+	ErrCancelled = errors.New("job cancelled")
+)
+
+type Job struct {
+	Id     int64  `json:"id"`
+	Kind   string `json:"kind"`
+	Status Status `json:"status"`
+	// Payload holds the parameters of the job, as the kind defines them.
+	Payload json.RawMessage `json:"payload"`
+	// Progress is a percentage, 100 once the job succeeded.
+	Progress int             `json:"progress"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	// Error is the error of the last attempt, also while a retry waits.
+	Error           string     `json:"error,omitempty"`
+	Attempts        int        `json:"attempts"`
+	MaxAttempts     int        `json:"max_attempts"`
+	RunAt           time.Time  `json:"run_at"`
+	CancelRequested bool       `json:"cancel_requested"`
+	CreatedAt       time.Time  `json:"created_at"`
+	StartedAt       *time.Time `json:"started_at,omitempty"`
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`
+	// Files are the names of the files the job produced.
+	Files []string `json:"files,omitempty"`
+
+	lockedBy string
+}
+
+// Finished tells whether the job will not run anymore.
+func (j *Job) Finished() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// File is an upload a job reads or a file it produced.
+type File struct {
+	Name        string
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Permanent marks an error retrying will not fix, e.g. an invalid payload,
+// the job fails right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+func isPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
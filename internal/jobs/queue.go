@@ -0,0 +1,248 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+const jobColumns = `id, kind, status, payload, progress, result, COALESCE(error, ''), attempts, max_attempts, run_at,
+	cancel_requested, created_at, started_at, finished_at, COALESCE(locked_by, ''),
+	ARRAY(SELECT name FROM job_files f WHERE f.job_id = jobs.id AND f.name <> 'input' ORDER BY name)`
+
+// Queue stores jobs in Postgres. Every read goes to the primary, a replica
+// may not have the job a client was just handed yet.
+type Queue struct {
+	db          *database.DB
+	maxAttempts int
+}
+
+// NewQueue returns a queue whose jobs run at most maxAttempts times.
+func NewQueue(db *database.DB, maxAttempts int) *Queue {
+	return &Queue{db: db, maxAttempts: maxAttempts}
+}
+
+// Enqueue adds a job of kind, payload is stored as JSON. input, when given,
+// is stored as the job's InputFile in the same transaction.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload interface{}, input *File) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := q.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	job, err := scanJob(tx.QueryRow(ctx, `INSERT INTO jobs (kind, payload, max_attempts) VALUES ($1, $2, $3) RETURNING `+jobColumns,
+		kind, data, q.maxAttempts))
+	if err != nil {
+		return nil, err
+	}
+
+	if input != nil {
+		input.Name = InputFile
+		if err := saveFile(ctx, tx, job.Id, input); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (q *Queue) Get(ctx context.Context, id int64) (*Job, error) {
+	job, err := scanJob(q.db.QueryRow(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return job, err
+}
+
+// Cancel cancels a queued job right away. A running job is asked to stop,
+// it is cancelled once its worker noticed, within a third of the lease.
+func (q *Queue) Cancel(ctx context.Context, id int64) (*Job, error) {
+	job, err := scanJob(q.db.QueryRow(ctx, `UPDATE jobs SET
+			cancel_requested = TRUE,
+			status = CASE WHEN status = 'queued' THEN 'cancelled' ELSE status END,
+			finished_at = CASE WHEN status = 'queued' THEN NOW() ELSE finished_at END
+		WHERE id = $1 AND status IN ('queued', 'running')
+		RETURNING `+jobColumns, id))
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return job, err
+	}
+
+	if _, err := q.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return nil, ErrFinished
+}
+
+// File reads a file of the job, the InputFile included.
+func (q *Queue) File(ctx context.Context, id int64, name string) (*File, error) {
+	f := &File{Name: name}
+	err := q.db.QueryRow(database.WithoutQueryTimeout(ctx), `SELECT filename, content_type, data FROM job_files WHERE job_id = $1 AND name = $2`, id, name).
+		Scan(&f.Filename, &f.ContentType, &f.Data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// claim takes the next due job of one of kinds, or one whose lease expired,
+// and leases it to worker. It returns nil when there is nothing to do.
+func (q *Queue) claim(ctx context.Context, worker string, kinds []string, lease time.Duration) (*Job, error) {
+	job, err := scanJob(q.db.QueryRow(ctx, `UPDATE jobs SET
+			status = 'running',
+			attempts = attempts + 1,
+			locked_by = $1,
+			locked_until = NOW() + make_interval(secs => $2),
+			started_at = COALESCE(started_at, NOW())
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE kind = ANY($3) AND (
+				(status = 'queued' AND run_at <= NOW()) OR
+				(status = 'running' AND locked_until < NOW()))
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED)
+		RETURNING `+jobColumns, worker, lease.Seconds(), kinds))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return job, err
+}
+
+// errLeaseLost means another worker claimed the job after its lease expired.
+var errLeaseLost = errors.New("job lease lost")
+
+// heartbeat extends the lease and tells whether the job should be cancelled.
+func (q *Queue) heartbeat(ctx context.Context, job *Job, lease time.Duration) (cancel bool, err error) {
+	err = q.db.QueryRow(ctx, `UPDATE jobs SET locked_until = NOW() + make_interval(secs => $3)
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'
+		RETURNING cancel_requested`, job.Id, job.lockedBy, lease.Seconds()).Scan(&cancel)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, errLeaseLost
+	}
+	return cancel, err
+}
+
+func (q *Queue) setProgress(ctx context.Context, job *Job, percent int) error {
+	_, err := q.db.Exec(ctx, `UPDATE jobs SET progress = $3 WHERE id = $1 AND locked_by = $2 AND status = 'running'`,
+		job.Id, job.lockedBy, percent)
+	return err
+}
+
+func (q *Queue) saveFile(ctx context.Context, job *Job, f *File) error {
+	tx, err := q.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Only the worker holding the lease may write, the row lock keeps it
+	// until the commit.
+	var locked bool
+	err = tx.QueryRow(ctx, `SELECT TRUE FROM jobs WHERE id = $1 AND locked_by = $2 AND status = 'running' FOR UPDATE`,
+		job.Id, job.lockedBy).Scan(&locked)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errLeaseLost
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := saveFile(database.WithoutQueryTimeout(ctx), tx, job.Id, f); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func saveFile(ctx context.Context, tx pgx.Tx, id int64, f *File) error {
+	_, err := tx.Exec(ctx, `INSERT INTO job_files (job_id, name, filename, content_type, data) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (job_id, name) DO UPDATE SET filename = EXCLUDED.filename, content_type = EXCLUDED.content_type, data = EXCLUDED.data, created_at = NOW()`,
+		id, f.Name, f.Filename, f.ContentType, f.Data)
+	return err
+}
+
+// finish ends the job with status, result is stored as JSON when not nil.
+func (q *Queue) finish(ctx context.Context, job *Job, status Status, result interface{}, message string) error {
+	var data []byte
+	if result != nil {
+		var err error
+		if data, err = json.Marshal(result); err != nil {
+			return err
+		}
+	}
+
+	tag, err := q.db.Exec(ctx, `UPDATE jobs SET
+			status = $3,
+			result = $4,
+			error = NULLIF($5, ''),
+			progress = CASE WHEN $3 = 'succeeded' THEN 100 ELSE progress END,
+			finished_at = NOW(),
+			locked_until = NULL
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'`,
+		job.Id, job.lockedBy, string(status), data, message)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return errLeaseLost
+	}
+	return nil
+}
+
+// retry queues the job again to run at runAt.
+func (q *Queue) retry(ctx context.Context, job *Job, runAt time.Time, message string) error {
+	_, err := q.db.Exec(ctx, `UPDATE jobs SET status = 'queued', run_at = $3, error = $4, locked_by = NULL, locked_until = NULL
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'`,
+		job.Id, job.lockedBy, runAt, message)
+	return err
+}
+
+// release hands the job back without counting the attempt, its worker is
+// shutting down.
+func (q *Queue) release(ctx context.Context, job *Job) error {
+	_, err := q.db.Exec(ctx, `UPDATE jobs SET status = 'queued', attempts = attempts - 1, run_at = NOW(), locked_by = NULL, locked_until = NULL
+		WHERE id = $1 AND locked_by = $2 AND status = 'running'`,
+		job.Id, job.lockedBy)
+	return err
+}
+
+// purge deletes the jobs that finished before, with their files.
+func (q *Queue) purge(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := q.db.Exec(ctx, `DELETE FROM jobs WHERE finished_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanJob(row pgx.Row) (*Job, error) {
+	var job Job
+	var payload, result []byte
+	err := row.Scan(&job.Id, &job.Kind, &job.Status, &payload, &job.Progress, &result, &job.Error, &job.Attempts, &job.MaxAttempts, &job.RunAt,
+		&job.CancelRequested, &job.CreatedAt, &job.StartedAt, &job.FinishedAt, &job.lockedBy, &job.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Payload = payload
+	if result != nil {
+		job.Result = result
+	}
+	return &job, nil
+}
@@ -0,0 +1,291 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+)
+
+const (
+	retryBaseDelay = 10 * time.Second
+	retryMaxDelay  = 10 * time.Minute
+	// finishTimeout bounds recording the outcome of a job, which happens
+	// after the job's own context may be gone.
+	finishTimeout = 10 * time.Second
+	purgePeriod   = 10 * time.Minute
+)
+
+// Handler runs one job of a kind. A returned error is retried with backoff
+// until the job's attempts are used up, unless it is Permanent. The result
+// is stored as the job's JSON result.
+type Handler func(ctx context.Context, task *Task) (result interface{}, err error)
+
+type Options struct {
+	// Concurrency is the number of jobs run at the same time.
+	Concurrency int
+	// PollInterval is the wait before looking for jobs again once the queue was empty.
+	PollInterval time.Duration
+	// Lease is the visibility timeout, a job not heard of for that long is
+	// claimed by another worker. Running jobs renew it every third of it.
+	Lease time.Duration
+	// Timeout bounds a single attempt.
+	Timeout time.Duration
+	// Retention is how long finished jobs and their files are kept.
+	Retention time.Duration
+}
+
+type Worker struct {
+	queue    *Queue
+	opts     Options
+	handlers map[string]Handler
+	// id tells this process apart in locked_by, every running job appends its slot.
+	id string
+}
+
+func NewWorker(queue *Queue, opts Options) *Worker {
+	host, _ := os.Hostname()
+	return &Worker{
+		queue:    queue,
+		opts:     opts,
+		handlers: map[string]Handler{},
+		id:       host + ":" + strconv.Itoa(os.Getpid()),
+	}
+}
+
+// Register makes the worker run jobs of kind with h, call it before Run.
+func (w *Worker) Register(kind string, h Handler) {
+	w.handlers[kind] = h
+}
+
+// Run claims and runs jobs until ctx is done. Jobs still running then are
+// stopped and handed back to the queue, Run returns once they are.
+func (w *Worker) Run(ctx context.Context) {
+	kinds := slices.Sorted(maps.Keys(w.handlers))
+	slog.Info("job worker started", "worker", w.id, "concurrency", w.opts.Concurrency, "kinds", kinds)
+
+	var wg sync.WaitGroup
+	for slot := range w.opts.Concurrency {
+		wg.Go(func() {
+			w.loop(ctx, fmt.Sprintf("%s:%d", w.id, slot), kinds)
+		})
+	}
+	wg.Go(func() {
+		w.purge(ctx)
+	})
+	wg.Wait()
+
+	slog.Info("job worker stopped", "worker", w.id)
+}
+
+func (w *Worker) loop(ctx context.Context, worker string, kinds []string) {
+	for ctx.Err() == nil {
+		job, err := w.queue.claim(ctx, worker, kinds, w.opts.Lease)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("claim job", "worker", worker, "error", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(w.opts.PollInterval):
+			}
+			continue
+		}
+
+		w.process(ctx, job)
+	}
+}
+
+func (w *Worker) process(ctx context.Context, job *Job) {
+	log := slog.With("job_id", job.Id, "kind", job.Kind, "attempt", job.Attempts)
+
+	finishCtx, cancelFinish := context.WithTimeout(context.WithoutCancel(ctx), finishTimeout)
+	defer cancelFinish()
+	finish := func(status Status, result interface{}, message string) {
+		if err := w.queue.finish(finishCtx, job, status, result, message); err != nil {
+			log.Error("record job outcome", "status", status, "error", err)
+		}
+	}
+
+	switch {
+	case job.CancelRequested:
+		// Its worker died before it noticed.
+		finish(StatusCancelled, nil, "")
+		return
+	case job.Attempts > job.MaxAttempts:
+		// Only a job whose lease kept expiring gets here, it keeps killing workers.
+		finish(StatusFailed, nil, fmt.Sprintf("lease expired on each of %d attempts", job.MaxAttempts))
+		return
+	}
+
+	log.Info("job started")
+	started := time.Now()
+
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	jobCtx, cancelTimeout := context.WithTimeout(jobCtx, w.opts.Timeout)
+	defer cancelTimeout()
+
+	stopHeartbeat := w.heartbeat(jobCtx, job, cancel)
+	result, err := w.run(jobCtx, job)
+	stopHeartbeat()
+
+	cause := context.Cause(jobCtx)
+	switch {
+	case err == nil:
+		finish(StatusSucceeded, result, "")
+		log.Info("job succeeded", "duration", time.Since(started).String())
+	case errors.Is(cause, errLeaseLost):
+		log.Warn("job lease lost, another worker took it over", "error", err)
+	case errors.Is(cause, ErrCancelled):
+		finish(StatusCancelled, nil, "")
+		log.Info("job cancelled", "duration", time.Since(started).String())
+	case ctx.Err() != nil:
+		if err := w.queue.release(finishCtx, job); err != nil {
+			log.Error("release job", "error", err)
+		}
+		log.Info("job handed back, worker is stopping")
+	case isPermanent(err) || job.Attempts >= job.MaxAttempts:
+		finish(StatusFailed, nil, err.Error())
+		log.Error("job failed", "error", err)
+	default:
+		delay := min(retryBaseDelay<<min(job.Attempts-1, 10), retryMaxDelay)
+		if err := w.queue.retry(finishCtx, job, time.Now().Add(delay), err.Error()); err != nil {
+			log.Error("queue job retry", "error", err)
+		}
+		log.Warn("job failed, retrying", "error", err, "retry_in", delay.String())
+	}
+}
+
+// run calls the kind's handler, a panic fails the attempt like an error.
+func (w *Worker) run(ctx context.Context, job *Job) (result interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			slog.Error("job panicked", "job_id", job.Id, "panic", fmt.Sprint(p), "stack", string(debug.Stack()))
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+
+	return w.handlers[job.Kind](ctx, &Task{Job: job, queue: w.queue})
+}
+
+// heartbeat renews the lease of job until the returned stop is called. It
+// cancels ctx when the job was cancelled or the lease was lost.
+func (w *Worker) heartbeat(ctx context.Context, job *Job, cancel context.CancelCauseFunc) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		ticker := time.NewTicker(w.opts.Lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			cancelled, err := w.queue.heartbeat(ctx, job, w.opts.Lease)
+			switch {
+			case errors.Is(err, errLeaseLost):
+				cancel(errLeaseLost)
+				return
+			case err != nil:
+				// The lease has two more beats before it expires.
+				slog.Warn("renew job lease", "job_id", job.Id, "error", err)
+			case cancelled:
+				cancel(ErrCancelled)
+				return
+			}
+		}
+	})
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// purge deletes finished jobs past the retention, every worker process does
+// it now and then.
+func (w *Worker) purge(ctx context.Context) {
+	ticker := time.NewTicker(purgePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		n, err := w.queue.purge(ctx, time.Now().Add(-w.opts.Retention))
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("purge finished jobs", "error", err)
+		}
+		if n > 0 {
+			slog.Info("purged finished jobs", "count", n)
+		}
+	}
+}
+
+// Task is the job a Handler runs, with access to the job's files and progress.
+type Task struct {
+	Job   *Job
+	queue *Queue
+
+	progress int
+}
+
+// Decode reads the payload into dst, a payload that does not fit fails the
+// job without retries.
+func (t *Task) Decode(dst interface{}) error {
+	if err := json.Unmarshal(t.Job.Payload, dst); err != nil {
+		return Permanent(fmt.Errorf("invalid %s payload: %w", t.Job.Kind, err))
+	}
+	return nil
+}
+
+// Progress records done out of total as a percentage. It stays below 100
+// until the job succeeded, and is only written when the percentage changed.
+func (t *Task) Progress(ctx context.Context, done int64, total int64) error {
+	percent := 99
+	if total > 0 && done < total {
+		percent = int(done * 100 / total)
+	}
+	if percent == t.progress {
+		return nil
+	}
+
+	t.progress = percent
+	return t.queue.setProgress(ctx, t.Job, percent)
+}
+
+// Input reads the file the job was enqueued with.
+func (t *Task) Input(ctx context.Context) (*File, error) {
+	f, err := t.queue.File(ctx, t.Job.Id, InputFile)
+	if errors.Is(err, domain.ErrNotFound) {
+		return nil, Permanent(fmt.Errorf("job %d has no input file", t.Job.Id))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read job input: %w", err)
+	}
+	return f, nil
+}
+
+// Save stores a file the job produced, it can be downloaded by its name.
+func (t *Task) Save(ctx context.Context, f *File) error {
+	return t.queue.saveFile(ctx, t.Job, f)
+}
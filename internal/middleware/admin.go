@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+)
+
+// Admin guards a route with "Authorization: Bearer <token>". An empty token
+// disables the route, it answers 403 until an admin token is configured.
+func Admin(token string) func(http.Handler) http.Handler {
+	// Comparing hashes keeps the comparison constant time whatever the length
+	// of the sent token.
+	want := sha256.Sum256([]byte(token))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if token == "" {
+				response.WriteError(w, r, "Admin routes are disabled", http.StatusForbidden)
+				return
+			}
+
+			sent, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			got := sha256.Sum256([]byte(strings.TrimSpace(sent)))
+			if !ok || subtle.ConstantTimeCompare(got[:], want[:]) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				response.WriteError(w, r, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
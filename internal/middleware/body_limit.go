@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+)
+
+// BodyLimit caps request bodies at maxBytes. A declared Content-Length above
+// the limit is rejected right away with 413, otherwise reading past the limit
+// fails with *http.MaxBytesError which the JSON decoding turns into 413.
+// Routes in limits, keyed by their pattern like "POST /api/restore", get
+// their own limit instead.
+func BodyLimit(maxBytes int64, routes *http.ServeMux, limits map[string]int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			maxBytes := maxBytes
+			if len(limits) > 0 {
+				if _, pattern := routes.Handler(r); limits[pattern] > 0 {
+					maxBytes = limits[pattern]
+				}
+			}
+
+			if r.ContentLength > maxBytes {
+				response.WriteError(w, r, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
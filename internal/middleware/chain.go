@@ -0,0 +1,12 @@
+package middleware
+
+import "net/http"
+
+// Chain wraps h with the middlewares, the first one is the outermost and sees
+// the request first.
+func Chain(h http.Handler, middlewares ...func(http.Handler) http.Handler) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
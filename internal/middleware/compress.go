@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// encodings in order of preference when the client accepts several with the same quality.
+var encodings = []string{"br", "gzip", "deflate"}
+
+// compressedTypes are media types that are compressed already, another pass
+// only costs CPU. Type prefixes end with "/".
+var compressedTypes = []string{
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-brotli",
+	"image/",
+	"audio/",
+	"video/",
+}
+
+// compressible reports whether a body of contentType is worth compressing.
+// SVG is text, unlike the other images.
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if mediaType == "image/svg+xml" {
+		return true
+	}
+
+	for _, t := range compressedTypes {
+		if mediaType == t || strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compress compresses responses with brotli, gzip or deflate as negotiated with
+// Accept-Encoding. Bodies smaller than minBytes, and bodies of a compressed
+// media type such as zip, gzip or images, are sent as-is, compressing them
+// costs more than it saves.
+// Streamed responses are compressed as soon as they flush.
+func Compress(minBytes int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+			if encoding == "" || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				encoding:       encoding,
+				minBytes:       minBytes,
+				statusCode:     http.StatusOK,
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// negotiateEncoding picks the supported encoding with the highest quality,
+// or "" when the client only takes identity.
+func negotiateEncoding(header string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.TrimSpace(key) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range encodings {
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// compressWriter holds back the body until minBytes are written, then decides
+// whether to compress. Headers are only sent at that point, so
+// Content-Encoding can still be added.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	minBytes int
+
+	statusCode int
+	buf        []byte
+	decided    bool
+	encoder    io.WriteCloser
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided {
+		return
+	}
+	cw.statusCode = code
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.minBytes {
+			return len(b), nil
+		}
+		if err := cw.start(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// start sends the headers and whatever is buffered, compressed or not.
+func (cw *compressWriter) start(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+
+	noBody := cw.statusCode < 200 || cw.statusCode == http.StatusNoContent || cw.statusCode == http.StatusNotModified
+	if compress && !noBody && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		// The compressed body is a different representation, keep validators weak.
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		switch cw.encoding {
+		case "br":
+			cw.encoder = brotli.NewWriterLevel(cw.ResponseWriter, brotli.DefaultCompression)
+		case "gzip":
+			cw.encoder = gzip.NewWriter(cw.ResponseWriter)
+		case "deflate":
+			cw.encoder, _ = flate.NewWriter(cw.ResponseWriter, flate.DefaultCompression)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.statusCode)
+
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	if cw.encoder != nil {
+		_, err := cw.encoder.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+// FlushError is used by http.ResponseController, a flush means the handler is
+// streaming so the response gets compressed regardless of the size so far.
+func (cw *compressWriter) FlushError() error {
+	if !cw.decided {
+		if err := cw.start(true); err != nil {
+			return err
+		}
+	}
+
+	if f, ok := cw.encoder.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to set deadlines.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if !cw.decided {
+		// The whole body stayed under minBytes.
+		cw.start(false)
+	}
+
+	if cw.encoder != nil {
+		cw.encoder.Close()
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCompressSkipsCompressedTypes(t *testing.T) {
+	body := strings.Repeat("a", 2048)
+
+	tests := []struct {
+		contentType string
+		encoding    string
+	}{
+		{"application/json", "gzip"},
+		{"text/csv; charset=utf-8", "gzip"},
+		{"image/svg+xml", "gzip"},
+		{"application/zip", ""},
+		{"application/gzip", ""},
+		{"image/png", ""},
+		{"Image/JPEG", ""},
+		{"video/mp4", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			h := Compress(1024)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(body))
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set("Accept-Encoding", "gzip")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+				t.Fatalf("Content-Encoding %q, want %q", got, tt.encoding)
+			}
+			if tt.encoding == "" && w.Body.String() != body {
+				t.Fatal("uncompressed body changed")
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/pkg/metrics"
+)
+
+// Metrics records request count and latency per route.
+// The route label is the pattern matched by routes, never the raw path, so ids
+// don't blow up the number of series.
+func Metrics(registry *metrics.Registry, routes *http.ServeMux) func(http.Handler) http.Handler {
+	requests := registry.NewCounterVec(
+		"http_requests_total",
+		"Total number of HTTP requests.",
+		"method", "route", "status",
+	)
+	duration := registry.NewHistogramVec(
+		"http_request_duration_seconds",
+		"HTTP request latency in seconds.",
+		metrics.DefBuckets,
+		"method", "route", "status",
+	)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			wrapped := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+
+			next.ServeHTTP(wrapped, r)
+
+			route := routePattern(routes, r)
+			status := strconv.Itoa(wrapped.statusCode)
+			requests.Inc(r.Method, route, status)
+			duration.Observe(time.Since(start).Seconds(), r.Method, route, status)
+		})
+	}
+}
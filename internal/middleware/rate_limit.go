@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/internal/ratelimit"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
+)
+
+const APIKeyHeader = "X-API-Key"
+
+// RateLimit applies the policy to requests under prefix, clients are told about
+// their budget with RateLimit-* headers and get 429 with Retry-After when it is
+// used up.
+// Clients are identified by X-API-Key when it is one of apiKeys, by remote ip
+// otherwise, so made up keys cannot be used to get a fresh budget.
+// When the store fails the request is let through, an outage of the limiter
+// should not take the API down with it.
+func RateLimit(store ratelimit.Store, policy *ratelimit.Policy, routes *http.ServeMux, prefix string, apiKeys []string) func(http.Handler) http.Handler {
+	known := make(map[string]bool, len(apiKeys))
+	for _, key := range apiKeys {
+		known[hashAPIKey(key)] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			_, pattern := routes.Handler(r)
+			limit, bucket := policy.LimitFor(r.Method, pattern)
+
+			result, err := store.Take(r.Context(), clientKey(r, known)+"|"+bucket, limit)
+			if err != nil {
+				logger.FromContext(r.Context()).Warn("rate limit store failed, allowing request", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+				response.WriteError(w, r, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientKey identifies the client by its API key when it is a known one, the
+// key is hashed so it is never stored in plain text.
+func clientKey(r *http.Request, known map[string]bool) string {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		if hash := hashAPIKey(key); known[hash] {
+			return "key:" + hash
+		}
+	}
+
+	return "ip:" + remoteIP(r)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/ratelimit"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store down")
+}
+
+// rateLimited serves GET /api/items and GET /health behind a limit of a
+// burst of 2 with a slow refill.
+func rateLimited(t *testing.T, store ratelimit.Store, apiKeys ...string) http.Handler {
+	t.Helper()
+
+	routes := http.NewServeMux()
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	routes.HandleFunc("GET /api/items", ok)
+	routes.HandleFunc("GET /health", ok)
+
+	policy, err := ratelimit.NewPolicy("0.001:2", "0.001:1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return RateLimit(store, policy, routes, "/api/", apiKeys)(routes)
+}
+
+func get(h http.Handler, path, ip, apiKey string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r.RemoteAddr = ip + ":1234"
+	if apiKey != "" {
+		r.Header.Set(APIKeyHeader, apiKey)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Run("budget per ip", func(t *testing.T) {
+		h := rateLimited(t, ratelimit.NewMemoryStore())
+
+		for i := range 2 {
+			w := get(h, "/api/items", "10.0.0.1", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("request %d: status %d", i, w.Code)
+			}
+			if got, want := w.Header().Get("RateLimit-Remaining"), strconv.Itoa(1-i); got != want {
+				t.Fatalf("request %d: RateLimit-Remaining %s, want %s", i, got, want)
+			}
+		}
+
+		w := get(h, "/api/items", "10.0.0.1", "")
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("status %d, want 429", w.Code)
+		}
+		if w.Header().Get("Retry-After") == "" {
+			t.Fatal("429 without Retry-After")
+		}
+
+		if w := get(h, "/api/items", "10.0.0.2", ""); w.Code != http.StatusOK {
+			t.Fatalf("other ip: status %d", w.Code)
+		}
+	})
+
+	t.Run("unknown api keys share the ip budget", func(t *testing.T) {
+		h := rateLimited(t, ratelimit.NewMemoryStore(), "known")
+
+		for i, key := range []string{"a", "b"} {
+			if w := get(h, "/api/items", "10.0.0.1", key); w.Code != http.StatusOK {
+				t.Fatalf("request %d: status %d", i, w.Code)
+			}
+		}
+		if w := get(h, "/api/items", "10.0.0.1", "c"); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("fresh unknown key: status %d, want 429", w.Code)
+		}
+	})
+
+	t.Run("known api key has its own budget", func(t *testing.T) {
+		h := rateLimited(t, ratelimit.NewMemoryStore(), "known")
+
+		for range 2 {
+			get(h, "/api/items", "10.0.0.1", "")
+		}
+		if w := get(h, "/api/items", "10.0.0.1", "known"); w.Code != http.StatusOK {
+			t.Fatalf("known key: status %d", w.Code)
+		}
+		// The key follows the client to another address.
+		get(h, "/api/items", "10.0.0.2", "known")
+		if w := get(h, "/api/items", "10.0.0.3", "known"); w.Code != http.StatusTooManyRequests {
+			t.Fatalf("known key from another ip: status %d, want 429", w.Code)
+		}
+	})
+
+	t.Run("routes outside the prefix are not limited", func(t *testing.T) {
+		h := rateLimited(t, ratelimit.NewMemoryStore())
+
+		for i := range 5 {
+			w := get(h, "/health", "10.0.0.1", "")
+			if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "" {
+				t.Fatalf("request %d: status %d, limit %q", i, w.Code, w.Header().Get("RateLimit-Limit"))
+			}
+		}
+	})
+
+	t.Run("failing store lets requests through", func(t *testing.T) {
+		h := rateLimited(t, failingStore{})
+
+		for i := range 5 {
+			if w := get(h, "/api/items", "10.0.0.1", ""); w.Code != http.StatusOK {
+				t.Fatalf("request %d: status %d", i, w.Code)
+			}
+		}
+	})
+}
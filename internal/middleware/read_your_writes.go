@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+)
+
+const (
+	// PrimaryUntilHeader and PrimaryUntilCookie carry, in unix milliseconds,
+	// until when the client's reads go to the primary. Clients without a cookie
+	// jar send the header of their last write back.
+	PrimaryUntilHeader = "X-Primary-Until"
+	PrimaryUntilCookie = "primary_until"
+)
+
+// ReadYourWrites sends the reads of a client to the primary for window after
+// it wrote, so it sees its own writes even when replicas lag behind.
+func ReadYourWrites(window time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if window <= 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if sticky(r, window) {
+				r = r.WithContext(database.WithPrimary(r.Context()))
+			}
+
+			switch r.Method {
+			case "GET", "HEAD", "OPTIONS":
+			default:
+				w = &stickyWriter{ResponseWriter: w, window: window, secure: r.TLS != nil}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// sticky tells whether the client wrote within window. Values further in the
+// future than window are ignored, clients cannot pin themselves to the primary.
+func sticky(r *http.Request, window time.Duration) bool {
+	value := r.Header.Get(PrimaryUntilHeader)
+	if value == "" {
+		if cookie, err := r.Cookie(PrimaryUntilCookie); err == nil {
+			value = cookie.Value
+		}
+	}
+
+	millis, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	until := time.UnixMilli(millis)
+	now := time.Now()
+	return until.After(now) && !until.After(now.Add(window))
+}
+
+// stickyWriter marks the client once the write turned out successful, before
+// the headers are sent.
+type stickyWriter struct {
+	http.ResponseWriter
+	window      time.Duration
+	secure      bool
+	wroteHeader bool
+}
+
+func (sw *stickyWriter) WriteHeader(code int) {
+	if !sw.wroteHeader && code < http.StatusBadRequest {
+		until := strconv.FormatInt(time.Now().Add(sw.window).UnixMilli(), 10)
+		sw.Header().Set(PrimaryUntilHeader, until)
+		http.SetCookie(sw.ResponseWriter, &http.Cookie{
+			Name:     PrimaryUntilCookie,
+			Value:    until,
+			Path:     "/",
+			MaxAge:   ceilSeconds(sw.window),
+			HttpOnly: true,
+			Secure:   sw.secure,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	sw.wroteHeader = true
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *stickyWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *stickyWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
@@ -1,9 +1,11 @@
 package middleware
 
 import (
-	"log"
+	"fmt"
 	"net/http"
+	"runtime/debug"
 
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
 	"github.com/BramAristyo/rest-api-contact-person/pkg/response"
 )
 
@@ -20,8 +22,17 @@ func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("panic: %v", err)
-				response.WriteError(w, "Internal Server error", 500)
+				if err == http.ErrAbortHandler {
+					// A deliberate abort, let the server drop the connection.
+					panic(err)
+				}
+				logger.FromContext(r.Context()).Error("panic recovered",
+					"panic", fmt.Sprint(err),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"stack", string(debug.Stack()),
+				)
+				response.WriteError(w, r, "Internal Server error", 500)
 				return
 			}
 		}()
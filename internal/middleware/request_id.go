@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength keeps client supplied ids from flooding the logs.
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestID accepts the caller's X-Request-ID or generates one, puts it in the
+// context and the response header, and attaches a logger carrying the request
+// id, route and remote ip to the context for every log line of the request.
+func RequestID(routes *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+
+			w.Header().Set(RequestIDHeader, id)
+
+			l := logger.FromContext(r.Context()).With(
+				"request_id", id,
+				"route", routePattern(routes, r),
+				"remote_ip", remoteIP(r),
+			)
+
+			ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+			ctx = logger.WithContext(ctx, l)
+
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID only lets through ids made of printable, header and log safe characters.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// routePattern returns the pattern routes would match for r without the method,
+// like /api/contacts/{id}, or "unmatched" when nothing matches.
+// Using the pattern instead of the raw path keeps ids out of labels and span names.
+func routePattern(routes *http.ServeMux, r *http.Request) string {
+	_, pattern := routes.Handler(r)
+	if pattern == "" {
+		return "unmatched"
+	}
+
+	// Patterns may start with a method, it is reported separately.
+	if _, path, found := strings.Cut(pattern, " "); found {
+		return path
+	}
+
+	return pattern
+}
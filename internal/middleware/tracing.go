@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/BramAristyo/rest-api-contact-person/pkg/tracing"
+)
+
+// Tracing starts a server span per request, continuing the caller's trace when
+// a W3C traceparent header is present. The span is named after the route
+// pattern matched by routes, like "GET /api/contacts/{id}".
+func Tracing(routes *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if parent, ok := tracing.Extract(r.Header); ok {
+				ctx = tracing.ContextWithRemoteParent(ctx, parent)
+			}
+
+			route := routePattern(routes, r)
+			ctx, span := tracing.StartWithKind(ctx, tracing.KindServer, r.Method+" "+route,
+				tracing.String("http.request.method", r.Method),
+				tracing.String("http.route", route),
+				tracing.String("url.path", r.URL.Path),
+			)
+			defer span.End()
+
+			// Lets callers and logs correlate the response with the trace.
+			if sc := span.SpanContext(); sc.IsValid() {
+				tracing.Inject(w.Header(), sc)
+			}
+
+			wrapped := &responseWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+
+			next.ServeHTTP(wrapped, r.WithContext(ctx))
+
+			span.SetAttributes(tracing.Int("http.response.status_code", wrapped.statusCode))
+			if wrapped.statusCode >= http.StatusInternalServerError {
+				span.RecordError(errors.New(http.StatusText(wrapped.statusCode)))
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// cleanupInterval is how often rows untouched for cleanupAge are deleted.
+const (
+	cleanupInterval = 10 * time.Minute
+	cleanupAge      = time.Hour
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table, so every API
+// instance shares the same limits.
+// The refill and take happen in the rate_limit_take function in one statement,
+// using the database clock so instances with skewed clocks agree.
+type PostgresStore struct {
+	db          *pgxpool.Pool
+	lastCleanup atomic.Int64
+}
+
+func NewPostgresStore(db *pgxpool.Pool) *PostgresStore {
+	s := &PostgresStore{db: db}
+	s.lastCleanup.Store(time.Now().UnixNano())
+	return s
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	s.cleanup()
+
+	var allowed bool
+	var tokens float64
+
+	err := s.db.QueryRow(ctx, `SELECT allowed, remaining FROM rate_limit_take($1, $2, $3)`, key, float64(limit.Burst), limit.Rate).Scan(&allowed, &tokens)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result(allowed, tokens, limit), nil
+}
+
+// cleanup deletes stale buckets in the background at most once per interval,
+// a deleted bucket starts full again which is what an old bucket would be anyway.
+func (s *PostgresStore) cleanup() {
+	last := s.lastCleanup.Load()
+	now := time.Now().UnixNano()
+	if time.Duration(now-last) < cleanupInterval || !s.lastCleanup.CompareAndSwap(last, now) {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		_, err := s.db.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < NOW() - make_interval(secs => $1)`, cleanupAge.Seconds())
+		if err != nil {
+			slog.Warn("rate limit cleanup failed", "error", err)
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+// Package ratelimit implements token bucket rate limiting with pluggable stores,
+// so limits can be kept in process or shared by every API instance.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit refills Rate tokens per second up to Burst, every request takes one token.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Result is the state of a bucket right after a request tried to take a token.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until a token is available, zero when allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// result builds the Result from the tokens left in a bucket after a take.
+func result(allowed bool, tokens float64, limit Limit) Result {
+	r := Result{
+		Allowed:   allowed,
+		Limit:     limit.Burst,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     secondsToDuration((float64(limit.Burst) - tokens) / limit.Rate),
+	}
+
+	if !allowed {
+		r.RetryAfter = secondsToDuration((1 - tokens) / limit.Rate)
+	}
+
+	return r
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// ParseLimit parses "rate:burst", e.g. "10:20" is 10 requests per second with bursts up to 20.
+func ParseLimit(value string) (Limit, error) {
+	rate, burst, found := strings.Cut(strings.TrimSpace(value), ":")
+	if !found {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected rate:burst", value)
+	}
+
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate in limit %q", value)
+	}
+
+	b, err := strconv.Atoi(burst)
+	if err != nil || b < 1 {
+		return Limit{}, fmt.Errorf("invalid burst in limit %q", value)
+	}
+
+	return Limit{Rate: r, Burst: b}, nil
+}
+
+// Policy decides which limit applies to a request.
+// Routes are keyed by the exact pattern registered on the mux, like
+// "GET /api/contacts/all", and take precedence over the read/write defaults.
+type Policy struct {
+	Read   Limit
+	Write  Limit
+	Routes map[string]Limit
+}
+
+// NewPolicy parses the read and write defaults and the per route overrides,
+// routes is a ";" separated list of "pattern=rate:burst".
+func NewPolicy(read string, write string, routes string) (*Policy, error) {
+	readLimit, err := ParseLimit(read)
+	if err != nil {
+		return nil, err
+	}
+
+	writeLimit, err := ParseLimit(write)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Policy{Read: readLimit, Write: writeLimit, Routes: make(map[string]Limit)}
+	for _, rule := range strings.Split(routes, ";") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+
+		pattern, value, found := strings.Cut(rule, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid route limit %q, expected pattern=rate:burst", rule)
+		}
+
+		limit, err := ParseLimit(value)
+		if err != nil {
+			return nil, err
+		}
+		p.Routes[strings.TrimSpace(pattern)] = limit
+	}
+
+	return p, nil
+}
+
+// LimitFor returns the limit and the bucket name for a request, routes with
+// their own limit get their own bucket, the others share the read or write one.
+func (p *Policy) LimitFor(method string, pattern string) (Limit, string) {
+	if limit, ok := p.Routes[pattern]; ok {
+		return limit, pattern
+	}
+
+	switch method {
+	case "GET", "HEAD", "OPTIONS":
+		return p.Read, "read"
+	default:
+		return p.Write, "write"
+	}
+}
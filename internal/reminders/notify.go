@@ -0,0 +1,226 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+)
+
+// EventDue is the event of a webhook sent for a due reminder.
+const EventDue = "reminder.due"
+
+// SignatureHeader carries the HMAC-SHA256 of a webhook body with the shared
+// secret, as sha256=<hex>.
+const SignatureHeader = "X-Signature"
+
+// Notifier sends a due reminder somewhere. An error is retried with backoff.
+type Notifier interface {
+	Name() string
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Notification is a due reminder with its contact.
+type Notification struct {
+	Reminder Reminder       `json:"reminder"`
+	Contact  domain.Contact `json:"contact"`
+	// Attempt counts the tries to send this occurrence, from 1.
+	Attempt int `json:"attempt"`
+}
+
+// LogNotifier writes due reminders to the log.
+type LogNotifier struct{}
+
+func (LogNotifier) Name() string {
+	return "log"
+}
+
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	slog.InfoContext(ctx, "reminder due",
+		"reminder_id", n.Reminder.Id,
+		"contact_id", n.Contact.Id,
+		"contact_name", n.Contact.Name,
+		"due_at", n.Reminder.DueAt,
+		"note", n.Reminder.Note,
+	)
+	return nil
+}
+
+// WebhookNotifier POSTs due reminders as JSON to a URL, signed when it has a
+// secret. Any status other than 2xx is an error.
+type WebhookNotifier struct {
+	URL    string
+	Secret string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url, secret string, timeout time.Duration) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:    url,
+		Secret: secret,
+		Client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (w *WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(struct {
+		Event string `json:"event"`
+		Notification
+	}{EventDue, n})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(w.Secret))
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// SMTPNotifier mails due reminders. It uses STARTTLS when the server offers
+// it and authenticates only with a username, so a local test server like
+// Mailpit works without either.
+type SMTPNotifier struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+	To       []string
+	Timeout  time.Duration
+}
+
+func (s *SMTPNotifier) Name() string {
+	return "smtp"
+}
+
+func (s *SMTPNotifier) Notify(ctx context.Context, n Notification) error {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.Username, s.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err := client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	data, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := data.Write(s.message(n)); err != nil {
+		return err
+	}
+	if err := data.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (s *SMTPNotifier) message(n Notification) []byte {
+	var b bytes.Buffer
+	header := func(name, value string) {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+
+	header("From", s.From)
+	header("To", strings.Join(s.To, ", "))
+	header("Subject", mime.QEncoding.Encode("utf-8", headerText("Reminder: "+n.Contact.Name)))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+
+	body := fmt.Sprintf("Contact: %s\nDue: %s\n", n.Contact.Name, n.Reminder.DueAt.Format(time.RFC3339))
+	if n.Contact.Email != "" {
+		body += "Email: " + n.Contact.Email + "\n"
+	}
+	if n.Contact.Phone != "" {
+		body += "Phone: " + n.Contact.Phone + "\n"
+	}
+	if n.Reminder.Note != "" {
+		body += "\n" + n.Reminder.Note + "\n"
+	}
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	return b.Bytes()
+}
+
+// headerText keeps a header value on one line, a name cannot add headers.
+func headerText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,83 @@
+// Package reminders are follow-ups attached to contacts. A scheduler in the
+// API fires the due ones through notifiers, only in the instance holding the
+// leader lock.
+package reminders
+
+import (
+	"errors"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusCompleted Status = "completed"
+)
+
+// ErrCompleted means the reminder was already completed.
+var ErrCompleted = errors.New("reminder already completed")
+
+type Reminder struct {
+	Id          int64  `json:"id"`
+	ContactId   int    `json:"contact_id"`
+	ContactName string `json:"contact_name"`
+	Note        string `json:"note"`
+	// Recurrence is a Rule, empty for a reminder that fires once.
+	Recurrence string `json:"recurrence,omitempty"`
+	// TimeZone is the wall clock the recurrence follows.
+	TimeZone string `json:"time_zone"`
+	Status   Status `json:"status"`
+	// OccursAt is the pending occurrence, DueAt when it fires, later once snoozed.
+	OccursAt time.Time `json:"occurs_at"`
+	DueAt    time.Time `json:"due_at"`
+	Overdue  bool      `json:"overdue"`
+	// NotifiedAt is when the pending occurrence was sent to the notifiers.
+	NotifiedAt *time.Time `json:"notified_at,omitempty"`
+	// NotifyError is why sending failed, kept once the attempts are used up.
+	NotifyError string     `json:"notify_error,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	// startsAt is the first occurrence, the recurrence counts from it.
+	startsAt time.Time
+}
+
+// CreateRequest is the body of POST /api/contacts/{id}/reminders.
+type CreateRequest struct {
+	Note       string    `json:"note" validate:"max=1000"`
+	DueAt      time.Time `json:"due_at"`
+	Recurrence string    `json:"recurrence" validate:"max=200"`
+	// TimeZone is an IANA name, UTC when empty.
+	TimeZone string `json:"time_zone"`
+}
+
+// SnoozeRequest moves a reminder to Until, or For from now on.
+type SnoozeRequest struct {
+	Until time.Time `json:"until"`
+	For   string    `json:"for"`
+}
+
+// Due selects reminders by when they are due.
+type Due string
+
+const (
+	// DueOverdue are pending reminders whose due time passed.
+	DueOverdue Due = "overdue"
+	// DueUpcoming are pending reminders due within a window from now.
+	DueUpcoming Due = "upcoming"
+)
+
+type Filter struct {
+	// ContactId limits the list to one contact, 0 is every contact.
+	ContactId int
+	// Status is "" for every status.
+	Status Status
+	// Due limits the list to pending reminders due at that time, "" is any time.
+	Due Due
+	// Within is the window of DueUpcoming.
+	Within time.Duration
+	Page   int
+	Limit  int
+}
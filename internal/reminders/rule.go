@@ -0,0 +1,164 @@
+package reminders
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxUnit is the longest a step of each frequency can take, used to skip
+// ahead without overshooting.
+var maxUnit = map[Frequency]time.Duration{
+	Daily:   25 * time.Hour,
+	Weekly:  7*24*time.Hour + time.Hour,
+	Monthly: 31*24*time.Hour + time.Hour,
+	Yearly:  366*24*time.Hour + time.Hour,
+}
+
+// Rule is the subset of an iCalendar RRULE reminders repeat with, e.g.
+// FREQ=WEEKLY;INTERVAL=2;COUNT=10. The zero Rule does not repeat.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// Count limits the occurrences, the first one included, 0 is no limit.
+	Count int
+	// Until is the last time an occurrence may fall on, zero is no limit.
+	Until time.Time
+}
+
+// ParseRule parses a recurrence, "" is no recurrence.
+func ParseRule(s string) (Rule, error) {
+	r := Rule{Interval: 1}
+	if s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:"); s == "" {
+		return Rule{}, nil
+	}
+
+	for part := range strings.SplitSeq(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("recurrence part %q is not NAME=VALUE", part)
+		}
+
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			if _, ok := maxUnit[r.Freq]; !ok {
+				return Rule{}, fmt.Errorf("FREQ must be DAILY, WEEKLY, MONTHLY or YEARLY, got %q", value)
+			}
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(value); err != nil || r.Interval < 1 {
+				return Rule{}, fmt.Errorf("INTERVAL must be a positive number, got %q", value)
+			}
+		case "COUNT":
+			if r.Count, err = strconv.Atoi(value); err != nil || r.Count < 1 {
+				return Rule{}, fmt.Errorf("COUNT must be a positive number, got %q", value)
+			}
+		case "UNTIL":
+			if r.Until, err = parseUntil(value); err != nil {
+				return Rule{}, fmt.Errorf("UNTIL must be like 20270131T090000Z or 20270131, got %q", value)
+			}
+		default:
+			return Rule{}, fmt.Errorf("recurrence part %s is not supported", name)
+		}
+	}
+
+	if r.Freq == "" {
+		return Rule{}, errors.New("recurrence needs a FREQ")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return Rule{}, errors.New("recurrence may have COUNT or UNTIL, not both")
+	}
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	// A date includes the whole day.
+	t, err := time.Parse("20060102", value)
+	return t.Add(24*time.Hour - time.Second), err
+}
+
+func (r Rule) IsZero() bool {
+	return r.Freq == ""
+}
+
+func (r Rule) String() string {
+	if r.IsZero() {
+		return ""
+	}
+
+	s := "FREQ=" + string(r.Freq)
+	if r.Interval > 1 {
+		s += ";INTERVAL=" + strconv.Itoa(r.Interval)
+	}
+	if r.Count > 0 {
+		s += ";COUNT=" + strconv.Itoa(r.Count)
+	}
+	if !r.Until.IsZero() {
+		s += ";UNTIL=" + r.Until.UTC().Format("20060102T150405Z")
+	}
+	return s
+}
+
+// Next returns the first occurrence after after, counted from start on the
+// wall clock of loc, so a reminder at 9:00 stays at 9:00 across DST changes.
+// A day missing from a month, like the 31st, falls on the month's last day.
+// False means there is none.
+func (r Rule) Next(start time.Time, after time.Time, loc *time.Location) (time.Time, bool) {
+	if r.IsZero() {
+		return time.Time{}, false
+	}
+
+	start = start.In(loc)
+	step := 1
+	if elapsed := after.Sub(start); elapsed > 0 {
+		step = max(1, int(elapsed/(maxUnit[r.Freq]*time.Duration(r.Interval))))
+	}
+
+	for ; r.Count == 0 || step < r.Count; step++ {
+		next := r.occurrence(start, step*r.Interval)
+		if !r.Until.IsZero() && next.After(r.Until) {
+			return time.Time{}, false
+		}
+		if next.After(after) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// occurrence is start moved by n steps of the frequency.
+func (r Rule) occurrence(start time.Time, n int) time.Time {
+	year, month, day := start.Date()
+	switch r.Freq {
+	case Daily:
+		day += n
+	case Weekly:
+		day += 7 * n
+	case Monthly:
+		month += time.Month(n)
+	case Yearly:
+		year += n
+	}
+
+	// Normalize the month first, then clamp the day into it.
+	first := time.Date(year, month, 1, 0, 0, 0, 0, start.Location())
+	if r.Freq == Monthly || r.Freq == Yearly {
+		day = min(day, time.Date(first.Year(), first.Month()+1, 0, 0, 0, 0, 0, start.Location()).Day())
+	}
+	return time.Date(first.Year(), first.Month(), day, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+}
@@ -0,0 +1,148 @@
+package reminders
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestRuleNext(t *testing.T) {
+	newYork := mustLoad(t, "America/New_York")
+	berlin := mustLoad(t, "Europe/Berlin")
+	at := func(loc *time.Location, year int, month time.Month, day, hour int) time.Time {
+		return time.Date(year, month, day, hour, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		after time.Time
+		loc   *time.Location
+		want  time.Time
+	}{
+		{"monthly 31st in February", "FREQ=MONTHLY", at(time.UTC, 2026, time.January, 31, 9), at(time.UTC, 2026, time.January, 31, 9),
+			time.UTC, at(time.UTC, 2026, time.February, 28, 9)},
+		{"monthly 31st in a leap February", "FREQ=MONTHLY", at(time.UTC, 2028, time.January, 31, 9), at(time.UTC, 2028, time.January, 31, 9),
+			time.UTC, at(time.UTC, 2028, time.February, 29, 9)},
+		{"monthly 31st back on the 31st after February", "FREQ=MONTHLY", at(time.UTC, 2026, time.January, 31, 9), at(time.UTC, 2026, time.February, 28, 9),
+			time.UTC, at(time.UTC, 2026, time.March, 31, 9)},
+		{"monthly 31st in a 30 day month", "FREQ=MONTHLY", at(time.UTC, 2026, time.March, 31, 9), at(time.UTC, 2026, time.March, 31, 9),
+			time.UTC, at(time.UTC, 2026, time.April, 30, 9)},
+		{"yearly leap day in a common year", "FREQ=YEARLY", at(time.UTC, 2024, time.February, 29, 9), at(time.UTC, 2024, time.February, 29, 9),
+			time.UTC, at(time.UTC, 2025, time.February, 28, 9)},
+		{"yearly leap day in the next leap year", "FREQ=YEARLY", at(time.UTC, 2024, time.February, 29, 9), at(time.UTC, 2027, time.March, 1, 9),
+			time.UTC, at(time.UTC, 2028, time.February, 29, 9)},
+
+		{"daily across the start of DST", "FREQ=DAILY", at(newYork, 2026, time.March, 7, 9), at(newYork, 2026, time.March, 7, 9),
+			newYork, at(newYork, 2026, time.March, 8, 9)},
+		{"daily across the end of DST", "FREQ=DAILY", at(newYork, 2026, time.October, 31, 9), at(newYork, 2026, time.October, 31, 9),
+			newYork, at(newYork, 2026, time.November, 1, 9)},
+		{"weekly across the end of DST", "FREQ=WEEKLY", at(berlin, 2026, time.October, 19, 9), at(berlin, 2026, time.October, 19, 9),
+			berlin, at(berlin, 2026, time.October, 26, 9)},
+		{"start given in another zone", "FREQ=DAILY", at(newYork, 2026, time.March, 7, 9).UTC(), at(newYork, 2026, time.March, 7, 9),
+			newYork, at(newYork, 2026, time.March, 8, 9)},
+
+		{"interval", "FREQ=WEEKLY;INTERVAL=2", at(time.UTC, 2026, time.January, 5, 9), at(time.UTC, 2026, time.January, 5, 9),
+			time.UTC, at(time.UTC, 2026, time.January, 19, 9)},
+		{"long after the start", "FREQ=DAILY", at(time.UTC, 2020, time.January, 1, 9), at(time.UTC, 2026, time.June, 15, 10),
+			time.UTC, at(time.UTC, 2026, time.June, 16, 9)},
+
+		{"count has occurrences left", "FREQ=DAILY;COUNT=3", at(time.UTC, 2026, time.January, 1, 9), at(time.UTC, 2026, time.January, 2, 9),
+			time.UTC, at(time.UTC, 2026, time.January, 3, 9)},
+		{"count includes the start", "FREQ=DAILY;COUNT=3", at(time.UTC, 2026, time.January, 1, 9), at(time.UTC, 2026, time.January, 3, 9),
+			time.UTC, time.Time{}},
+		{"count of one is only the start", "FREQ=DAILY;COUNT=1", at(time.UTC, 2026, time.January, 1, 9), at(time.UTC, 2026, time.January, 1, 9),
+			time.UTC, time.Time{}},
+		{"until is inclusive", "FREQ=DAILY;UNTIL=20260103T090000Z", at(time.UTC, 2026, time.January, 1, 9), at(time.UTC, 2026, time.January, 2, 9),
+			time.UTC, at(time.UTC, 2026, time.January, 3, 9)},
+		{"until passed", "FREQ=DAILY;UNTIL=20260103T090000Z", at(time.UTC, 2026, time.January, 1, 9), at(time.UTC, 2026, time.January, 3, 9),
+			time.UTC, time.Time{}},
+		{"until date includes the whole day", "FREQ=DAILY;UNTIL=20260103", at(time.UTC, 2026, time.January, 1, 23), at(time.UTC, 2026, time.January, 2, 23),
+			time.UTC, at(time.UTC, 2026, time.January, 3, 23)},
+		{"no recurrence", "", at(time.UTC, 2026, time.January, 1, 9), at(time.UTC, 2026, time.January, 1, 9),
+			time.UTC, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRule(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := rule.Next(tt.start, tt.after, tt.loc)
+			if ok != !tt.want.IsZero() || !got.Equal(tt.want) {
+				t.Fatalf("Next(%s) = %s, %v, want %s", tt.after, got, ok, tt.want)
+			}
+			if ok && got.In(tt.loc).Hour() != tt.start.In(tt.loc).Hour() {
+				t.Fatalf("Next moved the wall clock to %s", got.In(tt.loc))
+			}
+		})
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		ok   bool
+	}{
+		{"FREQ=DAILY", "FREQ=DAILY", true},
+		{"RRULE:freq=weekly;interval=2", "FREQ=WEEKLY;INTERVAL=2", true},
+		{"FREQ=MONTHLY;COUNT=12", "FREQ=MONTHLY;COUNT=12", true},
+		{"FREQ=YEARLY;UNTIL=20300101T000000Z", "FREQ=YEARLY;UNTIL=20300101T000000Z", true},
+		{"", "", true},
+
+		{"FREQ=HOURLY", "", false},
+		{"FREQ=MONTHLY;BYMONTHDAY=31", "", false},
+		{"FREQ=DAILY;COUNT=2;UNTIL=20300101", "", false},
+		{"FREQ=DAILY;INTERVAL=0", "", false},
+		{"FREQ=DAILY;COUNT=-1", "", false},
+		{"FREQ=DAILY;UNTIL=2030-01-01", "", false},
+		{"INTERVAL=2", "", false},
+		{"FREQ", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			rule, err := ParseRule(tt.in)
+			if (err == nil) != tt.ok {
+				t.Fatalf("error %v, want ok %v", err, tt.ok)
+			}
+			if got := rule.String(); got != tt.want {
+				t.Fatalf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReminderNext(t *testing.T) {
+	start := time.Date(2026, time.January, 1, 9, 0, 0, 0, time.UTC)
+	r := Reminder{Recurrence: "FREQ=DAILY;COUNT=5", TimeZone: "UTC", OccursAt: start.AddDate(0, 0, 1), startsAt: start}
+
+	// Sent late, the occurrences missed meanwhile are skipped.
+	next, ok, err := r.next(start.AddDate(0, 0, 2).Add(time.Hour))
+	if err != nil || !ok || !next.Equal(start.AddDate(0, 0, 3)) {
+		t.Fatalf("next = %s, %v, %v, want %s", next, ok, err, start.AddDate(0, 0, 3))
+	}
+
+	r.OccursAt = start.AddDate(0, 0, 4)
+	if _, ok, err := r.next(r.OccursAt); err != nil || ok {
+		t.Fatalf("last occurrence has a next one, error %v", err)
+	}
+
+	once := Reminder{TimeZone: "UTC", OccursAt: start, startsAt: start}
+	if _, ok, err := once.next(start); err != nil || ok {
+		t.Fatalf("reminder without recurrence has a next one, error %v", err)
+	}
+}
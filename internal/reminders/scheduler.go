@@ -0,0 +1,146 @@
+package reminders
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+)
+
+// leaderLockKey is the advisory lock of the scheduler's leader, "reminder" in ASCII.
+const leaderLockKey int64 = 0x72656d696e646572
+
+const (
+	retryBaseDelay = time.Minute
+	retryMaxDelay  = time.Hour
+	// recordTimeout bounds recording an outcome, which happens after the
+	// scheduler's own context may be gone.
+	recordTimeout = 10 * time.Second
+)
+
+type Options struct {
+	// Interval is the wait between looking for due reminders.
+	Interval time.Duration
+	// Batch is the most reminders sent per look, more are sent right after.
+	Batch int
+	// MaxAttempts is the tries to send an occurrence before giving up on it.
+	MaxAttempts int
+}
+
+// Scheduler sends due reminders to its notifiers. Every API instance runs
+// one, only the instance holding the leader lock sends.
+type Scheduler struct {
+	store     *Store
+	leader    *database.Leader
+	notifiers []Notifier
+	opts      Options
+}
+
+func NewScheduler(db *database.DB, store *Store, notifiers []Notifier, opts Options) *Scheduler {
+	return &Scheduler{
+		store:     store,
+		leader:    database.NewLeader(db.Pool, leaderLockKey),
+		notifiers: notifiers,
+		opts:      opts,
+	}
+}
+
+// Run sends due reminders until ctx is done, then gives up the leadership.
+func (s *Scheduler) Run(ctx context.Context) {
+	names := make([]string, len(s.notifiers))
+	for i, n := range s.notifiers {
+		names[i] = n.Name()
+	}
+	slog.Info("reminder scheduler started", "interval", s.opts.Interval.String(), "notifiers", names)
+
+	ticker := time.NewTicker(s.opts.Interval)
+	defer ticker.Stop()
+
+	leading := false
+	for {
+		isLeader, err := s.leader.Check(ctx)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.Warn("reminder scheduler leader check", "error", err)
+		case isLeader != leading:
+			leading = isLeader
+			slog.Info("reminder scheduler leadership changed", "leader", leading)
+		}
+		if isLeader {
+			s.fire(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+			s.leader.Release(releaseCtx)
+			cancel()
+			slog.Info("reminder scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fire sends due reminders batch after batch until none is left.
+func (s *Scheduler) fire(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := s.store.due(ctx, s.opts.Batch)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.Warn("find due reminders", "error", err)
+			}
+			return
+		}
+
+		for i := range due {
+			s.send(ctx, &due[i])
+		}
+		if len(due) < s.opts.Batch {
+			return
+		}
+	}
+}
+
+// send hands n to every notifier. One failing retries the occurrence with
+// all of them, notifiers are expected to tolerate a repeat.
+func (s *Scheduler) send(ctx context.Context, n *Notification) {
+	log := slog.With("reminder_id", n.Reminder.Id, "contact_id", n.Contact.Id, "attempt", n.Attempt)
+
+	var errs []string
+	for _, notifier := range s.notifiers {
+		if err := notifier.Notify(ctx, *n); err != nil {
+			errs = append(errs, notifier.Name()+": "+err.Error())
+		}
+	}
+	if ctx.Err() != nil {
+		// Stopping, the occurrence is sent again by the next leader.
+		return
+	}
+
+	recordCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordTimeout)
+	defer cancel()
+
+	if len(errs) == 0 {
+		if err := s.store.notified(recordCtx, n); err != nil {
+			log.Error("record reminder sent", "error", err)
+		}
+		return
+	}
+
+	message := strings.Join(errs, "; ")
+	var retryAt time.Time
+	if n.Attempt < s.opts.MaxAttempts {
+		retryAt = time.Now().Add(min(retryBaseDelay<<min(n.Attempt-1, 10), retryMaxDelay))
+	}
+	if err := s.store.failed(recordCtx, n, message, retryAt); err != nil {
+		log.Error("record reminder failure", "error", err)
+	}
+	if retryAt.IsZero() {
+		log.Error("reminder not sent, giving up", "error", message)
+	} else {
+		log.Warn("reminder not sent, retrying", "error", message, "retry_at", retryAt)
+	}
+}
@@ -0,0 +1,338 @@
+package reminders
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const reminderColumns = `r.id, r.contact_id, c.name, r.note, r.recurrence, r.time_zone, r.status, r.occurs_at, r.due_at,
+	r.status = 'pending' AND r.due_at <= NOW(), r.notified_at, COALESCE(r.notify_error, ''), r.completed_at,
+	r.created_at, r.updated_at, r.starts_at`
+
+const reminderFrom = ` FROM reminders r JOIN contacts c ON c.id = r.contact_id`
+
+// Store keeps reminders in Postgres. Every read goes to the primary, a
+// replica may not have a reminder that was just snoozed yet.
+type Store struct {
+	db *database.DB
+}
+
+func NewStore(db *database.DB) *Store {
+	return &Store{db: db}
+}
+
+// Create adds a pending reminder from the ContactId, Note, DueAt, Recurrence
+// and TimeZone of r. A missing contact is domain.ErrNotFound.
+func (s *Store) Create(ctx context.Context, r *Reminder) (*Reminder, error) {
+	var id int64
+	err := s.db.QueryRow(ctx, `INSERT INTO reminders (contact_id, note, recurrence, time_zone, starts_at, occurs_at, due_at, notify_after)
+		VALUES ($1, $2, $3, $4, $5, $5, $5, $5) RETURNING id`,
+		r.ContactId, r.Note, r.Recurrence, r.TimeZone, r.DueAt).Scan(&id)
+	var pgErr *pgconn.PgError
+	// 23503 foreign_key_violation, the contact does not exist.
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(ctx, id)
+}
+
+func (s *Store) Get(ctx context.Context, id int64) (*Reminder, error) {
+	r, err := scanReminder(s.db.QueryRow(ctx, `SELECT `+reminderColumns+reminderFrom+` WHERE r.id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	return r, err
+}
+
+// List returns a page of the reminders matching f, soonest due first, and
+// how many match in total.
+func (s *Store) List(ctx context.Context, f Filter) ([]Reminder, int64, error) {
+	where, args := f.where()
+
+	var total int64
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*)`+reminderFrom+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(ctx, `SELECT `+reminderColumns+reminderFrom+where+
+		` ORDER BY r.due_at, r.id LIMIT `+strconv.Itoa(f.Limit)+` OFFSET `+strconv.Itoa((f.Page-1)*f.Limit), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	reminders := []Reminder{}
+	for rows.Next() {
+		r, err := scanReminder(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		reminders = append(reminders, *r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return reminders, total, nil
+}
+
+func (f Filter) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if f.ContactId > 0 {
+		add(`r.contact_id = $?`, f.ContactId)
+	}
+	if f.Due != "" {
+		add(`r.status = $?`, string(StatusPending))
+	} else if f.Status != "" {
+		add(`r.status = $?`, string(f.Status))
+	}
+	switch f.Due {
+	case DueOverdue:
+		conditions = append(conditions, `r.due_at <= NOW()`)
+	case DueUpcoming:
+		conditions = append(conditions, `r.due_at > NOW()`)
+		add(`r.due_at <= NOW() + make_interval(secs => $?)`, f.Within.Seconds())
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return ` WHERE ` + strings.Join(conditions, " AND "), args
+}
+
+func (s *Store) Delete(ctx context.Context, id int64) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM reminders WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+	return nil
+}
+
+// Snooze moves a pending reminder to until, it fires again then.
+func (s *Store) Snooze(ctx context.Context, id int64, until time.Time) (*Reminder, error) {
+	tag, err := s.db.Exec(ctx, `UPDATE reminders SET
+			due_at = $2,
+			notify_after = $2,
+			notified_at = NULL,
+			notify_attempts = 0,
+			notify_error = NULL,
+			updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'`, id, until)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, s.notPending(ctx, id)
+	}
+
+	return s.Get(ctx, id)
+}
+
+// Complete completes a reminder. A recurring one moves on to its next
+// occurrence after now, or after the pending one when completed early, and
+// is only completed once its recurrence ended.
+func (s *Store) Complete(ctx context.Context, id int64, now time.Time) (*Reminder, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var status Status
+	var recurrence, timeZone string
+	var startsAt, occursAt time.Time
+	err = tx.QueryRow(ctx, `SELECT status, recurrence, time_zone, starts_at, occurs_at FROM reminders WHERE id = $1 FOR UPDATE`, id).
+		Scan(&status, &recurrence, &timeZone, &startsAt, &occursAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, domain.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if status == StatusCompleted {
+		return nil, ErrCompleted
+	}
+
+	next, ok, err := nextOccurrence(recurrence, timeZone, startsAt, occursAt, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if ok {
+		_, err = tx.Exec(ctx, `UPDATE reminders SET
+				occurs_at = $2,
+				due_at = $2,
+				notify_after = $2,
+				notified_at = NULL,
+				notify_attempts = 0,
+				notify_error = NULL,
+				updated_at = NOW()
+			WHERE id = $1`, id, next)
+	} else {
+		_, err = tx.Exec(ctx, `UPDATE reminders SET status = 'completed', completed_at = NOW(), updated_at = NOW() WHERE id = $1`, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, id)
+}
+
+func nextOccurrence(recurrence, timeZone string, startsAt, occursAt, now time.Time) (time.Time, bool, error) {
+	rule, err := ParseRule(recurrence)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	after := occursAt
+	if now.After(after) {
+		after = now
+	}
+	next, ok := rule.Next(startsAt, after, loc)
+	return next, ok, nil
+}
+
+// notPending tells why a reminder could not be changed.
+func (s *Store) notPending(ctx context.Context, id int64) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	return ErrCompleted
+}
+
+// due returns up to limit pending reminders whose occurrence was not sent
+// yet and is due, or due for another attempt, with their contact.
+func (s *Store) due(ctx context.Context, limit int) ([]Notification, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+reminderColumns+`, COALESCE(c.email, ''), COALESCE(c.phone, ''), r.notify_attempts`+reminderFrom+`
+		WHERE r.status = 'pending' AND r.notified_at IS NULL AND r.notify_after <= NOW()
+		ORDER BY r.notify_after, r.id
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		r, err := scanReminder(rows, &n.Contact.Email, &n.Contact.Phone, &n.Attempt)
+		if err != nil {
+			return nil, err
+		}
+		n.Reminder = *r
+		n.Contact.Id, n.Contact.Name = r.ContactId, r.ContactName
+		// The attempt being made now.
+		n.Attempt++
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// notified records that the occurrence due at dueAt was sent, a recurring
+// reminder moves on to its next occurrence. A reminder snoozed or completed
+// meanwhile has another due time and is left alone.
+func (s *Store) notified(ctx context.Context, n *Notification) error {
+	if next, ok, err := n.Reminder.next(time.Now()); err != nil || ok {
+		if err != nil {
+			return err
+		}
+		return s.advance(ctx, n, next, nil)
+	}
+
+	_, err := s.db.Exec(ctx, `UPDATE reminders SET notified_at = NOW(), notify_attempts = $3, notify_error = NULL
+		WHERE id = $1 AND due_at = $2 AND notified_at IS NULL`, n.Reminder.Id, n.Reminder.DueAt, n.Attempt)
+	return err
+}
+
+// failed records a failed attempt, retried from retryAt on. A zero retryAt
+// gives up, the occurrence counts as notified with the error kept.
+func (s *Store) failed(ctx context.Context, n *Notification, message string, retryAt time.Time) error {
+	if retryAt.IsZero() {
+		if next, ok, err := n.Reminder.next(time.Now()); err != nil || ok {
+			if err != nil {
+				return err
+			}
+			return s.advance(ctx, n, next, &message)
+		}
+	}
+
+	_, err := s.db.Exec(ctx, `UPDATE reminders SET
+			notify_attempts = $3,
+			notify_error = $4,
+			notify_after = COALESCE($5, notify_after),
+			notified_at = CASE WHEN $5::timestamptz IS NULL THEN NOW() END
+		WHERE id = $1 AND due_at = $2 AND notified_at IS NULL`,
+		n.Reminder.Id, n.Reminder.DueAt, n.Attempt, message, nullTime(retryAt))
+	return err
+}
+
+// advance moves a recurring reminder whose occurrence was sent on to next,
+// keeping notifyError when sending it was given up on.
+func (s *Store) advance(ctx context.Context, n *Notification, next time.Time, notifyError *string) error {
+	_, err := s.db.Exec(ctx, `UPDATE reminders SET
+			occurs_at = $3,
+			due_at = $3,
+			notify_after = $3,
+			notified_at = NULL,
+			notify_attempts = 0,
+			notify_error = $4,
+			updated_at = NOW()
+		WHERE id = $1 AND due_at = $2 AND notified_at IS NULL`,
+		n.Reminder.Id, n.Reminder.DueAt, next, notifyError)
+	return err
+}
+
+// next is the occurrence r moves on to once its pending one was sent, false
+// when it does not recur or its recurrence ended. Occurrences missed while
+// no scheduler ran are skipped.
+func (r *Reminder) next(now time.Time) (time.Time, bool, error) {
+	if r.Recurrence == "" {
+		return time.Time{}, false, nil
+	}
+	return nextOccurrence(r.Recurrence, r.TimeZone, r.startsAt, r.OccursAt, now)
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func scanReminder(row pgx.Row, extra ...interface{}) (*Reminder, error) {
+	var r Reminder
+	targets := []interface{}{&r.Id, &r.ContactId, &r.ContactName, &r.Note, &r.Recurrence, &r.TimeZone, &r.Status, &r.OccursAt, &r.DueAt,
+		&r.Overdue, &r.NotifiedAt, &r.NotifyError, &r.CompletedAt, &r.CreatedAt, &r.UpdatedAt, &r.startsAt}
+	if err := row.Scan(append(targets, extra...)...); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/cache"
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/logger"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/tracing"
+)
+
+// ContactsCacheChannel is the Postgres NOTIFY channel contact invalidations are sent on.
+const ContactsCacheChannel = "contacts_cache"
+
+const (
+	contactByIdPrefix = "contacts:id:"
+	contactPagePrefix = "contacts:page:"
+)
+
+// CachedContactRepository is a read-through cache in front of another
+// ContactRepository. GetById and Paginate are cached, every write drops the
+// written contact and all cached pages. GetAll, GetByGroupIds, GetDated, Count,
+// Fingerprint and Tags go straight to the wrapped repository.
+type CachedContactRepository struct {
+	domain.ContactRepository
+
+	backend  cache.Backend
+	ttl      time.Duration
+	notifier *cache.Notifier
+	metrics  *cache.Metrics
+	group    cache.Group
+
+	// generation is bumped by every invalidation, a load that raced with one
+	// does not store what it read.
+	generation atomic.Uint64
+
+	// Loads within primaryWindow of the last invalidation read the primary, so
+	// a lagging replica cannot put the old rows back for a whole ttl.
+	primaryWindow time.Duration
+	droppedAt     atomic.Int64
+}
+
+// NewCachedContactRepository wraps next, notifier and metrics may be nil for a
+// single instance without metrics. primaryWindow is 0 without read replicas.
+func NewCachedContactRepository(next domain.ContactRepository, backend cache.Backend, ttl time.Duration, primaryWindow time.Duration, notifier *cache.Notifier, metrics *cache.Metrics) *CachedContactRepository {
+	return &CachedContactRepository{
+		ContactRepository: next,
+		backend:           backend,
+		ttl:               ttl,
+		primaryWindow:     primaryWindow,
+		notifier:          notifier,
+		metrics:           metrics,
+	}
+}
+
+type contactPage struct {
+	Contacts []domain.Contact `json:"contacts"`
+	Total    int64            `json:"total"`
+}
+
+func (c *CachedContactRepository) Paginate(ctx context.Context, page int, limit int, fields []string, sort domain.Sort, filter domain.ContactFilter) ([]domain.Contact, int64, error) {
+	key := contactPagePrefix + strconv.Itoa(page) + ":" + strconv.Itoa(limit) + ":" + strings.Join(fields, ",") + ":" + sort.String() + ":" + filter.String()
+
+	var result contactPage
+	err := c.read(ctx, "paginate", key, &result, func(ctx context.Context) (interface{}, error) {
+		contacts, total, err := c.ContactRepository.Paginate(ctx, page, limit, fields, sort, filter)
+		return contactPage{Contacts: contacts, Total: total}, err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return result.Contacts, result.Total, nil
+}
+
+func (c *CachedContactRepository) GetById(ctx context.Context, id int, fields []string) (*domain.Contact, error) {
+	key := contactByIdPrefix + strconv.Itoa(id) + ":" + strings.Join(fields, ",")
+
+	var contact domain.Contact
+	err := c.read(ctx, "get_by_id", key, &contact, func(ctx context.Context) (interface{}, error) {
+		return c.ContactRepository.GetById(ctx, id, fields)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &contact, nil
+}
+
+func (c *CachedContactRepository) Store(ctx context.Context, contact *domain.Contact) (*domain.Contact, error) {
+	stored, err := c.ContactRepository.Store(ctx, contact)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Invalidate(ctx, stored.Id)
+	return stored, nil
+}
+
+func (c *CachedContactRepository) Update(ctx context.Context, id int, update *domain.ContactUpdate) (*domain.Contact, error) {
+	updated, err := c.ContactRepository.Update(ctx, id, update)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Invalidate(ctx, id)
+	return updated, nil
+}
+
+func (c *CachedContactRepository) Delete(ctx context.Context, id int) error {
+	if err := c.ContactRepository.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	c.Invalidate(ctx, id)
+	return nil
+}
+
+// Listen applies invalidations published by other instances until ctx is done.
+func (c *CachedContactRepository) Listen(ctx context.Context) {
+	if c.notifier == nil {
+		return
+	}
+
+	c.notifier.Listen(ctx, func(payload string) {
+		if payload == cache.InvalidateAll {
+			c.drop(ctx, "")
+			return
+		}
+
+		id, err := strconv.Atoi(payload)
+		if err != nil {
+			c.drop(ctx, "")
+			return
+		}
+		c.drop(ctx, contactByIdPrefix+strconv.Itoa(id)+":", contactPagePrefix)
+	})
+}
+
+// read answers from the cache or loads with fetch, concurrent misses on the
+// same key share one load. Errors are never cached.
+func (c *CachedContactRepository) read(ctx context.Context, operation string, key string, dst interface{}, fetch func(ctx context.Context) (interface{}, error)) error {
+	span := tracing.SpanFromContext(ctx)
+
+	data, ok, err := c.backend.Get(ctx, key)
+	if err != nil {
+		logger.FromContext(ctx).Warn("contacts cache get", "key", key, "error", err)
+	}
+	if ok {
+		c.metrics.Hit("contacts", operation)
+		span.SetAttributes(tracing.Bool("cache.hit", true))
+		return json.Unmarshal(data, dst)
+	}
+
+	c.metrics.Miss("contacts", operation)
+	span.SetAttributes(tracing.Bool("cache.hit", false))
+
+	data, err, _ = c.group.Do(key, func() ([]byte, error) {
+		generation := c.generation.Load()
+
+		// The load is shared, one caller giving up must not fail the others.
+		loadCtx := context.WithoutCancel(ctx)
+		if time.Since(time.Unix(0, c.droppedAt.Load())) < c.primaryWindow {
+			loadCtx = database.WithPrimary(loadCtx)
+		}
+		value, err := fetch(loadCtx)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		if c.generation.Load() == generation {
+			if err := c.backend.Set(loadCtx, key, data, c.ttl); err != nil {
+				logger.FromContext(ctx).Warn("contacts cache set", "key", key, "error", err)
+			}
+		}
+
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, dst)
+}
+
+// ReplaceTags changes any number of contacts, so everything is dropped.
+func (c *CachedContactRepository) ReplaceTags(ctx context.Context, from []string, to string) (int64, error) {
+	changed, err := c.ContactRepository.ReplaceTags(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	if changed > 0 {
+		c.InvalidateAll(ctx)
+	}
+	return changed, nil
+}
+
+// Invalidate drops the contact and every page locally and tells the other
+// instances, for writes to one contact that bypass the repository.
+func (c *CachedContactRepository) Invalidate(ctx context.Context, id int) {
+	c.drop(ctx, contactByIdPrefix+strconv.Itoa(id)+":", contactPagePrefix)
+
+	if c.notifier != nil {
+		if err := c.notifier.Publish(ctx, strconv.Itoa(id)); err != nil {
+			logger.FromContext(ctx).Warn("publish contacts cache invalidation", "contact_id", id, "error", err)
+		}
+	}
+}
+
+// InvalidateAll drops every cached contact and page, here and on the other
+// instances, for writes that bypass the repository like a restore.
+func (c *CachedContactRepository) InvalidateAll(ctx context.Context) {
+	c.drop(ctx, "")
+
+	if c.notifier != nil {
+		if err := c.notifier.Publish(ctx, cache.InvalidateAll); err != nil {
+			logger.FromContext(ctx).Warn("publish contacts cache invalidation", "error", err)
+		}
+	}
+}
+
+func (c *CachedContactRepository) drop(ctx context.Context, prefixes ...string) {
+	c.generation.Add(1)
+	c.droppedAt.Store(time.Now().UnixNano())
+
+	for _, prefix := range prefixes {
+		if err := c.backend.DeletePrefix(ctx, prefix); err != nil {
+			logger.FromContext(ctx).Warn("contacts cache delete", "prefix", prefix, "error", err)
+		}
+	}
+}
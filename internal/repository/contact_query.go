@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+)
+
+// queryDialect is how Postgres or SQLite spell the parts of a compiled
+// domain.ContactQuery. Each function gets the placeholder of its value.
+type queryDialect struct {
+	placeholder func(n int) string
+	// like is a case-insensitive LIKE, with \ escaping % and _.
+	like   func(column, value string) string
+	hasTag func(value string) string
+	// onOrAfter and before compare a timestamp column with a YYYY-MM-DD
+	// date, false when the column is NULL.
+	onOrAfter func(column, value string) string
+	before    func(column, value string) string
+}
+
+var postgresQueryDialect = queryDialect{
+	placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+	like: func(column, value string) string {
+		return `COALESCE(` + column + `, '') ILIKE ` + value + ` ESCAPE '\'`
+	},
+	hasTag: func(value string) string { return `tags ? ` + value },
+	onOrAfter: func(column, value string) string {
+		return `COALESCE(` + column + ` >= ` + postgresDay(column, value) + `, FALSE)`
+	},
+	before: func(column, value string) string {
+		return `COALESCE(` + column + ` < ` + postgresDay(column, value) + `, FALSE)`
+	},
+}
+
+// postgresDay is the start of the day value in UTC, as the type of column:
+// last_contacted_at is a TIMESTAMPTZ, the others a TIMESTAMP in UTC.
+func postgresDay(column, value string) string {
+	if column == "last_contacted_at" {
+		return `(` + value + `::date::timestamp AT TIME ZONE 'UTC')`
+	}
+	return value + `::date`
+}
+
+// sqliteQueryDialect compares times as text, they are stored UTC as
+// "2006-01-02 15:04:05...", which sorts after the bare date of its day. LIKE
+// ignores case of ASCII letters only.
+var sqliteQueryDialect = queryDialect{
+	placeholder: func(int) string { return "?" },
+	like: func(column, value string) string {
+		return `COALESCE(` + column + `, '') LIKE ` + value + ` ESCAPE '\'`
+	},
+	hasTag: func(value string) string {
+		return `EXISTS (SELECT 1 FROM json_each(contacts.tags) WHERE value = ` + value + `)`
+	},
+	onOrAfter: func(column, value string) string {
+		return `COALESCE(` + column + ` >= ` + value + `, FALSE)`
+	},
+	before: func(column, value string) string {
+		return `COALESCE(` + column + ` < ` + value + `, FALSE)`
+	},
+}
+
+// The allowlist of the compiler, the columns each kind of condition may
+// compare. Any other field is an error, so no caller supplied text ever lands
+// in the SQL.
+var (
+	queryTextColumns = []string{"name", "email", "phone"}
+	queryTimeColumns = []string{"created_at", "updated_at", "last_contacted_at"}
+)
+
+// compileQuery turns q into a condition of d, appending its values to args.
+func compileQuery(q domain.ContactQuery, d queryDialect, args *[]interface{}) (string, error) {
+	switch q := q.(type) {
+	case domain.QueryAnd:
+		return compileQueries(q, " AND ", d, args)
+	case domain.QueryOr:
+		return compileQueries(q, " OR ", d, args)
+	case domain.QueryNot:
+		condition, err := compileQuery(q.Query, d, args)
+		if err != nil {
+			return "", err
+		}
+		return `NOT (` + condition + `)`, nil
+	case domain.QueryCondition:
+		return compileCondition(q, d, args)
+	}
+	return "", fmt.Errorf("unknown query %T", q)
+}
+
+func compileQueries(queries []domain.ContactQuery, separator string, d queryDialect, args *[]interface{}) (string, error) {
+	conditions := make([]string, len(queries))
+	for i, query := range queries {
+		condition, err := compileQuery(query, d, args)
+		if err != nil {
+			return "", err
+		}
+		conditions[i] = `(` + condition + `)`
+	}
+	return strings.Join(conditions, separator), nil
+}
+
+func compileCondition(c domain.QueryCondition, d queryDialect, args *[]interface{}) (string, error) {
+	var columns []string
+	switch c.Operator {
+	case domain.QueryHas:
+		columns = []string{"tags"}
+	case domain.QueryAfter, domain.QueryBefore:
+		columns = queryTimeColumns
+	default:
+		columns = queryTextColumns
+	}
+	i := slices.Index(columns, c.Field)
+	if i < 0 {
+		return "", fmt.Errorf("cannot compare %q with %q", c.Field, c.Operator)
+	}
+	column := columns[i]
+
+	value := func(v interface{}) string {
+		*args = append(*args, v)
+		return d.placeholder(len(*args))
+	}
+
+	switch c.Operator {
+	case domain.QueryIs:
+		return `lower(COALESCE(` + column + `, '')) = lower(CAST(` + value(c.Value) + ` AS TEXT))`, nil
+	case domain.QueryIsNot:
+		return `lower(COALESCE(` + column + `, '')) <> lower(CAST(` + value(c.Value) + ` AS TEXT))`, nil
+	case domain.QueryContains:
+		return d.like(column, value("%"+escapeLike(c.Value)+"%")), nil
+	case domain.QueryStartsWith:
+		return d.like(column, value(escapeLike(c.Value)+"%")), nil
+	case domain.QueryEndsWith:
+		return d.like(column, value("%"+escapeLike(c.Value))), nil
+	case domain.QueryHas:
+		return d.hasTag(value(c.Value)), nil
+	case domain.QueryAfter:
+		return d.onOrAfter(column, value(c.Value)), nil
+	case domain.QueryBefore:
+		return d.before(column, value(c.Value)), nil
+	}
+	return "", fmt.Errorf("unknown query operator %q", c.Operator)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern, so value matches
+// literally.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
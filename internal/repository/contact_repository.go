@@ -2,91 +2,119 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"strings"
 
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
 	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
 	"github.com/jackc/pgx/v5"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type contactRepository struct {
-	db *pgxpool.Pool
+	db *database.DB
 }
 
-func (c contactRepository) GetAll(ctx context.Context) ([]domain.Contact, error) {
-	rows, err := c.db.Query(ctx, `SELECT id, name, email, phone, created_at, updated_at FROM contacts`)
-	if err != nil {
-		return nil, err
+// GetAll streams contacts one row at a time, nothing is collected so memory
+// stays flat no matter how many rows there are.
+// limit is a hard cap on the number of rows.
+func (c contactRepository) GetAll(ctx context.Context, limit int, fields []string) iter.Seq2[domain.Contact, error] {
+	return c.stream(ctx, contactColumns(fields), `ORDER BY id LIMIT $1`, limit)
+}
+
+func (c contactRepository) GetDated(ctx context.Context, groupId int, monthDays []string) iter.Seq2[domain.Contact, error] {
+	clause := `WHERE ` + datedCondition
+	var args []interface{}
+	if groupId > 0 {
+		args = append(args, groupId)
+		clause += fmt.Sprintf(` AND id IN (SELECT contact_id FROM contact_groups WHERE group_id = $%d)`, len(args))
+	}
+	if monthDays != nil {
+		args = append(args, monthDays)
+		// Every form of a date ends in -MM-DD.
+		days := fmt.Sprintf(`ANY($%d)`, len(args))
+		clause += ` AND (right(birthday, 5) = ` + days + ` OR right(anniversary, 5) = ` + days +
+			` OR EXISTS (SELECT 1 FROM jsonb_array_elements(dates) d WHERE right(d->>'date', 5) = ` + days + `))`
 	}
+	return c.stream(ctx, datedColumns, clause+` ORDER BY id`, args...)
+}
 
-	// Rows is stream of data from database, we need to close it after we're done to free up resources.
-	defer rows.Close()
+// stream yields the columns of the contacts matching clause as they are read.
+func (c contactRepository) stream(ctx context.Context, columns []string, clause string, args ...interface{}) iter.Seq2[domain.Contact, error] {
+	return func(yield func(domain.Contact, error) bool) {
+		// Only starting the query is retried, rows already sent cannot be taken back.
+		// The stream is bounded by the request and the row cap, not the statement timeout.
+		rows, err := read(ctx, c.db, func(ctx context.Context, db *database.DB) (pgx.Rows, error) {
+			return db.Query(database.WithoutQueryTimeout(ctx), `SELECT `+strings.Join(columns, ", ")+` FROM contacts `+clause, args...)
+		})
+		if err != nil {
+			yield(domain.Contact{}, err)
+			return
+		}
 
-	var contacts []domain.Contact
+		// Rows is stream of data from database, we need to close it after we're done to free up resources.
+		// Also runs when the consumer stops early.
+		defer rows.Close()
 
-	// Iterate over the rows and scan data into Structs.
-	// Memory efficient for large datasets since it doesn't load everything into memory at once.
-	for rows.Next() {
-		var c domain.Contact
-		err := rows.Scan(
-			&c.Id,
-			&c.Name,
-			&c.Email,
-			&c.Phone,
-			&c.CreatedAt,
-			&c.UpdatedAt,
-		)
+		for rows.Next() {
+			var contact domain.Contact
+			if err := rows.Scan(contactScanTargets(&contact, columns)...); err != nil {
+				yield(domain.Contact{}, err)
+				return
+			}
 
-		if err != nil {
-			return nil, err
+			if !yield(contact, nil) {
+				return
+			}
 		}
 
-		contacts = append(contacts, c)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
+		if err := rows.Err(); err != nil {
+			yield(domain.Contact{}, err)
+		}
 	}
-
-	return contacts, nil
 }
 
-func (c contactRepository) Paginate(ctx context.Context, page int, limit int) ([]domain.Contact, int64, error) {
+func (c contactRepository) Paginate(ctx context.Context, page int, limit int, fields []string, sort domain.Sort, filter domain.ContactFilter) ([]domain.Contact, int64, error) {
 	offset := (page - 1) * limit
-
-	// use Query instead of QueryRow since we expect multiple rows, and it returns a Rows object that we can iterate over.
-	rows, err := c.db.Query(ctx, `SELECT id, name, email, phone, created_at, updated_at FROM contacts ORDER BY id LIMIT $1 OFFSET $2`, limit, offset)
+	columns := contactColumns(fields)
+	where, args, err := filterCondition(filter)
 	if err != nil {
 		return nil, 0, err
 	}
 
-	defer rows.Close()
-
 	var contacts []domain.Contact
-	for rows.Next() {
-		var c domain.Contact
-		err := rows.Scan(
-			&c.Id,
-			&c.Name,
-			&c.Email,
-			&c.Phone,
-			&c.CreatedAt,
-			&c.UpdatedAt,
-		)
-
+	var total int64
+	// The page and its total come from the same database, so they agree
+	// even when the replicas lag differently.
+	err = c.db.Read(ctx, func(ctx context.Context, db *database.DB) error {
+		// use Query instead of QueryRow since we expect multiple rows, and it returns a Rows object that we can iterate over.
+		rows, err := db.Query(ctx, `SELECT `+strings.Join(columns, ", ")+` FROM contacts `+where+orderBy(sort)+
+			fmt.Sprintf(` LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2), append(args, limit, offset)...)
 		if err != nil {
-			return nil, 0, err
+			return err
 		}
 
-		contacts = append(contacts, c)
-	}
+		defer rows.Close()
 
-	if rows.Err() != nil {
-		return nil, 0, err
-	}
+		contacts = nil
+		for rows.Next() {
+			var c domain.Contact
+			if err := rows.Scan(contactScanTargets(&c, columns)...); err != nil {
+				return err
+			}
 
-	var total int64
-	err = c.db.QueryRow(ctx, `SELECT COUNT(*) FROM contacts`).Scan(&total)
+			contacts = append(contacts, c)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		return db.QueryRow(ctx, `SELECT COUNT(*) FROM contacts `+where, args...).Scan(&total)
+	})
 	if err != nil {
 		return nil, 0, err
 	}
@@ -94,27 +122,60 @@ func (c contactRepository) Paginate(ctx context.Context, page int, limit int) ([
 	return contacts, total, nil
 }
 
-func (c contactRepository) GetById(ctx context.Context, id int) (*domain.Contact, error) {
-	var contact domain.Contact
-
-	err := c.db.QueryRow(ctx, `SELECT id, name, email, phone, created_at, updated_at FROM contacts WHERE id = $1`, id).Scan(
-		&contact.Id,
-		&contact.Name,
-		&contact.Email,
-		&contact.Phone,
-		&contact.CreatedAt,
-		&contact.UpdatedAt,
-	)
-
-	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, errors.New("not found")
+// filterCondition is the WHERE of f with a trailing space, empty for the zero
+// filter. Tags every contact must have are matched with ?& and a choice of
+// tags with ?|, both served by the GIN index.
+func filterCondition(f domain.ContactFilter) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+
+	var all []string
+	for _, clause := range f.Tags {
+		if len(clause) == 1 {
+			all = append(all, clause[0])
+			continue
 		}
+		args = append(args, clause)
+		conditions = append(conditions, fmt.Sprintf(`tags ?| $%d`, len(args)))
+	}
+	if len(all) > 0 {
+		args = append(args, all)
+		conditions = append(conditions, fmt.Sprintf(`tags ?& $%d`, len(args)))
+	}
+	if f.GroupId != 0 {
+		args = append(args, f.GroupId)
+		conditions = append(conditions, fmt.Sprintf(`id IN (SELECT contact_id FROM contact_groups WHERE group_id = $%d)`, len(args)))
+	}
+	if f.Query != nil {
+		condition, err := compileQuery(f.Query, postgresQueryDialect, &args)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, `(`+condition+`)`)
+	}
 
-		return nil, err
+	if len(conditions) == 0 {
+		return "", nil, nil
 	}
+	return `WHERE ` + strings.Join(conditions, " AND ") + ` `, args, nil
+}
+
+func (c contactRepository) GetById(ctx context.Context, id int, fields []string) (*domain.Contact, error) {
+	columns := contactColumns(fields)
+
+	return read(ctx, c.db, func(ctx context.Context, db *database.DB) (*domain.Contact, error) {
+		var contact domain.Contact
+		err := db.QueryRow(ctx, `SELECT `+strings.Join(columns, ", ")+` FROM contacts WHERE id = $1`, id).Scan(contactScanTargets(&contact, columns)...)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, domain.ErrNotFound
+			}
+
+			return nil, err
+		}
 
-	return &contact, nil
+		return &contact, nil
+	})
 }
 
 func (c contactRepository) Store(ctx context.Context, contact *domain.Contact) (*domain.Contact, error) {
@@ -126,19 +187,22 @@ func (c contactRepository) Store(ctx context.Context, contact *domain.Contact) (
 	}
 
 	if exists {
-		return nil, errors.New("email already exists")
+		return nil, domain.ErrEmailTaken
 	}
 
 	var newId int
-	err = c.db.QueryRow(ctx, `INSERT INTO contacts (name, email, phone) VALUES ($1, $2, $3) RETURNING id`, contact.Name, contact.Email, contact.Phone).Scan(&newId)
+	err = c.db.QueryRow(ctx, `INSERT INTO contacts (name, email, phone, birthday, anniversary, dates, tags) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`,
+		contact.Name, contact.Email, contact.Phone, dateValue(contact.Birthday), dateValue(contact.Anniversary), datesValue(contact.Dates), tagsValue(contact.Tags)).Scan(&newId)
 	if err != nil {
-		return nil, err
+		// Another insert with the same email won the race after the EXISTS check.
+		return nil, emailTakenError(err)
 	}
 
-	return c.GetById(ctx, newId)
+	// A replica may not have the row yet.
+	return c.GetById(database.WithPrimary(ctx), newId, nil)
 }
 
-func (c contactRepository) Update(ctx context.Context, id int, contact *domain.Contact) (*domain.Contact, error) {
+func (c contactRepository) Update(ctx context.Context, id int, update *domain.ContactUpdate) (*domain.Contact, error) {
 	// Start a transaction to ensure data integrity during the update process.
 	tx, err := c.db.Begin(ctx)
 	if err != nil {
@@ -147,13 +211,19 @@ func (c contactRepository) Update(ctx context.Context, id int, contact *domain.C
 	defer tx.Rollback(ctx)
 
 	// using Exec instead of QueryRow since we don't need to return any data, just check affected rows.
-	result, err := tx.Exec(ctx, `UPDATE contacts SET name=$1, email=$2, phone=$3 WHERE id=$4`, contact.Name, contact.Email, contact.Phone, id)
+	// NULL keeps a column, so a concurrent tag rename or merge is not undone.
+	result, err := tx.Exec(ctx, `UPDATE contacts SET name=$1, email=$2, phone=$3,
+			birthday = CASE WHEN $4::text IS NULL THEN birthday ELSE NULLIF($4, '') END,
+			anniversary = CASE WHEN $5::text IS NULL THEN anniversary ELSE NULLIF($5, '') END,
+			dates = COALESCE($6::jsonb, dates), tags = COALESCE($7::jsonb, tags), updated_at=NOW() WHERE id=$8`,
+		update.Name, update.Email, update.Phone, optionalDateValue(update.Birthday), optionalDateValue(update.Anniversary),
+		optionalValue(update.Dates, datesValue), optionalValue(update.Tags, tagsValue), id)
 	if err != nil {
-		return nil, err
+		return nil, emailTakenError(err)
 	}
 
 	if result.RowsAffected() == 0 {
-		return nil, errors.New("Contact not found")
+		return nil, domain.ErrNotFound
 	}
 
 	// Commit the transaction after successful update.
@@ -161,7 +231,7 @@ func (c contactRepository) Update(ctx context.Context, id int, contact *domain.C
 		return nil, err
 	}
 
-	return c.GetById(ctx, id)
+	return c.GetById(database.WithPrimary(ctx), id, nil)
 }
 
 func (c contactRepository) Delete(ctx context.Context, id int) error {
@@ -171,13 +241,328 @@ func (c contactRepository) Delete(ctx context.Context, id int) error {
 	}
 
 	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+// emailTakenError maps a unique violation, the only unique column is email.
+func emailTakenError(err error) error {
+	var pgErr *pgconn.PgError
+	// 23505 unique_violation.
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return domain.ErrEmailTaken
+	}
+	return err
+}
+
+// GetByGroupIds loads the members of every given group with a single query, keyed by group id.
+func (c contactRepository) GetByGroupIds(ctx context.Context, groupIds []int) (map[int][]domain.Contact, error) {
+	return read(ctx, c.db, func(ctx context.Context, db *database.DB) (map[int][]domain.Contact, error) {
+		return c.getByGroupIds(ctx, db, groupIds)
+	})
+}
+
+func (c contactRepository) getByGroupIds(ctx context.Context, db *database.DB, groupIds []int) (map[int][]domain.Contact, error) {
+	rows, err := db.Query(ctx, `
+		SELECT cg.group_id, c.id, c.name, c.email, c.phone, c.created_at, c.updated_at
+		FROM contact_groups cg
+		JOIN contacts c ON c.id = cg.contact_id
+		WHERE cg.group_id = ANY($1)
+		ORDER BY c.id`, groupIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := make(map[int][]domain.Contact)
+	for rows.Next() {
+		var groupId int
+		var c domain.Contact
+		err := rows.Scan(
+			&groupId,
+			&c.Id,
+			&c.Name,
+			&c.Email,
+			&c.Phone,
+			&c.CreatedAt,
+			&c.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		contacts[groupId] = append(contacts[groupId], c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return contacts, nil
+}
+
+// contactColumns turns a ?fields= projection into the SELECT list.
+// Fields are expected to be validated against domain.ContactFields already, id is
+// always selected since includes are matched on it.
+func contactColumns(fields []string) []string {
+	if len(fields) == 0 {
+		return domain.ContactFields
+	}
+
+	columns := []string{"id"}
+	for _, f := range domain.ContactFields {
+		if f != "id" && slices.Contains(fields, f) {
+			columns = append(columns, f)
+		}
+	}
+
+	return columns
+}
+
+func contactScanTargets(c *domain.Contact, columns []string) []interface{} {
+	targets := make([]interface{}, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "id":
+			targets[i] = &c.Id
+		case "name":
+			targets[i] = &c.Name
+		case "email":
+			targets[i] = &c.Email
+		case "phone":
+			targets[i] = &c.Phone
+		case "birthday":
+			targets[i] = &dateColumn{&c.Birthday}
+		case "anniversary":
+			targets[i] = &dateColumn{&c.Anniversary}
+		case "dates":
+			targets[i] = &datesColumn{&c.Dates}
+		case "tags":
+			targets[i] = &tagsColumn{&c.Tags}
+		case "last_contacted_at":
+			targets[i] = &c.LastContactedAt
+		case "created_at":
+			targets[i] = &c.CreatedAt
+		case "updated_at":
+			targets[i] = &c.UpdatedAt
+		}
+	}
+
+	return targets
+}
+
+// orderBy is the ORDER BY of s, in Postgres and SQLite. The field is expected
+// to be one of domain.ContactSorts, NULL comes first and id breaks ties.
+func orderBy(s domain.Sort) string {
+	direction := ""
+	if s.Desc {
+		direction = " DESC"
+	}
+	if s.Field == "" || s.Field == "id" {
+		return "ORDER BY id" + direction
+	}
+
+	nulls := " NULLS FIRST"
+	if s.Desc {
+		nulls = " NULLS LAST"
+	}
+	return "ORDER BY " + s.Field + direction + nulls + ", id" + direction
+}
+
+// datedColumns are what GetDated reads, enough to list a contact's occasions.
+var datedColumns = []string{"id", "name", "birthday", "anniversary", "dates", "updated_at"}
+
+// datedCondition matches the contacts with any date, in Postgres and SQLite.
+const datedCondition = `(birthday IS NOT NULL OR anniversary IS NOT NULL OR dates <> '[]')`
+
+// dateColumn scans a birthday or anniversary, NULL when there is none.
+type dateColumn struct {
+	dst *domain.PartialDate
+}
+
+func (d *dateColumn) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*d.dst = domain.PartialDate{}
+		return nil
+	case string:
+		return d.dst.UnmarshalText([]byte(v))
+	case []byte:
+		return d.dst.UnmarshalText(v)
+	}
+	return fmt.Errorf("cannot scan %T into a date", src)
+}
+
+func dateValue(d domain.PartialDate) interface{} {
+	if d.IsZero() {
+		return nil
+	}
+	return d.String()
+}
+
+// optionalDateValue is NULL to keep a date and "" to remove it.
+func optionalDateValue(d *domain.PartialDate) interface{} {
+	if d == nil {
+		return nil
+	}
+	if d.IsZero() {
+		return ""
+	}
+	return d.String()
+}
+
+// optionalValue is NULL to keep a column, else value of *v.
+func optionalValue[T any](v *T, value func(T) string) interface{} {
+	if v == nil {
+		return nil
+	}
+	return value(*v)
+}
+
+// datesColumn scans the labelled dates, a JSON array.
+type datesColumn struct {
+	dst *[]domain.ContactDate
+}
+
+func (d *datesColumn) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*d.dst = []domain.ContactDate{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into dates", src)
+	}
+
+	// Non-nil so a contact without dates renders "dates": [].
+	dates := []domain.ContactDate{}
+	if err := json.Unmarshal(data, &dates); err != nil {
 		return err
 	}
+	*d.dst = dates
+	return nil
+}
+
+func datesValue(dates []domain.ContactDate) string {
+	if len(dates) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(dates)
+	return string(data)
+}
+
+// tagsColumn scans the tags, a JSON array.
+type tagsColumn struct {
+	dst *[]string
+}
+
+func (t *tagsColumn) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*t.dst = []string{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into tags", src)
+	}
 
+	// Non-nil so a contact without tags renders "tags": [].
+	tags := []string{}
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return err
+	}
+	*t.dst = tags
 	return nil
 }
 
-func NewContactRepository(db *pgxpool.Pool) domain.ContactRepository {
+func tagsValue(tags []string) string {
+	if len(tags) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(tags)
+	return string(data)
+}
+
+// Tags counts the contacts of every tag starting with prefix. The GIN index
+// does not help here, every contact's tags are read.
+func (c contactRepository) Tags(ctx context.Context, prefix string, limit int) ([]domain.Tag, error) {
+	return read(ctx, c.db, func(ctx context.Context, db *database.DB) ([]domain.Tag, error) {
+		rows, err := db.Query(ctx, `SELECT t.name, COUNT(*) FROM contacts, jsonb_array_elements_text(tags) AS t(name)
+			WHERE starts_with(t.name, $1)
+			GROUP BY t.name
+			ORDER BY COUNT(*) DESC, t.name
+			LIMIT $2`, prefix, limit)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		tags := []domain.Tag{}
+		for rows.Next() {
+			var tag domain.Tag
+			if err := rows.Scan(&tag.Name, &tag.Contacts); err != nil {
+				return nil, err
+			}
+			tags = append(tags, tag)
+		}
+		return tags, rows.Err()
+	})
+}
+
+func (c contactRepository) ReplaceTags(ctx context.Context, from []string, to string) (int64, error) {
+	tag, err := c.db.Exec(ctx, `UPDATE contacts c SET tags = (
+			SELECT jsonb_agg(DISTINCT renamed.name ORDER BY renamed.name) FROM (
+				SELECT CASE WHEN t.name = ANY($1) THEN $2 ELSE t.name END AS name
+				FROM jsonb_array_elements_text(c.tags) AS t(name)
+			) renamed
+		), updated_at = NOW()
+		WHERE c.tags ?| $1`, from, to)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (c contactRepository) Count(ctx context.Context) (int64, error) {
+	return read(ctx, c.db, func(ctx context.Context, db *database.DB) (int64, error) {
+		var total int64
+		err := db.QueryRow(ctx, `SELECT COUNT(*) FROM contacts`).Scan(&total)
+		return total, err
+	})
+}
+
+func (c contactRepository) Fingerprint(ctx context.Context) (domain.Fingerprint, error) {
+	return read(ctx, c.db, func(ctx context.Context, db *database.DB) (domain.Fingerprint, error) {
+		var f domain.Fingerprint
+		err := db.QueryRow(ctx, `SELECT COALESCE(MAX(updated_at), 'epoch'), COUNT(*) FROM contacts`).Scan(&f.LastUpdated, &f.Count)
+		return f, err
+	})
+}
+
+// read runs fn through DB.Read, so it goes to a replica when there is one and
+// is retried on transient errors. fn must query the db it is given and not write.
+func read[T any](ctx context.Context, db *database.DB, fn func(ctx context.Context, db *database.DB) (T, error)) (T, error) {
+	var result T
+	err := db.Read(ctx, func(ctx context.Context, db *database.DB) error {
+		var err error
+		result, err = fn(ctx, db)
+		return err
+	})
+	return result, err
+}
+
+func NewContactRepository(db *database.DB) domain.ContactRepository {
 	return &contactRepository{
 		db: db,
 	}
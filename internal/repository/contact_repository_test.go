@@ -0,0 +1,636 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+)
+
+// contactRepositoryFactory returns an empty repository and a way to create a
+// static group with members, those have no write API of their own.
+type contactRepositoryFactory func(t *testing.T) (repo domain.ContactRepository, addGroup func(name string, contactIds ...int) int)
+
+func TestMemoryContactRepository(t *testing.T) {
+	testContactRepository(t, func(t *testing.T) (domain.ContactRepository, func(string, ...int) int) {
+		store := NewMemoryStore()
+		return NewMemoryContactRepository(store), func(name string, contactIds ...int) int {
+			return store.AddGroup(name, contactIds...).Id
+		}
+	})
+}
+
+func TestSQLiteContactRepository(t *testing.T) {
+	testContactRepository(t, func(t *testing.T) (domain.ContactRepository, func(string, ...int) int) {
+		db, err := database.ConnectSQLite(":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		return NewSQLiteContactRepository(db), func(name string, contactIds ...int) int {
+			var id int
+			now := timestampNow()
+			if err := db.QueryRow(`INSERT INTO groups (name, created_at, updated_at) VALUES (?, ?, ?) RETURNING id`, name, now, now).Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			for _, contactId := range contactIds {
+				if _, err := db.Exec(`INSERT INTO contact_groups (contact_id, group_id) VALUES (?, ?)`, contactId, id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return id
+		}
+	})
+}
+
+// TestPostgresContactRepository runs against TEST_DATABASE_URL, a migrated
+// database whose contacts and groups are truncated before every subtest.
+func TestPostgresContactRepository(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := database.Connect(context.Background(), url, database.PoolConfig{MaxConns: 4, QueryTimeout: 5 * time.Second, ReadRetries: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	testContactRepository(t, func(t *testing.T) (domain.ContactRepository, func(string, ...int) int) {
+		ctx := context.Background()
+		if _, err := db.Exec(ctx, `TRUNCATE contacts, groups RESTART IDENTITY CASCADE`); err != nil {
+			t.Fatal(err)
+		}
+
+		return NewContactRepository(db), func(name string, contactIds ...int) int {
+			var id int
+			if err := db.QueryRow(ctx, `INSERT INTO groups (name) VALUES ($1) RETURNING id`, name).Scan(&id); err != nil {
+				t.Fatal(err)
+			}
+			for _, contactId := range contactIds {
+				if _, err := db.Exec(ctx, `INSERT INTO contact_groups (contact_id, group_id) VALUES ($1, $2)`, contactId, id); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return id
+		}
+	})
+}
+
+// fullUpdate is an update writing every field of c.
+func fullUpdate(c domain.Contact) *domain.ContactUpdate {
+	return &domain.ContactUpdate{
+		Name: c.Name, Email: c.Email, Phone: c.Phone,
+		Birthday: &c.Birthday, Anniversary: &c.Anniversary, Dates: &c.Dates, Tags: &c.Tags,
+	}
+}
+
+// testContactRepository is the behaviour every domain.ContactRepository must have.
+func testContactRepository(t *testing.T, newRepo contactRepositoryFactory) {
+	ctx := context.Background()
+
+	store := func(t *testing.T, repo domain.ContactRepository, n int) []domain.Contact {
+		t.Helper()
+		var contacts []domain.Contact
+		for i := range n {
+			c, err := repo.Store(ctx, &domain.Contact{
+				Name:  fmt.Sprintf("Contact %d", i),
+				Email: fmt.Sprintf("contact%d@example.com", i),
+				Phone: fmt.Sprintf("+6281234567%03d", i),
+			})
+			if err != nil {
+				t.Fatalf("store contact %d: %v", i, err)
+			}
+			contacts = append(contacts, *c)
+		}
+		return contacts
+	}
+
+	t.Run("StoreAndGetById", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		stored := store(t, repo, 1)[0]
+
+		if stored.Id == 0 || stored.CreatedAt.IsZero() || stored.UpdatedAt.IsZero() {
+			t.Fatalf("stored contact misses generated fields: %+v", stored)
+		}
+
+		got, err := repo.GetById(ctx, stored.Id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Name != stored.Name || got.Email != stored.Email || got.Phone != stored.Phone || !got.CreatedAt.Equal(stored.CreatedAt) {
+			t.Fatalf("got %+v, want %+v", got, stored)
+		}
+	})
+
+	t.Run("GetByIdNotFound", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		if _, err := repo.GetById(ctx, 42, nil); !errors.Is(err, domain.ErrNotFound) {
+			t.Fatalf("got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("StoreDuplicateEmail", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		existing := store(t, repo, 1)[0]
+
+		_, err := repo.Store(ctx, &domain.Contact{Name: "Other", Email: existing.Email, Phone: "+628000000000"})
+		if !errors.Is(err, domain.ErrEmailTaken) {
+			t.Fatalf("got %v, want ErrEmailTaken", err)
+		}
+	})
+
+	t.Run("ConcurrentStoreSameEmail", func(t *testing.T) {
+		repo, _ := newRepo(t)
+
+		var wg sync.WaitGroup
+		errs := make([]error, 10)
+		for i := range errs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, errs[i] = repo.Store(ctx, &domain.Contact{Name: "Same", Email: "same@example.com", Phone: "+628000000000"})
+			}()
+		}
+		wg.Wait()
+
+		stored := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				stored++
+			case !errors.Is(err, domain.ErrEmailTaken):
+				t.Fatalf("unexpected error %v", err)
+			}
+		}
+		if stored != 1 {
+			t.Fatalf("%d contacts stored with the same email, want 1", stored)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		stored := store(t, repo, 1)[0]
+		time.Sleep(time.Millisecond)
+
+		updated, err := repo.Update(ctx, stored.Id, fullUpdate(domain.Contact{Name: "Renamed", Email: stored.Email, Phone: "+628111111111"}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Name != "Renamed" || updated.Phone != "+628111111111" {
+			t.Fatalf("update not applied: %+v", updated)
+		}
+		if !updated.UpdatedAt.After(stored.UpdatedAt) {
+			t.Fatalf("updated_at %v not after %v", updated.UpdatedAt, stored.UpdatedAt)
+		}
+	})
+
+	t.Run("UpdateKeepsWhatItLeavesOut", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		stored := store(t, repo, 1)[0]
+
+		birthday, _ := domain.ParsePartialDate("--02-29")
+		full := stored
+		full.Birthday, full.Tags = birthday, []string{"vip"}
+		full.Dates = []domain.ContactDate{{Label: "Name day", Date: birthday}}
+		if _, err := repo.Update(ctx, stored.Id, fullUpdate(full)); err != nil {
+			t.Fatal(err)
+		}
+
+		// A rename in between is not undone by an update without tags.
+		if _, err := repo.ReplaceTags(ctx, []string{"vip"}, "key-account"); err != nil {
+			t.Fatal(err)
+		}
+		updated, err := repo.Update(ctx, stored.Id, &domain.ContactUpdate{Name: "Renamed", Email: stored.Email, Phone: stored.Phone})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Name != "Renamed" || updated.Birthday != birthday || len(updated.Dates) != 1 || !slices.Equal(updated.Tags, []string{"key-account"}) {
+			t.Fatalf("update without dates and tags = %+v", updated)
+		}
+
+		removed, err := repo.Update(ctx, stored.Id, &domain.ContactUpdate{
+			Name: "Renamed", Email: stored.Email, Phone: stored.Phone,
+			Birthday: &domain.PartialDate{}, Dates: &[]domain.ContactDate{}, Tags: &[]string{},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !removed.Birthday.IsZero() || len(removed.Dates) != 0 || len(removed.Tags) != 0 {
+			t.Fatalf("update removing dates and tags = %+v", removed)
+		}
+	})
+
+	t.Run("UpdateNotFound", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		_, err := repo.Update(ctx, 42, fullUpdate(domain.Contact{Name: "Nobody", Email: "nobody@example.com", Phone: "+628000000000"}))
+		if !errors.Is(err, domain.ErrNotFound) {
+			t.Fatalf("got %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("UpdateDuplicateEmail", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		contacts := store(t, repo, 2)
+
+		_, err := repo.Update(ctx, contacts[0].Id, fullUpdate(domain.Contact{Name: "Taken", Email: contacts[1].Email, Phone: "+628000000000"}))
+		if !errors.Is(err, domain.ErrEmailTaken) {
+			t.Fatalf("got %v, want ErrEmailTaken", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		stored := store(t, repo, 1)[0]
+
+		if err := repo.Delete(ctx, stored.Id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.GetById(ctx, stored.Id, nil); !errors.Is(err, domain.ErrNotFound) {
+			t.Fatalf("got %v after delete, want ErrNotFound", err)
+		}
+		if err := repo.Delete(ctx, stored.Id); !errors.Is(err, domain.ErrNotFound) {
+			t.Fatalf("got %v deleting twice, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Paginate", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		contacts := store(t, repo, 5)
+
+		page, total, err := repo.Paginate(ctx, 2, 2, nil, domain.Sort{}, domain.ContactFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 5 || len(page) != 2 || page[0].Id != contacts[2].Id || page[1].Id != contacts[3].Id {
+			t.Fatalf("page 2 = %+v total %d", page, total)
+		}
+
+		page, total, err = repo.Paginate(ctx, 4, 2, nil, domain.Sort{}, domain.ContactFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 5 || len(page) != 0 {
+			t.Fatalf("page past the end = %+v total %d", page, total)
+		}
+	})
+
+	t.Run("PaginateSorted", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		contacts := store(t, repo, 5)
+
+		page, _, err := repo.Paginate(ctx, 1, 2, []string{"name"}, domain.Sort{Field: "name", Desc: true}, domain.ContactFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 2 || page[0].Id != contacts[4].Id || page[1].Id != contacts[3].Id {
+			t.Fatalf("by name descending = %+v", page)
+		}
+
+		// Nobody was contacted, id breaks the tie.
+		page, _, err = repo.Paginate(ctx, 1, 2, nil, domain.Sort{Field: "last_contacted_at"}, domain.ContactFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) != 2 || page[0].Id != contacts[0].Id || page[1].Id != contacts[1].Id || page[0].LastContactedAt != nil {
+			t.Fatalf("by last contacted = %+v", page)
+		}
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		contacts := store(t, repo, 4)
+
+		tagged := map[int][]string{0: {"vip"}, 1: {"q3-lead", "vip"}, 2: {"needs-followup"}}
+		for i, tags := range tagged {
+			c := contacts[i]
+			if _, err := repo.Update(ctx, c.Id, fullUpdate(domain.Contact{Name: c.Name, Email: c.Email, Phone: c.Phone, Tags: tags})); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := repo.GetById(ctx, contacts[3].Id, []string{"tags"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Tags == nil || len(got.Tags) != 0 {
+			t.Fatalf("contact without tags = %+v", got)
+		}
+
+		ids := func(filter string) []int {
+			t.Helper()
+			tags, err := domain.ParseTagFilter(filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			page, total, err := repo.Paginate(ctx, 1, 10, nil, domain.Sort{}, domain.ContactFilter{Tags: tags})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if int(total) != len(page) {
+				t.Fatalf("%s: total %d for %d contacts", filter, total, len(page))
+			}
+			var ids []int
+			for _, c := range page {
+				ids = append(ids, c.Id)
+			}
+			return ids
+		}
+		for filter, want := range map[string][]int{
+			"vip":                    {contacts[0].Id, contacts[1].Id},
+			"vip,q3-lead":            {contacts[1].Id},
+			"q3-lead|needs-followup": {contacts[1].Id, contacts[2].Id},
+			"vip,q3-lead|nobody":     {contacts[1].Id},
+			"nobody":                 nil,
+		} {
+			if got := ids(filter); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("tags=%s matched %v, want %v", filter, got, want)
+			}
+		}
+
+		tags, err := repo.Tags(ctx, "", 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(tags) != "[{vip 2} {needs-followup 1} {q3-lead 1}]" {
+			t.Fatalf("tags = %v", tags)
+		}
+		if tags, err = repo.Tags(ctx, "q", 10); err != nil || len(tags) != 1 || tags[0].Name != "q3-lead" {
+			t.Fatalf("tags starting with q = %v, %v", tags, err)
+		}
+
+		// Contact 1 has both, it keeps vip once.
+		changed, err := repo.ReplaceTags(ctx, []string{"q3-lead", "needs-followup"}, "vip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != 2 {
+			t.Fatalf("replace changed %d contacts, want 2", changed)
+		}
+		if got := ids("vip"); len(got) != 3 {
+			t.Fatalf("vip after merge = %v", got)
+		}
+		got, err = repo.GetById(ctx, contacts[1].Id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got.Tags) != "[vip]" || !got.UpdatedAt.After(contacts[1].UpdatedAt) {
+			t.Fatalf("merged contact = %+v", got)
+		}
+	})
+
+	t.Run("Query", func(t *testing.T) {
+		repo, addGroup := newRepo(t)
+		contacts := store(t, repo, 4)
+
+		changed := map[int]domain.Contact{
+			0: {Name: "Ana", Email: "ana@acme.com", Tags: []string{"vip"}},
+			1: {Name: "Budi", Email: "budi@ACME.com"},
+			2: {Name: "Citra_Dewi", Email: "citra@example.com", Tags: []string{"vip"}},
+		}
+		for i, c := range changed {
+			c.Phone = contacts[i].Phone
+			if _, err := repo.Update(ctx, contacts[i].Id, fullUpdate(c)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		family := addGroup("Family", contacts[0].Id, contacts[2].Id)
+
+		ids := func(filter domain.ContactFilter) []int {
+			t.Helper()
+			page, total, err := repo.Paginate(ctx, 1, 10, nil, domain.Sort{}, filter)
+			if err != nil {
+				t.Fatalf("%s: %v", filter, err)
+			}
+			if int(total) != len(page) {
+				t.Fatalf("%s: total %d for %d contacts", filter, total, len(page))
+			}
+			var ids []int
+			for _, c := range page {
+				ids = append(ids, c.Id)
+			}
+			return ids
+		}
+		all := []int{contacts[0].Id, contacts[1].Id, contacts[2].Id, contacts[3].Id}
+		for expression, want := range map[string][]int{
+			"email ends with @acme.com":             {contacts[0].Id, contacts[1].Id},
+			"email ends with @acme.com AND tag:vip": {contacts[0].Id},
+			"NOT tag:vip":                           {contacts[1].Id, contacts[3].Id},
+			"name contains _":                       {contacts[2].Id},
+			"name contains %":                       nil,
+			`phone is "` + contacts[3].Phone + `"`:  {contacts[3].Id},
+			"name != ana":                           {contacts[1].Id, contacts[2].Id, contacts[3].Id},
+			"created_after:2000-01-01":              all,
+			"created_before:2000-01-01":             nil,
+			"contacted_after:2000-01-01":            nil,
+			"NOT contacted_after:2000-01-01":        all,
+			"(tag:vip OR name starts with bu) and NOT email = ANA@acme.com": {contacts[1].Id, contacts[2].Id},
+		} {
+			query, err := domain.ParseContactQuery(expression)
+			if err != nil {
+				t.Fatalf("%s: %v", expression, err)
+			}
+			if got := ids(domain.ContactFilter{Query: query}); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Fatalf("%s matched %v, want %v", expression, got, want)
+			}
+		}
+
+		if got := ids(domain.ContactFilter{GroupId: family}); fmt.Sprint(got) != fmt.Sprint([]int{contacts[0].Id, contacts[2].Id}) {
+			t.Fatalf("family members = %v", got)
+		}
+		query, _ := domain.ParseContactQuery("name is ana")
+		if got := ids(domain.ContactFilter{GroupId: family, Query: query}); fmt.Sprint(got) != fmt.Sprint([]int{contacts[0].Id}) {
+			t.Fatalf("family members named ana = %v", got)
+		}
+	})
+
+	t.Run("GetAll", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		contacts := store(t, repo, 5)
+
+		var ids []int
+		for c, err := range repo.GetAll(ctx, 3, nil) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, c.Id)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint([]int{contacts[0].Id, contacts[1].Id, contacts[2].Id}) {
+			t.Fatalf("got ids %v", ids)
+		}
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		repo, _ := newRepo(t)
+		stored := store(t, repo, 1)[0]
+
+		got, err := repo.GetById(ctx, stored.Id, []string{"email"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Id != stored.Id || got.Email != stored.Email || got.Name != "" || !got.CreatedAt.IsZero() {
+			t.Fatalf("projection to email = %+v", got)
+		}
+	})
+
+	t.Run("CountAndFingerprint", func(t *testing.T) {
+		repo, _ := newRepo(t)
+
+		empty, err := repo.Fingerprint(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if empty.Count != 0 {
+			t.Fatalf("empty fingerprint %+v", empty)
+		}
+
+		contacts := store(t, repo, 3)
+		if count, err := repo.Count(ctx); err != nil || count != 3 {
+			t.Fatalf("count = %d, %v", count, err)
+		}
+
+		before, err := repo.Fingerprint(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+
+		if _, err := repo.Update(ctx, contacts[0].Id, fullUpdate(domain.Contact{Name: "Changed", Email: contacts[0].Email, Phone: contacts[0].Phone})); err != nil {
+			t.Fatal(err)
+		}
+		after, err := repo.Fingerprint(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.Count != 3 || !after.LastUpdated.After(before.LastUpdated) {
+			t.Fatalf("fingerprint %+v did not move past %+v", after, before)
+		}
+	})
+
+	t.Run("DatesAndGetDated", func(t *testing.T) {
+		repo, addGroup := newRepo(t)
+		contacts := store(t, repo, 3)
+
+		birthday, _ := domain.ParsePartialDate("1992-02-29")
+		nameDay, _ := domain.ParsePartialDate("--07-26")
+		updated, err := repo.Update(ctx, contacts[1].Id, fullUpdate(domain.Contact{
+			Name:     contacts[1].Name,
+			Email:    contacts[1].Email,
+			Phone:    contacts[1].Phone,
+			Birthday: birthday,
+			Dates:    []domain.ContactDate{{Label: "Name day", Date: nameDay}},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Birthday != birthday || !updated.Anniversary.IsZero() || len(updated.Dates) != 1 || updated.Dates[0].Date != nameDay {
+			t.Fatalf("updated dates = %+v", updated)
+		}
+
+		got, err := repo.GetById(ctx, contacts[0].Id, []string{"birthday", "dates"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Birthday.IsZero() || got.Dates == nil || len(got.Dates) != 0 {
+			t.Fatalf("contact without dates = %+v", got)
+		}
+
+		family := addGroup("Family", contacts[0].Id)
+		work := addGroup("Work", contacts[1].Id)
+
+		var dated []domain.Contact
+		for c, err := range repo.GetDated(ctx, 0, nil) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			dated = append(dated, c)
+		}
+		if len(dated) != 1 || dated[0].Id != contacts[1].Id || dated[0].Name != contacts[1].Name || dated[0].Birthday != birthday || len(dated[0].Dates) != 1 {
+			t.Fatalf("dated contacts = %+v", dated)
+		}
+
+		for _, group := range []int{family, work} {
+			var n int
+			for _, err := range repo.GetDated(ctx, group, nil) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				n++
+			}
+			if want := map[int]int{family: 0, work: 1}[group]; n != want {
+				t.Fatalf("group %d has %d dated contacts, want %d", group, n, want)
+			}
+		}
+
+		anniversary, _ := domain.ParsePartialDate("2015-12-31")
+		if _, err := repo.Update(ctx, contacts[2].Id, fullUpdate(domain.Contact{
+			Name:        contacts[2].Name,
+			Email:       contacts[2].Email,
+			Phone:       contacts[2].Phone,
+			Anniversary: anniversary,
+		})); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range []struct {
+			monthDays []string
+			want      []int
+		}{
+			{[]string{"02-29"}, []int{contacts[1].Id}},
+			{[]string{"07-26", "12-31"}, []int{contacts[1].Id, contacts[2].Id}},
+			{[]string{"12-31"}, []int{contacts[2].Id}},
+			{[]string{"01-01"}, nil},
+			{[]string{}, nil},
+		} {
+			var ids []int
+			for c, err := range repo.GetDated(ctx, 0, tt.monthDays) {
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, c.Id)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Fatalf("dated on %v = %v, want %v", tt.monthDays, ids, tt.want)
+			}
+		}
+	})
+
+	t.Run("GetByGroupIds", func(t *testing.T) {
+		repo, addGroup := newRepo(t)
+		contacts := store(t, repo, 3)
+		family := addGroup("Family", contacts[0].Id, contacts[2].Id)
+		work := addGroup("Work", contacts[1].Id)
+		empty := addGroup("Empty")
+
+		members, err := repo.GetByGroupIds(ctx, []int{family, empty})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(members[family]) != 2 || members[family][0].Id != contacts[0].Id || members[family][1].Id != contacts[2].Id {
+			t.Fatalf("family members = %+v", members[family])
+		}
+		if len(members[empty]) != 0 || len(members[work]) != 0 {
+			t.Fatalf("unexpected members %+v", members)
+		}
+
+		if err := repo.Delete(ctx, contacts[0].Id); err != nil {
+			t.Fatal(err)
+		}
+		members, err = repo.GetByGroupIds(ctx, []int{family})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(members[family]) != 1 {
+			t.Fatalf("deleted contact still a member: %+v", members[family])
+		}
+	})
+}
@@ -0,0 +1,196 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/jackc/pgx/v5"
+)
+
+// groupColumns are the columns of a domain.Group, filter is NULL for a
+// static group.
+const groupColumns = `id, name, COALESCE(filter, ''), created_at, updated_at`
+
+type groupRepository struct {
+	db *database.DB
+}
+
+func (g groupRepository) Paginate(ctx context.Context, page int, limit int) ([]domain.Group, int64, error) {
+	offset := (page - 1) * limit
+
+	var groups []domain.Group
+	var total int64
+	// The page and its total come from the same database, so they agree
+	// even when the replicas lag differently.
+	err := g.db.Read(ctx, func(ctx context.Context, db *database.DB) error {
+		rows, err := db.Query(ctx, `SELECT `+groupColumns+` FROM groups ORDER BY id LIMIT $1 OFFSET $2`, limit, offset)
+		if err != nil {
+			return err
+		}
+
+		defer rows.Close()
+
+		groups = nil
+		for rows.Next() {
+			var g domain.Group
+			err := rows.Scan(
+				&g.Id,
+				&g.Name,
+				&g.Filter,
+				&g.CreatedAt,
+				&g.UpdatedAt,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			groups = append(groups, g)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		return db.QueryRow(ctx, `SELECT COUNT(*) FROM groups`).Scan(&total)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return groups, total, nil
+}
+
+func (g groupRepository) GetById(ctx context.Context, id int) (*domain.Group, error) {
+	return read(ctx, g.db, func(ctx context.Context, db *database.DB) (*domain.Group, error) {
+		var group domain.Group
+
+		err := db.QueryRow(ctx, `SELECT `+groupColumns+` FROM groups WHERE id = $1`, id).Scan(
+			&group.Id,
+			&group.Name,
+			&group.Filter,
+			&group.CreatedAt,
+			&group.UpdatedAt,
+		)
+
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, domain.ErrNotFound
+			}
+
+			return nil, err
+		}
+
+		return &group, nil
+	})
+}
+
+// GetByContactIds loads the groups of every given contact with a single query, keyed by contact id.
+func (g groupRepository) GetByContactIds(ctx context.Context, contactIds []int) (map[int][]domain.Group, error) {
+	return read(ctx, g.db, func(ctx context.Context, db *database.DB) (map[int][]domain.Group, error) {
+		return g.getByContactIds(ctx, db, contactIds)
+	})
+}
+
+func (g groupRepository) getByContactIds(ctx context.Context, db *database.DB, contactIds []int) (map[int][]domain.Group, error) {
+	rows, err := db.Query(ctx, `
+		SELECT cg.contact_id, g.id, g.name, COALESCE(g.filter, ''), g.created_at, g.updated_at
+		FROM contact_groups cg
+		JOIN groups g ON g.id = cg.group_id
+		WHERE cg.contact_id = ANY($1)
+		ORDER BY g.id`, contactIds)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := make(map[int][]domain.Group)
+	for rows.Next() {
+		var contactId int
+		var g domain.Group
+		err := rows.Scan(
+			&contactId,
+			&g.Id,
+			&g.Name,
+			&g.Filter,
+			&g.CreatedAt,
+			&g.UpdatedAt,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		groups[contactId] = append(groups[contactId], g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (g groupRepository) Count(ctx context.Context) (int64, error) {
+	return read(ctx, g.db, func(ctx context.Context, db *database.DB) (int64, error) {
+		var total int64
+		err := db.QueryRow(ctx, `SELECT COUNT(*) FROM groups`).Scan(&total)
+		return total, err
+	})
+}
+
+func (g groupRepository) Store(ctx context.Context, group *domain.Group) (*domain.Group, error) {
+	var stored domain.Group
+	err := g.db.QueryRow(ctx, `INSERT INTO groups (name, filter) VALUES ($1, NULLIF($2, '')) RETURNING `+groupColumns, group.Name, group.Filter).Scan(
+		&stored.Id,
+		&stored.Name,
+		&stored.Filter,
+		&stored.CreatedAt,
+		&stored.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stored, nil
+}
+
+func (g groupRepository) Update(ctx context.Context, id int, group *domain.Group) (*domain.Group, error) {
+	var updated domain.Group
+	err := g.db.QueryRow(ctx, `UPDATE groups SET name = $1, filter = NULLIF($2, ''), updated_at = NOW() WHERE id = $3 RETURNING `+groupColumns, group.Name, group.Filter, id).Scan(
+		&updated.Id,
+		&updated.Name,
+		&updated.Filter,
+		&updated.CreatedAt,
+		&updated.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (g groupRepository) Delete(ctx context.Context, id int) error {
+	result, err := g.db.Exec(ctx, `DELETE FROM groups WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func NewGroupRepository(db *database.DB) domain.GroupRepository {
+	return &groupRepository{
+		db: db,
+	}
+}
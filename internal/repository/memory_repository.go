@@ -0,0 +1,510 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+)
+
+// MemoryStore keeps contacts, groups and memberships in process, for demos and
+// tests without a database. Contacts and smart groups are managed through the
+// repositories, static groups have no write API so they are added with
+// AddGroup.
+type MemoryStore struct {
+	mu            sync.RWMutex
+	contacts      map[int]domain.Contact
+	groups        map[int]domain.Group
+	members       map[int][]int
+	nextContactId int
+	nextGroupId   int
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		contacts:      make(map[int]domain.Contact),
+		groups:        make(map[int]domain.Group),
+		members:       make(map[int][]int),
+		nextContactId: 1,
+		nextGroupId:   1,
+	}
+}
+
+// AddGroup creates a group with the given contacts as members.
+func (s *MemoryStore) AddGroup(name string, contactIds ...int) domain.Group {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := timestampNow()
+	group := domain.Group{Id: s.nextGroupId, Name: name, CreatedAt: now, UpdatedAt: now}
+	s.nextGroupId++
+
+	s.groups[group.Id] = group
+	for _, id := range contactIds {
+		if _, ok := s.contacts[id]; ok {
+			s.members[id] = append(s.members[id], group.Id)
+		}
+	}
+
+	return group
+}
+
+// timestampNow is rounded to microseconds like a Postgres timestamp.
+func timestampNow() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// sortedIds returns the keys of m in ascending order, rows are ordered by id
+// unless a ?sort= says otherwise.
+func sortedIds[V any](m map[int]V) []int {
+	ids := make([]int, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+type memoryContactRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryContactRepository(store *MemoryStore) domain.ContactRepository {
+	return &memoryContactRepository{store: store}
+}
+
+// GetAll works on a snapshot of the ids taken when iteration starts.
+func (m memoryContactRepository) GetAll(ctx context.Context, limit int, fields []string) iter.Seq2[domain.Contact, error] {
+	return func(yield func(domain.Contact, error) bool) {
+		m.store.mu.RLock()
+		ids := sortedIds(m.store.contacts)
+		m.store.mu.RUnlock()
+
+		for _, id := range ids[:min(limit, len(ids))] {
+			if err := ctx.Err(); err != nil {
+				yield(domain.Contact{}, err)
+				return
+			}
+
+			m.store.mu.RLock()
+			contact, ok := m.store.contacts[id]
+			m.store.mu.RUnlock()
+			if !ok {
+				continue
+			}
+
+			if !yield(projectContact(contact, fields), nil) {
+				return
+			}
+		}
+	}
+}
+
+func (m memoryContactRepository) GetDated(ctx context.Context, groupId int, monthDays []string) iter.Seq2[domain.Contact, error] {
+	onDays := func(contact domain.Contact) bool {
+		occasions := contact.Occasions()
+		return len(occasions) > 0 && (monthDays == nil || slices.ContainsFunc(occasions, func(o domain.Occasion) bool {
+			return slices.Contains(monthDays, o.Date.MonthDay())
+		}))
+	}
+
+	return func(yield func(domain.Contact, error) bool) {
+		m.store.mu.RLock()
+		var dated []domain.Contact
+		for _, id := range sortedIds(m.store.contacts) {
+			contact := m.store.contacts[id]
+			if onDays(contact) && (groupId == 0 || slices.Contains(m.store.members[id], groupId)) {
+				dated = append(dated, projectContact(contact, datedColumns))
+			}
+		}
+		m.store.mu.RUnlock()
+
+		for _, contact := range dated {
+			if !yield(contact, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (m memoryContactRepository) Paginate(ctx context.Context, page int, limit int, fields []string, sort domain.Sort, filter domain.ContactFilter) ([]domain.Contact, int64, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	ids := slices.DeleteFunc(sortedIds(m.store.contacts), func(id int) bool {
+		contact := m.store.contacts[id]
+		return !filter.Tags.Matches(contact.Tags) ||
+			filter.GroupId != 0 && !slices.Contains(m.store.members[id], filter.GroupId) ||
+			filter.Query != nil && !filter.Query.Matches(contact)
+	})
+	sortContacts(m.store.contacts, ids, sort)
+	offset := min((page-1)*limit, len(ids))
+
+	var contacts []domain.Contact
+	for _, id := range ids[offset:min(offset+limit, len(ids))] {
+		contacts = append(contacts, projectContact(m.store.contacts[id], fields))
+	}
+
+	return contacts, int64(len(ids)), nil
+}
+
+func (m memoryContactRepository) GetById(ctx context.Context, id int, fields []string) (*domain.Contact, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	contact, ok := m.store.contacts[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+
+	contact = projectContact(contact, fields)
+	return &contact, nil
+}
+
+func (m memoryContactRepository) GetByGroupIds(ctx context.Context, groupIds []int) (map[int][]domain.Contact, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	contacts := make(map[int][]domain.Contact)
+	for _, contactId := range sortedIds(m.store.contacts) {
+		for _, groupId := range m.store.members[contactId] {
+			if slices.Contains(groupIds, groupId) {
+				contacts[groupId] = append(contacts[groupId], m.store.contacts[contactId])
+			}
+		}
+	}
+
+	return contacts, nil
+}
+
+func (m memoryContactRepository) Count(ctx context.Context) (int64, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	return int64(len(m.store.contacts)), nil
+}
+
+func (m memoryContactRepository) Fingerprint(ctx context.Context) (domain.Fingerprint, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	f := domain.Fingerprint{LastUpdated: time.Unix(0, 0).UTC(), Count: int64(len(m.store.contacts))}
+	for _, c := range m.store.contacts {
+		if c.UpdatedAt.After(f.LastUpdated) {
+			f.LastUpdated = c.UpdatedAt
+		}
+	}
+
+	return f, nil
+}
+
+func (m memoryContactRepository) Store(ctx context.Context, contact *domain.Contact) (*domain.Contact, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if m.emailTaken(contact.Email, 0) {
+		return nil, domain.ErrEmailTaken
+	}
+
+	now := timestampNow()
+	stored := domain.Contact{
+		Id:          m.store.nextContactId,
+		Name:        contact.Name,
+		Email:       contact.Email,
+		Phone:       contact.Phone,
+		Birthday:    contact.Birthday,
+		Anniversary: contact.Anniversary,
+		Dates:       append([]domain.ContactDate{}, contact.Dates...),
+		Tags:        append([]string{}, contact.Tags...),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	m.store.nextContactId++
+	m.store.contacts[stored.Id] = stored
+
+	return &stored, nil
+}
+
+func (m memoryContactRepository) Update(ctx context.Context, id int, update *domain.ContactUpdate) (*domain.Contact, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	existing, ok := m.store.contacts[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+
+	if m.emailTaken(update.Email, id) {
+		return nil, domain.ErrEmailTaken
+	}
+
+	update.ApplyTo(&existing)
+	existing.UpdatedAt = timestampNow()
+	m.store.contacts[id] = existing
+
+	return &existing, nil
+}
+
+func (m memoryContactRepository) Delete(ctx context.Context, id int) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.contacts[id]; !ok {
+		return domain.ErrNotFound
+	}
+
+	// Memberships go with the contact, like ON DELETE CASCADE.
+	delete(m.store.contacts, id)
+	delete(m.store.members, id)
+
+	return nil
+}
+
+func (m memoryContactRepository) Tags(ctx context.Context, prefix string, limit int) ([]domain.Tag, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	counts := make(map[string]int64)
+	for _, c := range m.store.contacts {
+		for _, tag := range c.Tags {
+			if strings.HasPrefix(tag, prefix) {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := []domain.Tag{}
+	for name, n := range counts {
+		tags = append(tags, domain.Tag{Name: name, Contacts: n})
+	}
+	slices.SortFunc(tags, func(a, b domain.Tag) int {
+		return cmp.Or(cmp.Compare(b.Contacts, a.Contacts), strings.Compare(a.Name, b.Name))
+	})
+
+	return tags[:min(limit, len(tags))], nil
+}
+
+func (m memoryContactRepository) ReplaceTags(ctx context.Context, from []string, to string) (int64, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	var changed int64
+	now := timestampNow()
+	for id, c := range m.store.contacts {
+		if !slices.ContainsFunc(c.Tags, func(tag string) bool { return slices.Contains(from, tag) }) {
+			continue
+		}
+
+		tags := make([]string, len(c.Tags))
+		for i, tag := range c.Tags {
+			if slices.Contains(from, tag) {
+				tag = to
+			}
+			tags[i] = tag
+		}
+		slices.Sort(tags)
+		c.Tags = slices.Compact(tags)
+		c.UpdatedAt = now
+		m.store.contacts[id] = c
+		changed++
+	}
+
+	return changed, nil
+}
+
+// emailTaken reports whether another contact than exceptId uses email, the
+// caller holds the lock.
+func (m memoryContactRepository) emailTaken(email string, exceptId int) bool {
+	for id, c := range m.store.contacts {
+		if id != exceptId && c.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+// sortContacts orders ids like orderBy does in SQL.
+func sortContacts(contacts map[int]domain.Contact, ids []int, sort domain.Sort) {
+	slices.SortFunc(ids, func(a, b int) int {
+		x, y := contacts[a], contacts[b]
+
+		var n int
+		switch sort.Field {
+		case "name":
+			n = strings.Compare(x.Name, y.Name)
+		case "created_at":
+			n = x.CreatedAt.Compare(y.CreatedAt)
+		case "updated_at":
+			n = x.UpdatedAt.Compare(y.UpdatedAt)
+		case "last_contacted_at":
+			switch {
+			case x.LastContactedAt == nil || y.LastContactedAt == nil:
+				n = cmp.Compare(boolInt(x.LastContactedAt != nil), boolInt(y.LastContactedAt != nil))
+			default:
+				n = x.LastContactedAt.Compare(*y.LastContactedAt)
+			}
+		}
+		if n == 0 {
+			n = cmp.Compare(a, b)
+		}
+
+		if sort.Desc {
+			return -n
+		}
+		return n
+	})
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// projectContact keeps only the fields of a ?fields= projection, like the
+// SELECT list of the SQL repositories.
+func projectContact(c domain.Contact, fields []string) domain.Contact {
+	if len(fields) == 0 {
+		return c
+	}
+
+	projected := domain.Contact{Id: c.Id}
+	for _, f := range fields {
+		switch f {
+		case "name":
+			projected.Name = c.Name
+		case "email":
+			projected.Email = c.Email
+		case "phone":
+			projected.Phone = c.Phone
+		case "birthday":
+			projected.Birthday = c.Birthday
+		case "anniversary":
+			projected.Anniversary = c.Anniversary
+		case "dates":
+			projected.Dates = c.Dates
+		case "tags":
+			projected.Tags = c.Tags
+		case "last_contacted_at":
+			projected.LastContactedAt = c.LastContactedAt
+		case "created_at":
+			projected.CreatedAt = c.CreatedAt
+		case "updated_at":
+			projected.UpdatedAt = c.UpdatedAt
+		}
+	}
+
+	return projected
+}
+
+type memoryGroupRepository struct {
+	store *MemoryStore
+}
+
+func NewMemoryGroupRepository(store *MemoryStore) domain.GroupRepository {
+	return &memoryGroupRepository{store: store}
+}
+
+func (m memoryGroupRepository) Paginate(ctx context.Context, page int, limit int) ([]domain.Group, int64, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	ids := sortedIds(m.store.groups)
+	offset := min((page-1)*limit, len(ids))
+
+	var groups []domain.Group
+	for _, id := range ids[offset:min(offset+limit, len(ids))] {
+		groups = append(groups, m.store.groups[id])
+	}
+
+	return groups, int64(len(ids)), nil
+}
+
+func (m memoryGroupRepository) GetById(ctx context.Context, id int) (*domain.Group, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	group, ok := m.store.groups[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+
+	return &group, nil
+}
+
+func (m memoryGroupRepository) GetByContactIds(ctx context.Context, contactIds []int) (map[int][]domain.Group, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+
+	groups := make(map[int][]domain.Group)
+	for _, contactId := range contactIds {
+		if _, done := groups[contactId]; done {
+			continue
+		}
+
+		groupIds := slices.Clone(m.store.members[contactId])
+		slices.Sort(groupIds)
+		for _, groupId := range groupIds {
+			groups[contactId] = append(groups[contactId], m.store.groups[groupId])
+		}
+	}
+
+	return groups, nil
+}
+
+func (m memoryGroupRepository) Count(ctx context.Context) (int64, error) {
+	m.store.mu.RLock()
+	defer m.store.mu.RUnlock()
+	return int64(len(m.store.groups)), nil
+}
+
+func (m memoryGroupRepository) Store(ctx context.Context, group *domain.Group) (*domain.Group, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	now := timestampNow()
+	stored := domain.Group{Id: m.store.nextGroupId, Name: group.Name, Filter: group.Filter, CreatedAt: now, UpdatedAt: now}
+	m.store.nextGroupId++
+	m.store.groups[stored.Id] = stored
+
+	return &stored, nil
+}
+
+func (m memoryGroupRepository) Update(ctx context.Context, id int, group *domain.Group) (*domain.Group, error) {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	updated, ok := m.store.groups[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+
+	updated.Name = group.Name
+	updated.Filter = group.Filter
+	updated.UpdatedAt = timestampNow()
+	m.store.groups[id] = updated
+
+	return &updated, nil
+}
+
+func (m memoryGroupRepository) Delete(ctx context.Context, id int) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+
+	if _, ok := m.store.groups[id]; !ok {
+		return domain.ErrNotFound
+	}
+
+	// Memberships go with the group, like ON DELETE CASCADE.
+	delete(m.store.groups, id)
+	for contactId, groupIds := range m.store.members {
+		m.store.members[contactId] = slices.DeleteFunc(groupIds, func(groupId int) bool { return groupId == id })
+	}
+
+	return nil
+}
@@ -0,0 +1,469 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"iter"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteBatchSize is how many rows GetAll reads per query. The connection is
+// released between batches, so the consumer can run other queries while it
+// iterates, SQLite only has the one.
+const sqliteBatchSize = 500
+
+// sqliteTimeLayout is the text format ConnectSQLite stores times in.
+const sqliteTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+type sqliteContactRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteContactRepository(db *sql.DB) domain.ContactRepository {
+	return &sqliteContactRepository{db: db}
+}
+
+func (s sqliteContactRepository) GetAll(ctx context.Context, limit int, fields []string) iter.Seq2[domain.Contact, error] {
+	return s.stream(ctx, contactColumns(fields), "", nil, limit)
+}
+
+func (s sqliteContactRepository) GetDated(ctx context.Context, groupId int, monthDays []string) iter.Seq2[domain.Contact, error] {
+	condition := datedCondition
+	var args []interface{}
+	if groupId > 0 {
+		condition += ` AND id IN (SELECT contact_id FROM contact_groups WHERE group_id = ?)`
+		args = append(args, groupId)
+	}
+	if monthDays != nil {
+		// Every form of a date ends in -MM-DD, the days are bound as a JSON array.
+		days := `(SELECT value FROM json_each(?))`
+		condition += ` AND (substr(birthday, -5) IN ` + days + ` OR substr(anniversary, -5) IN ` + days +
+			` OR EXISTS (SELECT 1 FROM json_each(contacts.dates) d WHERE substr(json_extract(d.value, '$.date'), -5) IN ` + days + `))`
+		raw, _ := json.Marshal(monthDays)
+		args = append(args, string(raw), string(raw), string(raw))
+	}
+	return s.stream(ctx, datedColumns, condition, args, math.MaxInt)
+}
+
+// stream reads up to limit contacts matching condition, sqliteBatchSize at a time.
+func (s sqliteContactRepository) stream(ctx context.Context, columns []string, condition string, args []interface{}, limit int) iter.Seq2[domain.Contact, error] {
+	return func(yield func(domain.Contact, error) bool) {
+		where := `WHERE id > ?`
+		if condition != "" {
+			where += ` AND ` + condition
+		}
+		lastId := 0
+
+		for limit > 0 {
+			batchArgs := append(append([]interface{}{lastId}, args...), min(limit, sqliteBatchSize))
+			contacts, err := s.query(ctx, columns, where+` ORDER BY id LIMIT ?`, batchArgs...)
+			if err != nil {
+				yield(domain.Contact{}, err)
+				return
+			}
+
+			for _, contact := range contacts {
+				if !yield(contact, nil) {
+					return
+				}
+			}
+
+			if len(contacts) < sqliteBatchSize {
+				return
+			}
+			lastId = contacts[len(contacts)-1].Id
+			limit -= len(contacts)
+		}
+	}
+}
+
+func (s sqliteContactRepository) Paginate(ctx context.Context, page int, limit int, fields []string, sort domain.Sort, filter domain.ContactFilter) ([]domain.Contact, int64, error) {
+	where, args, err := sqliteFilterCondition(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	contacts, err := s.query(ctx, contactColumns(fields), where+orderBy(sort)+` LIMIT ? OFFSET ?`, append(args, limit, (page-1)*limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM contacts `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	return contacts, total, nil
+}
+
+// sqliteFilterCondition is the WHERE of f with a trailing space, empty for
+// the zero filter. SQLite has no index on the tags, every contact is read.
+func sqliteFilterCondition(f domain.ContactFilter) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	for _, clause := range f.Tags {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM json_each(contacts.tags) WHERE value IN (`+sqlitePlaceholders(len(clause))+`))`)
+		args = append(args, sqliteArgs(clause)...)
+	}
+	if f.GroupId != 0 {
+		conditions = append(conditions, `id IN (SELECT contact_id FROM contact_groups WHERE group_id = ?)`)
+		args = append(args, f.GroupId)
+	}
+	if f.Query != nil {
+		condition, err := compileQuery(f.Query, sqliteQueryDialect, &args)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, `(`+condition+`)`)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+	return `WHERE ` + strings.Join(conditions, " AND ") + ` `, args, nil
+}
+
+func (s sqliteContactRepository) GetById(ctx context.Context, id int, fields []string) (*domain.Contact, error) {
+	var contact domain.Contact
+	columns := contactColumns(fields)
+
+	err := s.db.QueryRowContext(ctx, `SELECT `+strings.Join(columns, ", ")+` FROM contacts WHERE id = ?`, id).Scan(contactScanTargets(&contact, columns)...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	return &contact, nil
+}
+
+func (s sqliteContactRepository) GetByGroupIds(ctx context.Context, groupIds []int) (map[int][]domain.Contact, error) {
+	contacts := make(map[int][]domain.Contact)
+	if len(groupIds) == 0 {
+		return contacts, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT cg.group_id, c.id, c.name, c.email, c.phone, c.created_at, c.updated_at
+		FROM contact_groups cg
+		JOIN contacts c ON c.id = cg.contact_id
+		WHERE cg.group_id IN (`+sqlitePlaceholders(len(groupIds))+`)
+		ORDER BY c.id`, sqliteArgs(groupIds)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var groupId int
+		var c domain.Contact
+		if err := rows.Scan(&groupId, &c.Id, &c.Name, &c.Email, &c.Phone, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		contacts[groupId] = append(contacts[groupId], c)
+	}
+
+	return contacts, rows.Err()
+}
+
+func (s sqliteContactRepository) Count(ctx context.Context) (int64, error) {
+	var total int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM contacts`).Scan(&total)
+	return total, err
+}
+
+func (s sqliteContactRepository) Fingerprint(ctx context.Context) (domain.Fingerprint, error) {
+	var lastUpdated sql.NullString
+	var f domain.Fingerprint
+
+	// MAX loses the column type, so the time comes back as text.
+	err := s.db.QueryRowContext(ctx, `SELECT MAX(updated_at), COUNT(*) FROM contacts`).Scan(&lastUpdated, &f.Count)
+	if err != nil {
+		return f, err
+	}
+
+	f.LastUpdated = time.Unix(0, 0).UTC()
+	if lastUpdated.Valid {
+		if f.LastUpdated, err = time.Parse(sqliteTimeLayout, lastUpdated.String); err != nil {
+			return f, err
+		}
+	}
+
+	return f, nil
+}
+
+func (s sqliteContactRepository) Store(ctx context.Context, contact *domain.Contact) (*domain.Contact, error) {
+	now := timestampNow()
+
+	var newId int
+	err := s.db.QueryRowContext(ctx, `INSERT INTO contacts (name, email, phone, birthday, anniversary, dates, tags, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`,
+		contact.Name, contact.Email, contact.Phone, dateValue(contact.Birthday), dateValue(contact.Anniversary), datesValue(contact.Dates), tagsValue(contact.Tags), now, now).Scan(&newId)
+	if err != nil {
+		return nil, sqliteEmailTakenError(err)
+	}
+
+	return s.GetById(ctx, newId, nil)
+}
+
+func (s sqliteContactRepository) Update(ctx context.Context, id int, update *domain.ContactUpdate) (*domain.Contact, error) {
+	// NULL keeps a column, so a concurrent tag rename or merge is not undone.
+	result, err := s.db.ExecContext(ctx, `UPDATE contacts SET name = ?1, email = ?2, phone = ?3,
+			birthday = CASE WHEN ?4 IS NULL THEN birthday ELSE NULLIF(?4, '') END,
+			anniversary = CASE WHEN ?5 IS NULL THEN anniversary ELSE NULLIF(?5, '') END,
+			dates = COALESCE(?6, dates), tags = COALESCE(?7, tags), updated_at = ?8 WHERE id = ?9`,
+		update.Name, update.Email, update.Phone, optionalDateValue(update.Birthday), optionalDateValue(update.Anniversary),
+		optionalValue(update.Dates, datesValue), optionalValue(update.Tags, tagsValue), timestampNow(), id)
+	if err != nil {
+		return nil, sqliteEmailTakenError(err)
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	return s.GetById(ctx, id, nil)
+}
+
+func (s sqliteContactRepository) Delete(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM contacts WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
+
+func (s sqliteContactRepository) Tags(ctx context.Context, prefix string, limit int) ([]domain.Tag, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT t.value, COUNT(*) FROM contacts, json_each(contacts.tags) AS t
+		WHERE substr(t.value, 1, length(?)) = ?
+		GROUP BY t.value
+		ORDER BY COUNT(*) DESC, t.value
+		LIMIT ?`, prefix, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []domain.Tag{}
+	for rows.Next() {
+		var tag domain.Tag
+		if err := rows.Scan(&tag.Name, &tag.Contacts); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (s sqliteContactRepository) ReplaceTags(ctx context.Context, from []string, to string) (int64, error) {
+	in := sqlitePlaceholders(len(from))
+	args := append(append(sqliteArgs(from), to, timestampNow()), sqliteArgs(from)...)
+
+	result, err := s.db.ExecContext(ctx, `UPDATE contacts SET tags = (
+			SELECT json_group_array(name) FROM (
+				SELECT DISTINCT CASE WHEN t.value IN (`+in+`) THEN ? ELSE t.value END AS name
+				FROM json_each(contacts.tags) AS t
+				ORDER BY name
+			)
+		), updated_at = ?
+		WHERE EXISTS (SELECT 1 FROM json_each(contacts.tags) WHERE value IN (`+in+`))`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// query selects columns of the contacts matching clause and collects them.
+func (s sqliteContactRepository) query(ctx context.Context, columns []string, clause string, args ...interface{}) ([]domain.Contact, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+strings.Join(columns, ", ")+` FROM contacts `+clause, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var contacts []domain.Contact
+	for rows.Next() {
+		var c domain.Contact
+		if err := rows.Scan(contactScanTargets(&c, columns)...); err != nil {
+			return nil, err
+		}
+
+		contacts = append(contacts, c)
+	}
+
+	return contacts, rows.Err()
+}
+
+// sqliteEmailTakenError maps a unique violation, the only unique column is email.
+func sqliteEmailTakenError(err error) error {
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE {
+		return domain.ErrEmailTaken
+	}
+	return err
+}
+
+// sqlitePlaceholders returns "?, ?, ?" for n arguments, SQLite has no arrays to use with ANY.
+func sqlitePlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func sqliteArgs[T any](values []T) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
+
+type sqliteGroupRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteGroupRepository(db *sql.DB) domain.GroupRepository {
+	return &sqliteGroupRepository{db: db}
+}
+
+func (s sqliteGroupRepository) Paginate(ctx context.Context, page int, limit int) ([]domain.Group, int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+groupColumns+` FROM groups ORDER BY id LIMIT ? OFFSET ?`, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var groups []domain.Group
+	for rows.Next() {
+		var g domain.Group
+		if err := rows.Scan(&g.Id, &g.Name, &g.Filter, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+
+		groups = append(groups, g)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	total, err := s.Count(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return groups, total, nil
+}
+
+func (s sqliteGroupRepository) GetById(ctx context.Context, id int) (*domain.Group, error) {
+	var group domain.Group
+
+	err := s.db.QueryRowContext(ctx, `SELECT `+groupColumns+` FROM groups WHERE id = ?`, id).Scan(&group.Id, &group.Name, &group.Filter, &group.CreatedAt, &group.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, domain.ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+func (s sqliteGroupRepository) GetByContactIds(ctx context.Context, contactIds []int) (map[int][]domain.Group, error) {
+	groups := make(map[int][]domain.Group)
+	if len(contactIds) == 0 {
+		return groups, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT cg.contact_id, g.id, g.name, COALESCE(g.filter, ''), g.created_at, g.updated_at
+		FROM contact_groups cg
+		JOIN groups g ON g.id = cg.group_id
+		WHERE cg.contact_id IN (`+sqlitePlaceholders(len(contactIds))+`)
+		ORDER BY g.id`, sqliteArgs(contactIds)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var contactId int
+		var g domain.Group
+		if err := rows.Scan(&contactId, &g.Id, &g.Name, &g.Filter, &g.CreatedAt, &g.UpdatedAt); err != nil {
+			return nil, err
+		}
+
+		groups[contactId] = append(groups[contactId], g)
+	}
+
+	return groups, rows.Err()
+}
+
+func (s sqliteGroupRepository) Count(ctx context.Context) (int64, error) {
+	var total int64
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM groups`).Scan(&total)
+	return total, err
+}
+
+func (s sqliteGroupRepository) Store(ctx context.Context, group *domain.Group) (*domain.Group, error) {
+	now := timestampNow()
+
+	var newId int
+	err := s.db.QueryRowContext(ctx, `INSERT INTO groups (name, filter, created_at, updated_at) VALUES (?, NULLIF(?, ''), ?, ?) RETURNING id`,
+		group.Name, group.Filter, now, now).Scan(&newId)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetById(ctx, newId)
+}
+
+func (s sqliteGroupRepository) Update(ctx context.Context, id int, group *domain.Group) (*domain.Group, error) {
+	result, err := s.db.ExecContext(ctx, `UPDATE groups SET name = ?, filter = NULLIF(?, ''), updated_at = ? WHERE id = ?`,
+		group.Name, group.Filter, timestampNow(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if affected == 0 {
+		return nil, domain.ErrNotFound
+	}
+
+	return s.GetById(ctx, id)
+}
+
+func (s sqliteGroupRepository) Delete(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM groups WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil {
+		return err
+	} else if affected == 0 {
+		return domain.ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/config"
+)
+
+type Server struct {
+	httpServer      *http.Server
+	shutdownTimeout time.Duration
+	// certFile and keyFile are set to serve HTTPS.
+	certFile string
+	keyFile  string
+}
+
+func New(cfg *config.Config, handler http.Handler) *Server {
+	return &Server{
+		httpServer: &http.Server{
+			Addr:              ":" + cfg.AppPort,
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+		shutdownTimeout: cfg.ShutdownTimeout,
+		certFile:        cfg.TLSCertFile,
+		keyFile:         cfg.TLSKeyFile,
+	}
+}
+
+// OnShutdown registers f to be called as soon as shutdown starts, e.g. to fail
+// readiness so load balancers stop routing new requests here.
+func (s *Server) OnShutdown(f func()) {
+	s.httpServer.RegisterOnShutdown(f)
+}
+
+// Run serves until ctx is cancelled, then stops accepting connections and waits
+// up to the shutdown timeout for in-flight requests to drain.
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		if s.certFile != "" {
+			slog.Info("server running", "addr", "https://localhost"+s.httpServer.Addr)
+			errCh <- s.httpServer.ListenAndServeTLS(s.certFile, s.keyFile)
+			return
+		}
+
+		slog.Info("server running", "addr", "http://localhost"+s.httpServer.Addr)
+		errCh <- s.httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		// Listening failed before any shutdown was requested, e.g. port in use.
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, waiting for in-flight requests", "timeout", s.shutdownTimeout.String())
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	if err := s.httpServer.Shutdown(shutdownCtx); err != nil {
+		// Deadline passed, cut the remaining connections.
+		s.httpServer.Close()
+		return err
+	}
+
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
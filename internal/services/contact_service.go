@@ -1,53 +1,282 @@
 package services
 
 import (
+	"cmp"
 	"context"
+	"iter"
+	"slices"
+	"time"
 
 	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/tracing"
 )
 
+// embedChunkSize is how many streamed contacts share one batched include query.
+const embedChunkSize = 500
+
 type contactService struct {
-	repository domain.ContactRepository
+	repository      domain.ContactRepository
+	groupRepository domain.GroupRepository
 }
 
-func NewContactService(repository domain.ContactRepository) domain.ContactService {
+func NewContactService(repository domain.ContactRepository, groupRepository domain.GroupRepository) domain.ContactService {
 	return &contactService{
-		repository: repository,
+		repository:      repository,
+		groupRepository: groupRepository,
 	}
 }
 
-func (c contactService) GetAll(ctx context.Context) ([]domain.Contact, error) {
-	return c.repository.GetAll(ctx)
+// GetAll streams contacts, requested relations are loaded per chunk of
+// embedChunkSize contacts so includes stay batched without collecting every row.
+func (c contactService) GetAll(ctx context.Context, limit int, opts domain.QueryOptions) iter.Seq2[domain.Contact, error] {
+	return func(yield func(domain.Contact, error) bool) {
+		// The span covers the iteration, that is when the queries actually run.
+		ctx, span := tracing.Start(ctx, "ContactService.GetAll", tracing.Int("limit", limit))
+		defer span.End()
+
+		chunk := make([]domain.Contact, 0, embedChunkSize)
+
+		flush := func() bool {
+			if err := c.embed(ctx, chunk, opts); err != nil {
+				span.RecordError(err)
+				yield(domain.Contact{}, err)
+				return false
+			}
+
+			for _, contact := range chunk {
+				if !yield(contact.Project(opts.Fields), nil) {
+					return false
+				}
+			}
+
+			chunk = chunk[:0]
+			return true
+		}
+
+		for contact, err := range c.repository.GetAll(ctx, limit, opts.Fields) {
+			if err != nil {
+				span.RecordError(err)
+				yield(domain.Contact{}, err)
+				return
+			}
+
+			if len(opts.Include) == 0 {
+				if !yield(contact.Project(opts.Fields), nil) {
+					return
+				}
+				continue
+			}
+
+			chunk = append(chunk, contact)
+			if len(chunk) == embedChunkSize && !flush() {
+				return
+			}
+		}
+
+		flush()
+	}
 }
 
-func (c contactService) Paginate(ctx context.Context, page int, limit int) ([]domain.Contact, int64, error) {
-	return c.repository.Paginate(ctx, page, limit)
+func (c contactService) Paginate(ctx context.Context, page int, limit int, opts domain.QueryOptions) ([]domain.Contact, int64, error) {
+	ctx, span := tracing.Start(ctx, "ContactService.Paginate", tracing.Int("page", page), tracing.Int("limit", limit))
+	defer span.End()
+
+	contacts, total, err := c.repository.Paginate(ctx, page, limit, opts.Fields, opts.Sort, opts.Filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, err
+	}
+
+	if err := c.embed(ctx, contacts, opts); err != nil {
+		span.RecordError(err)
+		return nil, 0, err
+	}
+	domain.ProjectContacts(contacts, opts.Fields)
+
+	return contacts, total, nil
 }
 
-func (c contactService) GetById(ctx context.Context, id int) (*domain.Contact, error) {
-	return c.repository.GetById(ctx, id)
+func (c contactService) GetById(ctx context.Context, id int, opts domain.QueryOptions) (*domain.Contact, error) {
+	ctx, span := tracing.Start(ctx, "ContactService.GetById", tracing.Int("contact.id", id))
+	defer span.End()
+
+	contact, err := c.repository.GetById(ctx, id, opts.Fields)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	contacts := []domain.Contact{*contact}
+	if err := c.embed(ctx, contacts, opts); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	domain.ProjectContacts(contacts, opts.Fields)
+
+	return &contacts[0], nil
 }
 
-func (c contactService) Store(ctx context.Context, req *domain.CreateContactRequest) (*domain.Contact, error) {
-	return c.repository.Store(ctx, &domain.Contact{
-		Name:  req.Name,
-		Email: req.Email,
-		Phone: req.Phone,
+func (c contactService) Fingerprint(ctx context.Context) (domain.Fingerprint, error) {
+	ctx, span := tracing.Start(ctx, "ContactService.Fingerprint")
+	defer span.End()
+
+	f, err := c.repository.Fingerprint(ctx)
+	span.RecordError(err)
+
+	return f, err
+}
+
+// Upcoming has the database find the contacts with a date on a day of the
+// window, and works out when and how often each one comes up.
+func (c contactService) Upcoming(ctx context.Context, today time.Time, days int, groupId int) ([]domain.Occasion, error) {
+	ctx, span := tracing.Start(ctx, "ContactService.Upcoming", tracing.Int("days", days), tracing.Int("group.id", groupId))
+	defer span.End()
+
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+
+	occasions := []domain.Occasion{}
+	for contact, err := range c.repository.GetDated(ctx, groupId, domain.MonthDays(today, days)) {
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+
+		for _, o := range contact.Occasions() {
+			on := o.Date.Next(today)
+			// Nothing to celebrate before the date itself happened.
+			if o.Date.HasYear() && on.Year() < o.Date.Year {
+				on = o.Date.In(o.Date.Year)
+			}
+
+			o.DaysUntil = int(on.Sub(today).Hours() / 24)
+			if o.DaysUntil >= days {
+				continue
+			}
+			o.On = domain.PartialDate{Year: on.Year(), Month: on.Month(), Day: on.Day()}
+			if o.Date.HasYear() {
+				o.Years = on.Year() - o.Date.Year
+			}
+			occasions = append(occasions, o)
+		}
+	}
+
+	slices.SortStableFunc(occasions, func(a, b domain.Occasion) int {
+		return cmp.Or(cmp.Compare(a.DaysUntil, b.DaysUntil), cmp.Compare(a.Name, b.Name), cmp.Compare(a.ContactId, b.ContactId))
 	})
+
+	return occasions, nil
+}
+
+func (c contactService) GetDated(ctx context.Context, groupId int) iter.Seq2[domain.Contact, error] {
+	return c.repository.GetDated(ctx, groupId, nil)
+}
+
+func (c contactService) Store(ctx context.Context, req *domain.CreateContactRequest) (*domain.Contact, error) {
+	ctx, span := tracing.Start(ctx, "ContactService.Store")
+	defer span.End()
+
+	tags := domain.NormalizeTags(req.Tags)
+	update := domain.ContactUpdate{Name: req.Name, Email: req.Email, Phone: req.Phone, Tags: &tags}
+	if err := req.ApplyTo(&update); err != nil {
+		return nil, err
+	}
+	contact := &domain.Contact{Dates: []domain.ContactDate{}}
+	update.ApplyTo(contact)
+
+	contact, err := c.repository.Store(ctx, contact)
+	span.RecordError(err)
+
+	return contact, err
 }
 
 func (c contactService) Update(ctx context.Context, id int, req *domain.UpdateContactRequest) (*domain.Contact, error) {
-	return c.repository.Update(ctx, id, &domain.Contact{
-		Id:    id,
-		Name:  req.Name,
-		Email: req.Email,
-		Phone: req.Phone,
-	})
+	ctx, span := tracing.Start(ctx, "ContactService.Update", tracing.Int("contact.id", id))
+	defer span.End()
+
+	// Tags and dates left out of the request stay nil and keep their current
+	// value in the database.
+	update := &domain.ContactUpdate{Name: req.Name, Email: req.Email, Phone: req.Phone}
+	if req.Tags != nil {
+		tags := domain.NormalizeTags(*req.Tags)
+		update.Tags = &tags
+	}
+	if err := req.ApplyTo(update); err != nil {
+		return nil, err
+	}
+
+	contact, err := c.repository.Update(ctx, id, update)
+	span.RecordError(err)
+
+	return contact, err
 }
 
 func (c contactService) Delete(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "ContactService.Delete", tracing.Int("contact.id", id))
+	defer span.End()
+
 	if err := c.repository.Delete(ctx, id); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+func (c contactService) Tags(ctx context.Context, prefix string, limit int) ([]domain.Tag, error) {
+	ctx, span := tracing.Start(ctx, "ContactService.Tags", tracing.String("prefix", prefix))
+	defer span.End()
+
+	tags, err := c.repository.Tags(ctx, prefix, limit)
+	span.RecordError(err)
+
+	return tags, err
+}
+
+func (c contactService) RenameTag(ctx context.Context, from, to string) (int64, error) {
+	ctx, span := tracing.Start(ctx, "ContactService.RenameTag", tracing.String("from", from), tracing.String("to", to))
+	defer span.End()
+
+	changed, err := c.repository.ReplaceTags(ctx, []string{domain.NormalizeTag(from)}, domain.NormalizeTag(to))
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+	if changed == 0 {
+		return 0, domain.ErrNotFound
+	}
+	return changed, nil
+}
+
+func (c contactService) MergeTags(ctx context.Context, req *domain.MergeTagsRequest) (int64, error) {
+	ctx, span := tracing.Start(ctx, "ContactService.MergeTags", tracing.String("target", req.Target))
+	defer span.End()
+
+	changed, err := c.repository.ReplaceTags(ctx, domain.NormalizeTags(req.Sources), domain.NormalizeTag(req.Target))
+	span.RecordError(err)
+
+	return changed, err
+}
+
+// embed loads the requested relations for all contacts in one batched query
+// instead of a lookup per contact.
+func (c contactService) embed(ctx context.Context, contacts []domain.Contact, opts domain.QueryOptions) error {
+	if !opts.Includes("groups") || len(contacts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(contacts))
+	for i, contact := range contacts {
+		ids[i] = contact.Id
+	}
+
+	groups, err := c.groupRepository.GetByContactIds(ctx, ids)
+	if err != nil {
 		return err
 	}
+
+	for i := range contacts {
+		// Non-nil so contacts without groups still render "groups": [].
+		contacts[i].Groups = append([]domain.Group{}, groups[contacts[i].Id]...)
+	}
+
 	return nil
 }
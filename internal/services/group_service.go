@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/pkg/tracing"
+)
+
+// memberFields are the columns GetByGroupIds loads, embedded members render
+// only those.
+var memberFields = []string{"name", "email", "phone", "created_at", "updated_at"}
+
+type groupService struct {
+	repository        domain.GroupRepository
+	contactRepository domain.ContactRepository
+}
+
+func NewGroupService(repository domain.GroupRepository, contactRepository domain.ContactRepository) domain.GroupService {
+	return &groupService{
+		repository:        repository,
+		contactRepository: contactRepository,
+	}
+}
+
+func (g groupService) Paginate(ctx context.Context, page int, limit int, opts domain.QueryOptions) ([]domain.Group, int64, error) {
+	ctx, span := tracing.Start(ctx, "GroupService.Paginate", tracing.Int("page", page), tracing.Int("limit", limit))
+	defer span.End()
+
+	groups, total, err := g.repository.Paginate(ctx, page, limit)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, err
+	}
+
+	if err := g.embed(ctx, groups, opts); err != nil {
+		span.RecordError(err)
+		return nil, 0, err
+	}
+
+	return groups, total, nil
+}
+
+func (g groupService) GetById(ctx context.Context, id int, opts domain.QueryOptions) (*domain.Group, error) {
+	ctx, span := tracing.Start(ctx, "GroupService.GetById", tracing.Int("group.id", id))
+	defer span.End()
+
+	group, err := g.repository.GetById(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	groups := []domain.Group{*group}
+	if err := g.embed(ctx, groups, opts); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return &groups[0], nil
+}
+
+func (g groupService) Contacts(ctx context.Context, id int, page int, limit int, opts domain.QueryOptions) ([]domain.Contact, int64, error) {
+	ctx, span := tracing.Start(ctx, "GroupService.Contacts", tracing.Int("group.id", id), tracing.Int("page", page), tracing.Int("limit", limit))
+	defer span.End()
+
+	group, err := g.repository.GetById(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, err
+	}
+
+	filter := opts.Filter
+	if group.Smart() {
+		// Only valid filters are saved, an error here is a bug.
+		if filter.Query, err = domain.ParseContactQuery(group.Filter); err != nil {
+			span.RecordError(err)
+			return nil, 0, fmt.Errorf("group %d filter: %w", id, err)
+		}
+	} else {
+		filter.GroupId = id
+	}
+
+	contacts, total, err := g.contactRepository.Paginate(ctx, page, limit, opts.Fields, opts.Sort, filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, err
+	}
+	domain.ProjectContacts(contacts, opts.Fields)
+
+	return contacts, total, nil
+}
+
+func (g groupService) Preview(ctx context.Context, filter string, page int, limit int, opts domain.QueryOptions) ([]domain.Contact, int64, error) {
+	ctx, span := tracing.Start(ctx, "GroupService.Preview", tracing.String("group.filter", filter), tracing.Int("page", page), tracing.Int("limit", limit))
+	defer span.End()
+
+	query, err := domain.ParseContactQuery(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts.Filter.Query = query
+	contacts, total, err := g.contactRepository.Paginate(ctx, page, limit, opts.Fields, opts.Sort, opts.Filter)
+	if err != nil {
+		span.RecordError(err)
+		return nil, 0, err
+	}
+	domain.ProjectContacts(contacts, opts.Fields)
+
+	return contacts, total, nil
+}
+
+func (g groupService) Store(ctx context.Context, req *domain.SmartGroupRequest) (*domain.Group, error) {
+	ctx, span := tracing.Start(ctx, "GroupService.Store")
+	defer span.End()
+
+	group, err := smartGroup(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := g.repository.Store(ctx, group)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+func (g groupService) Update(ctx context.Context, id int, req *domain.SmartGroupRequest) (*domain.Group, error) {
+	ctx, span := tracing.Start(ctx, "GroupService.Update", tracing.Int("group.id", id))
+	defer span.End()
+
+	group, err := smartGroup(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.checkSmart(ctx, id); err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	updated, err := g.repository.Update(ctx, id, group)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+func (g groupService) Delete(ctx context.Context, id int) error {
+	ctx, span := tracing.Start(ctx, "GroupService.Delete", tracing.Int("group.id", id))
+	defer span.End()
+
+	if err := g.checkSmart(ctx, id); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if err := g.repository.Delete(ctx, id); err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
+
+// checkSmart returns ErrStaticGroup unless group id is a smart group.
+func (g groupService) checkSmart(ctx context.Context, id int) error {
+	group, err := g.repository.GetById(database.WithPrimary(ctx), id)
+	if err != nil {
+		return err
+	}
+	if !group.Smart() {
+		return domain.ErrStaticGroup
+	}
+	return nil
+}
+
+// smartGroup checks the filter of req, it is saved as written.
+func smartGroup(req *domain.SmartGroupRequest) (*domain.Group, error) {
+	filter := strings.TrimSpace(req.Filter)
+	if _, err := domain.ParseContactQuery(filter); err != nil {
+		return nil, err
+	}
+	return &domain.Group{Name: strings.TrimSpace(req.Name), Filter: filter}, nil
+}
+
+// embed loads the requested relations for all groups in one batched query
+// instead of a lookup per group.
+func (g groupService) embed(ctx context.Context, groups []domain.Group, opts domain.QueryOptions) error {
+	if !opts.Includes("contacts") || len(groups) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(groups))
+	for i, group := range groups {
+		ids[i] = group.Id
+	}
+
+	contacts, err := g.contactRepository.GetByGroupIds(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range groups {
+		// Non-nil so groups without members still render "contacts": [].
+		groups[i].Contacts = append([]domain.Contact{}, contacts[groups[i].Id]...)
+		domain.ProjectContacts(groups[i].Contacts, memberFields)
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package snapshot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Mode string
+
+const (
+	// ModeMerge inserts the rows of the archive that are missing and updates
+	// the ones that differ, everything else is kept.
+	ModeMerge Mode = "merge"
+	// ModeReplace does what merge does and deletes the rows that are not in
+	// the archive, along with rows referencing them.
+	ModeReplace Mode = "replace"
+)
+
+// ErrConflict means the archive's rows break a constraint of the database,
+// e.g. an email another contact already has.
+var ErrConflict = errors.New("snapshot conflicts with the database")
+
+// Changes count what applying an archive does to one table.
+type Changes struct {
+	Inserted  int64 `json:"inserted"`
+	Updated   int64 `json:"updated"`
+	Deleted   int64 `json:"deleted"`
+	Unchanged int64 `json:"unchanged"`
+}
+
+type Report struct {
+	Mode   Mode               `json:"mode"`
+	DryRun bool               `json:"dry_run"`
+	Tables map[string]Changes `json:"tables"`
+}
+
+// Apply merges the archive into the tables or replaces them with it, in one
+// transaction matching rows by primary key. With dryRun the transaction is
+// rolled back, the report tells what would have changed. Unlike Restore,
+// sequences only move forward, ids handed out before are never reused.
+func Apply(ctx context.Context, pool *pgxpool.Pool, a *Archive, schemaVersion int64, mode Mode, dryRun bool) (*Report, error) {
+	if mode != ModeMerge && mode != ModeReplace {
+		return nil, fmt.Errorf("unknown restore mode %q", mode)
+	}
+	if err := a.checkSchema(schemaVersion); err != nil {
+		return nil, err
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The history comes from the archive like every other row.
+	if err := database.SkipChangeTracking(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Mode: mode, DryRun: dryRun, Tables: make(map[string]Changes, len(tables))}
+
+	if _, err := tx.Exec(ctx, `CREATE TEMPORARY TABLE snapshot_rows (line JSONB NOT NULL) ON COMMIT DROP`); err != nil {
+		return nil, err
+	}
+	// Every table is staged before anything changes, deletes have to see all
+	// of them and run children first.
+	for _, t := range tables {
+		if err := stageTable(ctx, tx, a, t); err != nil {
+			return nil, conflict(fmt.Errorf("restore %s: %w", t.name, err))
+		}
+	}
+
+	if mode == ModeReplace {
+		for _, t := range slices.Backward(tables) {
+			deleted, err := deleteMissing(ctx, tx, t)
+			if err != nil {
+				return nil, conflict(fmt.Errorf("restore %s: %w", t.name, err))
+			}
+			changes := report.Tables[t.name]
+			changes.Deleted = deleted
+			report.Tables[t.name] = changes
+		}
+	}
+
+	for _, t := range tables {
+		inserted, updated, err := upsert(ctx, tx, t)
+		if err != nil {
+			return nil, conflict(fmt.Errorf("restore %s: %w", t.name, err))
+		}
+
+		changes := report.Tables[t.name]
+		changes.Inserted, changes.Updated = inserted, updated
+		changes.Unchanged = a.Manifest.Rows[t.name] - inserted - updated
+		report.Tables[t.name] = changes
+	}
+
+	if dryRun {
+		return report, nil
+	}
+	// setval is not rolled back, a dry run must not get here.
+	for _, t := range tables {
+		if err := advanceSequences(ctx, tx, t.name); err != nil {
+			return nil, fmt.Errorf("advance %s sequences: %w", t.name, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, conflict(err)
+	}
+	return report, nil
+}
+
+// stageTable loads the table's rows of the archive into restore_<table>, a
+// copy of the table without its constraints.
+func stageTable(ctx context.Context, tx pgx.Tx, a *Archive, t table) error {
+	table := pgx.Identifier{t.name}.Sanitize()
+	staged := pgx.Identifier{"restore_" + t.name}.Sanitize()
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`CREATE TEMPORARY TABLE %s (LIKE %s) ON COMMIT DROP`, staged, table)); err != nil {
+		return err
+	}
+
+	r, err := a.open(t.name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if err := stage(ctx, tx, r); err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s SELECT r.* FROM snapshot_rows, jsonb_populate_record(NULL::%s, line) r`, staged, table))
+	if err != nil {
+		return err
+	}
+	if n := tag.RowsAffected(); n != a.Manifest.Rows[t.name] {
+		return fmt.Errorf("%w: %s has %d rows, the manifest says %d", ErrInvalidArchive, t.name, n, a.Manifest.Rows[t.name])
+	}
+
+	_, err = tx.Exec(ctx, `TRUNCATE snapshot_rows`)
+	return err
+}
+
+// deleteMissing deletes the rows whose key is not in the archive.
+func deleteMissing(ctx context.Context, tx pgx.Tx, t table) (int64, error) {
+	match := make([]string, len(t.key))
+	for i, column := range t.key {
+		quoted := pgx.Identifier{column}.Sanitize()
+		match[i] = "s." + quoted + " = t." + quoted
+	}
+
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`DELETE FROM %s t WHERE NOT EXISTS (SELECT 1 FROM %s s WHERE %s)`,
+		pgx.Identifier{t.name}.Sanitize(), pgx.Identifier{"restore_" + t.name}.Sanitize(), strings.Join(match, " AND ")))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// upsert inserts the staged rows, updating existing rows only where a column
+// differs, and counts the inserted and updated ones.
+func upsert(ctx context.Context, tx pgx.Tx, t table) (inserted int64, updated int64, err error) {
+	columns, err := insertColumns(ctx, tx, t.name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var values []string
+	for _, column := range columns {
+		if !slices.Contains(t.key, column) {
+			values = append(values, column)
+		}
+	}
+
+	onConflict := "DO NOTHING"
+	if len(values) > 0 {
+		set := make([]string, len(values))
+		for i, column := range values {
+			quoted := pgx.Identifier{column}.Sanitize()
+			set[i] = quoted + " = EXCLUDED." + quoted
+		}
+		onConflict = fmt.Sprintf(`DO UPDATE SET %s WHERE (%s) IS DISTINCT FROM (%s)`,
+			strings.Join(set, ", "), quoteColumns(values, "t."), quoteColumns(values, "EXCLUDED."))
+	}
+
+	// xmax is 0 for a freshly inserted row and set for an updated one.
+	rows, err := tx.Query(ctx, fmt.Sprintf(`INSERT INTO %s AS t (%s) SELECT %s FROM %s ORDER BY %s ON CONFLICT (%s) %s RETURNING xmax = 0`,
+		pgx.Identifier{t.name}.Sanitize(), quoteColumns(columns, ""), quoteColumns(columns, ""),
+		pgx.Identifier{"restore_" + t.name}.Sanitize(), quoteColumns(t.key, ""), quoteColumns(t.key, ""), onConflict))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var isInsert bool
+		if err := rows.Scan(&isInsert); err != nil {
+			return 0, 0, err
+		}
+		if isInsert {
+			inserted++
+		} else {
+			updated++
+		}
+	}
+	return inserted, updated, rows.Err()
+}
+
+// advanceSequences moves every serial of the table past its highest value,
+// but never back.
+func advanceSequences(ctx context.Context, tx pgx.Tx, name string) error {
+	serials, err := serialColumns(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+
+	table := pgx.Identifier{name}.Sanitize()
+	for _, s := range serials {
+		query := fmt.Sprintf(`SELECT setval($1::text::regclass, GREATEST(MAX(%s), pg_sequence_last_value($1::text::regclass), 1)) FROM %s`,
+			pgx.Identifier{s.column}.Sanitize(), table)
+		if _, err := tx.Exec(ctx, query, s.sequence); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// conflict marks integrity constraint violations, class 23, as ErrConflict.
+func conflict(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && strings.HasPrefix(pgErr.Code, "23") {
+		message := pgErr.Message
+		if pgErr.Detail != "" {
+			message += ": " + pgErr.Detail
+		}
+		return fmt.Errorf("%w: %s", ErrConflict, message)
+	}
+	return err
+}
@@ -0,0 +1,229 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixtures are groups and contacts with fixed ids, read from YAML or JSON
+// files like:
+//
+//	groups:
+//	  - id: 1
+//	    name: Family
+//	contacts:
+//	  - id: 1
+//	    name: Alice Smith
+//	    email: alice@example.com
+//	    groups: [1]
+//
+// Keys are column names, a contact's groups lists the ids of its groups.
+// Columns no record sets keep their defaults, a record that leaves out a
+// column others set gets NULL.
+type Fixtures struct {
+	groups   []fixture
+	contacts []fixture
+}
+
+type fixture struct {
+	// source points at the record in its file, for errors.
+	source string
+	id     int64
+	values map[string]interface{}
+	groups []int64
+}
+
+type fixtureFile struct {
+	Groups   []map[string]interface{} `yaml:"groups"`
+	Contacts []map[string]interface{} `yaml:"contacts"`
+}
+
+// ReadFixtures reads and merges fixture files. JSON is read as the YAML it
+// also is.
+func ReadFixtures(paths ...string) (*Fixtures, error) {
+	f := &Fixtures{}
+	for _, path := range paths {
+		if ext := filepath.Ext(path); ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			return nil, fmt.Errorf("%s: fixtures must be .yaml, .yml or .json files", path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var file fixtureFile
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		for i, values := range file.Groups {
+			g, err := newFixture(fmt.Sprintf("%s: groups[%d]", path, i), values)
+			if err != nil {
+				return nil, err
+			}
+			f.groups = append(f.groups, g)
+		}
+		for i, values := range file.Contacts {
+			c, err := newFixture(fmt.Sprintf("%s: contacts[%d]", path, i), values)
+			if err != nil {
+				return nil, err
+			}
+			if c.groups, err = groupIds(c.source, values["groups"]); err != nil {
+				return nil, err
+			}
+			delete(c.values, "groups")
+			f.contacts = append(f.contacts, c)
+		}
+	}
+
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func newFixture(source string, values map[string]interface{}) (fixture, error) {
+	id, ok := positiveInt(values["id"])
+	if !ok {
+		return fixture{}, fmt.Errorf("%s: id must be a positive integer, fixtures need stable ids", source)
+	}
+	return fixture{source: source, id: id, values: values}, nil
+}
+
+func groupIds(source string, value interface{}) ([]int64, error) {
+	if value == nil {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: groups must be a list of group ids", source)
+	}
+
+	ids := make([]int64, 0, len(list))
+	for _, item := range list {
+		id, ok := positiveInt(item)
+		if !ok {
+			return nil, fmt.Errorf("%s: groups must be a list of group ids, got %v", source, item)
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func positiveInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), v > 0
+	case int64:
+		return v, v > 0
+	case uint64:
+		return int64(v), v > 0 && v <= 1<<63-1
+	default:
+		return 0, false
+	}
+}
+
+// check catches duplicate ids, also across files, and memberships of groups
+// that are not in the fixtures.
+func (f *Fixtures) check() error {
+	groups := make(map[int64]string, len(f.groups))
+	for _, g := range f.groups {
+		if other, ok := groups[g.id]; ok {
+			return fmt.Errorf("%s: group id %d is already used by %s", g.source, g.id, other)
+		}
+		groups[g.id] = g.source
+	}
+
+	contacts := make(map[int64]string, len(f.contacts))
+	for _, c := range f.contacts {
+		if other, ok := contacts[c.id]; ok {
+			return fmt.Errorf("%s: contact id %d is already used by %s", c.source, c.id, other)
+		}
+		contacts[c.id] = c.source
+
+		for _, id := range c.groups {
+			if _, ok := groups[id]; !ok {
+				return fmt.Errorf("%s: group %d is not in the fixtures", c.source, id)
+			}
+		}
+	}
+	return nil
+}
+
+// Counts are the rows the fixtures load into each table.
+func (f *Fixtures) Counts() map[string]int64 {
+	memberships := 0
+	for _, c := range f.contacts {
+		memberships += len(c.groups)
+	}
+	return map[string]int64{"groups": int64(len(f.groups)), "contacts": int64(len(f.contacts)), "contact_groups": int64(memberships)}
+}
+
+// LoadFixtures replaces the contents of the tables with the fixtures, like
+// Restore does with an archive.
+func LoadFixtures(ctx context.Context, pool *pgxpool.Pool, f *Fixtures) (map[string]int64, error) {
+	ndjson := map[string]*bytes.Buffer{"groups": {}, "contacts": {}, "contact_groups": {}, "reminders": {}, "interactions": {}, "contact_events": {}}
+	set := map[string][]string{}
+
+	for _, name := range []string{"groups", "contacts"} {
+		records := f.groups
+		if name == "contacts" {
+			records = f.contacts
+		}
+
+		// jsonb_populate_record ignores keys that are no column, a typo would
+		// silently load nothing.
+		columns, err := insertColumns(ctx, pool, name)
+		if err != nil {
+			return nil, err
+		}
+		used := map[string]bool{}
+		for _, r := range records {
+			for key := range r.values {
+				if !slices.Contains(columns, key) {
+					return nil, fmt.Errorf("%s: %s has no column %q", r.source, name, key)
+				}
+				used[key] = true
+			}
+		}
+		for _, column := range columns {
+			if used[column] {
+				set[name] = append(set[name], column)
+			}
+		}
+
+		encoder := json.NewEncoder(ndjson[name])
+		for _, r := range records {
+			if err := encoder.Encode(r.values); err != nil {
+				return nil, fmt.Errorf("%s: %w", r.source, err)
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(ndjson["contact_groups"])
+	for _, c := range f.contacts {
+		for _, group := range c.groups {
+			if err := encoder.Encode(map[string]int64{"contact_id": c.id, "group_id": group}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return replace(ctx, pool, func(name string) (io.ReadCloser, error) {
+		return io.NopCloser(ndjson[name]), nil
+	}, set, f.Counts())
+}
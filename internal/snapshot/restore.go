@@ -0,0 +1,201 @@
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxLineBytes bounds a single row of an NDJSON file.
+const maxLineBytes = 16 << 20
+
+// Restore replaces the contents of the tables with the archive, in one
+// transaction, and resets the id sequences past the restored ids. Tables
+// referencing contacts or groups are emptied as well.
+func Restore(ctx context.Context, pool *pgxpool.Pool, a *Archive, schemaVersion int64) (map[string]int64, error) {
+	if err := a.checkSchema(schemaVersion); err != nil {
+		return nil, err
+	}
+
+	counts, err := replace(ctx, pool, a.open, nil, a.Manifest.Rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return counts, nil
+}
+
+// replace truncates the tables and fills each from the NDJSON rows open
+// returns. Only the given columns of a table are set, the others keep their
+// defaults, all of them when a table has none. With expected, a table with
+// another number of rows rolls it all back.
+func replace(ctx context.Context, pool *pgxpool.Pool, open func(table string) (io.ReadCloser, error), columns map[string][]string, expected map[string]int64) (map[string]int64, error) {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := database.SkipChangeTracking(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = pgx.Identifier{t.name}.Sanitize()
+	}
+	if _, err := tx.Exec(ctx, `TRUNCATE `+strings.Join(names, ", ")+` RESTART IDENTITY CASCADE`); err != nil {
+		return nil, err
+	}
+	// Rows are staged as jsonb and spread into the columns by name.
+	if _, err := tx.Exec(ctx, `CREATE TEMPORARY TABLE snapshot_rows (line JSONB NOT NULL) ON COMMIT DROP`); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(tables))
+	for _, t := range tables {
+		r, err := open(t.name)
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := copyTable(ctx, tx, t.name, columns[t.name], r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("restore %s: %w", t.name, err)
+		}
+		if expected != nil && n != expected[t.name] {
+			return nil, fmt.Errorf("%w: %s has %d rows, the manifest says %d", ErrInvalidArchive, t.name, n, expected[t.name])
+		}
+		counts[t.name] = n
+
+		if err := resetSequences(ctx, tx, t.name); err != nil {
+			return nil, fmt.Errorf("reset %s sequences: %w", t.name, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func copyTable(ctx context.Context, tx pgx.Tx, name string, columns []string, r io.Reader) (int64, error) {
+	if len(columns) == 0 {
+		var err error
+		if columns, err = insertColumns(ctx, tx, name); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := stage(ctx, tx, r); err != nil {
+		return 0, err
+	}
+
+	table := pgx.Identifier{name}.Sanitize()
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`INSERT INTO %s (%s) SELECT %s FROM snapshot_rows, jsonb_populate_record(NULL::%s, line) r`,
+		table, quoteColumns(columns, ""), quoteColumns(columns, "r."), table))
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(ctx, `TRUNCATE snapshot_rows`); err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// stage copies NDJSON rows into the snapshot_rows table of the transaction.
+func stage(ctx context.Context, tx pgx.Tx, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	_, err := tx.CopyFrom(ctx, pgx.Identifier{"snapshot_rows"}, []string{"line"}, &lineSource{scanner: scanner})
+	return err
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+// insertColumns are the columns of a table a row can set, generated ones are left out.
+func insertColumns(ctx context.Context, q querier, name string) ([]string, error) {
+	rows, err := q.Query(ctx, `SELECT column_name::text FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND is_generated = 'NEVER'
+		ORDER BY ordinal_position`, name)
+	if err != nil {
+		return nil, err
+	}
+
+	columns, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s does not exist, is the database migrated?", name)
+	}
+	return columns, nil
+}
+
+// resetSequences moves every serial of the table past its highest value, so
+// the next insert does not collide with a restored id.
+func resetSequences(ctx context.Context, tx pgx.Tx, name string) error {
+	serials, err := serialColumns(ctx, tx, name)
+	if err != nil {
+		return err
+	}
+
+	table := pgx.Identifier{name}.Sanitize()
+	for _, s := range serials {
+		query := fmt.Sprintf(`SELECT setval($1::text::regclass, COALESCE(MAX(%s), 0) + 1, false) FROM %s`, pgx.Identifier{s.column}.Sanitize(), table)
+		if _, err := tx.Exec(ctx, query, s.sequence); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type serial struct{ column, sequence string }
+
+// serialColumns are the columns of a table filled from a sequence.
+func serialColumns(ctx context.Context, tx pgx.Tx, name string) ([]serial, error) {
+	rows, err := tx.Query(ctx, `SELECT column_name::text, pg_get_serial_sequence($1, column_name) FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $2 AND pg_get_serial_sequence($1, column_name) IS NOT NULL`,
+		pgx.Identifier{name}.Sanitize(), name)
+	if err != nil {
+		return nil, err
+	}
+
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (serial, error) {
+		var s serial
+		err := row.Scan(&s.column, &s.sequence)
+		return s, err
+	})
+}
+
+// lineSource feeds the non-empty lines of an NDJSON file to COPY.
+type lineSource struct {
+	scanner *bufio.Scanner
+}
+
+func (s *lineSource) Next() bool {
+	for s.scanner.Scan() {
+		if len(strings.TrimSpace(s.scanner.Text())) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *lineSource) Values() ([]interface{}, error) {
+	return []interface{}{s.scanner.Text()}, nil
+}
+
+func (s *lineSource) Err() error {
+	return s.scanner.Err()
+}
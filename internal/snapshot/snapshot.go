@@ -0,0 +1,243 @@
+// Package snapshot copies the contacts, groups and their memberships into a
+// portable archive and back, and loads fixtures with stable ids.
+//
+// An archive is a zip with one NDJSON file per table, a row per line as
+// row_to_json writes it, and a manifest.json with row counts and checksums.
+// Rows carry every column by name, so columns added by later migrations are
+// kept without changes here.
+package snapshot
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FormatVersion is raised when the layout of the archive changes. Version 2
+// added the checksums, archives of version 1 are still read.
+const FormatVersion = 2
+
+const manifestFile = "manifest.json"
+
+var (
+	// ErrInvalidArchive means the archive is damaged or no snapshot at all.
+	ErrInvalidArchive = errors.New("invalid snapshot archive")
+	// ErrSchemaMismatch means the archive was taken at another schema version.
+	ErrSchemaMismatch = errors.New("snapshot schema version mismatch")
+)
+
+type table struct {
+	name string
+	// key is the primary key, rows are ordered and matched by it.
+	key []string
+}
+
+// tables are written and restored in this order, parents first.
+var tables = []table{
+	{name: "groups", key: []string{"id"}},
+	{name: "contacts", key: []string{"id"}},
+	{name: "contact_groups", key: []string{"contact_id", "group_id"}},
+	{name: "reminders", key: []string{"id"}},
+	{name: "interactions", key: []string{"id"}},
+	{name: "contact_events", key: []string{"id"}},
+}
+
+type Manifest struct {
+	Format int `json:"format"`
+	// SchemaVersion is the migration the database was at, an archive only
+	// restores into a database at the same version.
+	SchemaVersion int64     `json:"schema_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Rows counts the rows of each table.
+	Rows map[string]int64 `json:"rows"`
+	// Checksums are the hex SHA-256 of each table's NDJSON file.
+	Checksums map[string]string `json:"checksums,omitempty"`
+}
+
+// Write streams every table into a zip archive on w. The rows are read in one
+// repeatable read transaction, so the archive is consistent while the API
+// keeps writing.
+func Write(ctx context.Context, pool *pgxpool.Pool, schemaVersion int64, w io.Writer) (*Manifest, error) {
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	manifest := &Manifest{
+		Format:        FormatVersion,
+		SchemaVersion: schemaVersion,
+		CreatedAt:     time.Now().UTC(),
+		Rows:          map[string]int64{},
+		Checksums:     map[string]string{},
+	}
+	archive := zip.NewWriter(w)
+
+	for _, t := range tables {
+		file, err := archive.Create(t.name + ".ndjson")
+		if err != nil {
+			return nil, err
+		}
+
+		sum := sha256.New()
+		n, err := writeTable(ctx, tx, t, io.MultiWriter(file, sum))
+		if err != nil {
+			return nil, fmt.Errorf("snapshot %s: %w", t.name, err)
+		}
+		manifest.Rows[t.name] = n
+		manifest.Checksums[t.name] = hex.EncodeToString(sum.Sum(nil))
+	}
+
+	// The manifest goes last, only then the counts are known.
+	file, err := archive.Create(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func writeTable(ctx context.Context, tx pgx.Tx, t table, w io.Writer) (int64, error) {
+	name := pgx.Identifier{t.name}.Sanitize()
+	rows, err := tx.Query(ctx, fmt.Sprintf(`SELECT row_to_json(t)::text FROM %s t ORDER BY %s`, name, quoteColumns(t.key, "")))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	buffered := bufio.NewWriter(w)
+	var n int64
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return n, err
+		}
+		buffered.WriteString(line)
+		buffered.WriteByte('\n')
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+
+	return n, buffered.Flush()
+}
+
+// Archive is an opened snapshot, ready to be restored.
+type Archive struct {
+	Manifest Manifest
+	files    map[string]*zip.File
+}
+
+// Open reads the manifest of an archive and checks that it has every table.
+func Open(r io.ReaderAt, size int64) (*Archive, error) {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	a := &Archive{files: make(map[string]*zip.File, len(reader.File))}
+	for _, f := range reader.File {
+		a.files[f.Name] = f
+	}
+
+	file, ok := a.files[manifestFile]
+	if !ok {
+		return nil, fmt.Errorf("%w: manifest.json is missing", ErrInvalidArchive)
+	}
+	content, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	if err := json.NewDecoder(content).Decode(&a.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: manifest.json: %v", ErrInvalidArchive, err)
+	}
+	if a.Manifest.Format < 1 || a.Manifest.Format > FormatVersion {
+		return nil, fmt.Errorf("%w: format %d is not supported, expected at most %d", ErrInvalidArchive, a.Manifest.Format, FormatVersion)
+	}
+	for _, t := range tables {
+		if _, ok := a.files[t.name+".ndjson"]; !ok {
+			return nil, fmt.Errorf("%w: %s.ndjson is missing", ErrInvalidArchive, t.name)
+		}
+		if _, ok := a.Manifest.Checksums[t.name]; !ok && a.Manifest.Format >= 2 {
+			return nil, fmt.Errorf("%w: manifest.json has no checksum of %s", ErrInvalidArchive, t.name)
+		}
+	}
+
+	return a, nil
+}
+
+// checkSchema fails unless the archive was taken at schemaVersion.
+func (a *Archive) checkSchema(schemaVersion int64) error {
+	if a.Manifest.SchemaVersion != schemaVersion {
+		return fmt.Errorf("%w: the snapshot was taken at schema version %d, the database is at version %d",
+			ErrSchemaMismatch, a.Manifest.SchemaVersion, schemaVersion)
+	}
+	return nil
+}
+
+// open reads the NDJSON file of a table. A file that does not match its
+// checksum fails at its end, so the transaction reading it rolls back.
+func (a *Archive) open(name string) (io.ReadCloser, error) {
+	file, err := a.files[name+".ndjson"].Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+
+	want, ok := a.Manifest.Checksums[name]
+	if !ok {
+		return file, nil
+	}
+	return &checkedReader{ReadCloser: file, name: name, sum: sha256.New(), want: want}, nil
+}
+
+type checkedReader struct {
+	io.ReadCloser
+	name string
+	sum  hash.Hash
+	want string
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.sum.Write(p[:n])
+	switch {
+	case err == io.EOF && hex.EncodeToString(c.sum.Sum(nil)) != c.want:
+		return n, fmt.Errorf("%w: %s.ndjson does not match its checksum", ErrInvalidArchive, c.name)
+	case err != nil && err != io.EOF:
+		// zip.ErrChecksum and friends.
+		return n, fmt.Errorf("%w: %s.ndjson: %v", ErrInvalidArchive, c.name, err)
+	}
+	return n, err
+}
+
+// quoteColumns joins quoted column names, each prefixed with prefix.
+func quoteColumns(columns []string, prefix string) string {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = prefix + pgx.Identifier{column}.Sanitize()
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,84 @@
+package tasks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/jobs"
+	"github.com/BramAristyo/rest-api-contact-person/internal/snapshot"
+)
+
+// ExportFile is the name of the archive an export job produces.
+const ExportFile = "archive"
+
+// ImportPayload are the options of an import, the archive is the job's input file.
+type ImportPayload struct {
+	Mode   snapshot.Mode `json:"mode"`
+	DryRun bool          `json:"dry_run"`
+}
+
+// export writes a snapshot archive, like GET /api/backup, into the job's
+// ExportFile.
+func (t *tasks) export(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	status, err := t.migrator.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var archive bytes.Buffer
+	manifest, err := snapshot.Write(ctx, t.db.Pool, status.Version, &archive)
+	if err != nil {
+		return nil, err
+	}
+
+	err = task.Save(ctx, &jobs.File{
+		Name:        ExportFile,
+		Filename:    "contacts-" + manifest.CreatedAt.Format("20060102T150405Z") + ".zip",
+		ContentType: "application/zip",
+		Data:        archive.Bytes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// importArchive applies the job's input archive, like POST /api/restore.
+func (t *tasks) importArchive(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	var payload ImportPayload
+	if err := task.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload.Mode != snapshot.ModeMerge && payload.Mode != snapshot.ModeReplace {
+		return nil, jobs.Permanent(fmt.Errorf("unknown import mode %q", payload.Mode))
+	}
+
+	input, err := task.Input(ctx)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := snapshot.Open(bytes.NewReader(input.Data), int64(len(input.Data)))
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+
+	status, err := t.migrator.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := snapshot.Apply(ctx, t.db.Pool, archive, status.Version, payload.Mode, payload.DryRun)
+	if errors.Is(err, snapshot.ErrInvalidArchive) || errors.Is(err, snapshot.ErrSchemaMismatch) || errors.Is(err, snapshot.ErrConflict) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !payload.DryRun {
+		t.invalidate(ctx)
+	}
+	return report, nil
+}
@@ -0,0 +1,222 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/domain"
+	"github.com/BramAristyo/rest-api-contact-person/internal/jobs"
+	"github.com/jackc/pgx/v5"
+)
+
+// purgeBatchSize is the number of contacts a purge deletes per statement.
+const purgeBatchSize = 1000
+
+type MergeContactsPayload struct {
+	TargetId  int   `json:"target_id" validate:"required,gt=0"`
+	SourceIds []int `json:"source_ids" validate:"required,min=1,max=100,dive,gt=0"`
+}
+
+type mergeResult struct {
+	TargetId int `json:"target_id"`
+	Merged   int `json:"merged"`
+	// GroupsAdded counts the memberships the target took over.
+	GroupsAdded int64 `json:"groups_added"`
+	// InteractionsMoved counts the interactions the target took over.
+	InteractionsMoved int64 `json:"interactions_moved"`
+}
+
+// mergeContacts folds the source contacts into the target: the target joins
+// their groups, takes over their interactions and reminders, adds their tags,
+// takes the first email and phone among them it lacks, and the sources are
+// deleted.
+func (t *tasks) mergeContacts(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	var payload MergeContactsPayload
+	if err := task.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if len(payload.SourceIds) == 0 || slices.Contains(payload.SourceIds, payload.TargetId) {
+		return nil, jobs.Permanent(errors.New("source_ids must be set and must not contain target_id"))
+	}
+
+	tx, err := t.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	contacts, err := lockContacts(ctx, tx, append([]int{payload.TargetId}, payload.SourceIds...))
+	if err != nil {
+		return nil, err
+	}
+
+	target := contacts[payload.TargetId]
+	email, phone := target.Email, target.Phone
+	for _, id := range payload.SourceIds {
+		if email == "" {
+			email = contacts[id].Email
+		}
+		if phone == "" {
+			phone = contacts[id].Phone
+		}
+	}
+
+	tag, err := tx.Exec(ctx, `INSERT INTO contact_groups (contact_id, group_id)
+		SELECT $1, group_id FROM contact_groups WHERE contact_id = ANY($2)
+		ON CONFLICT DO NOTHING`, payload.TargetId, payload.SourceIds)
+	if err != nil {
+		return nil, err
+	}
+	groupsAdded := tag.RowsAffected()
+
+	tag, err = tx.Exec(ctx, `UPDATE interactions SET contact_id = $1 WHERE contact_id = ANY($2)`, payload.TargetId, payload.SourceIds)
+	if err != nil {
+		return nil, err
+	}
+	interactionsMoved := tag.RowsAffected()
+	if _, err := tx.Exec(ctx, `UPDATE reminders SET contact_id = $1 WHERE contact_id = ANY($2)`, payload.TargetId, payload.SourceIds); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE contacts SET tags = (
+			SELECT COALESCE(jsonb_agg(DISTINCT t.name ORDER BY t.name), '[]')
+			FROM contacts c, jsonb_array_elements_text(c.tags) AS t(name)
+			WHERE c.id = $1 OR c.id = ANY($2)
+		) WHERE id = $1`, payload.TargetId, payload.SourceIds); err != nil {
+		return nil, err
+	}
+
+	// The sources go first, the target may take over one's unique email.
+	if _, err := tx.Exec(ctx, `DELETE FROM contacts WHERE id = ANY($1)`, payload.SourceIds); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE contacts SET email = NULLIF($2, ''), phone = NULLIF($3, ''), updated_at = NOW() WHERE id = $1`,
+		payload.TargetId, email, phone); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	t.invalidate(ctx)
+
+	return mergeResult{
+		TargetId:          payload.TargetId,
+		Merged:            len(payload.SourceIds),
+		GroupsAdded:       groupsAdded,
+		InteractionsMoved: interactionsMoved,
+	}, nil
+}
+
+// lockContacts reads the email and phone of the contacts, locked until the
+// end of tx. A missing contact fails the job.
+func lockContacts(ctx context.Context, tx pgx.Tx, ids []int) (map[int]domain.Contact, error) {
+	rows, err := tx.Query(ctx, `SELECT id, COALESCE(email, ''), COALESCE(phone, '') FROM contacts WHERE id = ANY($1) ORDER BY id FOR UPDATE`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	contacts := make(map[int]domain.Contact, len(ids))
+	for rows.Next() {
+		var c domain.Contact
+		if err := rows.Scan(&c.Id, &c.Email, &c.Phone); err != nil {
+			return nil, err
+		}
+		contacts[c.Id] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, ok := contacts[id]; !ok {
+			return nil, jobs.Permanent(fmt.Errorf("contact %d: %w", id, domain.ErrNotFound))
+		}
+	}
+	return contacts, nil
+}
+
+// PurgeContactsPayload selects the contacts to delete, every filter that is
+// set must match.
+type PurgeContactsPayload struct {
+	Ids           []int      `json:"ids,omitempty" validate:"omitempty,max=10000,dive,gt=0"`
+	GroupId       int        `json:"group_id,omitempty" validate:"omitempty,gt=0"`
+	UpdatedBefore *time.Time `json:"updated_before,omitempty"`
+}
+
+// Empty tells whether no filter is set, a purge never deletes everything.
+func (p PurgeContactsPayload) Empty() bool {
+	return len(p.Ids) == 0 && p.GroupId == 0 && p.UpdatedBefore == nil
+}
+
+func (p PurgeContactsPayload) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "$?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if len(p.Ids) > 0 {
+		add(`id = ANY($?)`, p.Ids)
+	}
+	if p.GroupId > 0 {
+		add(`id IN (SELECT contact_id FROM contact_groups WHERE group_id = $?)`, p.GroupId)
+	}
+	if p.UpdatedBefore != nil {
+		add(`updated_at < $?`, *p.UpdatedBefore)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+type purgeResult struct {
+	Deleted int64 `json:"deleted"`
+}
+
+// purgeContacts deletes the matching contacts in batches, each committed on
+// its own. A retry continues with what is left.
+func (t *tasks) purgeContacts(ctx context.Context, task *jobs.Task) (interface{}, error) {
+	var payload PurgeContactsPayload
+	if err := task.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if payload.Empty() {
+		return nil, jobs.Permanent(errors.New("a purge needs at least one of ids, group_id or updated_before"))
+	}
+	where, args := payload.where()
+
+	var total int64
+	if err := t.db.QueryRow(ctx, `SELECT COUNT(*) FROM contacts WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, err
+	}
+
+	var deleted int64
+	defer func() {
+		if deleted > 0 {
+			t.invalidate(context.WithoutCancel(ctx))
+		}
+	}()
+
+	for {
+		tag, err := t.db.Exec(ctx, fmt.Sprintf(`DELETE FROM contacts WHERE id IN (SELECT id FROM contacts WHERE %s ORDER BY id LIMIT %d)`, where, purgeBatchSize), args...)
+		if err != nil {
+			return nil, err
+		}
+		if tag.RowsAffected() == 0 {
+			break
+		}
+		deleted += tag.RowsAffected()
+
+		if err := task.Progress(ctx, deleted, total); err != nil {
+			return nil, err
+		}
+	}
+
+	return purgeResult{Deleted: deleted}, nil
+}
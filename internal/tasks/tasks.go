@@ -0,0 +1,37 @@
+// Package tasks are the kinds of background jobs, run by a jobs.Worker in
+// the API or in cmd/worker.
+package tasks
+
+import (
+	"context"
+
+	"github.com/BramAristyo/rest-api-contact-person/internal/database"
+	"github.com/BramAristyo/rest-api-contact-person/internal/jobs"
+)
+
+const (
+	KindExport        = "export"
+	KindImport        = "import"
+	KindMergeContacts = "contacts.merge"
+	KindPurgeContacts = "contacts.purge"
+)
+
+type tasks struct {
+	db       *database.DB
+	migrator *database.Migrator
+	// invalidate drops cached contacts after a job changed them, in every instance.
+	invalidate func(ctx context.Context)
+}
+
+// Register adds every kind to w. invalidate may be nil without a contacts cache.
+func Register(w *jobs.Worker, db *database.DB, migrator *database.Migrator, invalidate func(ctx context.Context)) {
+	if invalidate == nil {
+		invalidate = func(ctx context.Context) {}
+	}
+	t := &tasks{db: db, migrator: migrator, invalidate: invalidate}
+
+	w.Register(KindExport, t.export)
+	w.Register(KindImport, t.importArchive)
+	w.Register(KindMergeContacts, t.mergeContacts)
+	w.Register(KindPurgeContacts, t.purgeContacts)
+}
@@ -0,0 +1,30 @@
+CREATE TABLE rate_limit_buckets (
+    key        VARCHAR(255) PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+-- Refills the bucket for the elapsed time and takes one token if available.
+-- The upsert keeps the row locked until the statement ends, so concurrent
+-- requests from every API instance are serialized per key.
+CREATE OR REPLACE FUNCTION rate_limit_take(p_key VARCHAR, p_burst DOUBLE PRECISION, p_rate DOUBLE PRECISION)
+RETURNS TABLE (allowed BOOLEAN, remaining DOUBLE PRECISION) AS $$
+DECLARE
+    v_tokens DOUBLE PRECISION;
+    v_now    TIMESTAMPTZ := clock_timestamp();
+BEGIN
+    INSERT INTO rate_limit_buckets AS b (key, tokens, updated_at)
+    VALUES (p_key, p_burst, v_now)
+    ON CONFLICT (key) DO UPDATE
+        SET tokens = LEAST(p_burst, b.tokens + GREATEST(0, EXTRACT(EPOCH FROM (v_now - b.updated_at))) * p_rate),
+            updated_at = v_now
+    RETURNING b.tokens INTO v_tokens;
+
+    IF v_tokens >= 1 THEN
+        UPDATE rate_limit_buckets SET tokens = v_tokens - 1 WHERE rate_limit_buckets.key = p_key;
+        RETURN QUERY SELECT TRUE, v_tokens - 1;
+    ELSE
+        RETURN QUERY SELECT FALSE, v_tokens;
+    END IF;
+END;
+$$ LANGUAGE plpgsql;
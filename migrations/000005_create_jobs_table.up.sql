@@ -0,0 +1,39 @@
+CREATE TABLE jobs (
+    id               BIGSERIAL PRIMARY KEY,
+    kind             VARCHAR(50) NOT NULL,
+    status           VARCHAR(20) NOT NULL DEFAULT 'queued',
+    payload          JSONB NOT NULL DEFAULT '{}',
+    progress         SMALLINT NOT NULL DEFAULT 0,
+    result           JSONB,
+    error            TEXT,
+    attempts         INT NOT NULL DEFAULT 0,
+    max_attempts     INT NOT NULL,
+    -- A queued job runs from run_at on, a retry waits there for its backoff.
+    run_at           TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- A running job whose lease expired is claimed again by another worker.
+    locked_until     TIMESTAMPTZ,
+    locked_by        VARCHAR(100),
+    cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at       TIMESTAMPTZ,
+    finished_at      TIMESTAMPTZ,
+    CONSTRAINT jobs_status_check CHECK (status IN ('queued', 'running', 'succeeded', 'failed', 'cancelled')),
+    CONSTRAINT jobs_progress_check CHECK (progress BETWEEN 0 AND 100)
+);
+
+-- Workers look for due queued jobs and expired leases.
+CREATE INDEX jobs_queued_idx ON jobs (run_at) WHERE status = 'queued';
+CREATE INDEX jobs_running_idx ON jobs (locked_until) WHERE status = 'running';
+CREATE INDEX jobs_finished_idx ON jobs (finished_at) WHERE finished_at IS NOT NULL;
+
+-- Uploads a job reads and files it produces, e.g. an import's archive or an
+-- export's download.
+CREATE TABLE job_files (
+    job_id       BIGINT NOT NULL REFERENCES jobs(id) ON DELETE CASCADE,
+    name         VARCHAR(50) NOT NULL,
+    filename     VARCHAR(255) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    data         BYTEA NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (job_id, name)
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS contacts_dated_idx;
+
+ALTER TABLE contacts
+    DROP COLUMN IF EXISTS birthday,
+    DROP COLUMN IF EXISTS anniversary,
+    DROP COLUMN IF EXISTS dates;
@@ -0,0 +1,13 @@
+-- Dates are stored as YYYY-MM-DD, or --MM-DD when the year is unknown, and
+-- the labelled dates as a JSON array of {"label", "date"}.
+ALTER TABLE contacts
+    ADD COLUMN birthday    VARCHAR(10),
+    ADD COLUMN anniversary VARCHAR(10),
+    ADD COLUMN dates       JSONB NOT NULL DEFAULT '[]',
+    ADD CONSTRAINT contacts_birthday_check CHECK (birthday ~ '^(\d{4}|-)-\d{2}-\d{2}$'),
+    ADD CONSTRAINT contacts_anniversary_check CHECK (anniversary ~ '^(\d{4}|-)-\d{2}-\d{2}$'),
+    ADD CONSTRAINT contacts_dates_check CHECK (jsonb_typeof(dates) = 'array');
+
+-- Upcoming dates and the calendar feed only read the contacts with a date.
+CREATE INDEX contacts_dated_idx ON contacts (id)
+    WHERE birthday IS NOT NULL OR anniversary IS NOT NULL OR dates <> '[]';
@@ -0,0 +1,29 @@
+CREATE TABLE reminders (
+    id              BIGSERIAL PRIMARY KEY,
+    contact_id      BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    note            TEXT NOT NULL DEFAULT '',
+    -- An RRULE like FREQ=WEEKLY;INTERVAL=2, empty for a reminder that fires once.
+    recurrence      VARCHAR(200) NOT NULL DEFAULT '',
+    time_zone       VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    status          VARCHAR(20) NOT NULL DEFAULT 'pending',
+    -- The recurrence counts from starts_at, occurs_at is the pending
+    -- occurrence and due_at when it fires, later than occurs_at once snoozed.
+    starts_at       TIMESTAMPTZ NOT NULL,
+    occurs_at       TIMESTAMPTZ NOT NULL,
+    due_at          TIMESTAMPTZ NOT NULL,
+    -- The scheduler sends from notify_after on, a retry waits there for its backoff.
+    notify_after    TIMESTAMPTZ NOT NULL,
+    notify_attempts INT NOT NULL DEFAULT 0,
+    notify_error    TEXT,
+    notified_at     TIMESTAMPTZ,
+    completed_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT reminders_status_check CHECK (status IN ('pending', 'completed'))
+);
+
+-- The scheduler looks for occurrences not sent yet, the API for overdue and
+-- upcoming ones.
+CREATE INDEX reminders_notify_idx ON reminders (notify_after) WHERE status = 'pending' AND notified_at IS NULL;
+CREATE INDEX reminders_due_idx ON reminders (due_at) WHERE status = 'pending';
+CREATE INDEX reminders_contact_idx ON reminders (contact_id);
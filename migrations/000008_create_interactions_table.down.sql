@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS interactions;
+DROP FUNCTION IF EXISTS interactions_refresh_last_contacted();
+DROP FUNCTION IF EXISTS refresh_last_contacted(BIGINT);
+DROP TRIGGER IF EXISTS contact_groups_record_membership ON contact_groups;
+DROP FUNCTION IF EXISTS record_membership();
+DROP TRIGGER IF EXISTS contacts_record_update ON contacts;
+DROP FUNCTION IF EXISTS record_contact_update();
+DROP FUNCTION IF EXISTS contacts_tracking_changes();
+DROP TABLE IF EXISTS contact_events;
+
+DROP INDEX IF EXISTS contacts_last_contacted_idx;
+ALTER TABLE contacts DROP COLUMN IF EXISTS last_contacted_at;
@@ -0,0 +1,120 @@
+-- Calls, meetings, emails and notes logged against a contact.
+CREATE TABLE interactions (
+    id          BIGSERIAL PRIMARY KEY,
+    contact_id  BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    type        VARCHAR(20) NOT NULL,
+    occurred_at TIMESTAMPTZ NOT NULL,
+    summary     VARCHAR(200) NOT NULL,
+    body        TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT interactions_type_check CHECK (type IN ('call', 'meeting', 'email', 'note'))
+);
+
+CREATE INDEX interactions_contact_idx ON interactions (contact_id, occurred_at);
+
+-- The changes to a contact and its group memberships, written by the
+-- triggers below. changes maps each changed field to {"from", "to"}.
+CREATE TABLE contact_events (
+    id          BIGSERIAL PRIMARY KEY,
+    contact_id  BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    kind        VARCHAR(20) NOT NULL,
+    changes     JSONB,
+    -- The group is kept by name, it may be gone by the time the event is read.
+    group_id    BIGINT,
+    group_name  VARCHAR(100),
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT contact_events_kind_check CHECK (kind IN ('contact_updated', 'group_joined', 'group_left'))
+);
+
+CREATE INDEX contact_events_contact_idx ON contact_events (contact_id, occurred_at);
+
+-- The last call, meeting or email, notes do not count.
+ALTER TABLE contacts ADD COLUMN last_contacted_at TIMESTAMPTZ;
+
+CREATE INDEX contacts_last_contacted_idx ON contacts (last_contacted_at NULLS FIRST, id);
+
+-- Restores and the seeder write rows that carry their history and
+-- last_contacted_at already, they turn the triggers off for their transaction
+-- with SET LOCAL contacts.track_changes = 'off'.
+CREATE FUNCTION contacts_tracking_changes() RETURNS BOOLEAN AS $$
+    SELECT COALESCE(current_setting('contacts.track_changes', true), '') <> 'off';
+$$ LANGUAGE sql STABLE;
+
+CREATE FUNCTION record_contact_update() RETURNS trigger AS $$
+DECLARE
+    old_row JSONB := to_jsonb(OLD);
+    new_row JSONB := to_jsonb(NEW);
+    changes JSONB := '{}';
+    field   TEXT;
+BEGIN
+    IF NOT contacts_tracking_changes() THEN
+        RETURN NULL;
+    END IF;
+
+    FOREACH field IN ARRAY ARRAY['name', 'email', 'phone', 'birthday', 'anniversary', 'dates'] LOOP
+        IF old_row -> field IS DISTINCT FROM new_row -> field THEN
+            changes := changes || jsonb_build_object(field, jsonb_build_object('from', old_row -> field, 'to', new_row -> field));
+        END IF;
+    END LOOP;
+
+    IF changes <> '{}' THEN
+        INSERT INTO contact_events (contact_id, kind, changes) VALUES (NEW.id, 'contact_updated', changes);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER contacts_record_update AFTER UPDATE ON contacts
+    FOR EACH ROW EXECUTE FUNCTION record_contact_update();
+
+CREATE FUNCTION record_membership() RETURNS trigger AS $$
+BEGIN
+    IF NOT contacts_tracking_changes() THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP = 'INSERT' THEN
+        INSERT INTO contact_events (contact_id, kind, group_id, group_name)
+        VALUES (NEW.contact_id, 'group_joined', NEW.group_id, (SELECT name FROM groups WHERE id = NEW.group_id));
+    -- A contact being deleted leaves its groups, its history goes with it.
+    ELSIF EXISTS (SELECT 1 FROM contacts WHERE id = OLD.contact_id) THEN
+        INSERT INTO contact_events (contact_id, kind, group_id, group_name)
+        VALUES (OLD.contact_id, 'group_left', OLD.group_id, (SELECT name FROM groups WHERE id = OLD.group_id));
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER contact_groups_record_membership AFTER INSERT OR DELETE ON contact_groups
+    FOR EACH ROW EXECUTE FUNCTION record_membership();
+
+-- updated_at moves along, so ETags and caches see the new last_contacted_at.
+CREATE FUNCTION refresh_last_contacted(contact BIGINT) RETURNS VOID AS $$
+    UPDATE contacts c SET last_contacted_at = latest.at, updated_at = NOW()
+    FROM (SELECT MAX(occurred_at) AS at FROM interactions WHERE contact_id = contact AND type <> 'note') latest
+    WHERE c.id = contact AND c.last_contacted_at IS DISTINCT FROM latest.at;
+$$ LANGUAGE sql;
+
+CREATE FUNCTION interactions_refresh_last_contacted() RETURNS trigger AS $$
+BEGIN
+    IF NOT contacts_tracking_changes() THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP = 'DELETE' THEN
+        PERFORM refresh_last_contacted(OLD.contact_id);
+        RETURN NULL;
+    END IF;
+
+    PERFORM refresh_last_contacted(NEW.contact_id);
+    -- A merge moves interactions to another contact.
+    IF TG_OP = 'UPDATE' AND OLD.contact_id <> NEW.contact_id THEN
+        PERFORM refresh_last_contacted(OLD.contact_id);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER interactions_refresh_last_contacted AFTER INSERT OR UPDATE OR DELETE ON interactions
+    FOR EACH ROW EXECUTE FUNCTION interactions_refresh_last_contacted();
@@ -0,0 +1,26 @@
+CREATE OR REPLACE FUNCTION record_contact_update() RETURNS trigger AS $$
+DECLARE
+    old_row JSONB := to_jsonb(OLD);
+    new_row JSONB := to_jsonb(NEW);
+    changes JSONB := '{}';
+    field   TEXT;
+BEGIN
+    IF NOT contacts_tracking_changes() THEN
+        RETURN NULL;
+    END IF;
+
+    FOREACH field IN ARRAY ARRAY['name', 'email', 'phone', 'birthday', 'anniversary', 'dates'] LOOP
+        IF old_row -> field IS DISTINCT FROM new_row -> field THEN
+            changes := changes || jsonb_build_object(field, jsonb_build_object('from', old_row -> field, 'to', new_row -> field));
+        END IF;
+    END LOOP;
+
+    IF changes <> '{}' THEN
+        INSERT INTO contact_events (contact_id, kind, changes) VALUES (NEW.id, 'contact_updated', changes);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP INDEX IF EXISTS contacts_tags_idx;
+ALTER TABLE contacts DROP CONSTRAINT IF EXISTS contacts_tags_check, DROP COLUMN IF EXISTS tags;
@@ -0,0 +1,32 @@
+-- Free-form labels, a JSON array of normalized tags. The GIN index serves
+-- ?& (every tag) and ?| (any tag) filters.
+ALTER TABLE contacts
+    ADD COLUMN tags JSONB NOT NULL DEFAULT '[]',
+    ADD CONSTRAINT contacts_tags_check CHECK (jsonb_typeof(tags) = 'array');
+
+CREATE INDEX contacts_tags_idx ON contacts USING GIN (tags);
+
+-- Tag changes show in the contact's history like its other fields.
+CREATE OR REPLACE FUNCTION record_contact_update() RETURNS trigger AS $$
+DECLARE
+    old_row JSONB := to_jsonb(OLD);
+    new_row JSONB := to_jsonb(NEW);
+    changes JSONB := '{}';
+    field   TEXT;
+BEGIN
+    IF NOT contacts_tracking_changes() THEN
+        RETURN NULL;
+    END IF;
+
+    FOREACH field IN ARRAY ARRAY['name', 'email', 'phone', 'birthday', 'anniversary', 'dates', 'tags'] LOOP
+        IF old_row -> field IS DISTINCT FROM new_row -> field THEN
+            changes := changes || jsonb_build_object(field, jsonb_build_object('from', old_row -> field, 'to', new_row -> field));
+        END IF;
+    END LOOP;
+
+    IF changes <> '{}' THEN
+        INSERT INTO contact_events (contact_id, kind, changes) VALUES (NEW.id, 'contact_updated', changes);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
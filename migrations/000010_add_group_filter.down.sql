@@ -0,0 +1,4 @@
+-- Smart groups would be left as static groups without members.
+DELETE FROM groups WHERE filter IS NOT NULL;
+
+ALTER TABLE groups DROP COLUMN IF EXISTS filter;
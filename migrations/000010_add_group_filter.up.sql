@@ -0,0 +1,4 @@
+-- The filter expression of a smart group, whose members are the contacts it
+-- matches when read. Static groups keep NULL and their members in
+-- contact_groups.
+ALTER TABLE groups ADD COLUMN filter TEXT;
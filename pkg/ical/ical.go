@@ -0,0 +1,135 @@
+// Package ical writes iCalendar feeds (RFC 5545), just enough for all-day
+// recurring events that calendar apps can subscribe to.
+// See https://www.rfc-editor.org/rfc/rfc5545
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of a feed.
+const ContentType = "text/calendar; charset=utf-8"
+
+// maxLineOctets is the longest a content line may be, longer ones are folded.
+const maxLineOctets = 75
+
+type Calendar struct {
+	ProdId string
+	Name   string
+	// RefreshInterval is how often subscribers should fetch the feed again, 0 leaves it to them.
+	RefreshInterval time.Duration
+}
+
+// Event is an all-day event.
+type Event struct {
+	UID   string
+	Stamp time.Time
+	// Start is the day of the event, the time of day is ignored.
+	Start time.Time
+	// RRule repeats the event, e.g. "FREQ=YEARLY".
+	RRule       string
+	Summary     string
+	Description string
+	Categories  []string
+}
+
+type Writer struct {
+	w *bufio.Writer
+}
+
+// NewWriter starts the calendar, Close ends it.
+func NewWriter(w io.Writer, cal Calendar) *Writer {
+	cw := &Writer{w: bufio.NewWriter(w)}
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", cal.ProdId)
+	cw.line("CALSCALE", "GREGORIAN")
+	cw.line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		cw.line("X-WR-CALNAME", Text(cal.Name))
+	}
+	if cal.RefreshInterval > 0 {
+		cw.line("REFRESH-INTERVAL;VALUE=DURATION", duration(cal.RefreshInterval))
+		cw.line("X-PUBLISHED-TTL", duration(cal.RefreshInterval))
+	}
+	return cw
+}
+
+// Event writes e, an error means the feed cannot be written anymore.
+func (cw *Writer) Event(e Event) error {
+	cw.line("BEGIN", "VEVENT")
+	cw.line("UID", e.UID)
+	cw.line("DTSTAMP", e.Stamp.UTC().Format("20060102T150405Z"))
+	cw.line("DTSTART;VALUE=DATE", e.Start.Format("20060102"))
+	if e.RRule != "" {
+		cw.line("RRULE", e.RRule)
+	}
+	cw.line("SUMMARY", Text(e.Summary))
+	if e.Description != "" {
+		cw.line("DESCRIPTION", Text(e.Description))
+	}
+	if len(e.Categories) > 0 {
+		categories := make([]string, len(e.Categories))
+		for i, c := range e.Categories {
+			categories[i] = Text(c)
+		}
+		cw.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	// All-day events like birthdays do not block time.
+	cw.line("TRANSP", "TRANSPARENT")
+	return cw.line("END", "VEVENT")
+}
+
+// Close ends the calendar and flushes what is buffered.
+func (cw *Writer) Close() error {
+	cw.line("END", "VCALENDAR")
+	return cw.w.Flush()
+}
+
+// line writes a content line, folded after maxLineOctets octets without
+// splitting a UTF-8 sequence. bufio keeps the first error.
+func (cw *Writer) line(name, value string) error {
+	line := name + ":" + value
+	width := maxLineOctets
+	for len(line) > width {
+		cut := width
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		cw.w.WriteString(line[:cut])
+		cw.w.WriteString("\r\n ")
+		line = line[cut:]
+		// The space leading a continuation line counts.
+		width = maxLineOctets - 1
+	}
+	cw.w.WriteString(line)
+	_, err := cw.w.WriteString("\r\n")
+	return err
+}
+
+// Text escapes a TEXT value.
+func Text(s string) string {
+	return textEscaper.Replace(s)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", "")
+
+// duration formats d as a DURATION value, e.g. PT12H.
+func duration(d time.Duration) string {
+	s := "PT"
+	if h := int(d / time.Hour); h > 0 {
+		s += strconv.Itoa(h) + "H"
+	}
+	if m := int(d % time.Hour / time.Minute); m > 0 {
+		s += strconv.Itoa(m) + "M"
+	}
+	if sec := int(d % time.Minute / time.Second); sec > 0 || s == "PT" {
+		s += strconv.Itoa(sec) + "S"
+	}
+	return s
+}
@@ -0,0 +1,93 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrEmptyBody     = errors.New("request body is empty")
+	ErrTrailingData  = errors.New("request body must only contain a single JSON value")
+	ErrBodyTooLarge  = errors.New("request body too large")
+	ErrMalformedJSON = errors.New("request body is not valid JSON")
+)
+
+// FieldError is a problem with a single field of the body, the caller reports
+// it as a validation error of that field.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// DecodeJSON decodes a single JSON value from the request body into dst.
+// In strict mode unknown fields are rejected instead of silently ignored.
+// Data after the value is always rejected.
+func DecodeJSON(r *http.Request, dst interface{}, strict bool) error {
+	dec := json.NewDecoder(r.Body)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	// A second Decode must hit EOF, anything else is trailing data.
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return ErrBodyTooLarge
+		}
+		return ErrTrailingData
+	}
+
+	return nil
+}
+
+func decodeError(err error) error {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return ErrEmptyBody
+	case errors.As(err, &maxBytesErr):
+		return ErrBodyTooLarge
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrMalformedJSON
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		field := strings.ToLower(typeErr.Field)
+		return &FieldError{Field: field, Message: fmt.Sprintf("%s must be a %s", field, jsonKind(typeErr.Type.Kind().String()))}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields.
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &FieldError{Field: field, Message: field + " is not allowed"}
+	default:
+		return ErrMalformedJSON
+	}
+}
+
+// jsonKind names Go kinds the way API clients know them.
+func jsonKind(kind string) string {
+	switch {
+	case strings.HasPrefix(kind, "int"), strings.HasPrefix(kind, "uint"), strings.HasPrefix(kind, "float"):
+		return "number"
+	case kind == "bool":
+		return "boolean"
+	case kind == "slice", kind == "array":
+		return "array"
+	case kind == "map", kind == "struct":
+		return "object"
+	default:
+		return kind
+	}
+}
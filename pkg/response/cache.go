@@ -0,0 +1,64 @@
+package response
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CacheControl makes clients revalidate on every use, which with an ETag turns
+// repeated polling into cheap 304 responses.
+const CacheControl = "private, no-cache"
+
+// WeakETag hashes the parts into a weak validator, weak because the same data
+// may be encoded differently, e.g. compressed.
+func WeakETag(parts ...interface{}) string {
+	h := sha256.New()
+	for _, p := range parts {
+		fmt.Fprintf(h, "%v\x00", p)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// BodyETag hashes an encoded body into a weak validator, weak because
+// compression still changes the bytes on the wire.
+func BodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// NotModified sets the ETag and Cache-Control headers and answers 304 when the
+// client already has this version. It returns true when the response is done.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", CacheControl)
+
+	if !matchesETag(r.Header.Get("If-None-Match"), etag) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// matchesETag uses the weak comparison of RFC 9110 section 8.8.3.2, which is
+// the one If-None-Match requires.
+func matchesETag(header string, etag string) bool {
+	if header == "" {
+		return false
+	}
+
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
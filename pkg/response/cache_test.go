@@ -0,0 +1,34 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWritePaginatedCached(t *testing.T) {
+	serve := func(data interface{}, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		WritePaginatedCached(w, r, data, PaginationMeta{Page: 1, Limit: 10, Total: 1, TotalPages: 1})
+		return w
+	}
+
+	first := serve([]string{"a"}, "")
+	etag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || etag != BodyETag(first.Body.Bytes()) {
+		t.Fatalf("status %d, ETag %q is not the hash of the body", first.Code, etag)
+	}
+
+	if w := serve([]string{"a"}, etag); w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Fatalf("same body: status %d with %d bytes, want an empty 304", w.Code, w.Body.Len())
+	}
+
+	changed := serve([]string{"b"}, etag)
+	if changed.Code != http.StatusOK || changed.Header().Get("ETag") == etag {
+		t.Fatalf("changed body: status %d, ETag %q", changed.Code, changed.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,117 @@
+package response
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+)
+
+// csvEncoder renders collections as one row per record with a header row taken
+// from the record keys.
+// When the payload is an envelope its "data" member is encoded, a null one is an
+// empty collection and has no rows at all. A single record becomes a single row
+// and anything else is ErrUnsupportedPayload.
+type csvEncoder struct{}
+
+func (csvEncoder) ContentType() string {
+	return "text/csv; charset=utf-8"
+}
+
+func (csvEncoder) Encode(w io.Writer, v interface{}) error {
+	tree, err := normalize(v)
+	if err != nil {
+		return err
+	}
+
+	if envelope, ok := tree.(object); ok {
+		if data, ok := envelope.get("data"); ok {
+			tree = data
+		}
+	}
+	if tree == nil {
+		tree = []interface{}{}
+	}
+
+	var records []object
+	switch value := tree.(type) {
+	case []interface{}:
+		for _, item := range value {
+			record, ok := item.(object)
+			if !ok {
+				return ErrUnsupportedPayload
+			}
+			records = append(records, record)
+		}
+	case object:
+		records = []object{value}
+	default:
+		return ErrUnsupportedPayload
+	}
+
+	// Header is the union of keys in order of first appearance, so records with
+	// omitted fields still line up.
+	var header []string
+	index := map[string]int{}
+	for _, record := range records {
+		for _, m := range record {
+			if _, ok := index[m.Key]; !ok {
+				index[m.Key] = len(header)
+				header = append(header, m.Key)
+			}
+		}
+	}
+
+	if len(records) == 0 {
+		// No record to take a header from.
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		row := make([]string, len(header))
+		for _, m := range record {
+			row[index[m.Key]] = csvCell(m.Value)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvCell keeps scalars as-is and falls back to JSON for nested values.
+func csvCell(v interface{}) string {
+	switch v.(type) {
+	case object, []interface{}:
+		raw, _ := json.Marshal(toNative(v))
+		return string(raw)
+	default:
+		return scalarString(v)
+	}
+}
+
+// toNative converts a normalized tree back to plain maps and slices for encoding/json.
+func toNative(v interface{}) interface{} {
+	switch value := v.(type) {
+	case object:
+		m := make(map[string]interface{}, len(value))
+		for _, member := range value {
+			m[member.Key] = toNative(member.Value)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(value))
+		for i, item := range value {
+			arr[i] = toNative(item)
+		}
+		return arr
+	default:
+		return value
+	}
+}
@@ -0,0 +1,45 @@
+package response
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCSVEmptyPage(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+	}{
+		{"nil page", []streamRecord(nil)},
+		{"empty page", []streamRecord{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/?format=csv", nil)
+			w := httptest.NewRecorder()
+
+			WritePaginated(w, r, tt.data, PaginationMeta{Page: 2, Limit: 10, Total: 3, TotalPages: 1}, http.StatusOK)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d", w.Code)
+			}
+			if got := w.Body.String(); got != "" {
+				t.Fatalf("body %q, want no rows", got)
+			}
+			if got := w.Header().Get("X-Total-Count"); got != "3" {
+				t.Fatalf("X-Total-Count %q, want 3", got)
+			}
+		})
+	}
+}
+
+func TestCSVPage(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?format=csv", nil)
+	w := httptest.NewRecorder()
+
+	WritePaginated(w, r, []streamRecord{{Id: 1, Name: "Ada"}}, PaginationMeta{Page: 1, Limit: 10, Total: 1, TotalPages: 1}, http.StatusOK)
+	if got, want := w.Body.String(), "id,name\n1,Ada\n"; got != want {
+		t.Fatalf("body %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnsupportedPayload is returned by an Encoder when the payload has a shape
+// the format cannot represent, e.g. a scalar value encoded as CSV.
+var ErrUnsupportedPayload = errors.New("payload cannot be represented in this format")
+
+// Encoder serializes a response payload into a single media type.
+type Encoder interface {
+	ContentType() string
+	Encode(w io.Writer, v interface{}) error
+}
+
+type format struct {
+	name       string
+	mediaTypes []string
+	encoder    Encoder
+}
+
+// formats is the registry used for content negotiation, the first entry is the
+// default when the client accepts anything.
+var formats []format
+
+func init() {
+	Register("json", jsonEncoder{}, "application/json")
+	Register("xml", xmlEncoder{}, "application/xml", "text/xml")
+	Register("csv", csvEncoder{}, "text/csv")
+	Register("ndjson", ndjsonEncoder{}, "application/x-ndjson")
+	Register("msgpack", msgpackEncoder{}, "application/msgpack", "application/x-msgpack", "application/vnd.msgpack")
+}
+
+// Register adds an encoder that can be selected with ?format=<name> or with any
+// of the given media types in the Accept header.
+// Registering an existing name replaces the previous encoder.
+func Register(name string, encoder Encoder, mediaTypes ...string) {
+	f := format{name: name, mediaTypes: mediaTypes, encoder: encoder}
+
+	for i := range formats {
+		if formats[i].name == name {
+			formats[i] = f
+			return
+		}
+	}
+
+	formats = append(formats, f)
+}
+
+// Negotiate picks the encoder for the request, the ?format= query parameter
+// wins over the Accept header. It returns false when nothing acceptable is
+// registered so the caller can answer with 406.
+func Negotiate(r *http.Request) (Encoder, bool) {
+	if r == nil {
+		return formats[0].encoder, true
+	}
+
+	if name := r.URL.Query().Get("format"); name != "" {
+		for _, f := range formats {
+			if f.name == name {
+				return f.encoder, true
+			}
+		}
+		return nil, false
+	}
+
+	accept := r.Header.Get("Accept")
+	if strings.TrimSpace(accept) == "" {
+		return formats[0].encoder, true
+	}
+
+	for _, mediaRange := range parseAccept(accept) {
+		if enc, ok := lookup(mediaRange); ok {
+			return enc, true
+		}
+	}
+
+	return nil, false
+}
+
+func lookup(mediaRange string) (Encoder, bool) {
+	if mediaRange == "*/*" {
+		return formats[0].encoder, true
+	}
+
+	// Wildcard subtype like "text/*" matches the first registered format of that type.
+	if prefix, ok := strings.CutSuffix(mediaRange, "/*"); ok {
+		for _, f := range formats {
+			for _, mt := range f.mediaTypes {
+				if strings.HasPrefix(mt, prefix+"/") {
+					return f.encoder, true
+				}
+			}
+		}
+		return nil, false
+	}
+
+	for _, f := range formats {
+		for _, mt := range f.mediaTypes {
+			if mt == mediaRange {
+				return f.encoder, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// parseAccept returns the media ranges of an Accept header ordered by their
+// quality value, ranges with q=0 are dropped.
+func parseAccept(header string) []string {
+	type acceptRange struct {
+		mediaRange string
+		q          float64
+	}
+
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaRange := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaRange == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, p := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.TrimSpace(key) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if q <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, acceptRange{mediaRange: mediaRange, q: q})
+	}
+
+	// Stable sort keeps the client's order for ranges with the same quality.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	result := make([]string, len(ranges))
+	for i, r := range ranges {
+		result[i] = r.mediaRange
+	}
+
+	return result
+}
+
+type jsonEncoder struct{}
+
+func (jsonEncoder) ContentType() string {
+	return "application/json"
+}
+
+func (jsonEncoder) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
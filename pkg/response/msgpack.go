@@ -0,0 +1,119 @@
+package response
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+)
+
+// msgpackEncoder implements the subset of MessagePack needed for JSON shaped
+// data: nil, bool, int, float64, str, array and map.
+// See https://github.com/msgpack/msgpack/blob/master/spec.md
+type msgpackEncoder struct{}
+
+func (msgpackEncoder) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackEncoder) Encode(w io.Writer, v interface{}) error {
+	tree, err := normalize(v)
+	if err != nil {
+		return err
+	}
+
+	var buf []byte
+	buf = appendMsgpack(buf, tree)
+
+	_, err = w.Write(buf)
+	return err
+}
+
+func appendMsgpack(buf []byte, v interface{}) []byte {
+	switch value := v.(type) {
+	case nil:
+		return append(buf, 0xc0)
+	case bool:
+		if value {
+			return append(buf, 0xc3)
+		}
+		return append(buf, 0xc2)
+	case json.Number:
+		if i, err := strconv.ParseInt(value.String(), 10, 64); err == nil {
+			return appendMsgpackInt(buf, i)
+		}
+		f, _ := value.Float64()
+		buf = append(buf, 0xcb)
+		return binary.BigEndian.AppendUint64(buf, math.Float64bits(f))
+	case string:
+		return appendMsgpackString(buf, value)
+	case []interface{}:
+		buf = appendMsgpackHeader(buf, len(value), 0x90, 0xdc, 0xdd)
+		for _, item := range value {
+			buf = appendMsgpack(buf, item)
+		}
+		return buf
+	case object:
+		buf = appendMsgpackHeader(buf, len(value), 0x80, 0xde, 0xdf)
+		for _, m := range value {
+			buf = appendMsgpackString(buf, m.Key)
+			buf = appendMsgpack(buf, m.Value)
+		}
+		return buf
+	default:
+		return append(buf, 0xc0)
+	}
+}
+
+func appendMsgpackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(buf, byte(i))
+	case i < 0 && i >= -32:
+		return append(buf, byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(buf, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		buf = append(buf, 0xd1)
+		return binary.BigEndian.AppendUint16(buf, uint16(int16(i)))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		buf = append(buf, 0xd2)
+		return binary.BigEndian.AppendUint32(buf, uint32(int32(i)))
+	default:
+		buf = append(buf, 0xd3)
+		return binary.BigEndian.AppendUint64(buf, uint64(i))
+	}
+}
+
+func appendMsgpackString(buf []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n <= 31:
+		buf = append(buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		buf = append(buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, 0xda)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, 0xdb)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+	return append(buf, s...)
+}
+
+// appendMsgpackHeader writes the length prefix shared by arrays and maps, fix
+// holds the fixarray/fixmap marker for lengths up to 15.
+func appendMsgpackHeader(buf []byte, n int, fix, marker16, marker32 byte) []byte {
+	switch {
+	case n <= 15:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		buf = append(buf, marker16)
+		return binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, marker32)
+		return binary.BigEndian.AppendUint32(buf, uint32(n))
+	}
+}
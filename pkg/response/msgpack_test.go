@@ -0,0 +1,90 @@
+package response
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMsgpackEncoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  string
+	}{
+		{"nil", nil, "c0"},
+		{"false", false, "c2"},
+		{"true", true, "c3"},
+		{"positive fixint", 127, "7f"},
+		{"negative fixint", -32, "e0"},
+		{"int8", -33, "d0df"},
+		{"int16", 1000, "d103e8"},
+		{"int32", 70000, "d200011170"},
+		{"int64", int64(1) << 40, "d30000010000000000"},
+		{"float64", 1.5, "cb3ff8000000000000"},
+		{"fixstr", "abc", "a3616263"},
+		{"empty string", "", "a0"},
+		{"fixarray", []int{1, 2}, "920102"},
+		{"empty array", []int{}, "90"},
+		// Keys keep the order of the struct fields, like the JSON output.
+		{"fixmap", struct {
+			B int    `json:"b"`
+			A string `json:"a"`
+		}{1, "x"}, "82a16201a161a178"},
+		{"omitzero", struct {
+			A int `json:"a,omitzero"`
+			B int `json:"b"`
+		}{0, 2}, "81a16202"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := (msgpackEncoder{}).Encode(&buf, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(buf.Bytes()); got != tt.want {
+				t.Fatalf("encoded %v as %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMsgpackEncoderLengths(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  interface{}
+		header string
+	}{
+		{"str8", strings.Repeat("a", 32), "d920"},
+		{"str16", strings.Repeat("a", 256), "da0100"},
+		{"str32", strings.Repeat("a", 65536), "db00010000"},
+		{"array16", make([]int, 16), "dc0010"},
+		{"array32", make([]int, 65536), "dd00010000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := (msgpackEncoder{}).Encode(&buf, tt.value); err != nil {
+				t.Fatal(err)
+			}
+			if got := hex.EncodeToString(buf.Bytes()); !strings.HasPrefix(got, tt.header) {
+				t.Fatalf("header %s, want %s", got[:min(len(got), 12)], tt.header)
+			}
+		})
+	}
+
+	m := make(map[string]int, 16)
+	for i := range 16 {
+		m[strings.Repeat("k", i+1)] = i
+	}
+	var buf bytes.Buffer
+	if err := (msgpackEncoder{}).Encode(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(buf.Bytes()[:3]); got != "de0010" {
+		t.Fatalf("map16 header %s, want de0010", got)
+	}
+}
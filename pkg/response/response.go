@@ -1,8 +1,11 @@
 package response
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 )
 
 type PaginationMeta struct {
@@ -29,64 +32,98 @@ type ErrorResponse struct {
 	Errors  map[string]string `json:"errors,omitempty"`
 }
 
-func WriteSuccess(w http.ResponseWriter, data interface{}, message string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-
-	err := json.NewEncoder(w).Encode(SuccessResponse{
+func WriteSuccess(w http.ResponseWriter, r *http.Request, data interface{}, message string, statusCode int) {
+	write(w, r, SuccessResponse{
 		Success: true,
 		Data:    data,
 		Message: message,
-	})
-
-	if err != nil {
-		WriteError(w, "Failed to encode success response", http.StatusInternalServerError)
-		return
-	}
+	}, statusCode)
 }
 
-func WriteError(w http.ResponseWriter, message string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-
-	err := json.NewEncoder(w).Encode(ErrorResponse{
+func WriteError(w http.ResponseWriter, r *http.Request, message string, statusCode int) {
+	write(w, r, ErrorResponse{
 		Success: false,
 		Message: message,
-	})
-
-	if err != nil {
-		WriteError(w, "Failed to encode error response", http.StatusInternalServerError)
-		return
-	}
+	}, statusCode)
 }
 
-func WriteValidationErrors(w http.ResponseWriter, errors map[string]string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-
-	err := json.NewEncoder(w).Encode(ErrorResponse{
+func WriteValidationErrors(w http.ResponseWriter, r *http.Request, errors map[string]string, statusCode int) {
+	write(w, r, ErrorResponse{
 		Success: false,
 		Message: "Validation failed",
 		Errors:  errors,
-	})
+	}, statusCode)
+}
 
-	if err != nil {
-		WriteError(w, "Failed to encode validation error response", http.StatusInternalServerError)
-		return
-	}
+func WritePaginated(w http.ResponseWriter, r *http.Request, data interface{}, meta PaginationMeta, statusCode int) {
+	// Formats like CSV have no place for meta, so it is mirrored in headers.
+	w.Header().Set("X-Total-Count", strconv.FormatInt(meta.Total, 10))
+	w.Header().Set("X-Total-Pages", strconv.FormatInt(meta.TotalPages, 10))
+
+	write(w, r, PaginatedResponse{
+		Data: data,
+		Meta: meta,
+	}, statusCode)
 }
 
-func WritePaginated(w http.ResponseWriter, data interface{}, meta PaginationMeta, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+// WritePaginatedCached is WritePaginated with an ETag hashed from the encoded
+// body, so it always matches what was served even when the data comes from a
+// cache. A client that already has the body gets 304.
+func WritePaginatedCached(w http.ResponseWriter, r *http.Request, data interface{}, meta PaginationMeta) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(meta.Total, 10))
+	w.Header().Set("X-Total-Pages", strconv.FormatInt(meta.TotalPages, 10))
 
-	err := json.NewEncoder(w).Encode(PaginatedResponse{
+	body, ok := encode(w, r, PaginatedResponse{
 		Data: data,
 		Meta: meta,
 	})
-
-	if err != nil {
-		WriteError(w, "Failed to encode paginated response", http.StatusInternalServerError)
+	if !ok || NotModified(w, r, BodyETag(body)) {
 		return
 	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// write encodes the payload with the negotiated encoder.
+func write(w http.ResponseWriter, r *http.Request, payload interface{}, statusCode int) {
+	if body, ok := encode(w, r, payload); ok {
+		w.WriteHeader(statusCode)
+		w.Write(body)
+	}
+}
+
+// encode encodes the payload with the negotiated encoder and sets its
+// Content-Type, the caller writes the status and the body. The body is encoded
+// into a buffer first, so an encoding failure can still be reported with a
+// proper status code instead of a half written body, encode has then answered
+// and returns false.
+func encode(w http.ResponseWriter, r *http.Request, payload interface{}) ([]byte, bool) {
+	w.Header().Add("Vary", "Accept")
+
+	encoder, ok := Negotiate(r)
+	if !ok {
+		writeJSON(w, ErrorResponse{Success: false, Message: "Not acceptable"}, http.StatusNotAcceptable)
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	if err := encoder.Encode(&buf, payload); err != nil {
+		if errors.Is(err, ErrUnsupportedPayload) {
+			writeJSON(w, ErrorResponse{Success: false, Message: "Response cannot be represented as " + encoder.ContentType()}, http.StatusNotAcceptable)
+			return nil, false
+		}
+
+		writeJSON(w, ErrorResponse{Success: false, Message: "Failed to encode response"}, http.StatusInternalServerError)
+		return nil, false
+	}
+
+	w.Header().Set("Content-Type", encoder.ContentType())
+	return buf.Bytes(), true
+}
+
+func writeJSON(w http.ResponseWriter, payload interface{}, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(payload)
 }
@@ -0,0 +1,283 @@
+package response
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"iter"
+	"net/http"
+	"time"
+)
+
+// flushEvery is how many items are written between flushes of a streamed response.
+const flushEvery = 100
+
+// streamWriteTimeout replaces the server write timeout for streamed responses,
+// the deadline is pushed back on every flush so a stream only times out when it
+// stops making progress rather than when it is simply long.
+const streamWriteTimeout = 30 * time.Second
+
+// StreamEncoder is implemented by encoders that can write a collection item by
+// item, so the whole collection never has to be held in memory. columns are
+// the keys of every item, for formats with a header.
+type StreamEncoder interface {
+	Encoder
+	NewStream(w io.Writer, columns []string) Stream
+}
+
+// Stream writes the items of a single streamed response.
+// Close receives the error that interrupted the stream, if any, so the format
+// can tell the client the body is incomplete. Formats that cannot say so in
+// the body return the error, and the connection is aborted instead.
+type Stream interface {
+	Item(v interface{}) error
+	Close(message string, err error) error
+}
+
+// WriteStream writes items as they are produced by the iterator, columns are
+// the keys of every item.
+// An error before the first item still gets a proper 500, after that the status
+// is already sent and the error is reported inside the body by the format, or
+// by aborting the connection when the format has no way to.
+// Encoders without streaming support get 406, collecting the items for them
+// would hold the whole collection in memory.
+func WriteStream[T any](w http.ResponseWriter, r *http.Request, items iter.Seq2[T, error], columns []string, message string) {
+	encoder, ok := Negotiate(r)
+	if !ok {
+		writeJSON(w, ErrorResponse{Success: false, Message: "Not acceptable"}, http.StatusNotAcceptable)
+		return
+	}
+
+	streamEncoder, ok := encoder.(StreamEncoder)
+	if !ok {
+		writeJSON(w, ErrorResponse{Success: false, Message: "Format cannot be streamed"}, http.StatusNotAcceptable)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	var stream Stream
+	start := func() {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		w.Header().Add("Vary", "Accept")
+		w.Header().Set("Content-Type", encoder.ContentType())
+		w.WriteHeader(http.StatusOK)
+		stream = streamEncoder.NewStream(w, columns)
+	}
+
+	count := 0
+	for item, err := range items {
+		if err != nil {
+			if stream == nil {
+				WriteError(w, r, "Error iterating items", http.StatusInternalServerError)
+				return
+			}
+			if stream.Close(message, err) != nil {
+				// A chunked body cut short is the only way left to
+				// tell the client it is incomplete.
+				panic(http.ErrAbortHandler)
+			}
+			return
+		}
+
+		if stream == nil {
+			start()
+		}
+
+		if err := stream.Item(item); err != nil {
+			// The client is most likely gone, nothing left to report to.
+			return
+		}
+
+		count++
+		if count%flushEvery == 0 {
+			rc.Flush()
+			rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		}
+	}
+
+	if stream == nil {
+		start()
+	}
+	stream.Close(message, nil)
+}
+
+// NewStream writes the envelope with "data" first so success and message can be
+// decided after the last item.
+func (jsonEncoder) NewStream(w io.Writer, columns []string) Stream {
+	return &jsonStream{w: w}
+}
+
+type jsonStream struct {
+	w       io.Writer
+	started bool
+}
+
+func (s *jsonStream) Item(v interface{}) error {
+	prefix := ","
+	if !s.started {
+		prefix = `{"data":[`
+		s.started = true
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(s.w, prefix); err != nil {
+		return err
+	}
+	_, err = s.w.Write(raw)
+	return err
+}
+
+func (s *jsonStream) Close(message string, err error) error {
+	if !s.started {
+		if _, err := io.WriteString(s.w, `{"data":[`); err != nil {
+			return err
+		}
+	}
+
+	tail := struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}{Success: err == nil, Message: message}
+	if err != nil {
+		tail.Message = "Response interrupted"
+	}
+
+	raw, _ := json.Marshal(tail)
+	// Splice the tail object into the envelope: `],` + `"success":...}`.
+	if _, err := io.WriteString(s.w, "],"); err != nil {
+		return err
+	}
+	_, werr := s.w.Write(append(raw[1:], '\n'))
+	return werr
+}
+
+// ndjsonEncoder writes one JSON document per line. Envelopes with a "data"
+// collection are unwrapped to one line per item.
+type ndjsonEncoder struct{}
+
+func (ndjsonEncoder) ContentType() string {
+	return "application/x-ndjson"
+}
+
+func (e ndjsonEncoder) Encode(w io.Writer, v interface{}) error {
+	tree, err := normalize(v)
+	if err != nil {
+		return err
+	}
+
+	items := []interface{}{tree}
+	if envelope, ok := tree.(object); ok {
+		if data, ok := envelope.get("data"); ok {
+			if collection, ok := data.([]interface{}); ok {
+				items = collection
+			}
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	for _, item := range items {
+		if err := enc.Encode(toNative(item)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ndjsonEncoder) NewStream(w io.Writer, columns []string) Stream {
+	return &ndjsonStream{enc: json.NewEncoder(w)}
+}
+
+type ndjsonStream struct {
+	enc *json.Encoder
+}
+
+func (s *ndjsonStream) Item(v interface{}) error {
+	return s.enc.Encode(v)
+}
+
+// Close only writes a line when the stream was interrupted, a clean end is the
+// end of the body.
+func (s *ndjsonStream) Close(message string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return s.enc.Encode(ErrorResponse{Success: false, Message: "Response interrupted"})
+}
+
+// NewStream uses columns as the CSV header, keys of a record outside of it
+// are dropped and missing ones left empty.
+func (csvEncoder) NewStream(w io.Writer, columns []string) Stream {
+	header := make(map[string]int, len(columns))
+	for i, column := range columns {
+		header[column] = i
+	}
+	return &csvStream{w: csv.NewWriter(w), columns: columns, header: header}
+}
+
+type csvStream struct {
+	w       *csv.Writer
+	columns []string
+	header  map[string]int
+	started bool
+}
+
+// start writes the header row once.
+func (s *csvStream) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+	return s.w.Write(s.columns)
+}
+
+func (s *csvStream) Item(v interface{}) error {
+	tree, err := normalize(v)
+	if err != nil {
+		return err
+	}
+
+	record, ok := tree.(object)
+	if !ok {
+		return ErrUnsupportedPayload
+	}
+
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	row := make([]string, len(s.columns))
+	for _, m := range record {
+		if i, ok := s.header[m.Key]; ok {
+			row[i] = csvCell(m.Value)
+		}
+	}
+
+	if err := s.w.Write(row); err != nil {
+		return err
+	}
+
+	// csv.Writer buffers internally, flush so the periodic http flush sends rows.
+	s.w.Flush()
+	return s.w.Error()
+}
+
+// Close returns err, CSV has no room for an error after the rows, an empty
+// stream is still sent its header.
+func (s *csvStream) Close(message string, err error) error {
+	if err != nil {
+		s.w.Flush()
+		return err
+	}
+
+	if err := s.start(); err != nil {
+		return err
+	}
+	s.w.Flush()
+	return s.w.Error()
+}
@@ -0,0 +1,184 @@
+package response
+
+import (
+	"bytes"
+	"errors"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8"?>` + "\n"
+
+type streamRecord struct {
+	Id    int    `json:"id"`
+	Name  string `json:"name,omitzero"`
+	Email string `json:"email,omitzero"`
+}
+
+func TestCSVStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns []string
+		items   []interface{}
+		want    string
+	}{
+		{
+			name:    "header from the columns, not the first record",
+			columns: []string{"id", "name", "email"},
+			items:   []interface{}{streamRecord{Id: 1}, streamRecord{Id: 2, Name: "Ada", Email: "ada@example.com"}},
+			want:    "id,name,email\n1,,\n2,Ada,ada@example.com\n",
+		},
+		{
+			name:    "keys outside the columns are dropped",
+			columns: []string{"id", "name"},
+			items:   []interface{}{streamRecord{Id: 1, Name: "Ada", Email: "ada@example.com"}},
+			want:    "id,name\n1,Ada\n",
+		},
+		{
+			name:    "empty stream still has a header",
+			columns: []string{"id", "name"},
+			want:    "id,name\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			stream := (csvEncoder{}).NewStream(&buf, tt.columns)
+			for _, item := range tt.items {
+				if err := stream.Item(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := stream.Close("ok", nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVStreamCloseReturnsError(t *testing.T) {
+	var buf bytes.Buffer
+	stream := (csvEncoder{}).NewStream(&buf, []string{"id"})
+	if err := stream.Item(streamRecord{Id: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	interrupted := errors.New("connection reset")
+	if err := stream.Close("ok", interrupted); err != interrupted {
+		t.Fatalf("Close returned %v, want %v", err, interrupted)
+	}
+	if got := buf.String(); got != "id\n1\n" {
+		t.Fatalf("got %q, rows before the error should be flushed", got)
+	}
+}
+
+// failingItems yields n records and then err.
+func failingItems(n int, err error) iter.Seq2[streamRecord, error] {
+	return func(yield func(streamRecord, error) bool) {
+		for i := range n {
+			if !yield(streamRecord{Id: i + 1}, nil) {
+				return
+			}
+		}
+		yield(streamRecord{}, err)
+	}
+}
+
+func TestWriteStreamInterrupted(t *testing.T) {
+	t.Run("csv aborts the connection", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/?format=csv", nil)
+		w := httptest.NewRecorder()
+
+		defer func() {
+			if p := recover(); p != http.ErrAbortHandler {
+				t.Fatalf("recovered %v, want http.ErrAbortHandler", p)
+			}
+			if got := w.Body.String(); got != "id,name\n1,\n" {
+				t.Fatalf("body %q", got)
+			}
+		}()
+		WriteStream(w, r, failingItems(1, errors.New("boom")), []string{"id", "name"}, "ok")
+	})
+
+	t.Run("json reports it in the body", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		w := httptest.NewRecorder()
+
+		WriteStream(w, r, failingItems(1, errors.New("boom")), []string{"id"}, "ok")
+		want := `{"data":[{"id":1}],"success":false,"message":"Response interrupted"}` + "\n"
+		if got := w.Body.String(); got != want {
+			t.Fatalf("body %q, want %q", got, want)
+		}
+	})
+
+	t.Run("error before the first item is a 500", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/?format=csv", nil)
+		w := httptest.NewRecorder()
+
+		WriteStream(w, r, failingItems(0, errors.New("boom")), []string{"id"}, "ok")
+		if w.Code != http.StatusInternalServerError {
+			t.Fatalf("status %d, want 500", w.Code)
+		}
+	})
+}
+
+func TestXMLStream(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []interface{}
+		err   error
+		want  string
+	}{
+		{
+			name:  "items then the status",
+			items: []interface{}{streamRecord{Id: 1, Name: "Ada"}, streamRecord{Id: 2}},
+			want: xmlHeader + `<response><data><item><id>1</id><name>Ada</name></item><item><id>2</id></item></data>` +
+				`<success>true</success><message>ok</message></response>`,
+		},
+		{
+			name: "empty stream",
+			want: xmlHeader + `<response><data></data><success>true</success><message>ok</message></response>`,
+		},
+		{
+			name:  "interrupted",
+			items: []interface{}{streamRecord{Id: 1}},
+			err:   errors.New("boom"),
+			want: xmlHeader + `<response><data><item><id>1</id></item></data>` +
+				`<success>false</success><message>Response interrupted</message></response>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			stream := (xmlEncoder{}).NewStream(&buf, nil)
+			for _, item := range tt.items {
+				if err := stream.Item(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := stream.Close("ok", tt.err); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Fatalf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteStreamWithoutStreamEncoder(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/?format=msgpack", nil)
+	w := httptest.NewRecorder()
+
+	WriteStream(w, r, failingItems(1, nil), []string{"id"}, "ok")
+	if w.Code != http.StatusNotAcceptable {
+		t.Fatalf("status %d, want 406", w.Code)
+	}
+}
@@ -24,6 +24,10 @@ func FormatValidationError(err error) map[string]string {
 				errs[field] = field + " must be a valid email address"
 			case "e164":
 				errs[field] = field + " must be a valid E.164 phone number"
+			case "partial_date":
+				errs[field] = field + " must be a date like 1990-05-12, or --05-12 without the year"
+			case "tag":
+				errs[field] = field + " must be letters, digits, - and _, up to 50 characters"
 			default:
 				errs[field] = "Invalid value for " + field
 			}
@@ -0,0 +1,91 @@
+package response
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// member is a single key of an object, objects keep their keys in order so the
+// non JSON formats render fields in the same order as the JSON output.
+type member struct {
+	Key   string
+	Value interface{}
+}
+
+type object []member
+
+func (o object) get(key string) (interface{}, bool) {
+	for _, m := range o {
+		if m.Key == key {
+			return m.Value, true
+		}
+	}
+	return nil, false
+}
+
+// normalize turns any payload into a tree of nil, bool, json.Number, string,
+// []interface{} and object.
+// Going through encoding/json means json tags, omitempty and custom marshalers
+// are honoured the same way for every format.
+func normalize(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+
+	return decodeValue(dec)
+}
+
+func decodeValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		switch t {
+		case '{':
+			obj := object{}
+			for dec.More() {
+				keyTok, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+
+				value, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+
+				obj = append(obj, member{Key: keyTok.(string), Value: value})
+			}
+			// consume the closing '}'
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return obj, nil
+		case '[':
+			arr := []interface{}{}
+			for dec.More() {
+				value, err := decodeValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, value)
+			}
+			// consume the closing ']'
+			if _, err := dec.Token(); err != nil {
+				return nil, err
+			}
+			return arr, nil
+		}
+		return nil, fmt.Errorf("unexpected delimiter %q", t)
+	default:
+		return t, nil
+	}
+}
@@ -0,0 +1,178 @@
+package response
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// xmlEncoder renders the payload under a <response> root, object keys become
+// elements and array entries become repeated <item> elements.
+type xmlEncoder struct{}
+
+func (xmlEncoder) ContentType() string {
+	return "application/xml"
+}
+
+func (xmlEncoder) Encode(w io.Writer, v interface{}) error {
+	tree, err := normalize(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	if err := encodeXMLElement(enc, "response", tree); err != nil {
+		return err
+	}
+
+	return enc.Flush()
+}
+
+// NewStream writes the envelope with <data> first so success and message can
+// be decided after the last item.
+func (xmlEncoder) NewStream(w io.Writer, columns []string) Stream {
+	return &xmlStream{w: w, enc: xml.NewEncoder(w)}
+}
+
+type xmlStream struct {
+	w       io.Writer
+	enc     *xml.Encoder
+	started bool
+}
+
+var (
+	xmlResponse = xml.StartElement{Name: xml.Name{Local: "response"}}
+	xmlData     = xml.StartElement{Name: xml.Name{Local: "data"}}
+)
+
+// start opens <response> and <data> once.
+func (s *xmlStream) start() error {
+	if s.started {
+		return nil
+	}
+	s.started = true
+
+	if _, err := io.WriteString(s.w, xml.Header); err != nil {
+		return err
+	}
+	if err := s.enc.EncodeToken(xmlResponse); err != nil {
+		return err
+	}
+	return s.enc.EncodeToken(xmlData)
+}
+
+func (s *xmlStream) Item(v interface{}) error {
+	tree, err := normalize(v)
+	if err != nil {
+		return err
+	}
+
+	if err := s.start(); err != nil {
+		return err
+	}
+	if err := encodeXMLElement(s.enc, "item", tree); err != nil {
+		return err
+	}
+	return s.enc.Flush()
+}
+
+func (s *xmlStream) Close(message string, err error) error {
+	if err := s.start(); err != nil {
+		return err
+	}
+
+	if err != nil {
+		message = "Response interrupted"
+	}
+	if err := s.enc.EncodeToken(xmlData.End()); err != nil {
+		return err
+	}
+	if err := encodeXMLElement(s.enc, "success", err == nil); err != nil {
+		return err
+	}
+	if err := encodeXMLElement(s.enc, "message", message); err != nil {
+		return err
+	}
+	if err := s.enc.EncodeToken(xmlResponse.End()); err != nil {
+		return err
+	}
+	return s.enc.Flush()
+}
+
+func encodeXMLElement(enc *xml.Encoder, name string, v interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case nil:
+	case object:
+		for _, m := range value {
+			if err := encodeXMLElement(enc, m.Key, m.Value); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := encodeXMLElement(enc, "item", item); err != nil {
+				return err
+			}
+		}
+	default:
+		if err := enc.EncodeToken(xml.CharData(scalarString(value))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// xmlName makes a JSON key usable as an element name.
+func xmlName(key string) string {
+	var b strings.Builder
+	for i, r := range key {
+		valid := unicode.IsLetter(r) || r == '_' || (i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'))
+		if !valid {
+			if i == 0 && unicode.IsDigit(r) {
+				b.WriteRune('_')
+				b.WriteRune(r)
+				continue
+			}
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+
+	if b.Len() == 0 {
+		return "_"
+	}
+
+	return b.String()
+}
+
+// scalarString formats a normalized scalar the way it appears in JSON, without quotes.
+func scalarString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		if value {
+			return "true"
+		}
+		return "false"
+	default:
+		raw, _ := json.Marshal(value)
+		return string(raw)
+	}
+}
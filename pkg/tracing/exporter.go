@@ -0,0 +1,240 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+// WriterExporter writes one JSON object per span, meant for stdout or a file
+// so traces can be inspected without any collector running.
+type WriterExporter struct {
+	w      io.Writer
+	closer io.Closer
+}
+
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewFileExporter appends spans to the file at path, the file is closed on Shutdown.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WriterExporter{w: f, closer: f}, nil
+}
+
+type spanRecord struct {
+	TraceId      string                 `json:"trace_id"`
+	SpanId       string                 `json:"span_id"`
+	ParentSpanId string                 `json:"parent_span_id,omitempty"`
+	Name         string                 `json:"name"`
+	Kind         SpanKind               `json:"kind"`
+	Start        string                 `json:"start"`
+	DurationMs   float64                `json:"duration_ms"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+}
+
+func (e *WriterExporter) Export(ctx context.Context, spans []*Span) error {
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		record := spanRecord{
+			TraceId:    s.Context.TraceID.String(),
+			SpanId:     s.Context.SpanID.String(),
+			Name:       s.Name,
+			Kind:       s.Kind,
+			Start:      s.StartTime.Format("2006-01-02T15:04:05.000000Z07:00"),
+			DurationMs: float64(s.EndTime.Sub(s.StartTime).Microseconds()) / 1000,
+			Error:      s.Err,
+		}
+
+		if s.ParentSpanID.IsValid() {
+			record.ParentSpanId = s.ParentSpanID.String()
+		}
+
+		if len(s.Attributes) > 0 {
+			record.Attributes = make(map[string]interface{}, len(s.Attributes))
+			for _, a := range s.Attributes {
+				record.Attributes[a.Key] = a.Value
+			}
+		}
+
+		if err := enc.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *WriterExporter) Shutdown(ctx context.Context) error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
+
+// OTLPExporter sends spans to an OpenTelemetry collector with OTLP/HTTP using
+// the JSON encoding, e.g. endpoint http://localhost:4318/v1/traces.
+// See https://opentelemetry.io/docs/specs/otlp/#otlphttp
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+}
+
+func NewOTLPExporter(endpoint string, serviceName string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint:    endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{},
+	}
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              SpanKind        `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	scope := otlpScopeSpans{
+		Scope: otlpScope{Name: "github.com/BramAristyo/rest-api-contact-person/pkg/tracing"},
+	}
+
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceId:           s.Context.TraceID.String(),
+			SpanId:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		}
+
+		if s.ParentSpanID.IsValid() {
+			span.ParentSpanId = s.ParentSpanID.String()
+		}
+
+		for _, a := range s.Attributes {
+			span.Attributes = append(span.Attributes, otlpAttr(a))
+		}
+
+		// STATUS_CODE_ERROR is 2, unset (0) otherwise.
+		if s.Err != "" {
+			span.Status = otlpStatus{Code: 2, Message: s.Err}
+		}
+
+		scope.Spans = append(scope.Spans, span)
+	}
+
+	body, err := json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{otlpAttr(String("service.name", e.serviceName))},
+			},
+			ScopeSpans: []otlpScopeSpans{scope},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+
+	return nil
+}
+
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+func otlpAttr(a Attribute) otlpAttribute {
+	var v otlpValue
+	switch value := a.Value.(type) {
+	case string:
+		v.StringValue = &value
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case bool:
+		v.BoolValue = &value
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+
+	return otlpAttribute{Key: a.Key, Value: v}
+}
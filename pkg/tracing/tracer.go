@@ -0,0 +1,117 @@
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize     = 2048
+	batchSize     = 512
+	flushInterval = 2 * time.Second
+)
+
+// Exporter ships finished spans somewhere, it is only called from the tracer's
+// own goroutine so it does not need to be safe for concurrent use.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+// Tracer batches finished spans and exports them in the background, so
+// requests never wait on the exporter.
+type Tracer struct {
+	exporter Exporter
+	queue    chan *Span
+	done     chan struct{}
+
+	// mu guards closing queue against spans still being ended.
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		queue:    make(chan *Span, queueSize),
+		done:     make(chan struct{}),
+	}
+
+	go t.run()
+	return t
+}
+
+// enqueue drops the span when the queue is full rather than blocking the request.
+func (t *Tracer) enqueue(span *Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return
+	}
+
+	select {
+	case t.queue <- span:
+	default:
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), flushInterval)
+		defer cancel()
+
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			slog.Error("tracing: export spans", "spans", len(batch), "error", err)
+		}
+		batch = make([]*Span, 0, batchSize)
+	}
+
+	for {
+		select {
+		case span, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+
+			batch = append(batch, span)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// Shutdown exports the spans still queued and shuts the exporter down.
+// Spans ended after Shutdown are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return t.exporter.Shutdown(ctx)
+}
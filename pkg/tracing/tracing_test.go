@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+type recordingExporter struct {
+	spans []*Span
+}
+
+func (e *recordingExporter) Export(ctx context.Context, spans []*Span) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// installTracer sets a tracer for the test, the returned function shuts it
+// down and returns the exported spans.
+func installTracer(t *testing.T) func() []*Span {
+	exporter := &recordingExporter{}
+	tracer := NewTracer(exporter)
+	SetTracer(tracer)
+	t.Cleanup(func() { SetTracer(nil) })
+
+	return func() []*Span {
+		if err := tracer.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return exporter.spans
+	}
+}
+
+func TestStartInheritsSampled(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	tests := []struct {
+		name        string
+		traceparent string
+		sampled     bool
+		flags       string
+	}{
+		{"no parent", "", true, "01"},
+		{"sampled parent", "00-" + traceID + "-00f067aa0ba902b7-01", true, "01"},
+		{"unsampled parent", "00-" + traceID + "-00f067aa0ba902b7-00", false, "00"},
+		{"other flags set", "00-" + traceID + "-00f067aa0ba902b7-02", false, "00"},
+		{"malformed parent", "00-" + traceID + "-00f067aa0ba902b7", true, "01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installTracer(t)
+
+			header := http.Header{}
+			if tt.traceparent != "" {
+				header.Set(TraceparentHeader, tt.traceparent)
+			}
+
+			ctx := context.Background()
+			if parent, ok := Extract(header); ok {
+				ctx = ContextWithRemoteParent(ctx, parent)
+			}
+			ctx, server := StartWithKind(ctx, KindServer, "server")
+			_, child := Start(ctx, "child")
+
+			for _, span := range []*Span{server, child} {
+				if span.Context.Sampled != tt.sampled {
+					t.Fatalf("%s sampled %v, want %v", span.Name, span.Context.Sampled, tt.sampled)
+				}
+			}
+			if child.Context.TraceID != server.Context.TraceID || child.ParentSpanID != server.Context.SpanID {
+				t.Fatalf("child is not in the trace of its parent")
+			}
+
+			out := http.Header{}
+			Inject(out, child.SpanContext())
+			if got, want := out.Get(TraceparentHeader)[53:], tt.flags; got != want {
+				t.Fatalf("injected flags %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestUnsampledSpansAreNotExported(t *testing.T) {
+	exported := installTracer(t)
+
+	sampled := SpanContext{TraceID: TraceID{1}, SpanID: SpanID{1}, Sampled: true}
+	unsampled := SpanContext{TraceID: TraceID{2}, SpanID: SpanID{2}}
+
+	_, kept := Start(ContextWithRemoteParent(context.Background(), sampled), "kept")
+	_, dropped := Start(ContextWithRemoteParent(context.Background(), unsampled), "dropped")
+	kept.End()
+	dropped.End()
+
+	spans := exported()
+	if len(spans) != 1 || spans[0].Name != "kept" {
+		names := make([]string, len(spans))
+		for i, span := range spans {
+			names[i] = span.Name
+		}
+		t.Fatalf("exported %v, want [kept]", names)
+	}
+}